@@ -0,0 +1,215 @@
+// Command native-client is a minimal native app that signs in through ProtocolSoup the way
+// RFC 8252 recommends: it opens the system browser, receives the authorization response on
+// an ephemeral loopback port and redeems the code with its PKCE verifier.
+//
+//	go run ./cmd/native-client -issuer http://localhost:8080
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// callbackPath is the path of the client's registered loopback redirect URI
+const callbackPath = "/callback"
+
+// authorizationResponse is what the loopback listener received from the browser
+type authorizationResponse struct {
+	code string
+	err  error
+}
+
+func main() {
+	issuer := flag.String("issuer", "http://localhost:8080", "ProtocolSoup base URL")
+	protocol := flag.String("protocol", "oidc", "protocol endpoints to use: oidc or oauth2")
+	clientID := flag.String("client", "native-app", "client_id of the native app")
+	scope := flag.String("scope", "openid profile email", "requested scope")
+	openBrowser := flag.Bool("open", true, "open the authorization URL in the system browser")
+	timeout := flag.Duration("timeout", 5*time.Minute, "how long to wait for the user to sign in")
+	flag.Parse()
+
+	if *protocol != "oidc" && *protocol != "oauth2" {
+		log.Fatalf("Unsupported protocol %q: use oidc or oauth2", *protocol)
+	}
+	base := strings.TrimRight(*issuer, "/") + "/" + *protocol
+
+	verifier := randomString(32)
+	state := randomString(16)
+	nonce := randomString(16)
+	challenge := sha256.Sum256([]byte(verifier))
+
+	// Listen on the loopback IP literal, never "localhost", which may resolve elsewhere (RFC 8252 Section 8.3)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Failed to start loopback listener: %v", err)
+	}
+	redirectURI := fmt.Sprintf("http://%s%s", listener.Addr().String(), callbackPath)
+
+	responses := make(chan authorizationResponse, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		response := parseCallback(r.URL.Query(), state)
+		w.Header().Set("Content-Type", "text/html")
+		if response.err != nil {
+			fmt.Fprintf(w, "<h1>Sign-in failed</h1><p>%s</p>", html.EscapeString(response.err.Error()))
+		} else {
+			fmt.Fprint(w, "<h1>Signed in</h1><p>You can close this window and return to the terminal.</p>")
+		}
+		select {
+		case responses <- response:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {*clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {*scope},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if *protocol == "oidc" {
+		params.Set("nonce", nonce)
+	}
+	authorizationURL := base + "/authorize?" + params.Encode()
+
+	log.Printf("Listening for the authorization response on %s", redirectURI)
+	fmt.Printf("\nOpen this URL to sign in:\n\n  %s\n\n", authorizationURL)
+	if *openBrowser {
+		if err := launchBrowser(authorizationURL); err != nil {
+			log.Printf("Could not open the browser (%v); open the URL manually", err)
+		}
+	}
+
+	var response authorizationResponse
+	select {
+	case response = <-responses:
+	case <-time.After(*timeout):
+		log.Fatalf("Timed out after %s waiting for the authorization response", *timeout)
+	}
+	if response.err != nil {
+		log.Fatalf("Authorization failed: %v", response.err)
+	}
+	log.Println("Authorization code received; exchanging it with the PKCE verifier")
+
+	tokens, err := exchangeCode(base+"/token", *clientID, response.code, redirectURI, verifier)
+	if err != nil {
+		log.Fatalf("Token exchange failed: %v", err)
+	}
+	pretty, _ := json.MarshalIndent(tokens, "", "  ")
+	fmt.Printf("\nToken response:\n%s\n", pretty)
+
+	if idToken, ok := tokens["id_token"].(string); ok {
+		claims, err := decodeClaims(idToken)
+		if err != nil {
+			log.Fatalf("Failed to decode ID token: %v", err)
+		}
+		if claims["nonce"] != nonce {
+			log.Fatalf("ID token nonce does not match the request")
+		}
+		pretty, _ := json.MarshalIndent(claims, "", "  ")
+		fmt.Printf("\nID token claims:\n%s\n", pretty)
+	}
+}
+
+// parseCallback extracts the code from the redirect, checking state to reject injected responses
+func parseCallback(query url.Values, state string) authorizationResponse {
+	if errorCode := query.Get("error"); errorCode != "" {
+		return authorizationResponse{err: fmt.Errorf("%s: %s", errorCode, query.Get("error_description"))}
+	}
+	if query.Get("state") != state {
+		return authorizationResponse{err: errors.New("state does not match the request")}
+	}
+	code := query.Get("code")
+	if code == "" {
+		return authorizationResponse{err: errors.New("no authorization code in the response")}
+	}
+	return authorizationResponse{code: code}
+}
+
+// exchangeCode redeems the authorization code as a public client, proving possession of the verifier
+func exchangeCode(tokenEndpoint, clientID, code, redirectURI, verifier string) (map[string]interface{}, error) {
+	resp, err := http.PostForm(tokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var tokens map[string]interface{}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("unexpected response (status %d): %s", resp.StatusCode, body)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", tokens["error"], tokens["error_description"])
+	}
+	return tokens, nil
+}
+
+// decodeClaims decodes the payload of a JWT; the client received it directly from the token endpoint over TLS
+func decodeClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("not a signed JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// launchBrowser opens the URL in the system browser, as native apps must not use embedded web views (RFC 8252 Section 8.12)
+func launchBrowser(target string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", target).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", target).Start()
+	default:
+		return exec.Command("xdg-open", target).Start()
+	}
+}
+
+// randomString returns n random bytes, base64url encoded
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("Failed to generate random value: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"log"
 	"net/http"
 	"os"
@@ -19,22 +21,44 @@ import (
 	"github.com/ParleSec/ProtocolSoup/internal/protocols/saml"
 	"github.com/ParleSec/ProtocolSoup/internal/protocols/scim"
 	"github.com/ParleSec/ProtocolSoup/internal/protocols/spiffe"
+	spiffelib "github.com/ParleSec/ProtocolSoup/internal/spiffe"
 )
 
 func main() {
 	// Load configuration
 	cfg := core.LoadConfig()
 
-	// Initialize cryptographic key set
-	keySet, err := crypto.NewKeySet()
+	// Open the MockIdP store, which also keeps the cryptographic keys
+	store, err := mockidp.OpenStore(cfg.MockIdPStore, cfg.MockIdPDataDir)
+	if err != nil {
+		log.Fatalf("Failed to open MockIdP store: %v", err)
+	}
+	defer store.Close()
+
+	// Load the cryptographic key set, generating it on first start
+	keySet, err := mockidp.LoadKeySet(store)
 	if err != nil {
 		log.Fatalf("Failed to initialize key set: %v", err)
 	}
 	log.Println("Cryptographic keys initialized")
 
 	// Initialize mock identity provider
-	idp := mockidp.NewMockIdP(keySet)
-	log.Println("Mock Identity Provider initialized")
+	idp, err := mockidp.NewMockIdP(keySet, store)
+	if err != nil {
+		log.Fatalf("Failed to initialize MockIdP: %v", err)
+	}
+	if err := idp.SetPasswordHashAlgorithm(cfg.MockIdPPasswordHash); err != nil {
+		log.Fatalf("Failed to configure MockIdP password hashing: %v", err)
+	}
+	// Development relying parties run on localhost, so only then may client-hosted documents
+	// such as a jwks_uri be fetched from loopback and private addresses
+	idp.SetPrivateNetworkFetches(cfg.IsDevelopment())
+	if cfg.MockIdPPairwiseSalt != "" {
+		idp.SetPairwiseSalt(cfg.MockIdPPairwiseSalt)
+	}
+	stopSweeper := idp.StartExpirySweeper(time.Minute)
+	defer stopSweeper()
+	log.Printf("Mock Identity Provider initialized (%s store)", cfg.MockIdPStore)
 
 	// Initialize looking glass engine
 	lgEngine := lookingglass.NewEngine()
@@ -88,6 +112,15 @@ func main() {
 	}
 	log.Printf("Initialized %d protocol plugins", len(registry.List()))
 
+	// Token exchange trusts SAML assertions signed by the SAML identity provider
+	oauth2Plugin.SetSAMLAssertionVerifier(samlPlugin)
+
+	// Verify JWT-SVID subject tokens in token exchange when SPIRE is available
+	if spiffePlugin.IsEnabled() {
+		oauth2Plugin.SetJWTSVIDValidator(spiffePlugin.WorkloadClient())
+		log.Println("Token exchange JWT-SVID validation enabled")
+	}
+
 	// Create and configure server
 	server := core.NewServer(cfg, registry, lgEngine, keySet)
 	httpServer := &http.Server{
@@ -98,6 +131,62 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Serve mutual TLS client authentication and certificate-bound tokens (RFC 8705) on a separate listener
+	var mtlsShutdown func(context.Context) error
+	if cfg.MTLSListenAddr != "" {
+		testCA, err := crypto.NewTestCA("ProtocolSoup Test CA")
+		if err != nil {
+			log.Fatalf("Failed to create mTLS test CA: %v", err)
+		}
+		oauth2Plugin.EnableMTLS(cfg.MTLSBaseURL, testCA)
+
+		if spiffePlugin.IsEnabled() {
+			// X509-SVIDs authenticate clients registered with their SPIFFE ID as tls_client_auth_san_uri.
+			// The handshake verifies client certificates against the bundle and the test CA.
+			workloadClient := spiffePlugin.WorkloadClient()
+			oauth2Plugin.TrustClientCertificates(workloadClient)
+			mtlsServer, err := spiffelib.NewMTLSServer(workloadClient, server.Router(), cfg.MTLSListenAddr, &spiffelib.MTLSConfig{
+				RequireClientCert: false,
+				TrustDomain:       workloadClient.TrustDomain(),
+				ClientCAs:         []*x509.Certificate{testCA.Certificate()},
+			})
+			if err != nil {
+				log.Fatalf("Failed to create mTLS server: %v", err)
+			}
+			go func() {
+				if err := mtlsServer.ListenAndServeTLS(ctx); err != nil && err != http.ErrServerClosed {
+					log.Printf("mTLS server failed: %v", err)
+				}
+			}()
+			mtlsShutdown = mtlsServer.Shutdown
+		} else {
+			// Without SPIRE the test CA issues the server certificate as well as client certificates
+			serverCert, err := testCA.IssueServerCertificate("localhost", "127.0.0.1")
+			if err != nil {
+				log.Fatalf("Failed to issue mTLS server certificate: %v", err)
+			}
+			mtlsServer := &http.Server{
+				Addr:    cfg.MTLSListenAddr,
+				Handler: server.Router(),
+				TLSConfig: &tls.Config{
+					Certificates: []tls.Certificate{serverCert},
+					ClientAuth:   tls.RequestClientCert,
+					MinVersion:   tls.VersionTLS12,
+				},
+				ReadTimeout:  15 * time.Second,
+				WriteTimeout: 15 * time.Second,
+				IdleTimeout:  60 * time.Second,
+			}
+			go func() {
+				log.Printf("mTLS server listening on %s (test CA)", cfg.MTLSListenAddr)
+				if err := mtlsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+					log.Printf("mTLS server failed: %v", err)
+				}
+			}()
+			mtlsShutdown = mtlsServer.Shutdown
+		}
+	}
+
 	// Start server in goroutine
 	go func() {
 		log.Printf("Server starting on %s", cfg.ListenAddr)
@@ -123,6 +212,12 @@ func main() {
 		log.Printf("Plugin shutdown error: %v", err)
 	}
 
+	if mtlsShutdown != nil {
+		if err := mtlsShutdown(shutdownCtx); err != nil {
+			log.Printf("mTLS server shutdown error: %v", err)
+		}
+	}
+
 	// Shutdown HTTP server
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
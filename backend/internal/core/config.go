@@ -19,6 +19,19 @@ type Config struct {
 	// Enable mock identity provider
 	MockIdPEnabled bool
 
+	// Mock identity provider store: memory, or sqlite to persist state across restarts and processes
+	MockIdPStore string
+
+	// Directory holding the mock identity provider's SQLite database
+	MockIdPDataDir string
+
+	// Algorithm hashing mock identity provider passwords: argon2id, bcrypt or pbkdf2-sha256
+	MockIdPPasswordHash string
+
+	// Secret salt of pairwise subject identifiers; when empty, a random salt is generated on
+	// first start and kept in the MockIdP store
+	MockIdPPairwiseSalt string
+
 	// CORS allowed origins
 	CORSOrigins []string
 
@@ -27,18 +40,30 @@ type Config struct {
 
 	// Static files directory (for serving frontend in combined deployment)
 	StaticDir string
+
+	// Mutual TLS listening address for RFC 8705 client authentication; empty disables it
+	MTLSListenAddr string
+
+	// Base URL of the mutual TLS listener, advertised as mtls_endpoint_aliases
+	MTLSBaseURL string
 }
 
 // LoadConfig loads configuration from environment variables with sensible defaults
 func LoadConfig() *Config {
 	cfg := &Config{
-		Environment:    getEnv("SHOWCASE_ENV", "development"),
-		ListenAddr:     getEnv("SHOWCASE_LISTEN_ADDR", ":8080"),
-		BaseURL:        getEnv("SHOWCASE_BASE_URL", "http://localhost:8080"),
-		MockIdPEnabled: getEnvBool("SHOWCASE_MOCK_IDP", true),
-		CORSOrigins:    getEnvList("SHOWCASE_CORS_ORIGINS", []string{"http://localhost:3000", "http://localhost:5173"}),
-		Debug:          getEnvBool("SHOWCASE_DEBUG", false),
-		StaticDir:      getEnv("SHOWCASE_STATIC_DIR", ""),
+		Environment:         getEnv("SHOWCASE_ENV", "development"),
+		ListenAddr:          getEnv("SHOWCASE_LISTEN_ADDR", ":8080"),
+		BaseURL:             getEnv("SHOWCASE_BASE_URL", "http://localhost:8080"),
+		MockIdPEnabled:      getEnvBool("SHOWCASE_MOCK_IDP", true),
+		MockIdPStore:        getEnv("SHOWCASE_MOCKIDP_STORE", "memory"),
+		MockIdPDataDir:      getEnv("SHOWCASE_MOCKIDP_DATA_DIR", "./data"),
+		MockIdPPasswordHash: getEnv("SHOWCASE_MOCKIDP_PASSWORD_HASH", "argon2id"),
+		MockIdPPairwiseSalt: getEnv("SHOWCASE_MOCKIDP_PAIRWISE_SALT", ""),
+		CORSOrigins:         getEnvList("SHOWCASE_CORS_ORIGINS", []string{"http://localhost:3000", "http://localhost:5173"}),
+		Debug:               getEnvBool("SHOWCASE_DEBUG", false),
+		StaticDir:           getEnv("SHOWCASE_STATIC_DIR", ""),
+		MTLSListenAddr:      getEnv("SHOWCASE_MTLS_LISTEN_ADDR", ""),
+		MTLSBaseURL:         getEnv("SHOWCASE_MTLS_BASE_URL", "https://localhost:8443"),
 	}
 
 	return cfg
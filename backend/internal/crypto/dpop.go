@@ -0,0 +1,100 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPoPProofType is the required typ header of a DPoP proof JWT (RFC 9449 Section 4.2)
+const DPoPProofType = "dpop+jwt"
+
+// DPoPSigningAlgorithms lists the asymmetric algorithms accepted for DPoP proofs
+var DPoPSigningAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// DPoPProof is a DPoP proof JWT whose signature has been verified with its embedded key
+type DPoPProof struct {
+	Raw        string
+	Algorithm  string
+	JWK        JWK
+	Thumbprint string // RFC 7638 thumbprint of JWK, used as cnf.jkt
+	JTI        string
+	HTM        string
+	HTU        string
+	IssuedAt   time.Time
+	Nonce      string
+	ATH        string
+	Header     map[string]interface{}
+	Claims     map[string]interface{}
+}
+
+// ParseDPoPProof parses a DPoP proof, checks its header and verifies its signature against the
+// public key in the jwk header. Request binding (htm, htu, ath), freshness, nonce and replay
+// checks are the caller's responsibility.
+func ParseDPoPProof(proof string) (*DPoPProof, error) {
+	var key JWK
+	token, err := jwt.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != DPoPProofType {
+			return nil, fmt.Errorf("typ header must be %s", DPoPProofType)
+		}
+
+		rawJWK, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+		if _, hasPrivate := rawJWK["d"]; hasPrivate {
+			return nil, errors.New("jwk header must not contain a private key")
+		}
+
+		data, err := json.Marshal(rawJWK)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk header: %w", err)
+		}
+		if err := json.Unmarshal(data, &key); err != nil {
+			return nil, fmt.Errorf("invalid jwk header: %w", err)
+		}
+		return key.ToPublicKey()
+	}, jwt.WithValidMethods(DPoPSigningAlgorithms))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DPoP proof: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid DPoP proof claims")
+	}
+
+	parsed := &DPoPProof{
+		Raw:        proof,
+		Algorithm:  token.Method.Alg(),
+		JWK:        key,
+		Thumbprint: key.Thumbprint(),
+		Header:     token.Header,
+		Claims:     claims,
+	}
+	parsed.JTI, _ = claims["jti"].(string)
+	parsed.HTM, _ = claims["htm"].(string)
+	parsed.HTU, _ = claims["htu"].(string)
+	parsed.Nonce, _ = claims["nonce"].(string)
+	parsed.ATH, _ = claims["ath"].(string)
+	if iat, ok := claims["iat"].(float64); ok {
+		parsed.IssuedAt = time.Unix(int64(iat), 0)
+	}
+
+	if parsed.JTI == "" || parsed.HTM == "" || parsed.HTU == "" || parsed.IssuedAt.IsZero() {
+		return nil, errors.New("DPoP proof must contain jti, htm, htu and iat claims")
+	}
+
+	return parsed, nil
+}
+
+// DPoPAccessTokenHash computes the ath claim value for an access token (RFC 9449 Section 4.2)
+func DPoPAccessTokenHash(accessToken string) string {
+	hash := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,146 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	jose "github.com/go-jose/go-jose/v4"
+)
+
+// JWE key management algorithms (RFC 7518 Section 4.3, 4.6)
+const (
+	KeyAlgRSAOAEP      = "RSA-OAEP"
+	KeyAlgRSAOAEP256   = "RSA-OAEP-256"
+	KeyAlgECDHESA256KW = "ECDH-ES+A256KW"
+)
+
+// JWE content encryption algorithms (RFC 7518 Section 5.2, 5.3)
+const (
+	EncA128GCM      = "A128GCM"
+	EncA256GCM      = "A256GCM"
+	EncA128CBCHS256 = "A128CBC-HS256"
+)
+
+// JWEKeyAlgorithms and JWEContentEncryptionAlgorithms list the supported JWE algorithms
+var (
+	JWEKeyAlgorithms               = []string{KeyAlgRSAOAEP256, KeyAlgRSAOAEP, KeyAlgECDHESA256KW}
+	JWEContentEncryptionAlgorithms = []string{EncA128GCM, EncA256GCM, EncA128CBCHS256}
+)
+
+// IsJWE reports whether a compact serialization is a JWE (five parts) rather than a JWS (three)
+func IsJWE(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// JWEKeyType returns the JWK key type a key management algorithm encrypts to
+func JWEKeyType(alg string) string {
+	if alg == KeyAlgECDHESA256KW {
+		return "EC"
+	}
+	return "RSA"
+}
+
+// EncryptJWE encrypts plaintext to a public key as a compact JWE (RFC 7516 Section 7.1). key is
+// an *rsa.PublicKey for the RSA-OAEP algorithms or an *ecdsa.PublicKey for ECDH-ES+A256KW.
+// cty is set to "JWT" for nested tokens so the recipient knows to verify the inner JWS.
+func EncryptJWE(plaintext []byte, key interface{}, kid, alg, enc, cty string) (string, error) {
+	if !slices.Contains(JWEKeyAlgorithms, alg) {
+		return "", fmt.Errorf("unsupported JWE alg: %s", alg)
+	}
+	if !slices.Contains(JWEContentEncryptionAlgorithms, enc) {
+		return "", fmt.Errorf("unsupported JWE enc: %s", enc)
+	}
+
+	opts := &jose.EncrypterOptions{}
+	if cty != "" {
+		opts.WithContentType(jose.ContentType(cty))
+	}
+	encrypter, err := jose.NewEncrypter(jose.ContentEncryption(enc), jose.Recipient{
+		Algorithm: jose.KeyAlgorithm(alg),
+		Key:       key,
+		KeyID:     kid,
+	}, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s encrypter: %w", alg, err)
+	}
+	object, err := encrypter.Encrypt(plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt JWE: %w", err)
+	}
+	return object.CompactSerialize()
+}
+
+// DecryptJWE decrypts a compact JWE with an *rsa.PrivateKey or *ecdsa.PrivateKey and returns the
+// plaintext and the protected header. Only the supported algorithms are accepted.
+func DecryptJWE(token string, key interface{}) ([]byte, map[string]interface{}, error) {
+	header, err := DecodeJWEHeader(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	object, err := jose.ParseEncryptedCompact(token, joseKeyAlgorithms(), joseContentEncryptionAlgorithms())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid JWE: %w", err)
+	}
+	plaintext, err := object.Decrypt(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt JWE: %w", err)
+	}
+	return plaintext, header, nil
+}
+
+// DecryptJWE decrypts a JWE encrypted to one of the key set's encryption keys, chosen by the alg
+// of its header. A JWE whose kid names another key was not encrypted to this server.
+func (ks *KeySet) DecryptJWE(token string) ([]byte, map[string]interface{}, error) {
+	header, err := DecodeJWEHeader(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	alg, _ := header["alg"].(string)
+	kid, _ := header["kid"].(string)
+
+	var key interface{} = ks.EncryptionPrivateKey()
+	keyID := ks.EncryptionKeyID()
+	if JWEKeyType(alg) == "EC" {
+		key = ks.ECEncryptionPrivateKey()
+		keyID = ks.ECEncryptionKeyID()
+	}
+	if kid != "" && kid != keyID {
+		return nil, nil, fmt.Errorf("JWE is encrypted to key %s, which is not an encryption key of this server", kid)
+	}
+	return DecryptJWE(token, key)
+}
+
+// DecodeJWEHeader decodes the protected header of a compact JWE without decrypting it
+func DecodeJWEHeader(token string) (map[string]interface{}, error) {
+	protected, _, _ := strings.Cut(token, ".")
+	headerJSON, err := base64.RawURLEncoding.DecodeString(protected)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JWE header: %w", err)
+	}
+	var header map[string]interface{}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse JWE header: %w", err)
+	}
+	return header, nil
+}
+
+// joseKeyAlgorithms returns JWEKeyAlgorithms as go-jose key algorithms
+func joseKeyAlgorithms() []jose.KeyAlgorithm {
+	algs := make([]jose.KeyAlgorithm, len(JWEKeyAlgorithms))
+	for i, alg := range JWEKeyAlgorithms {
+		algs[i] = jose.KeyAlgorithm(alg)
+	}
+	return algs
+}
+
+// joseContentEncryptionAlgorithms returns JWEContentEncryptionAlgorithms as go-jose content encryptions
+func joseContentEncryptionAlgorithms() []jose.ContentEncryption {
+	encs := make([]jose.ContentEncryption, len(JWEContentEncryptionAlgorithms))
+	for i, enc := range JWEContentEncryptionAlgorithms {
+		encs[i] = jose.ContentEncryption(enc)
+	}
+	return encs
+}
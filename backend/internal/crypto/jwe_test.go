@@ -0,0 +1,203 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	jose "github.com/go-jose/go-jose/v4"
+)
+
+type jweTestKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newJWETestKeys(t *testing.T) jweTestKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jweTestKeys{rsa: rsaKey, ec: ecKey}
+}
+
+// keys returns the public and private key an algorithm encrypts and decrypts with
+func (k jweTestKeys) keys(alg string) (interface{}, interface{}) {
+	if JWEKeyType(alg) == "EC" {
+		return &k.ec.PublicKey, k.ec
+	}
+	return &k.rsa.PublicKey, k.rsa
+}
+
+// replacePart returns token with one of its five parts re-encoded after change
+func replacePart(t *testing.T, token string, index int, change func([]byte) []byte) string {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	decoded, err := base64.RawURLEncoding.DecodeString(parts[index])
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts[index] = base64.RawURLEncoding.EncodeToString(change(decoded))
+	return strings.Join(parts, ".")
+}
+
+func flipLastBit(b []byte) []byte {
+	out := append([]byte(nil), b...)
+	out[len(out)-1] ^= 1
+	return out
+}
+
+func TestJWERoundTrip(t *testing.T) {
+	keys := newJWETestKeys(t)
+	plaintext := []byte(`{"sub":"alice"}`)
+	for _, alg := range JWEKeyAlgorithms {
+		for _, enc := range JWEContentEncryptionAlgorithms {
+			pub, priv := keys.keys(alg)
+			token, err := EncryptJWE(plaintext, pub, "kid-1", alg, enc, "JWT")
+			if err != nil {
+				t.Fatalf("%s/%s: EncryptJWE: %v", alg, enc, err)
+			}
+			got, header, err := DecryptJWE(token, priv)
+			if err != nil {
+				t.Fatalf("%s/%s: DecryptJWE: %v", alg, enc, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("%s/%s: plaintext = %q", alg, enc, got)
+			}
+			if header["alg"] != alg || header["enc"] != enc || header["kid"] != "kid-1" || header["cty"] != "JWT" {
+				t.Errorf("%s/%s: header = %v", alg, enc, header)
+			}
+		}
+	}
+}
+
+func TestJWEInteroperatesWithGoJose(t *testing.T) {
+	keys := newJWETestKeys(t)
+	plaintext := []byte("interop")
+	keyAlgorithms := []jose.KeyAlgorithm{jose.RSA_OAEP, jose.RSA_OAEP_256, jose.ECDH_ES_A256KW}
+	contentEncryption := []jose.ContentEncryption{jose.A128GCM, jose.A256GCM, jose.A128CBC_HS256}
+
+	for _, alg := range JWEKeyAlgorithms {
+		for _, enc := range JWEContentEncryptionAlgorithms {
+			pub, priv := keys.keys(alg)
+
+			ours, err := EncryptJWE(plaintext, pub, "", alg, enc, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := jose.ParseEncrypted(ours, keyAlgorithms, contentEncryption)
+			if err != nil {
+				t.Fatalf("%s/%s: go-jose cannot parse our JWE: %v", alg, enc, err)
+			}
+			if got, err := parsed.Decrypt(priv); err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("%s/%s: go-jose decrypted %q, %v", alg, enc, got, err)
+			}
+
+			encrypter, err := jose.NewEncrypter(jose.ContentEncryption(enc), jose.Recipient{Algorithm: jose.KeyAlgorithm(alg), Key: pub}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			object, err := encrypter.Encrypt(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			theirs, err := object.CompactSerialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _, err := DecryptJWE(theirs, priv); err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("%s/%s: decrypted go-jose JWE to %q, %v", alg, enc, got, err)
+			}
+		}
+	}
+}
+
+func TestJWERejectsWrongKey(t *testing.T) {
+	keys, other := newJWETestKeys(t), newJWETestKeys(t)
+	for _, alg := range JWEKeyAlgorithms {
+		pub, _ := keys.keys(alg)
+		_, wrong := other.keys(alg)
+		token, err := EncryptJWE([]byte("secret"), pub, "", alg, EncA256GCM, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := DecryptJWE(token, wrong); err == nil {
+			t.Errorf("%s: decrypted with the wrong key", alg)
+		}
+	}
+
+	// A key of the wrong type is refused rather than misused
+	token, err := EncryptJWE([]byte("secret"), &keys.rsa.PublicKey, "", KeyAlgRSAOAEP256, EncA128GCM, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DecryptJWE(token, keys.ec); err == nil {
+		t.Error("RSA-OAEP-256 JWE decrypted with an EC key")
+	}
+}
+
+func TestJWERejectsTampering(t *testing.T) {
+	keys := newJWETestKeys(t)
+	for _, enc := range JWEContentEncryptionAlgorithms {
+		token, err := EncryptJWE([]byte("secret"), &keys.rsa.PublicKey, "", KeyAlgRSAOAEP256, enc, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tampered := map[string]string{
+			"tag":        replacePart(t, token, 4, flipLastBit),
+			"ciphertext": replacePart(t, token, 3, flipLastBit),
+			"iv":         replacePart(t, token, 2, flipLastBit),
+			// The protected header is the additional authenticated data
+			"header": replacePart(t, token, 0, func(b []byte) []byte {
+				return bytes.Replace(b, []byte(`{`), []byte(`{"kid":"x",`), 1)
+			}),
+		}
+		for part, token := range tampered {
+			if _, _, err := DecryptJWE(token, keys.rsa); err == nil {
+				t.Errorf("%s: decrypted with a tampered %s", enc, part)
+			}
+		}
+	}
+}
+
+func TestJWERejectsUnsupportedAlgorithms(t *testing.T) {
+	keys := newJWETestKeys(t)
+	if _, err := EncryptJWE([]byte("x"), &keys.rsa.PublicKey, "", "RSA1_5", EncA128GCM, ""); err == nil {
+		t.Error("encrypted with RSA1_5")
+	}
+	if _, err := EncryptJWE([]byte("x"), &keys.rsa.PublicKey, "", KeyAlgRSAOAEP256, "A192GCM", ""); err == nil {
+		t.Error("encrypted with A192GCM")
+	}
+
+	token, err := EncryptJWE([]byte("x"), &keys.rsa.PublicKey, "", KeyAlgRSAOAEP256, EncA128GCM, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{
+		"alg dir":     `{"alg":"dir","enc":"A128GCM"}`,
+		"alg none":    `{"alg":"none","enc":"A128GCM"}`,
+		"enc A192GCM": `{"alg":"RSA-OAEP-256","enc":"A192GCM"}`,
+		"no enc":      `{"alg":"RSA-OAEP-256"}`,
+	}
+	for name, header := range headers {
+		forged := replacePart(t, token, 0, func([]byte) []byte { return []byte(header) })
+		if _, _, err := DecryptJWE(forged, keys.rsa); err == nil {
+			t.Errorf("%s: decrypted", name)
+		}
+	}
+
+	if _, _, err := DecryptJWE("a.b.c", keys.rsa); err == nil {
+		t.Error("decrypted a three-part token")
+	}
+}
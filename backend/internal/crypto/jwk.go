@@ -30,12 +30,17 @@ type cachedJWKS struct {
 
 // NewJWKSFetcher creates a new JWKS fetcher with caching
 func NewJWKSFetcher(cacheTTL time.Duration) *JWKSFetcher {
+	return NewJWKSFetcherWithClient(cacheTTL, &http.Client{
+		Timeout: 10 * time.Second,
+	})
+}
+
+// NewJWKSFetcherWithClient creates a JWKS fetcher that fetches with httpClient
+func NewJWKSFetcherWithClient(cacheTTL time.Duration, httpClient *http.Client) *JWKSFetcher {
 	return &JWKSFetcher{
-		cache: make(map[string]*cachedJWKS),
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		cacheTTL: cacheTTL,
+		cache:      make(map[string]*cachedJWKS),
+		httpClient: httpClient,
+		cacheTTL:   cacheTTL,
 	}
 }
 
@@ -36,27 +36,121 @@ type StandardClaims struct {
 	Custom map[string]interface{} `json:"-"`
 }
 
-// CreateAccessToken creates a new access token
-func (s *JWTService) CreateAccessToken(subject string, audience string, scope string, duration time.Duration, customClaims map[string]interface{}) (string, error) {
+// AccessTokenType is the JWT typ header of access tokens (RFC 9068 Section 2.1)
+const AccessTokenType = "at+jwt"
+
+// IDTokenType is the JWT typ header of ID tokens. Every other JWT this server signs with the same
+// keys has a typ of its own, so only ID tokens carry this one (RFC 8725 Section 3.11).
+const IDTokenType = "JWT"
+
+// RefreshTokenType is the JWT typ header of refresh tokens
+const RefreshTokenType = "refresh+jwt"
+
+// AuthorizationResponseType is the JWT typ header of JARM authorization responses
+const AuthorizationResponseType = "oauth-authz-resp+jwt"
+
+// UserInfoType is the JWT typ header of signed UserInfo responses
+const UserInfoType = "userinfo+jwt"
+
+// LogoutTokenType is the JWT typ header of logout tokens (OIDC Back-Channel Logout 1.0 Section 2.4)
+const LogoutTokenType = "logout+jwt"
+
+// SoftwareStatementType is the JWT typ header of software statements issued by this server
+const SoftwareStatementType = "software-statement+jwt"
+
+// MetadataType is the JWT typ header of signed_metadata
+const MetadataType = "metadata+jwt"
+
+// MetadataLifetime is how long a signed_metadata JWT is valid. Metadata is signed afresh for every
+// request, so the lifetime only bounds how long a cached copy is trusted.
+const MetadataLifetime = 24 * time.Hour
+
+// BackchannelLogoutEvent is the member of a logout token's events claim (OIDC Back-Channel Logout 1.0 Section 2.4)
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// UserInfoClaimsClaim is the private access token claim carrying the userinfo member of an OIDC
+// claims request to the UserInfo endpoint
+const UserInfoClaimsClaim = "userinfo_claims"
+
+// AccessTokenClaims describes the contents of an access token (RFC 9068 Section 2.2)
+type AccessTokenClaims struct {
+	Subject  string
+	ClientID string
+	// Audience lists the resource servers the token is intended for; defaults to ClientID
+	Audience []string
+	Scope    string
+	// AuthTime, ACR and AMR describe the user authentication; AuthTime is zero for client-only tokens
+	AuthTime time.Time
+	ACR      string
+	AMR      []string
+	Groups   []string
+	Roles    []string
+	// AuthorizationDetails are the fine-grained permissions granted with the token (RFC 9396 Section 9.1)
+	AuthorizationDetails []map[string]interface{}
+	// UserInfoClaims is the userinfo member of the OIDC claims request parameter as JSON, naming
+	// the claims the UserInfo endpoint releases for the token beyond those of its scopes
+	UserInfoClaims string
+	Custom         map[string]interface{}
+}
+
+// AccessTokenPayload builds the claims set of an access token
+func (s *JWTService) AccessTokenPayload(c AccessTokenClaims, duration time.Duration) jwt.MapClaims {
 	now := time.Now()
 
-	claims := jwt.MapClaims{
-		"iss":   s.issuer,
-		"sub":   subject,
-		"aud":   audience,
-		"exp":   now.Add(duration).Unix(),
-		"iat":   now.Unix(),
-		"nbf":   now.Unix(),
-		"scope": scope,
-		"jti":   generateKeyID("jti"),
-	}
-
-	// Add custom claims
-	for k, v := range customClaims {
+	claims := jwt.MapClaims{}
+	// Custom claims first so they cannot override the registered ones
+	for k, v := range c.Custom {
 		claims[k] = v
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	claims["iss"] = s.issuer
+	claims["sub"] = c.Subject
+	claims["client_id"] = c.ClientID
+	claims["exp"] = now.Add(duration).Unix()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["jti"] = generateKeyID("jti")
+
+	switch len(c.Audience) {
+	case 0:
+		claims["aud"] = c.ClientID
+	case 1:
+		claims["aud"] = c.Audience[0]
+	default:
+		claims["aud"] = c.Audience
+	}
+	if c.Scope != "" {
+		claims["scope"] = c.Scope
+	}
+	if !c.AuthTime.IsZero() {
+		claims["auth_time"] = c.AuthTime.Unix()
+	}
+	if c.ACR != "" {
+		claims["acr"] = c.ACR
+	}
+	if len(c.AMR) > 0 {
+		claims["amr"] = c.AMR
+	}
+	if len(c.Groups) > 0 {
+		claims["groups"] = c.Groups
+	}
+	if len(c.Roles) > 0 {
+		claims["roles"] = c.Roles
+	}
+	if len(c.AuthorizationDetails) > 0 {
+		claims["authorization_details"] = c.AuthorizationDetails
+	}
+	if c.UserInfoClaims != "" {
+		claims[UserInfoClaimsClaim] = c.UserInfoClaims
+	}
+
+	return claims
+}
+
+// CreateAccessToken creates a JWT access token with the at+jwt type (RFC 9068)
+func (s *JWTService) CreateAccessToken(c AccessTokenClaims, duration time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, s.AccessTokenPayload(c, duration))
+	token.Header["typ"] = AccessTokenType
 	token.Header["kid"] = s.keySet.RSAKeyID()
 
 	return token.SignedString(s.keySet.RSAPrivateKey())
@@ -85,6 +179,35 @@ func (s *JWTService) CreateIDToken(subject string, audience string, nonce string
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = IDTokenType
+	token.Header["kid"] = s.keySet.RSAKeyID()
+
+	return token.SignedString(s.keySet.RSAPrivateKey())
+}
+
+// CreateLogoutToken creates a logout token telling a client that the user's session ended. The
+// session ID is omitted when empty. A logout token never carries a nonce, so it cannot be
+// mistaken for an ID token (OIDC Back-Channel Logout 1.0 Section 2.4).
+func (s *JWTService) CreateLogoutToken(subject, audience, sessionID string, duration time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss": s.issuer,
+		"sub": subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(duration).Unix(),
+		"jti": generateKeyID("logout"),
+		"events": map[string]interface{}{
+			BackchannelLogoutEvent: map[string]interface{}{},
+		},
+	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = LogoutTokenType
 	token.Header["kid"] = s.keySet.RSAKeyID()
 
 	return token.SignedString(s.keySet.RSAPrivateKey())
@@ -106,11 +229,122 @@ func (s *JWTService) CreateRefreshToken(subject string, clientID string, scope s
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = RefreshTokenType
+	token.Header["kid"] = s.keySet.RSAKeyID()
+
+	return token.SignedString(s.keySet.RSAPrivateKey())
+}
+
+// CreateSoftwareStatement signs client metadata as a software statement (RFC 7591 Section 2.3).
+// Statements are signed with the dedicated statement key and carry their own typ, so they are
+// never accepted where a token is expected.
+func (s *JWTService) CreateSoftwareStatement(metadata map[string]interface{}, duration time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{}
+	for k, v := range metadata {
+		claims[k] = v
+	}
+	claims["iss"] = s.issuer
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = SoftwareStatementType
+	token.Header["kid"] = s.keySet.StatementKeyID()
+
+	return token.SignedString(s.keySet.StatementPrivateKey())
+}
+
+// ValidateSoftwareStatement verifies a software statement issued by CreateSoftwareStatement
+func (s *JWTService) ValidateSoftwareStatement(statement string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(statement, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != SoftwareStatementType {
+			return nil, fmt.Errorf("typ must be %s", SoftwareStatementType)
+		}
+		return &s.keySet.StatementPrivateKey().PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer(s.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("software statement validation failed: %w", err)
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid software statement")
+	}
+	return claims, nil
+}
+
+// SignMetadata signs server metadata as the signed_metadata JWT (RFC 8414 Section 2.1). It is
+// signed with the published key so clients can verify it, and carries its own typ and an exp so
+// it is never mistaken for a token or trusted indefinitely.
+func (s *JWTService) SignMetadata(metadata map[string]interface{}) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{}
+	for k, v := range metadata {
+		claims[k] = v
+	}
+	claims["iss"] = s.issuer
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(MetadataLifetime).Unix()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = MetadataType
 	token.Header["kid"] = s.keySet.RSAKeyID()
 
 	return token.SignedString(s.keySet.RSAPrivateKey())
 }
 
+// CreateAuthorizationResponse signs authorization response parameters as a JWT for the
+// JARM response modes (JARM Section 2.1). The client is the audience, so a response
+// injected from another client's flow fails validation. alg is RS256 or ES256.
+func (s *JWTService) CreateAuthorizationResponse(clientID string, params map[string]string, alg string, duration time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{}
+	for k, v := range params {
+		claims[k] = v
+	}
+	claims["iss"] = s.issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
+
+	return s.signTyped(claims, alg, AuthorizationResponseType)
+}
+
+// CreateUserInfoJWT signs UserInfo claims for a client with alg, adding iss and aud so the
+// response cannot be replayed to another client (OIDC Core Section 5.3.2)
+func (s *JWTService) CreateUserInfoJWT(clientID string, userClaims map[string]interface{}, alg string) (string, error) {
+	claims := jwt.MapClaims{}
+	for k, v := range userClaims {
+		claims[k] = v
+	}
+	claims["iss"] = s.issuer
+	claims["aud"] = clientID
+
+	return s.signTyped(claims, alg, UserInfoType)
+}
+
+// signTyped signs claims with alg, RS256 or ES256, under the given typ header
+func (s *JWTService) signTyped(claims jwt.MapClaims, alg, typ string) (string, error) {
+	if alg == jwt.SigningMethodES256.Alg() {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["typ"] = typ
+		token.Header["kid"] = s.keySet.ECKeyID()
+		return token.SignedString(s.keySet.ECPrivateKey())
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = s.keySet.RSAKeyID()
+	return token.SignedString(s.keySet.RSAPrivateKey())
+}
+
+// SigningAlgorithms lists the JWS algorithms of the tokens this service signs
+func (s *JWTService) SigningAlgorithms() []string {
+	return []string{jwt.SigningMethodRS256.Alg()}
+}
+
 // ValidateToken validates a JWT and returns its claims
 func (s *JWTService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -141,6 +375,57 @@ func (s *JWTService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	return claims, nil
 }
 
+// ValidateAccessToken validates a JWT access token issued by this server. The typ must be at+jwt
+// and exp is required, so no other JWT signed with the same key is accepted as an access token
+// (RFC 9068 Section 4).
+func (s *JWTService) ValidateAccessToken(tokenString string) (jwt.MapClaims, error) {
+	return s.validateTyped(tokenString, AccessTokenType)
+}
+
+// ValidateIDToken validates an ID token issued by this server, requiring its typ, exp and aud.
+// Claims that only the server's other tokens carry are refused, so a token signed before every
+// JWT had a typ of its own is not taken for an ID token either.
+func (s *JWTService) ValidateIDToken(tokenString string) (jwt.MapClaims, error) {
+	claims, err := s.validateTyped(tokenString, IDTokenType)
+	if err != nil {
+		return nil, err
+	}
+	if aud, _ := claims.GetAudience(); len(aud) == 0 {
+		return nil, errors.New("ID token has no audience")
+	}
+	for _, name := range []string{"type", "scope", "client_id"} {
+		if _, ok := claims[name]; ok {
+			return nil, fmt.Errorf("ID tokens carry no %s claim", name)
+		}
+	}
+	return claims, nil
+}
+
+// ValidateRefreshToken validates a refresh token issued by this server, requiring its typ and exp
+func (s *JWTService) ValidateRefreshToken(tokenString string) (jwt.MapClaims, error) {
+	return s.validateTyped(tokenString, RefreshTokenType)
+}
+
+// validateTyped validates an RS256 JWT issued by this server with the given typ header.
+// The "application/" prefix of the media type may be omitted (RFC 7515 Section 4.1.9).
+func (s *JWTService) validateTyped(tokenString, typ string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		header, _ := token.Header["typ"].(string)
+		if !strings.EqualFold(strings.TrimPrefix(strings.ToLower(header), "application/"), typ) {
+			return nil, fmt.Errorf("typ must be %s", typ)
+		}
+		return s.keySet.RSAPublicKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithIssuer(s.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("token validation failed: %w", err)
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
 // DecodeTokenWithoutValidation decodes a JWT without validating signature
 // Used for looking glass inspection
 func DecodeTokenWithoutValidation(tokenString string) (*DecodedToken, error) {
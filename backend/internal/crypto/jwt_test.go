@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestJWTService(t *testing.T) *JWTService {
+	t.Helper()
+	keySet, err := NewKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewJWTService(keySet, "http://localhost:8080")
+}
+
+func TestValidateIDTokenRejectsOtherTokens(t *testing.T) {
+	s := newTestJWTService(t)
+	idToken, err := s.CreateIDToken("alice", "demo-app", "", time.Now(), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateIDToken(idToken); err != nil {
+		t.Fatalf("ID token rejected: %v", err)
+	}
+
+	refreshToken, err := s.CreateRefreshToken("alice", "demo-app", "openid", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jarm, err := s.CreateAuthorizationResponse("demo-app", map[string]string{"code": "c"}, "RS256", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userinfo, err := s.CreateUserInfoJWT("demo-app", map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}, "RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A refresh token signed before refresh tokens had a typ of their own
+	untypedRefresh, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": s.issuer, "sub": "alice", "aud": "demo-app", "client_id": "demo-app", "scope": "openid",
+		"type": "refresh", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(s.keySet.RSAPrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{
+		"refresh token":         refreshToken,
+		"JARM response":         jarm,
+		"UserInfo JWT":          userinfo,
+		"untyped refresh token": untypedRefresh,
+	} {
+		if _, err := s.ValidateIDToken(token); err == nil {
+			t.Errorf("%s accepted as an ID token", name)
+		}
+	}
+
+	if _, err := s.ValidateRefreshToken(refreshToken); err != nil {
+		t.Errorf("refresh token rejected: %v", err)
+	}
+	if _, err := s.ValidateRefreshToken(idToken); err == nil {
+		t.Error("ID token accepted as a refresh token")
+	}
+}
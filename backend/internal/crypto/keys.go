@@ -6,8 +6,10 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
@@ -16,15 +18,26 @@ import (
 
 // KeySet manages cryptographic keys for the showcase
 type KeySet struct {
-	rsaKey    *rsa.PrivateKey
-	ecKey     *ecdsa.PrivateKey
-	rsaKeyID  string
-	ecKeyID   string
-	createdAt time.Time
-	mu        sync.RWMutex
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	rsaKeyID string
+	ecKeyID  string
+	// encKey decrypts JWEs sent to the server, such as encrypted request objects; it is never used for signing
+	encKey   *rsa.PrivateKey
+	encKeyID string
+	// ecEncKey is the ECDH-ES key agreement counterpart of encKey
+	ecEncKey   *ecdsa.PrivateKey
+	ecEncKeyID string
+	// statementKey signs software statements only. It is not published and no other token
+	// validates against it, so a statement can never pass as an access or ID token.
+	statementKey   *ecdsa.PrivateKey
+	statementKeyID string
+	createdAt      time.Time
+	mu             sync.RWMutex
 }
 
-// NewKeySet generates a new key set with RSA and EC keys
+// NewKeySet generates a new key set with RSA and EC signing keys, RSA and EC encryption keys and
+// a software statement signing key
 func NewKeySet() (*KeySet, error) {
 	// Generate RSA key (2048 bits for demo purposes)
 	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -38,19 +51,151 @@ func NewKeySet() (*KeySet, error) {
 		return nil, fmt.Errorf("failed to generate EC key: %w", err)
 	}
 
+	// Generate RSA encryption key
+	encKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate RSA encryption key: %w", err)
+	}
+
+	// Generate EC encryption key (P-256, for ECDH-ES)
+	ecEncKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate EC encryption key: %w", err)
+	}
+
+	// Generate software statement signing key (P-256)
+	statementKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate software statement key: %w", err)
+	}
+
 	// Generate key IDs
 	rsaKeyID := generateKeyID("rsa")
 	ecKeyID := generateKeyID("ec")
 
 	return &KeySet{
-		rsaKey:    rsaKey,
-		ecKey:     ecKey,
-		rsaKeyID:  rsaKeyID,
-		ecKeyID:   ecKeyID,
-		createdAt: time.Now(),
+		rsaKey:         rsaKey,
+		ecKey:          ecKey,
+		rsaKeyID:       rsaKeyID,
+		ecKeyID:        ecKeyID,
+		encKey:         encKey,
+		encKeyID:       generateKeyID("enc"),
+		ecEncKey:       ecEncKey,
+		ecEncKeyID:     generateKeyID("enc-ec"),
+		statementKey:   statementKey,
+		statementKeyID: generateKeyID("stmt"),
+		createdAt:      time.Now(),
 	}, nil
 }
 
+// storedKeySet is the serialized form of a KeySet, with private keys as PKCS #8 DER
+type storedKeySet struct {
+	RSAKey         []byte    `json:"rsa_key"`
+	RSAKeyID       string    `json:"rsa_kid"`
+	ECKey          []byte    `json:"ec_key"`
+	ECKeyID        string    `json:"ec_kid"`
+	EncKey         []byte    `json:"enc_key"`
+	EncKeyID       string    `json:"enc_kid"`
+	ECEncKey       []byte    `json:"ec_enc_key"`
+	ECEncKeyID     string    `json:"ec_enc_kid"`
+	StatementKey   []byte    `json:"statement_key"`
+	StatementKeyID string    `json:"statement_kid"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// MarshalKeySet encodes every key of the set, private keys included, so the set can be saved
+// and restored with UnmarshalKeySet. The result is as sensitive as the keys themselves.
+func MarshalKeySet(ks *KeySet) ([]byte, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	stored := storedKeySet{
+		RSAKeyID:       ks.rsaKeyID,
+		ECKeyID:        ks.ecKeyID,
+		EncKeyID:       ks.encKeyID,
+		ECEncKeyID:     ks.ecEncKeyID,
+		StatementKeyID: ks.statementKeyID,
+		CreatedAt:      ks.createdAt,
+	}
+	for _, key := range []struct {
+		dst *[]byte
+		key interface{}
+	}{
+		{&stored.RSAKey, ks.rsaKey},
+		{&stored.ECKey, ks.ecKey},
+		{&stored.EncKey, ks.encKey},
+		{&stored.ECEncKey, ks.ecEncKey},
+		{&stored.StatementKey, ks.statementKey},
+	} {
+		der, err := x509.MarshalPKCS8PrivateKey(key.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode key: %w", err)
+		}
+		*key.dst = der
+	}
+	return json.Marshal(stored)
+}
+
+// UnmarshalKeySet restores a key set encoded by MarshalKeySet
+func UnmarshalKeySet(data []byte) (*KeySet, error) {
+	var stored storedKeySet
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode key set: %w", err)
+	}
+
+	ks := &KeySet{
+		rsaKeyID:       stored.RSAKeyID,
+		ecKeyID:        stored.ECKeyID,
+		encKeyID:       stored.EncKeyID,
+		ecEncKeyID:     stored.ECEncKeyID,
+		statementKeyID: stored.StatementKeyID,
+		createdAt:      stored.CreatedAt,
+	}
+	var err error
+	if ks.rsaKey, err = parseRSAKey(stored.RSAKey); err != nil {
+		return nil, err
+	}
+	if ks.encKey, err = parseRSAKey(stored.EncKey); err != nil {
+		return nil, err
+	}
+	if ks.ecKey, err = parseECKey(stored.ECKey); err != nil {
+		return nil, err
+	}
+	if ks.ecEncKey, err = parseECKey(stored.ECEncKey); err != nil {
+		return nil, err
+	}
+	if ks.statementKey, err = parseECKey(stored.StatementKey); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// parseRSAKey decodes a PKCS #8 RSA private key
+func parseRSAKey(der []byte) (*rsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode RSA key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("stored key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// parseECKey decodes a PKCS #8 P-256 private key
+func parseECKey(der []byte) (*ecdsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode EC key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, errors.New("stored key is not a P-256 key")
+	}
+	return ecKey, nil
+}
+
 // generateKeyID creates a unique key identifier
 func generateKeyID(prefix string) string {
 	b := make([]byte, 8)
@@ -100,6 +245,48 @@ func (ks *KeySet) ECKeyID() string {
 	return ks.ecKeyID
 }
 
+// EncryptionPrivateKey returns the RSA key that decrypts JWEs encrypted to the server
+func (ks *KeySet) EncryptionPrivateKey() *rsa.PrivateKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.encKey
+}
+
+// EncryptionKeyID returns the encryption key ID
+func (ks *KeySet) EncryptionKeyID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.encKeyID
+}
+
+// ECEncryptionPrivateKey returns the EC key that decrypts ECDH-ES JWEs encrypted to the server
+func (ks *KeySet) ECEncryptionPrivateKey() *ecdsa.PrivateKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.ecEncKey
+}
+
+// ECEncryptionKeyID returns the EC encryption key ID
+func (ks *KeySet) ECEncryptionKeyID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.ecEncKeyID
+}
+
+// StatementPrivateKey returns the EC key that signs software statements
+func (ks *KeySet) StatementPrivateKey() *ecdsa.PrivateKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.statementKey
+}
+
+// StatementKeyID returns the software statement key ID
+func (ks *KeySet) StatementKeyID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.statementKeyID
+}
+
 // JWK represents a JSON Web Key
 type JWK struct {
 	Kty string `json:"kty"`           // Key Type
@@ -131,6 +318,8 @@ func (ks *KeySet) PublicJWKS() JWKS {
 		Keys: []JWK{
 			ks.rsaPublicJWK(),
 			ks.ecPublicJWK(),
+			ks.encPublicJWK(),
+			ks.ecEncPublicJWK(),
 		},
 	}
 }
@@ -162,6 +351,33 @@ func (ks *KeySet) ecPublicJWK() JWK {
 	}
 }
 
+// encPublicJWK creates a JWK from the RSA encryption public key
+func (ks *KeySet) encPublicJWK() JWK {
+	pub := &ks.encKey.PublicKey
+	return JWK{
+		Kty: "RSA",
+		Use: "enc",
+		Kid: ks.encKeyID,
+		Alg: KeyAlgRSAOAEP256,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// ecEncPublicJWK creates a JWK from the EC encryption public key
+func (ks *KeySet) ecEncPublicJWK() JWK {
+	pub := &ks.ecEncKey.PublicKey
+	return JWK{
+		Kty: "EC",
+		Use: "enc",
+		Kid: ks.ecEncKeyID,
+		Alg: KeyAlgECDHESA256KW,
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
 // GetJWKByID returns a specific JWK by key ID
 func (ks *KeySet) GetJWKByID(kid string) (JWK, bool) {
 	ks.mu.RLock()
@@ -172,6 +388,10 @@ func (ks *KeySet) GetJWKByID(kid string) (JWK, bool) {
 		return ks.rsaPublicJWK(), true
 	case ks.ecKeyID:
 		return ks.ecPublicJWK(), true
+	case ks.encKeyID:
+		return ks.encPublicJWK(), true
+	case ks.ecEncKeyID:
+		return ks.ecEncPublicJWK(), true
 	default:
 		return JWK{}, false
 	}
@@ -194,10 +414,34 @@ func (ks *KeySet) Rotate() error {
 		return fmt.Errorf("failed to generate EC key: %w", err)
 	}
 
+	// Generate new RSA encryption key
+	encKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate RSA encryption key: %w", err)
+	}
+
+	// Generate new EC encryption key
+	ecEncKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate EC encryption key: %w", err)
+	}
+
+	// Generate new software statement key
+	statementKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate software statement key: %w", err)
+	}
+
 	ks.rsaKey = rsaKey
 	ks.ecKey = ecKey
+	ks.encKey = encKey
 	ks.rsaKeyID = generateKeyID("rsa")
 	ks.ecKeyID = generateKeyID("ec")
+	ks.encKeyID = generateKeyID("enc")
+	ks.ecEncKey = ecEncKey
+	ks.ecEncKeyID = generateKeyID("enc-ec")
+	ks.statementKey = statementKey
+	ks.statementKeyID = generateKeyID("stmt")
 	ks.createdAt = time.Now()
 
 	return nil
@@ -0,0 +1,164 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// CertificateThumbprint returns the base64url SHA-256 hash of a certificate's DER encoding,
+// used as the cnf.x5t#S256 claim of certificate-bound tokens (RFC 8705 Section 3.1)
+func CertificateThumbprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// TestCA is a locally generated certificate authority that issues the mutual TLS server
+// certificate and demo client certificates, so mTLS works without a SPIRE deployment
+type TestCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+// NewTestCA generates a self-signed P-256 CA certificate valid for one year
+func NewTestCA(commonName string) (*TestCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"ProtocolSoup"}},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &TestCA{cert: cert, key: key, pool: pool}, nil
+}
+
+// Certificate returns the CA certificate
+func (ca *TestCA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// CertificatePEM returns the CA certificate PEM encoded, for clients to trust the mTLS listener
+func (ca *TestCA) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// IssueServerCertificate issues a TLS server certificate for the given DNS names and IP addresses
+func (ca *TestCA) IssueServerCertificate(hosts ...string) (tls.Certificate, error) {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0]},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, key, err := ca.issue(template)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key}, nil
+}
+
+// IssueClientCertificate issues a client certificate and returns it and its private key PEM
+// encoded. The subject and SAN values are what tls_client_auth matches against the client's
+// registered metadata (RFC 8705 Section 2.1.2).
+func (ca *TestCA) IssueClientCertificate(subject pkix.Name, dnsNames []string, uris []*url.URL) (certPEM, keyPEM []byte, err error) {
+	template := &x509.Certificate{
+		Subject:     subject,
+		DNSNames:    dnsNames,
+		URIs:        uris,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, key, err := ca.issue(template)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// VerifyClientCertificate verifies that a presented chain was issued by the CA for client authentication
+func (ca *TestCA) VerifyClientCertificate(chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return errors.New("no client certificate presented")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         ca.pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
+
+// issue signs a leaf certificate template with a fresh P-256 key, valid for 30 days
+func (ca *TestCA) issue(template *x509.Certificate) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+
+	now := time.Now()
+	template.SerialNumber = randomSerial()
+	template.NotBefore = now.Add(-time.Minute)
+	template.NotAfter = now.AddDate(0, 0, 30)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to issue certificate: %w", err)
+	}
+	return der, key, nil
+}
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial
+}
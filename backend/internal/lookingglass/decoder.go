@@ -7,6 +7,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
 )
 
 // Decoder provides decoding utilities for various protocol artifacts
@@ -29,7 +31,7 @@ type DecodedJWT struct {
 // JWTAnalysis contains analysis of a JWT
 type JWTAnalysis struct {
 	Algorithm    string          `json:"algorithm"`
-	Type         string          `json:"type"` // access_token, id_token, refresh_token
+	Type         string          `json:"type"` // access_token, id_token, refresh_token, dpop_proof, request_object, authorization_response
 	IsExpired    bool            `json:"is_expired"`
 	ExpiresIn    string          `json:"expires_in,omitempty"`
 	Issuer       string          `json:"issuer,omitempty"`
@@ -99,7 +101,11 @@ func (d *Decoder) analyzeJWT(header, payload map[string]interface{}) JWTAnalysis
 	}
 
 	// Determine token type
-	analysis.Type = d.determineTokenType(payload)
+	analysis.Type = d.determineTokenType(header, payload)
+	if analysis.Type == "access_token" && !isAccessTokenTyp(header) {
+		analysis.SecurityNotes = append(analysis.SecurityNotes,
+			"Access token does not declare typ 'at+jwt' - it could be confused with an ID token or other JWT (RFC 9068 Section 4)")
+	}
 
 	// Standard claims
 	standardClaims := map[string]string{
@@ -128,6 +134,30 @@ func (d *Decoder) analyzeJWT(header, payload map[string]interface{}) JWTAnalysis
 		"picture":             "URL of profile picture",
 	}
 
+	// JWT access token claims (RFC 9068 Section 2.2)
+	accessTokenClaims := map[string]string{
+		"client_id":    "Client ID - Client the token was issued to",
+		"scope":        "Scope - Permissions granted to the client",
+		"groups":       "Groups the user belongs to",
+		"roles":        "Roles assigned to the user",
+		"entitlements": "Entitlements granted to the user",
+	}
+
+	// Authorization request and response parameters carried as claims (RFC 9101, JARM)
+	authorizationClaims := map[string]string{
+		"response_type":         "Response Type - Flow the client requested",
+		"response_mode":         "Response Mode - How the authorization response is returned",
+		"redirect_uri":          "Redirect URI - Where the authorization response is sent",
+		"state":                 "State - Client value that binds the response to the request",
+		"code":                  "Authorization Code - Exchanged at the token endpoint",
+		"code_challenge":        "PKCE Code Challenge - Hash of the client's code verifier",
+		"code_challenge_method": "PKCE Code Challenge Method",
+		"error":                 "Error - Why the authorization request failed",
+		"error_description":     "Error Description - Human-readable error details",
+		"access_token":          "Access Token - Returned directly by an implicit response",
+		"id_token":              "ID Token - Returned directly by an implicit or hybrid response",
+	}
+
 	// Analyze each claim
 	for key, value := range payload {
 		claim := ClaimAnalysis{
@@ -141,7 +171,16 @@ func (d *Decoder) analyzeJWT(header, payload map[string]interface{}) JWTAnalysis
 		} else if desc, ok := oidcClaims[key]; ok {
 			claim.Description = desc
 			claim.Category = "oidc"
-		} else if key == "scope" || key == "roles" || key == "permissions" {
+		} else if key == "cnf" {
+			claim.Description = "Confirmation - key the token is bound to (cnf.jkt for DPoP)"
+			claim.Category = "authorization"
+		} else if desc, ok := accessTokenClaims[key]; ok {
+			claim.Description = desc
+			claim.Category = "authorization"
+		} else if desc, ok := authorizationClaims[key]; ok {
+			claim.Description = desc
+			claim.Category = "authorization"
+		} else if key == "permissions" {
 			claim.Description = "Authorization-related claim"
 			claim.Category = "authorization"
 		} else {
@@ -197,13 +236,28 @@ func (d *Decoder) checkAlgorithmSecurity(analysis *JWTAnalysis, alg string) {
 	}
 }
 
-func (d *Decoder) determineTokenType(payload map[string]interface{}) string {
-	// Check for OIDC ID token indicators
-	if _, hasNonce := payload["nonce"]; hasNonce {
-		return "id_token"
+func (d *Decoder) determineTokenType(header, payload map[string]interface{}) string {
+	// The typ header is authoritative when present
+	if isAccessTokenTyp(header) {
+		return "access_token"
 	}
-	if _, hasAuthTime := payload["auth_time"]; hasAuthTime {
-		return "id_token"
+	if typ, _ := header["typ"].(string); strings.EqualFold(typ, "dpop+jwt") {
+		return "dpop_proof"
+	}
+	if typ, _ := header["typ"].(string); strings.EqualFold(typ, "oauth-authz-req+jwt") {
+		return "request_object"
+	}
+
+	// Request objects carry the authorization parameters; JARM responses carry the result
+	if _, hasResponseType := payload["response_type"]; hasResponseType {
+		return "request_object"
+	}
+	_, hasCode := payload["code"]
+	_, hasError := payload["error"]
+	_, hasToken := payload["access_token"]
+	_, hasIDToken := payload["id_token"]
+	if (hasCode || hasError || hasToken || hasIDToken) && payload["sub"] == nil {
+		return "authorization_response"
 	}
 
 	// Check for refresh token
@@ -211,14 +265,30 @@ func (d *Decoder) determineTokenType(payload map[string]interface{}) string {
 		return "refresh_token"
 	}
 
-	// Check for scope (typical for access tokens)
-	if _, hasScope := payload["scope"]; hasScope {
+	// Access tokens carry scope or client_id, which ID tokens never do
+	_, hasScope := payload["scope"]
+	_, hasClientID := payload["client_id"]
+	if hasScope || hasClientID {
 		return "access_token"
 	}
 
+	// Check for OIDC ID token indicators
+	if _, hasNonce := payload["nonce"]; hasNonce {
+		return "id_token"
+	}
+	if _, hasAuthTime := payload["auth_time"]; hasAuthTime {
+		return "id_token"
+	}
+
 	return "unknown"
 }
 
+// isAccessTokenTyp reports whether a JWT header declares an RFC 9068 access token
+func isAccessTokenTyp(header map[string]interface{}) bool {
+	typ, _ := header["typ"].(string)
+	return strings.EqualFold(typ, "at+jwt") || strings.EqualFold(typ, "application/at+jwt")
+}
+
 // DecodedAuthorizationRequest represents a decoded OAuth authorization request
 type DecodedAuthorizationRequest struct {
 	ResponseType        string   `json:"response_type"`
@@ -229,10 +299,18 @@ type DecodedAuthorizationRequest struct {
 	Nonce               string   `json:"nonce,omitempty"`
 	CodeChallenge       string   `json:"code_challenge,omitempty"`
 	CodeChallengeMethod string   `json:"code_challenge_method,omitempty"`
-	SecurityNotes       []string `json:"security_notes"`
+	ResponseMode        string   `json:"response_mode,omitempty"`
+	RequestURI          string   `json:"request_uri,omitempty"`
+	// RequestObject is the signed request object from the request parameter (RFC 9101)
+	RequestObject          *DecodedJWT            `json:"request_object,omitempty"`
+	RequestObjectEncrypted bool                   `json:"request_object_encrypted,omitempty"`
+	EncryptionHeader       map[string]interface{} `json:"encryption_header,omitempty"`
+	SecurityNotes          []string               `json:"security_notes"`
 }
 
-// DecodeAuthorizationRequest decodes an authorization request URL
+// DecodeAuthorizationRequest decodes an authorization request URL. A request object in the
+// request parameter is unwrapped and its claims take precedence over the query, as they do
+// at the authorization server; an encrypted one can only be described, not opened.
 func (d *Decoder) DecodeAuthorizationRequest(requestURL string) (*DecodedAuthorizationRequest, error) {
 	parsed, err := url.Parse(requestURL)
 	if err != nil {
@@ -249,9 +327,31 @@ func (d *Decoder) DecodeAuthorizationRequest(requestURL string) (*DecodedAuthori
 		Nonce:               query.Get("nonce"),
 		CodeChallenge:       query.Get("code_challenge"),
 		CodeChallengeMethod: query.Get("code_challenge_method"),
+		ResponseMode:        query.Get("response_mode"),
+		RequestURI:          query.Get("request_uri"),
 		SecurityNotes:       make([]string, 0),
 	}
 
+	if request := query.Get("request"); request != "" {
+		if crypto.IsJWE(request) {
+			decoded.RequestObjectEncrypted = true
+			decoded.EncryptionHeader, _ = crypto.DecodeJWEHeader(request)
+			decoded.SecurityNotes = append(decoded.SecurityNotes,
+				"Request object is encrypted to the authorization server - its parameters are hidden from the browser")
+		} else {
+			requestObject, err := d.DecodeJWT(request)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode request object: %w", err)
+			}
+			decoded.RequestObject = requestObject
+			decoded.applyRequestObject(requestObject.Payload)
+			if requestObject.Analysis.Algorithm == "none" {
+				decoded.SecurityNotes = append(decoded.SecurityNotes,
+					"WARNING: Unsigned request object - it will be rejected")
+			}
+		}
+	}
+
 	// Security analysis
 	if decoded.State == "" {
 		decoded.SecurityNotes = append(decoded.SecurityNotes,
@@ -276,6 +376,93 @@ func (d *Decoder) DecodeAuthorizationRequest(requestURL string) (*DecodedAuthori
 	return decoded, nil
 }
 
+// applyRequestObject replaces the decoded parameters with those signed in a request object
+func (r *DecodedAuthorizationRequest) applyRequestObject(claims map[string]interface{}) {
+	fields := map[string]*string{
+		"response_type":         &r.ResponseType,
+		"client_id":             &r.ClientID,
+		"redirect_uri":          &r.RedirectURI,
+		"scope":                 &r.Scope,
+		"state":                 &r.State,
+		"nonce":                 &r.Nonce,
+		"code_challenge":        &r.CodeChallenge,
+		"code_challenge_method": &r.CodeChallengeMethod,
+		"response_mode":         &r.ResponseMode,
+	}
+	for name, field := range fields {
+		if value, ok := claims[name].(string); ok {
+			*field = value
+		}
+	}
+}
+
+// DecodedAuthorizationResponse represents a decoded JWT authorization response (JARM)
+type DecodedAuthorizationResponse struct {
+	// ResponseMode is where the response parameter was found: query.jwt, fragment.jwt or form_post.jwt
+	ResponseMode     string                 `json:"response_mode"`
+	Response         *DecodedJWT            `json:"response,omitempty"`
+	Encrypted        bool                   `json:"encrypted,omitempty"`
+	EncryptionHeader map[string]interface{} `json:"encryption_header,omitempty"`
+	Code             string                 `json:"code,omitempty"`
+	State            string                 `json:"state,omitempty"`
+	Error            string                 `json:"error,omitempty"`
+	SecurityNotes    []string               `json:"security_notes"`
+}
+
+// DecodeAuthorizationResponse decodes the response parameter of a JARM redirect URL, from the
+// query or the fragment, or of a form_post.jwt body
+func (d *Decoder) DecodeAuthorizationResponse(responseURL string) (*DecodedAuthorizationResponse, error) {
+	decoded := &DecodedAuthorizationResponse{SecurityNotes: make([]string, 0)}
+
+	var response string
+	if parsed, err := url.Parse(responseURL); err == nil && (parsed.Scheme != "" || parsed.Fragment != "") {
+		if response = parsed.Query().Get("response"); response != "" {
+			decoded.ResponseMode = "query.jwt"
+		} else if fragment, err := url.ParseQuery(parsed.Fragment); err == nil {
+			response = fragment.Get("response")
+			decoded.ResponseMode = "fragment.jwt"
+		}
+	} else if body, err := url.ParseQuery(responseURL); err == nil {
+		response = body.Get("response")
+		decoded.ResponseMode = "form_post.jwt"
+	}
+	if response == "" {
+		return nil, fmt.Errorf("no response parameter found")
+	}
+
+	if crypto.IsJWE(response) {
+		decoded.Encrypted = true
+		decoded.EncryptionHeader, _ = crypto.DecodeJWEHeader(response)
+		decoded.SecurityNotes = append(decoded.SecurityNotes,
+			"Response is encrypted to the client - only the client can read the code or tokens")
+		return decoded, nil
+	}
+
+	jwt, err := d.DecodeJWT(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	decoded.Response = jwt
+	decoded.Code, _ = jwt.Payload["code"].(string)
+	decoded.State, _ = jwt.Payload["state"].(string)
+	decoded.Error, _ = jwt.Payload["error"].(string)
+
+	if decoded.ResponseMode == "query.jwt" && (jwt.Payload["access_token"] != nil || jwt.Payload["id_token"] != nil) {
+		decoded.SecurityNotes = append(decoded.SecurityNotes,
+			"WARNING: Tokens must not be returned in the query - use fragment.jwt or form_post.jwt")
+	}
+	if jwt.Payload["aud"] == nil || jwt.Payload["iss"] == nil {
+		decoded.SecurityNotes = append(decoded.SecurityNotes,
+			"WARNING: JARM responses must contain iss and aud so the client can detect mix-up and injection")
+	}
+	if jwt.Analysis.IsExpired {
+		decoded.SecurityNotes = append(decoded.SecurityNotes,
+			"WARNING: Response has expired and must be rejected")
+	}
+
+	return decoded, nil
+}
+
 // DecodedTokenRequest represents a decoded token request
 type DecodedTokenRequest struct {
 	GrantType    string   `json:"grant_type"`
@@ -285,6 +472,7 @@ type DecodedTokenRequest struct {
 	CodeVerifier string   `json:"code_verifier,omitempty"`
 	RefreshToken string   `json:"refresh_token,omitempty"`
 	Scope        string   `json:"scope,omitempty"`
+	ClientAssertionType string `json:"client_assertion_type,omitempty"`
 	SecurityNotes []string `json:"security_notes"`
 }
 
@@ -303,9 +491,18 @@ func (d *Decoder) DecodeTokenRequest(body string) (*DecodedTokenRequest, error)
 		CodeVerifier: values.Get("code_verifier"),
 		RefreshToken: values.Get("refresh_token"),
 		Scope:        values.Get("scope"),
+		ClientAssertionType: values.Get("client_assertion_type"),
 		SecurityNotes: make([]string, 0),
 	}
 
+	if decoded.ClientAssertionType != "" {
+		decoded.SecurityNotes = append(decoded.SecurityNotes,
+			"Client authenticates with a signed JWT assertion (RFC 7523) - no client secret is sent")
+	} else if values.Get("client_secret") != "" {
+		decoded.SecurityNotes = append(decoded.SecurityNotes,
+			"Client secret sent in the request body - prefer HTTP Basic or a JWT client assertion")
+	}
+
 	// Security analysis based on grant type
 	switch decoded.GrantType {
 	case "authorization_code":
@@ -319,6 +516,12 @@ func (d *Decoder) DecodeTokenRequest(body string) (*DecodedTokenRequest, error)
 	case "client_credentials":
 		decoded.SecurityNotes = append(decoded.SecurityNotes,
 			"Client credentials grant - used for machine-to-machine authentication")
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		decoded.SecurityNotes = append(decoded.SecurityNotes,
+			"Device authorization grant - the client must honor the polling interval and slow_down responses")
+	case "urn:ietf:params:oauth:grant-type:token-exchange":
+		decoded.SecurityNotes = append(decoded.SecurityNotes,
+			"Token exchange grant - the issued token must not carry broader scope than the subject token")
 	case "password":
 		decoded.SecurityNotes = append(decoded.SecurityNotes,
 			"WARNING: Resource Owner Password grant is deprecated and should be avoided")
@@ -327,3 +530,108 @@ func (d *Decoder) DecodeTokenRequest(body string) (*DecodedTokenRequest, error)
 	return decoded, nil
 }
 
+
+// DecodedDPoPProof represents a DPoP proof JWT broken down for inspection
+type DecodedDPoPProof struct {
+	Raw           string                 `json:"raw"`
+	Header        map[string]interface{} `json:"header"`
+	Payload       map[string]interface{} `json:"payload"`
+	HeaderFields  []ClaimAnalysis        `json:"header_fields"`
+	Claims        []ClaimAnalysis        `json:"claims"`
+	Checks        []DPoPCheck            `json:"checks"`
+	SecurityNotes []string               `json:"security_notes"`
+}
+
+// DPoPCheck describes one validation step a server performs on a DPoP proof
+type DPoPCheck struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Reference   string `json:"reference"`
+}
+
+// DPoPProofChecks returns the DPoP proof validation steps in the order a server performs them
+func DPoPProofChecks() []DPoPCheck {
+	return []DPoPCheck{
+		{ID: "single_header", Name: "Single DPoP Header", Description: "Exactly one DPoP header is present in the request", Reference: "RFC 9449 Section 4.3"},
+		{ID: "typ", Name: "Proof Type", Description: "The typ header is dpop+jwt, so a proof cannot be confused with any other JWT", Reference: "RFC 9449 Section 4.2"},
+		{ID: "alg", Name: "Asymmetric Algorithm", Description: "The proof is signed with a supported asymmetric algorithm, never none or an HMAC", Reference: "RFC 9449 Section 4.2"},
+		{ID: "jwk", Name: "Public Key Header", Description: "The jwk header carries the public key and no private key material", Reference: "RFC 9449 Section 4.2"},
+		{ID: "signature", Name: "Signature", Description: "The signature verifies with the key in the jwk header, proving possession of the private key", Reference: "RFC 9449 Section 4.3"},
+		{ID: "htm", Name: "HTTP Method", Description: "The htm claim matches the method of the request carrying the proof", Reference: "RFC 9449 Section 4.3"},
+		{ID: "htu", Name: "HTTP URI", Description: "The htu claim matches the request URI without query and fragment", Reference: "RFC 9449 Section 4.3"},
+		{ID: "iat", Name: "Freshness", Description: "The iat claim is within the server's acceptance window", Reference: "RFC 9449 Section 11.1"},
+		{ID: "nonce", Name: "Server Nonce", Description: "The nonce claim matches a value the server issued in a DPoP-Nonce header, limiting pre-generated proofs", Reference: "RFC 9449 Section 8"},
+		{ID: "ath", Name: "Access Token Hash", Description: "At a protected resource, the ath claim is the hash of the presented access token", Reference: "RFC 9449 Section 7"},
+		{ID: "key_binding", Name: "Key Binding", Description: "The proof key thumbprint matches the cnf.jkt claim of the access token or refresh token", Reference: "RFC 9449 Section 6"},
+		{ID: "jti", Name: "Replay", Description: "The jti has not been seen before within the acceptance window", Reference: "RFC 9449 Section 11.1"},
+	}
+}
+
+// DecodeDPoPProof decodes a DPoP proof JWT and explains its header and claims
+func (d *Decoder) DecodeDPoPProof(proof string) (*DecodedDPoPProof, error) {
+	decoded, err := d.DecodeJWT(proof)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DecodedDPoPProof{
+		Raw:           proof,
+		Header:        decoded.Header,
+		Payload:       decoded.Payload,
+		HeaderFields:  make([]ClaimAnalysis, 0),
+		Claims:        make([]ClaimAnalysis, 0),
+		Checks:        DPoPProofChecks(),
+		SecurityNotes: make([]string, 0),
+	}
+
+	headerDescriptions := map[string]string{
+		"typ": "Type - must be dpop+jwt",
+		"alg": "Algorithm - asymmetric algorithm used to sign the proof",
+		"jwk": "JSON Web Key - public key the proof is signed with; its thumbprint becomes cnf.jkt",
+	}
+	for key, value := range decoded.Header {
+		desc, ok := headerDescriptions[key]
+		if !ok {
+			desc = "Additional header parameter"
+		}
+		result.HeaderFields = append(result.HeaderFields, ClaimAnalysis{Name: key, Value: value, Description: desc, Category: "dpop"})
+	}
+
+	claimDescriptions := map[string]string{
+		"jti":   "JWT ID - unique identifier used for replay detection",
+		"htm":   "HTTP Method - method of the request the proof is bound to",
+		"htu":   "HTTP URI - target URI of the request, without query and fragment",
+		"iat":   "Issued At - when the proof was created",
+		"nonce": "Nonce - value previously supplied by the server in a DPoP-Nonce header",
+		"ath":   "Access Token Hash - base64url SHA-256 of the access token, required at resource servers",
+	}
+	for key, value := range decoded.Payload {
+		desc, ok := claimDescriptions[key]
+		if !ok {
+			desc = "Custom claim"
+		}
+		result.Claims = append(result.Claims, ClaimAnalysis{Name: key, Value: value, Description: desc, Category: "dpop"})
+	}
+
+	if typ, _ := decoded.Header["typ"].(string); typ != "dpop+jwt" {
+		result.SecurityNotes = append(result.SecurityNotes, "CRITICAL: typ header is not dpop+jwt")
+	}
+	if jwk, ok := decoded.Header["jwk"].(map[string]interface{}); !ok {
+		result.SecurityNotes = append(result.SecurityNotes, "CRITICAL: missing jwk header")
+	} else if _, hasPrivate := jwk["d"]; hasPrivate {
+		result.SecurityNotes = append(result.SecurityNotes, "CRITICAL: jwk header exposes the private key")
+	}
+	switch decoded.Analysis.Algorithm {
+	case "none", "HS256", "HS384", "HS512":
+		result.SecurityNotes = append(result.SecurityNotes, "CRITICAL: DPoP proofs must use an asymmetric algorithm")
+	}
+	if _, ok := decoded.Payload["ath"]; !ok {
+		result.SecurityNotes = append(result.SecurityNotes, "No ath claim - acceptable at the token endpoint, required when presenting an access token")
+	}
+	if _, ok := decoded.Payload["nonce"]; !ok {
+		result.SecurityNotes = append(result.SecurityNotes, "No nonce claim - the server may respond with use_dpop_nonce")
+	}
+
+	return result, nil
+}
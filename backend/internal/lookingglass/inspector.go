@@ -1,6 +1,8 @@
 package lookingglass
 
 import (
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -161,8 +163,17 @@ func (e *Engine) AddEvent(sessionID string, event Event) {
 	session.broadcast(event)
 }
 
-// DecodeToken decodes a token for inspection
+// DecodeToken decodes a token for inspection. A pasted authorization request or JARM response
+// URL is unwrapped to its request or response JWT. A JWE is never decrypted: anyone can call the
+// decoder, and decrypting would reveal request objects and tokens encrypted to the server, so
+// only the protected header is shown.
 func (e *Engine) DecodeToken(tokenString string, keySet *crypto.KeySet) (*TokenInspection, error) {
+	tokenString, wrappedIn := unwrapToken(strings.TrimSpace(tokenString))
+
+	if crypto.IsJWE(tokenString) {
+		return encryptedTokenInspection(tokenString, wrappedIn)
+	}
+
 	decoded, err := crypto.DecodeTokenWithoutValidation(tokenString)
 	if err != nil {
 		return nil, err
@@ -174,6 +185,7 @@ func (e *Engine) DecodeToken(tokenString string, keySet *crypto.KeySet) (*TokenI
 		Signature:   decoded.Signature,
 		HeaderRaw:   decoded.HeaderRaw,
 		PayloadRaw:  decoded.PayloadRaw,
+		WrappedIn:   wrappedIn,
 		Annotations: make([]Annotation, 0),
 	}
 
@@ -194,16 +206,36 @@ func (e *Engine) DecodeToken(tokenString string, keySet *crypto.KeySet) (*TokenI
 	return inspection, nil
 }
 
+// encryptedTokenInspection inspects a JWE by its protected header alone
+func encryptedTokenInspection(token, wrappedIn string) (*TokenInspection, error) {
+	header, err := crypto.DecodeJWEHeader(token)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenInspection{
+		EncryptionHeader: header,
+		WrappedIn:        wrappedIn,
+		Annotations: []Annotation{{
+			Type:        AnnotationTypeExplanation,
+			Title:       "Encrypted Token (JWE)",
+			Description: formatValue("The content is encrypted, so only its recipient can read it. The decoder shows the protected header and does not decrypt tokens for its callers. Key management algorithm", header["alg"]),
+			Reference:   "RFC 7516 Section 5.2",
+		}},
+	}, nil
+}
+
 // TokenInspection represents a decoded and annotated token
 type TokenInspection struct {
-	Header         map[string]interface{} `json:"header"`
-	Payload        map[string]interface{} `json:"payload"`
-	Signature      string                 `json:"signature"`
-	HeaderRaw      string                 `json:"header_raw"`
-	PayloadRaw     string                 `json:"payload_raw"`
-	SignatureValid bool                   `json:"signature_valid"`
-	Algorithm      string                 `json:"algorithm"`
-	Annotations    []Annotation           `json:"annotations"`
+	Header           map[string]interface{} `json:"header"`
+	Payload          map[string]interface{} `json:"payload"`
+	Signature        string                 `json:"signature"`
+	HeaderRaw        string                 `json:"header_raw"`
+	PayloadRaw       string                 `json:"payload_raw"`
+	SignatureValid   bool                   `json:"signature_valid"`
+	Algorithm        string                 `json:"algorithm"`
+	EncryptionHeader map[string]interface{} `json:"encryption_header,omitempty"` // JWE header when the token was encrypted
+	WrappedIn        string                 `json:"wrapped_in,omitempty"`        // request or response when unwrapped from a URL
+	Annotations      []Annotation           `json:"annotations"`
 }
 
 func (ti *TokenInspection) addTokenAnnotations() {
@@ -284,6 +316,79 @@ func (ti *TokenInspection) addTokenAnnotations() {
 			Reference:   "OpenID Connect Core 1.0 Section 2",
 		})
 	}
+
+	// Sender-constrained tokens and DPoP proofs
+	if cnf, ok := ti.Payload["cnf"].(map[string]interface{}); ok {
+		if jkt, ok := cnf["jkt"]; ok {
+			ti.Annotations = append(ti.Annotations, Annotation{
+				Type:        AnnotationTypeBestPractice,
+				Title:       "DPoP-Bound Token (cnf.jkt)",
+				Description: formatValue("Token is bound to the key with this JWK thumbprint and must be presented with a DPoP proof signed by it", jkt),
+				Reference:   "RFC 9449 Section 6.1",
+			})
+		}
+	}
+
+	if typ, _ := ti.Header["typ"].(string); typ == "at+jwt" || typ == "application/at+jwt" {
+		ti.Annotations = append(ti.Annotations, Annotation{
+			Type:        AnnotationTypeBestPractice,
+			Title:       "JWT Access Token (at+jwt)",
+			Description: "The explicit typ header stops this access token from being accepted as an ID token, and resource servers can validate it locally without introspection",
+			Reference:   "RFC 9068 Section 2.1",
+		})
+	}
+
+	if typ, _ := ti.Header["typ"].(string); typ == "oauth-authz-req+jwt" || ti.Payload["response_type"] != nil {
+		ti.Annotations = append(ti.Annotations, Annotation{
+			Type:        AnnotationTypeBestPractice,
+			Title:       "Request Object",
+			Description: "A JWT-secured authorization request. The authorization server verifies the client's signature and uses these parameters in place of the query, so they cannot be altered in the browser",
+			Reference:   "RFC 9101 Section 4",
+		})
+	}
+
+	if _, hasCode := ti.Payload["code"]; (hasCode || ti.Payload["error"] != nil) && ti.Payload["sub"] == nil {
+		ti.Annotations = append(ti.Annotations, Annotation{
+			Type:        AnnotationTypeBestPractice,
+			Title:       "JWT Authorization Response (JARM)",
+			Description: "The authorization response parameters signed by the server. The client checks iss, aud and exp before using the code, so injected or replayed responses are rejected",
+			Reference:   "JARM Section 2.1",
+		})
+	}
+
+	if typ, _ := ti.Header["typ"].(string); typ == "dpop+jwt" {
+		ti.Annotations = append(ti.Annotations, Annotation{
+			Type:        AnnotationTypeExplanation,
+			Title:       "DPoP Proof",
+			Description: "A proof-of-possession JWT bound to one HTTP request by htm and htu, signed with the key in its jwk header",
+			Reference:   "RFC 9449 Section 4.2",
+		})
+	}
+}
+
+// unwrapToken extracts the request object or JARM response from a pasted URL or form body
+func unwrapToken(input string) (string, string) {
+	if !strings.ContainsAny(input, "?#=") {
+		return input, ""
+	}
+	candidates := make([]url.Values, 0, 3)
+	if parsed, err := url.Parse(input); err == nil {
+		candidates = append(candidates, parsed.Query())
+		if fragment, err := url.ParseQuery(parsed.Fragment); err == nil {
+			candidates = append(candidates, fragment)
+		}
+	}
+	if body, err := url.ParseQuery(input); err == nil {
+		candidates = append(candidates, body)
+	}
+	for _, values := range candidates {
+		for _, name := range []string{"request", "response"} {
+			if token := values.Get(name); token != "" {
+				return token, name
+			}
+		}
+	}
+	return input, ""
 }
 
 func formatValue(desc string, value interface{}) string {
@@ -0,0 +1,43 @@
+package lookingglass
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+func TestDecodeTokenDoesNotDecryptJWEs(t *testing.T) {
+	keySet, err := crypto.NewKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := crypto.NewJWTService(keySet, "http://localhost:8080").CreateIDToken("alice", "jwe-app", "", time.Now(), time.Hour, map[string]interface{}{"email": "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto.EncryptJWE([]byte(idToken), &keySet.EncryptionPrivateKey().PublicKey, keySet.EncryptionKeyID(), crypto.KeyAlgRSAOAEP256, crypto.EncA256GCM, "JWT")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inspection, err := NewEngine().DecodeToken(encrypted, keySet)
+	if err != nil {
+		t.Fatalf("DecodeToken: %v", err)
+	}
+	if inspection.Payload != nil || inspection.PayloadRaw != "" || strings.Contains(inspection.HeaderRaw, "alice") {
+		t.Errorf("encrypted token decrypted: %+v", inspection)
+	}
+	if inspection.EncryptionHeader["alg"] != crypto.KeyAlgRSAOAEP256 || inspection.EncryptionHeader["kid"] != keySet.EncryptionKeyID() {
+		t.Errorf("encryption header = %v", inspection.EncryptionHeader)
+	}
+
+	signed, err := NewEngine().DecodeToken(idToken, keySet)
+	if err != nil {
+		t.Fatalf("DecodeToken of the signed token: %v", err)
+	}
+	if signed.Payload["email"] != "alice@example.com" || !signed.SignatureValid {
+		t.Errorf("signed token inspection = %+v", signed)
+	}
+}
@@ -0,0 +1,167 @@
+package mockidp
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// Access token formats a client can be configured with
+const (
+	// AccessTokenFormatJWT issues self-contained at+jwt tokens (RFC 9068)
+	AccessTokenFormatJWT = "jwt"
+	// AccessTokenFormatOpaque issues random reference tokens resolved via introspection (RFC 7662)
+	AccessTokenFormatOpaque = "opaque"
+)
+
+// AccessTokenFormat returns the access token format configured for a client. Pairwise clients
+// always get opaque tokens: a JWT would show them the user ID and profile claims their pairwise
+// sub is meant to hide.
+func (idp *MockIdP) AccessTokenFormat(clientID string) string {
+	client, exists := idp.GetClient(clientID)
+	if !exists {
+		return AccessTokenFormatJWT
+	}
+	if client.SubjectType == SubjectTypePairwise {
+		return AccessTokenFormatOpaque
+	}
+	if client.AccessTokenFormat == "" {
+		return AccessTokenFormatJWT
+	}
+	return client.AccessTokenFormat
+}
+
+// IssueAccessToken issues an access token in the format configured for claims.ClientID. When the
+// subject is a user, the authentication context and the user's groups and roles are added.
+func (idp *MockIdP) IssueAccessToken(claims crypto.AccessTokenClaims, duration time.Duration) (string, error) {
+	if user, exists := idp.GetUser(claims.Subject); exists {
+		if claims.ACR == "" && !claims.AuthTime.IsZero() {
+			claims.ACR = ACRPassword
+			claims.AMR = []string{"pwd"}
+		}
+		if claims.Groups == nil {
+			claims.Groups = user.Groups
+		}
+		if claims.Roles == nil {
+			claims.Roles = user.Roles
+		}
+	}
+
+	jwtService := idp.JWTService()
+	if idp.AccessTokenFormat(claims.ClientID) != AccessTokenFormatOpaque {
+		return jwtService.CreateAccessToken(claims, duration)
+	}
+
+	// Round-trip through JSON so stored claims have the same types as claims decoded from a JWT
+	encoded, err := json.Marshal(jwtService.AccessTokenPayload(claims, duration))
+	if err != nil {
+		return "", err
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(encoded, &payload); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := generateRandomString(43)
+	err = idp.store.PutReferenceToken(&models.ReferenceToken{
+		Token:     token,
+		ClientID:  claims.ClientID,
+		Claims:    payload,
+		ExpiresAt: now.Add(duration),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ResolveToken returns the claims of an access token issued by this server: reference tokens are
+// looked up, JWTs must be at+jwt access tokens with a valid signature and lifetime. ID tokens,
+// refresh tokens, other JWTs signed by this server and tokens of disabled or deleted clients
+// are rejected.
+func (idp *MockIdP) ResolveToken(token string) (map[string]interface{}, error) {
+	claims, err := idp.resolveAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := idp.checkTokenClient(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (idp *MockIdP) resolveAccessToken(token string) (map[string]interface{}, error) {
+	ref, err := idp.store.GetReferenceToken(token)
+	if err != nil {
+		return idp.JWTService().ValidateAccessToken(token)
+	}
+	if time.Now().After(ref.ExpiresAt) {
+		return nil, errors.New("reference token expired")
+	}
+
+	claims := make(map[string]interface{}, len(ref.Claims))
+	for k, v := range ref.Claims {
+		claims[k] = v
+	}
+	return claims, nil
+}
+
+// ValidateIDToken returns the claims of an unexpired ID token this server issued. Its audience
+// must be a registered, enabled client.
+func (idp *MockIdP) ValidateIDToken(token string) (map[string]interface{}, error) {
+	claims, err := idp.JWTService().ValidateIDToken(token)
+	if err != nil {
+		return nil, err
+	}
+	aud, _ := claims.GetAudience()
+	if _, exists := idp.GetClient(aud[0]); !exists {
+		return nil, errors.New("ID token audience is not a registered client")
+	}
+	return claims, nil
+}
+
+// checkTokenClient rejects a token whose client has been disabled or deleted since it was issued
+func (idp *MockIdP) checkTokenClient(claims map[string]interface{}) error {
+	clientID, _ := claims["client_id"].(string)
+	if clientID == "" {
+		return nil
+	}
+	if _, exists := idp.GetClient(clientID); !exists {
+		return errors.New("client is disabled or no longer registered")
+	}
+	return nil
+}
+
+// IsReferenceToken reports whether token is an opaque access token issued by this server
+func (idp *MockIdP) IsReferenceToken(token string) bool {
+	_, err := idp.store.GetReferenceToken(token)
+	return err == nil
+}
+
+// RevokeReferenceToken deletes an opaque access token issued to clientID (RFC 7009 Section 2.1)
+func (idp *MockIdP) RevokeReferenceToken(token, clientID string) {
+	if ref, err := idp.store.GetReferenceToken(token); err == nil && ref.ClientID == clientID {
+		logStoreError("delete reference token", idp.store.DeleteReferenceToken(token))
+	}
+}
+
+// AccessTokenJTI returns the jti of an access token issued by this server, used to link it to its refresh token
+func (idp *MockIdP) AccessTokenJTI(token string) string {
+	if ref, err := idp.store.GetReferenceToken(token); err == nil {
+		jti, _ := ref.Claims["jti"].(string)
+		return jti
+	}
+
+	decoded, err := crypto.DecodeTokenWithoutValidation(token)
+	if err != nil {
+		return ""
+	}
+	jti, _ := decoded.Payload["jti"].(string)
+	return jti
+}
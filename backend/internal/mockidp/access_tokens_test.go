@@ -0,0 +1,100 @@
+package mockidp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+// signServerJWT signs claims with the provider's access token key and the given typ header
+func signServerJWT(t *testing.T, idp *MockIdP, typ string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	token.Header["kid"] = idp.KeySet().RSAKeyID()
+	signed, err := token.SignedString(idp.KeySet().RSAPrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestResolveTokenAcceptsAccessTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	token, err := idp.IssueAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "demo-app", Scope: "openid"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := idp.ResolveToken(token)
+	if err != nil {
+		t.Fatalf("ResolveToken: %v", err)
+	}
+	if claims["sub"] != "alice" {
+		t.Errorf("sub = %v, want alice", claims["sub"])
+	}
+}
+
+func TestResolveTokenRejectsOtherServerJWTs(t *testing.T) {
+	idp := newTestIdP(t)
+	jwtService := idp.JWTService()
+	idToken, err := jwtService.CreateIDToken("alice", "demo-app", "", time.Now(), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := jwtService.CreateRefreshToken("alice", "demo-app", "openid", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cases := map[string]string{
+		"id token":      idToken,
+		"refresh token": refreshToken,
+		"untyped JWT": signServerJWT(t, idp, "", jwt.MapClaims{
+			"iss": idp.GetIssuer(), "sub": "alice", "exp": now.Add(time.Hour).Unix(),
+		}),
+		"access token without exp": signServerJWT(t, idp, crypto.AccessTokenType, jwt.MapClaims{
+			"iss": idp.GetIssuer(), "sub": "alice",
+		}),
+		"expired access token": signServerJWT(t, idp, crypto.AccessTokenType, jwt.MapClaims{
+			"iss": idp.GetIssuer(), "sub": "alice", "exp": now.Add(-time.Minute).Unix(),
+		}),
+	}
+	for name, token := range cases {
+		if _, err := idp.ResolveToken(token); err == nil {
+			t.Errorf("%s resolved as an access token", name)
+		}
+	}
+}
+
+func TestResolveRefreshTokenRequiresRecord(t *testing.T) {
+	idp := newTestIdP(t)
+	token, err := idp.JWTService().CreateRefreshToken("alice", "demo-app", "openid", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idp.ResolveRefreshToken(token); err == nil {
+		t.Error("refresh token without a record resolved")
+	}
+	idp.StoreRefreshToken(token, "demo-app", "alice", "openid", "", time.Now(), time.Now().Add(time.Hour))
+	if _, err := idp.ResolveRefreshToken(token); err != nil {
+		t.Errorf("ResolveRefreshToken: %v", err)
+	}
+}
+
+func TestValidateIDTokenRequiresRegisteredAudience(t *testing.T) {
+	idp := newTestIdP(t)
+	for aud, want := range map[string]bool{"demo-app": true, "unknown-app": false} {
+		token, err := idp.JWTService().CreateIDToken("alice", aud, "", time.Now(), time.Hour, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := idp.ValidateIDToken(token); (err == nil) != want {
+			t.Errorf("aud %s: err = %v", aud, err)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package mockidp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ErrAlreadyExists is returned when creating a user or client whose ID, or a user whose email, is taken
+var ErrAlreadyExists = errors.New("already exists")
+
+// adminIdentifierPattern restricts user IDs and client IDs chosen by administrators
+var adminIdentifierPattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// CreateUser validates and stores a new user, hashing their password
+func (idp *MockIdP) CreateUser(user *models.User) error {
+	if err := validateUser(user); err != nil {
+		return err
+	}
+	if user.Password == "" {
+		return errors.New("password is required")
+	}
+	if err := idp.setPassword(user, user.Password); err != nil {
+		return err
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	if _, err := idp.store.GetUser(user.ID); err == nil {
+		return fmt.Errorf("user %s %w", user.ID, ErrAlreadyExists)
+	}
+	if err := idp.checkEmailAvailable(user); err != nil {
+		return err
+	}
+	user.CreatedAt = time.Now()
+	return idp.store.PutUser(user)
+}
+
+// UpdateUser replaces an existing user. A non-empty Password is a new password to validate
+// and hash; an empty one keeps the current password.
+func (idp *MockIdP) UpdateUser(user *models.User) error {
+	if err := validateUser(user); err != nil {
+		return err
+	}
+	if user.Password != "" {
+		if err := idp.setPassword(user, user.Password); err != nil {
+			return err
+		}
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	existing, err := idp.store.GetUser(user.ID)
+	if err != nil {
+		return err
+	}
+	if err := idp.checkEmailAvailable(user); err != nil {
+		return err
+	}
+	if user.Password == "" {
+		user.Password = existing.Password
+	}
+	user.CreatedAt = existing.CreatedAt
+	return idp.store.PutUser(user)
+}
+
+// DeleteUser removes a user. Tokens already issued stay valid until they expire.
+func (idp *MockIdP) DeleteUser(id string) error {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	return idp.store.DeleteUser(id)
+}
+
+// setPassword checks a new password against the password policy and stores its hash on user
+func (idp *MockIdP) setPassword(user *models.User, password string) error {
+	if err := DefaultPasswordPolicy.Validate(user, password); err != nil {
+		return err
+	}
+	hash, err := idp.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	return nil
+}
+
+// ListRoles returns every role held by a user, with the IDs of the users holding it
+func (idp *MockIdP) ListRoles() map[string][]string {
+	roles := make(map[string][]string)
+	for _, user := range idp.ListUsers() {
+		for _, role := range user.Roles {
+			roles[role] = append(roles[role], user.ID)
+		}
+	}
+	for _, members := range roles {
+		sort.Strings(members)
+	}
+	return roles
+}
+
+// checkEmailAvailable rejects an email address already used by another user. Caller must hold the lock.
+func (idp *MockIdP) checkEmailAvailable(user *models.User) error {
+	other, err := idp.store.GetUserByEmail(user.Email)
+	if err == nil && other.ID != user.ID {
+		return fmt.Errorf("email %s %w", user.Email, ErrAlreadyExists)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func validateUser(user *models.User) error {
+	if !adminIdentifierPattern.MatchString(user.ID) {
+		return errors.New("id must be 1-64 letters, digits or . _ @ -")
+	}
+	if !strings.Contains(user.Email, "@") {
+		return errors.New("email must be an email address")
+	}
+	if user.Name == "" {
+		user.Name = user.ID
+	}
+	if user.Roles == nil {
+		user.Roles = []string{}
+	}
+	for _, role := range user.Roles {
+		if strings.TrimSpace(role) == "" {
+			return errors.New("roles must not be empty strings")
+		}
+	}
+	for name := range user.Claims {
+		if reservedClaims[name] {
+			return fmt.Errorf("claim %s is set by the server and cannot be customized", name)
+		}
+	}
+	return nil
+}
+
+// reservedClaims are the token and identity claims custom user claims must not override
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"auth_time": true, "nonce": true, "acr": true, "amr": true, "azp": true, "sid": true,
+	"scope": true, "client_id": true, "cnf": true, "userinfo_claims": true,
+	"name": true, "email": true, "email_verified": true, "preferred_username": true, "roles": true, "groups": true,
+}
+
+// LookupClient retrieves a client by ID, including disabled clients that GetClient hides
+func (idp *MockIdP) LookupClient(id string) (*models.Client, bool) {
+	client, err := idp.store.GetClient(id)
+	logStoreError("get client", err)
+	return client, err == nil
+}
+
+// CreateClient validates and stores a new client. A confidential client that authenticates
+// with a secret and has none is given a generated one.
+func (idp *MockIdP) CreateClient(client *models.Client) error {
+	if err := validateAdminClient(client, nil); err != nil {
+		return err
+	}
+	if err := idp.checkSectorIdentifierURI(client.SectorIdentifierURI, client.RedirectURIs); err != nil {
+		return err
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	if _, err := idp.store.GetClient(client.ID); err == nil {
+		return fmt.Errorf("client %s %w", client.ID, ErrAlreadyExists)
+	}
+	if client.Public {
+		client.Secret = ""
+	} else if client.Secret == "" && UsesClientSecret(client.TokenEndpointAuthMethod) {
+		client.Secret = generateRandomString(48)
+	}
+	client.CreatedAt = time.Now()
+	return idp.store.PutClient(client)
+}
+
+// UpdateClient replaces an existing client, keeping its secret and registration. A client made
+// confidential is given a secret. Settings the admin API cannot create, such as key-based
+// authentication or the device grant, are accepted as long as they are unchanged, so a
+// registered or demo client can still be renamed or disabled.
+func (idp *MockIdP) UpdateClient(client *models.Client) error {
+	current, exists := idp.LookupClient(client.ID)
+	if !exists {
+		return ErrNotFound
+	}
+	if err := validateAdminClient(client, current); err != nil {
+		return err
+	}
+	if client.SectorIdentifierURI != current.SectorIdentifierURI || !slices.Equal(client.RedirectURIs, current.RedirectURIs) {
+		if err := idp.checkSectorIdentifierURI(client.SectorIdentifierURI, client.RedirectURIs); err != nil {
+			return err
+		}
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	existing, err := idp.store.GetClient(client.ID)
+	if err != nil {
+		return err
+	}
+	client.Secret = existing.Secret
+	if client.Public {
+		client.Secret = ""
+	} else if client.Secret == "" && UsesClientSecret(client.TokenEndpointAuthMethod) {
+		client.Secret = generateRandomString(48)
+	}
+	client.Registration = existing.Registration
+	client.RegistrationAccessToken = existing.RegistrationAccessToken
+	client.CreatedAt = existing.CreatedAt
+	return idp.store.PutClient(client)
+}
+
+// DeleteClient removes a client and its refresh and reference tokens
+func (idp *MockIdP) DeleteClient(id string) error {
+	if _, exists := idp.LookupClient(id); !exists {
+		return ErrNotFound
+	}
+	idp.DeleteClientRegistration(id)
+	return nil
+}
+
+// RotateClientSecret replaces a confidential client's secret and returns the new one. The old
+// secret stops working immediately.
+func (idp *MockIdP) RotateClientSecret(id string) (string, error) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	client, err := idp.store.GetClient(id)
+	if err != nil {
+		return "", err
+	}
+	if client.Public {
+		return "", errors.New("public clients have no secret")
+	}
+	client.Secret = generateRandomString(48)
+	if err := idp.store.PutClient(client); err != nil {
+		return "", err
+	}
+	return client.Secret, nil
+}
+
+// validateAdminClient checks a client created or updated through the admin API. existing is the
+// stored client on update and nil on create; values it already has are not re-validated.
+func validateAdminClient(client, existing *models.Client) error {
+	if !adminIdentifierPattern.MatchString(client.ID) {
+		return errors.New("client_id must be 1-64 letters, digits or . _ @ -")
+	}
+	if client.Name == "" {
+		client.Name = client.ID
+	}
+	if client.ApplicationType != "" && client.ApplicationType != "web" && client.ApplicationType != ApplicationTypeNative {
+		return errors.New("application_type must be web or native")
+	}
+
+	switch client.TokenEndpointAuthMethod {
+	case "", AuthMethodClientSecretBasic, AuthMethodClientSecretPost, AuthMethodClientSecretJWT:
+		if client.Public && client.TokenEndpointAuthMethod != "" {
+			return errors.New("public clients must use token_endpoint_auth_method none")
+		}
+	case AuthMethodNone:
+		if !client.Public {
+			return errors.New("token_endpoint_auth_method none is only for public clients")
+		}
+	default:
+		keeps := existing != nil && existing.TokenEndpointAuthMethod == client.TokenEndpointAuthMethod && existing.Public == client.Public
+		if !keeps {
+			return fmt.Errorf("token_endpoint_auth_method %q needs keys or certificates; use dynamic registration instead", client.TokenEndpointAuthMethod)
+		}
+	}
+
+	hadGrant, hadRedirectURI := map[string]bool{}, map[string]bool{}
+	if existing != nil {
+		for _, gt := range existing.GrantTypes {
+			hadGrant[gt] = true
+		}
+		for _, uri := range existing.RedirectURIs {
+			hadRedirectURI[uri] = true
+		}
+	}
+
+	if len(client.GrantTypes) == 0 {
+		return errors.New("grant_types is required")
+	}
+	grants := make(map[string]bool)
+	for _, gt := range client.GrantTypes {
+		if !registrableGrantTypes[gt] && !hadGrant[gt] {
+			return fmt.Errorf("unsupported grant_type %q", gt)
+		}
+		grants[gt] = true
+	}
+	if client.Public && (grants["client_credentials"] || grants["urn:ietf:params:oauth:grant-type:token-exchange"]) {
+		return errors.New("public clients cannot use the client_credentials or token-exchange grants")
+	}
+
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+	if (grants["authorization_code"] || grants["implicit"]) && len(client.RedirectURIs) == 0 {
+		return errors.New("redirect_uris is required for redirect-based grant types")
+	}
+	for _, uri := range client.RedirectURIs {
+		if hadRedirectURI[uri] {
+			continue
+		}
+		if err := validateRegisteredRedirectURI(uri, client.ApplicationType); err != nil {
+			return fmt.Errorf("redirect_uri %s: %w", uri, err)
+		}
+	}
+
+	if err := validateSubjectType(client.SubjectType, client.SectorIdentifierURI, client.RedirectURIs); err != nil {
+		return err
+	}
+	if err := validateResponseAlgorithms(client); err != nil {
+		return err
+	}
+
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+	for _, scope := range client.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \"\\") {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+	return nil
+}
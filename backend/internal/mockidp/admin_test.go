@@ -0,0 +1,76 @@
+package mockidp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+func TestUpdateClientKeepsSettingsAdminCannotCreate(t *testing.T) {
+	idp := newTestIdP(t)
+
+	// Every demo client, whatever its authentication method or grants, can be disabled
+	for _, client := range idp.ListClients() {
+		update := *client
+		update.Disabled = true
+		if err := idp.UpdateClient(&update); err != nil {
+			t.Errorf("%s: disabling failed: %v", client.ID, err)
+		}
+	}
+
+	// Switching to key-based authentication still needs dynamic registration
+	demo, _ := idp.LookupClient("demo-app")
+	update := *demo
+	update.TokenEndpointAuthMethod = AuthMethodPrivateKeyJWT
+	if err := idp.UpdateClient(&update); err == nil {
+		t.Error("demo-app switched to private_key_jwt through the admin API")
+	}
+	update = *demo
+	update.GrantTypes = append(update.GrantTypes, "password")
+	if err := idp.UpdateClient(&update); err == nil {
+		t.Error("password grant added through the admin API")
+	}
+}
+
+func TestTokensOfDisabledClientsAreRejected(t *testing.T) {
+	idp := newTestIdP(t)
+	token, err := idp.IssueAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "demo-app", Scope: "openid"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := idp.JWTService().CreateRefreshToken("alice", "demo-app", "openid", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.StoreRefreshToken(refresh, "demo-app", "alice", "openid", "", time.Now(), time.Now().Add(time.Hour))
+
+	setDisabled := func(disabled bool) {
+		client, _ := idp.LookupClient("demo-app")
+		update := *client
+		update.Disabled = disabled
+		if err := idp.UpdateClient(&update); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setDisabled(true)
+	if _, err := idp.ResolveToken(token); err == nil {
+		t.Error("access token of a disabled client resolved")
+	}
+	if _, err := idp.ResolveRefreshToken(refresh); err == nil {
+		t.Error("refresh token of a disabled client resolved")
+	}
+
+	setDisabled(false)
+	if _, err := idp.ResolveToken(token); err != nil {
+		t.Errorf("access token of a re-enabled client rejected: %v", err)
+	}
+
+	if err := idp.DeleteClient("demo-app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idp.ResolveToken(token); err == nil {
+		t.Error("access token of a deleted client resolved")
+	}
+}
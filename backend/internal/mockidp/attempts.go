@@ -0,0 +1,86 @@
+package mockidp
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter counts failed attempts per key, such as a client address or an account, within
+// a sliding window. It guards guessable secrets like user codes and passwords against brute force.
+type attemptLimiter struct {
+	limit    int
+	window   time.Duration
+	mu       sync.Mutex
+	attempts map[string][]time.Time // key -> times of recent attempts
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{limit: limit, window: window, attempts: make(map[string][]time.Time)}
+}
+
+// Allow records an attempt for key and reports whether it is within the limit. Checking and
+// recording happen under one lock, so parallel attempts cannot all slip under the limit.
+func (l *attemptLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recent := l.recent(key, time.Now())
+	if len(recent) >= l.limit {
+		l.attempts[key] = recent
+		return false
+	}
+	l.attempts[key] = append(recent, time.Now())
+	return true
+}
+
+// Exceeded reports whether key has used up its attempts, without recording one
+func (l *attemptLimiter) Exceeded(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.recent(key, time.Now())) >= l.limit
+}
+
+// Reset forgets the attempts of key
+func (l *attemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// RetryAt returns when key may attempt again, or the zero time if it has attempts left
+func (l *attemptLimiter) RetryAt(key string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recent := l.recent(key, time.Now())
+	if len(recent) < l.limit {
+		return time.Time{}
+	}
+	return recent[len(recent)-l.limit].Add(l.window)
+}
+
+// Prune forgets every attempt that has left the window, so keys seen once do not pile up
+func (l *attemptLimiter) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key := range l.attempts {
+		if recent := l.recent(key, now); recent != nil {
+			l.attempts[key] = recent
+		}
+	}
+}
+
+// recent returns the attempts of key inside the window. Caller must hold the lock.
+func (l *attemptLimiter) recent(key string, now time.Time) []time.Time {
+	cutoff := now.Add(-l.window)
+	kept := l.attempts[key][:0]
+	for _, t := range l.attempts[key] {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == 0 {
+		delete(l.attempts, key)
+		return nil
+	}
+	return kept
+}
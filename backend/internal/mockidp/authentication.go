@@ -0,0 +1,84 @@
+package mockidp
+
+import (
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// Authentication context classes, from the lowest to the highest assurance level
+const (
+	// ACRPassword is the authentication context class of a username and password login
+	ACRPassword = "urn:protocolsoup:acr:password"
+	// ACRMultiFactor is a password login confirmed with a one-time code
+	ACRMultiFactor = "urn:protocolsoup:acr:mfa"
+)
+
+// ACRValues lists the supported authentication context classes in increasing order of assurance
+var ACRValues = []string{ACRPassword, ACRMultiFactor}
+
+// ErrorInsufficientUserAuthentication is returned by a resource server when the access token
+// reflects a weaker or older authentication than the resource requires (RFC 9470 Section 3)
+const ErrorInsufficientUserAuthentication = "insufficient_user_authentication"
+
+// DemoOneTimeCode is the one-time code accepted as every user's second factor. It is public and
+// never changes, so the mfa class it grants demonstrates the flow but proves nothing; a
+// deployment that needs real step-up must register a CredentialVerifier of its own instead.
+const DemoOneTimeCode = "123456"
+
+// Authentication describes when and how a user authenticated
+type Authentication struct {
+	Time time.Time
+	ACR  string
+	AMR  []string
+	// SessionID is the session the user authenticated in, released as the sid claim; empty for
+	// grants made without a session
+	SessionID string
+}
+
+// ACRLevel returns the assurance level of an acr value, or 0 if it is not supported
+func ACRLevel(acr string) int {
+	for i, value := range ACRValues {
+		if value == acr {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// SelectACR chooses the authentication context class for acr_values, which are listed in
+// order of preference (OIDC Core Section 3.1.2.1). Unsupported values are skipped, and a
+// password login is used when none of them is supported.
+func SelectACR(acrValues []string) string {
+	for _, acr := range acrValues {
+		if ACRLevel(acr) > 0 {
+			return acr
+		}
+	}
+	return ACRPassword
+}
+
+// SetAuthorizationCodeSession records the session in which the user authenticated for a code
+func (idp *MockIdP) SetAuthorizationCodeSession(code, sessionID string) {
+	idp.updateAuthorizationCode(code, func(authCode *models.AuthorizationCode) {
+		authCode.SessionID = sessionID
+	})
+}
+
+// SessionAuthentication returns how the user authenticated in a session. Grants made without
+// a session are treated as a password login at fallback.
+func (idp *MockIdP) SessionAuthentication(sessionID string, fallback time.Time) Authentication {
+	if session, exists := idp.GetSession(sessionID); exists {
+		return Authentication{Time: session.AuthTime, ACR: session.ACR, AMR: session.AMR, SessionID: session.ID}
+	}
+	return Authentication{Time: fallback, ACR: ACRPassword, AMR: idp.AMRForACR(ACRPassword)}
+}
+
+// SetRefreshTokenAuthentication records the authentication a refresh token's grant was made with
+func (idp *MockIdP) SetRefreshTokenAuthentication(token string, auth Authentication) {
+	idp.updateRefreshToken(token, func(rt *models.RefreshToken) {
+		rt.ACR = auth.ACR
+		rt.AMR = auth.AMR
+		rt.SessionID = auth.SessionID
+	})
+}
@@ -0,0 +1,365 @@
+package mockidp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ErrorInvalidAuthorizationDetails is the error code for rejected authorization_details (RFC 9396 Section 5)
+const ErrorInvalidAuthorizationDetails = "invalid_authorization_details"
+
+// builtinAuthorizationDetailsTypes are the JSON schemas of the authorization details types known at startup
+var builtinAuthorizationDetailsTypes = map[string]string{
+	// Payment initiation, modelled on RFC 9396 Section 2
+	"payment_initiation": `{
+		"type": "object",
+		"required": ["type", "instructedAmount", "creditorName", "creditorAccount"],
+		"properties": {
+			"type": {"type": "string"},
+			"actions": {"type": "array", "minItems": 1, "items": {"type": "string", "enum": ["initiate", "status", "cancel"]}},
+			"locations": {"type": "array", "items": {"type": "string"}},
+			"instructedAmount": {
+				"type": "object",
+				"required": ["currency", "amount"],
+				"properties": {
+					"currency": {"type": "string", "pattern": "^[A-Z]{3}$"},
+					"amount": {"type": "string", "pattern": "^[0-9]+(\\.[0-9]{1,2})?$"}
+				},
+				"additionalProperties": false
+			},
+			"creditorName": {"type": "string", "minLength": 1, "maxLength": 140},
+			"creditorAccount": {
+				"type": "object",
+				"required": ["iban"],
+				"properties": {
+					"iban": {"type": "string", "pattern": "^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$"}
+				},
+				"additionalProperties": false
+			},
+			"remittanceInformationUnstructured": {"type": "string", "maxLength": 140}
+		},
+		"additionalProperties": false
+	}`,
+	// Read access to accounts, balances and transactions
+	"account_information": `{
+		"type": "object",
+		"required": ["type", "actions"],
+		"properties": {
+			"type": {"type": "string"},
+			"actions": {"type": "array", "minItems": 1, "items": {"type": "string", "enum": ["list_accounts", "read_balances", "read_transactions"]}},
+			"locations": {"type": "array", "items": {"type": "string"}},
+			"identifier": {"type": "string"},
+			"datatypes": {"type": "array", "items": {"type": "string"}}
+		},
+		"additionalProperties": false
+	}`,
+}
+
+// commonAuthorizationDetailsFields are the fields every type may use, all arrays of strings
+// except identifier (RFC 9396 Section 2.2)
+var commonAuthorizationDetailsFields = []string{"locations", "actions", "datatypes", "privileges"}
+
+// RegisterAuthorizationDetailsType adds or replaces the JSON schema that validates a type
+func (idp *MockIdP) RegisterAuthorizationDetailsType(detailType string, schema []byte) error {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(schema, &parsed); err != nil {
+		return fmt.Errorf("invalid schema for %s: %w", detailType, err)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	idp.authorizationDetailsTypes[detailType] = parsed
+	return nil
+}
+
+// AuthorizationDetailsTypes returns the registered authorization details types, sorted
+func (idp *MockIdP) AuthorizationDetailsTypes() []string {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	types := make([]string, 0, len(idp.authorizationDetailsTypes))
+	for t := range idp.authorizationDetailsTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ParseAuthorizationDetails parses an authorization_details parameter and validates every entry
+// against the schema of its type and the types the client is registered for
+func (idp *MockIdP) ParseAuthorizationDetails(clientID, raw string) ([]map[string]interface{}, error) {
+	var details []map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &details); err != nil {
+		return nil, errors.New("authorization_details must be a JSON array of objects")
+	}
+	if len(details) == 0 {
+		return nil, errors.New("authorization_details must not be empty")
+	}
+
+	client, exists := idp.GetClient(clientID)
+	if !exists {
+		return nil, errors.New("unknown client")
+	}
+	allowed := make(map[string]bool)
+	for _, t := range client.AuthorizationDetailsTypes {
+		allowed[t] = true
+	}
+
+	for i, detail := range details {
+		detailType, _ := detail["type"].(string)
+		if detailType == "" {
+			return nil, fmt.Errorf("authorization_details[%d]: type is required", i)
+		}
+		if !allowed[detailType] {
+			return nil, fmt.Errorf("authorization_details[%d]: client is not authorized for type %q", i, detailType)
+		}
+
+		idp.mu.RLock()
+		schema, known := idp.authorizationDetailsTypes[detailType]
+		idp.mu.RUnlock()
+		if !known {
+			return nil, fmt.Errorf("authorization_details[%d]: unknown type %q", i, detailType)
+		}
+
+		if err := validateCommonAuthorizationDetailsFields(detail); err != nil {
+			return nil, fmt.Errorf("authorization_details[%d]: %v", i, err)
+		}
+		if err := validateJSONSchema(detail, schema, "$"); err != nil {
+			return nil, fmt.Errorf("authorization_details[%d] (%s): %v", i, detailType, err)
+		}
+	}
+
+	return details, nil
+}
+
+// AuthorizationDetailsCovered reports whether every requested detail is contained in a granted
+// detail of the same type, so a token request can narrow but never widen the grant (RFC 9396 Section 6.1)
+func AuthorizationDetailsCovered(requested, granted []map[string]interface{}) bool {
+	for _, req := range requested {
+		covered := false
+		for _, grant := range granted {
+			if req["type"] == grant["type"] && valueContained(req, grant) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// GrantAuthorizationDetails records the authorization details the user consented to on an authorization code
+func (idp *MockIdP) GrantAuthorizationDetails(code string, details []map[string]interface{}) {
+	idp.updateAuthorizationCode(code, func(authCode *models.AuthorizationCode) {
+		authCode.AuthorizationDetails = details
+	})
+}
+
+// SetRefreshTokenAuthorizationDetails records the authorization details granted with a refresh token
+func (idp *MockIdP) SetRefreshTokenAuthorizationDetails(token string, details []map[string]interface{}) {
+	idp.updateRefreshToken(token, func(rt *models.RefreshToken) {
+		rt.AuthorizationDetails = details
+	})
+}
+
+// loadBuiltinAuthorizationDetailsTypes parses the built-in schemas. Caller must hold the lock.
+func (idp *MockIdP) loadBuiltinAuthorizationDetailsTypes() {
+	for detailType, schema := range builtinAuthorizationDetailsTypes {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(schema), &parsed); err != nil {
+			panic(fmt.Sprintf("invalid built-in schema for %s: %v", detailType, err))
+		}
+		idp.authorizationDetailsTypes[detailType] = parsed
+	}
+}
+
+// checkAuthorizationDetailsTypes checks that registered client metadata names only known types
+func (idp *MockIdP) checkAuthorizationDetailsTypes(types []string) error {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	for _, t := range types {
+		if _, known := idp.authorizationDetailsTypes[t]; !known {
+			return metadataError("unsupported authorization_details_types value %q", t)
+		}
+	}
+	return nil
+}
+
+// validateCommonAuthorizationDetailsFields checks the shape of the fields shared by all types
+func validateCommonAuthorizationDetailsFields(detail map[string]interface{}) error {
+	for _, field := range commonAuthorizationDetailsFields {
+		value, present := detail[field]
+		if !present {
+			continue
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array of strings", field)
+		}
+		for _, item := range items {
+			if _, ok := item.(string); !ok {
+				return fmt.Errorf("%s must be an array of strings", field)
+			}
+		}
+	}
+	if identifier, present := detail["identifier"]; present {
+		if _, ok := identifier.(string); !ok {
+			return errors.New("identifier must be a string")
+		}
+	}
+	return nil
+}
+
+// validateJSONSchema validates a decoded JSON value against the subset of JSON Schema used by
+// the registry: type, enum, required, properties, additionalProperties, items, minItems,
+// minLength, maxLength, pattern, minimum and maximum
+func validateJSONSchema(value interface{}, schema map[string]interface{}, path string) error {
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		match := false
+		for _, allowed := range enum {
+			match = match || reflect.DeepEqual(value, allowed)
+		}
+		if !match {
+			return fmt.Errorf("%s: value is not one of the allowed values", path)
+		}
+	}
+
+	schemaType, _ := schema["type"].(string)
+	switch schemaType {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, _ := name.(string); key != "" {
+					if _, present := obj[key]; !present {
+						return fmt.Errorf("%s.%s: is required", path, key)
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, child := range obj {
+			if propSchema, ok := properties[key].(map[string]interface{}); ok {
+				if err := validateJSONSchema(child, propSchema, path+"."+key); err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s.%s: property is not allowed", path, key)
+				}
+			case map[string]interface{}:
+				if err := validateJSONSchema(child, additional, path+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(items)) < minItems {
+			return fmt.Errorf("%s: must contain at least %d items", path, int(minItems))
+		}
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range items {
+				if err := validateJSONSchema(item, itemSchema, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len(s)) < minLength {
+			return fmt.Errorf("%s: must be at least %d characters", path, int(minLength))
+		}
+		if maxLength, ok := schema["maxLength"].(float64); ok && float64(len(s)) > maxLength {
+			return fmt.Errorf("%s: must be at most %d characters", path, int(maxLength))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: invalid schema pattern: %v", path, err)
+			}
+			if !re.MatchString(s) {
+				return fmt.Errorf("%s: does not match pattern %s", path, pattern)
+			}
+		}
+	case "number", "integer":
+		n, ok := value.(float64)
+		if !ok || (schemaType == "integer" && n != float64(int64(n))) {
+			return fmt.Errorf("%s: expected %s", path, schemaType)
+		}
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			return fmt.Errorf("%s: must be at least %v", path, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			return fmt.Errorf("%s: must be at most %v", path, maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	}
+
+	return nil
+}
+
+// valueContained reports whether requested is equal to or narrower than granted. Objects must
+// keep every field of the grant, since a field left out would no longer restrict anything; only
+// arrays may omit elements, and never all of them.
+func valueContained(requested, granted interface{}) bool {
+	switch req := requested.(type) {
+	case map[string]interface{}:
+		grant, ok := granted.(map[string]interface{})
+		if !ok || len(req) != len(grant) {
+			return false
+		}
+		for key, value := range req {
+			grantValue, present := grant[key]
+			if !present || !valueContained(value, grantValue) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		grant, ok := granted.([]interface{})
+		if !ok || (len(req) == 0 && len(grant) > 0) {
+			return false
+		}
+		for _, item := range req {
+			found := false
+			for _, grantItem := range grant {
+				if reflect.DeepEqual(item, grantItem) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(requested, granted)
+	}
+}
@@ -0,0 +1,43 @@
+package mockidp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func parseDetails(t *testing.T, raw string) []map[string]interface{} {
+	t.Helper()
+	var details []map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &details); err != nil {
+		t.Fatal(err)
+	}
+	return details
+}
+
+func TestAuthorizationDetailsCoveredOnlyNarrows(t *testing.T) {
+	granted := parseDetails(t, `[{"type":"account_information","actions":["list_accounts","read_balances"],"identifier":"acct-1","locations":["https://bank.example/accounts"]}]`)
+
+	covered := map[string]string{
+		"same grant":    `[{"type":"account_information","actions":["list_accounts","read_balances"],"identifier":"acct-1","locations":["https://bank.example/accounts"]}]`,
+		"fewer actions": `[{"type":"account_information","actions":["read_balances"],"identifier":"acct-1","locations":["https://bank.example/accounts"]}]`,
+	}
+	for name, raw := range covered {
+		if !AuthorizationDetailsCovered(parseDetails(t, raw), granted) {
+			t.Errorf("%s: not covered", name)
+		}
+	}
+
+	widened := map[string]string{
+		"identifier dropped": `[{"type":"account_information","actions":["read_balances"],"locations":["https://bank.example/accounts"]}]`,
+		"locations dropped":  `[{"type":"account_information","actions":["read_balances"],"identifier":"acct-1"}]`,
+		"no actions":         `[{"type":"account_information","actions":[],"identifier":"acct-1","locations":["https://bank.example/accounts"]}]`,
+		"other identifier":   `[{"type":"account_information","actions":["read_balances"],"identifier":"acct-2","locations":["https://bank.example/accounts"]}]`,
+		"added action":       `[{"type":"account_information","actions":["read_transactions"],"identifier":"acct-1","locations":["https://bank.example/accounts"]}]`,
+		"added field":        `[{"type":"account_information","actions":["read_balances"],"identifier":"acct-1","locations":["https://bank.example/accounts"],"datatypes":["balance"]}]`,
+	}
+	for name, raw := range widened {
+		if AuthorizationDetailsCovered(parseDetails(t, raw), granted) {
+			t.Errorf("%s: reported as covered", name)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package mockidp
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// CIBA token delivery modes (OpenID CIBA Core 1.0 Section 5)
+const (
+	DeliveryModePoll = "poll"
+	DeliveryModePing = "ping"
+	DeliveryModePush = "push"
+)
+
+// GrantTypeCIBA is the grant type used to redeem an auth_req_id at the token endpoint (OpenID CIBA Core 1.0 Section 10.1)
+const GrantTypeCIBA = "urn:openid:params:grant-type:ciba"
+
+// SupportedDeliveryModes lists the backchannel token delivery modes the provider implements
+var SupportedDeliveryModes = []string{DeliveryModePoll, DeliveryModePing, DeliveryModePush}
+
+const (
+	// backchannelRequestLifetime is the default and maximum lifetime of an auth_req_id
+	backchannelRequestLifetime = 5 * time.Minute
+	// backchannelPollInterval is the minimum polling interval in seconds for poll mode clients
+	backchannelPollInterval = 5
+)
+
+// ResolveLoginHint finds the user identified by a login_hint, which may be an email address or user ID
+func (idp *MockIdP) ResolveLoginHint(hint string) (*models.User, error) {
+	if user, exists := idp.GetUserByEmail(hint); exists {
+		return user, nil
+	}
+	if user, exists := idp.GetUser(hint); exists {
+		return user, nil
+	}
+	return nil, errors.New("login_hint does not identify a known user")
+}
+
+// UserFromIDTokenHint finds the user identified by an ID token this provider issued, verified as
+// ParseIDTokenHint does. A recently expired token is still accepted, since the hint only names
+// the user and does not authenticate them (OpenID Connect Core 1.0 Section 3.1.2.1).
+func (idp *MockIdP) UserFromIDTokenHint(hint string) (*models.User, error) {
+	parsed, err := idp.ParseIDTokenHint(hint)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.User, nil
+}
+
+// SetBackchannelClientNotificationEndpoint sets where ping and push results are delivered for a client
+func (idp *MockIdP) SetBackchannelClientNotificationEndpoint(clientID, endpoint string) {
+	idp.updateClient(clientID, func(client *models.Client) {
+		client.BackchannelClientNotificationEndpoint = endpoint
+	})
+}
+
+// CreateBackchannelAuthentication stores a new CIBA authentication request. The caller fills in the
+// client, user, scope and delivery details; the auth_req_id, status and timestamps are assigned here.
+// A requestedExpiry of zero, or one beyond the maximum lifetime, uses the maximum.
+func (idp *MockIdP) CreateBackchannelAuthentication(req *models.BackchannelAuthentication, requestedExpiry time.Duration) *models.BackchannelAuthentication {
+	lifetime := backchannelRequestLifetime
+	if requestedExpiry > 0 && requestedExpiry < lifetime {
+		lifetime = requestedExpiry
+	}
+
+	now := time.Now()
+	req.AuthReqID = generateRandomString(32)
+	req.Status = models.DeviceStatusPending
+	req.ExpiresAt = now.Add(lifetime)
+	req.CreatedAt = now
+	if req.DeliveryMode == DeliveryModePoll {
+		req.Interval = backchannelPollInterval
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	for id, existing := range idp.backchannelRequests {
+		if existing.ExpiresAt.Before(now) {
+			delete(idp.backchannelRequests, id)
+		}
+	}
+	idp.backchannelRequests[req.AuthReqID] = req
+	return req
+}
+
+// GetBackchannelAuthentication looks up a CIBA authentication request by its auth_req_id
+func (idp *MockIdP) GetBackchannelAuthentication(authReqID string) (*models.BackchannelAuthentication, bool) {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	req, exists := idp.backchannelRequests[authReqID]
+	return req, exists
+}
+
+// ListPendingBackchannelAuthentications returns the unexpired requests awaiting a decision on the
+// authentication device, oldest first. An empty userID lists the requests of every user.
+func (idp *MockIdP) ListPendingBackchannelAuthentications(userID string) []*models.BackchannelAuthentication {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	now := time.Now()
+	pending := make([]*models.BackchannelAuthentication, 0)
+	for _, req := range idp.backchannelRequests {
+		if req.Status != models.DeviceStatusPending || req.ExpiresAt.Before(now) {
+			continue
+		}
+		if userID == "" || req.UserID == userID {
+			pending = append(pending, req)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	return pending
+}
+
+// ApproveBackchannelAuthentication records that the user approved a request on their authentication device
+func (idp *MockIdP) ApproveBackchannelAuthentication(authReqID, userID string) (*models.BackchannelAuthentication, error) {
+	return idp.completeBackchannelAuthentication(authReqID, userID, models.DeviceStatusApproved)
+}
+
+// DenyBackchannelAuthentication records that the user denied a request on their authentication device
+func (idp *MockIdP) DenyBackchannelAuthentication(authReqID, userID string) (*models.BackchannelAuthentication, error) {
+	return idp.completeBackchannelAuthentication(authReqID, userID, models.DeviceStatusDenied)
+}
+
+func (idp *MockIdP) completeBackchannelAuthentication(authReqID, userID, status string) (*models.BackchannelAuthentication, error) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	req, exists := idp.backchannelRequests[authReqID]
+	if !exists {
+		return nil, errors.New("unknown auth_req_id")
+	}
+	if req.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("authentication request expired")
+	}
+	// Only the user the request was addressed to can answer it
+	if req.UserID != userID {
+		return nil, errors.New("authentication request belongs to another user")
+	}
+	if req.Status != models.DeviceStatusPending {
+		return nil, errors.New("authentication request already completed")
+	}
+
+	req.Status = status
+	if status == models.DeviceStatusApproved {
+		req.AuthTime = time.Now()
+	}
+	return req, nil
+}
+
+// PollBackchannelAuthentication is called by the token endpoint for each CIBA grant request. It
+// reuses the device flow polling errors, which CIBA shares (OpenID CIBA Core 1.0 Section 11).
+// The returned request is non-nil for pending and slow_down results so callers can report the
+// current polling interval.
+func (idp *MockIdP) PollBackchannelAuthentication(authReqID, clientID string) (*models.BackchannelAuthentication, error) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	req, exists := idp.backchannelRequests[authReqID]
+	if !exists {
+		return nil, errors.New("invalid auth_req_id")
+	}
+	if req.ClientID != clientID {
+		return nil, errors.New("client ID mismatch")
+	}
+
+	now := time.Now()
+	if req.ExpiresAt.Before(now) {
+		delete(idp.backchannelRequests, authReqID)
+		return nil, ErrExpiredToken
+	}
+
+	// Only poll mode clients are held to the interval; ping clients fetch once when notified
+	if req.Interval > 0 && !req.LastPolledAt.IsZero() && now.Sub(req.LastPolledAt) < time.Duration(req.Interval)*time.Second {
+		req.Interval += 5
+		req.LastPolledAt = now
+		return req, ErrSlowDown
+	}
+	req.LastPolledAt = now
+
+	switch req.Status {
+	case models.DeviceStatusApproved:
+		// auth_req_id is single use once tokens are issued
+		delete(idp.backchannelRequests, authReqID)
+		return req, nil
+	case models.DeviceStatusDenied:
+		delete(idp.backchannelRequests, authReqID)
+		return nil, ErrAccessDenied
+	default:
+		return req, ErrAuthorizationPending
+	}
+}
+
+// DeleteBackchannelAuthentication removes a request once its result has been pushed to the client
+func (idp *MockIdP) DeleteBackchannelAuthentication(authReqID string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	delete(idp.backchannelRequests, authReqID)
+}
@@ -0,0 +1,190 @@
+package mockidp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ClaimRequest asks for an individual claim (OIDC Core Section 5.5.1). A null request in the
+// claims parameter is decoded as a nil *ClaimRequest and asks for the claim in the default manner.
+type ClaimRequest struct {
+	// Essential marks a claim the client needs for the user's task to go smoothly
+	Essential bool `json:"essential,omitempty"`
+	// Value and Values ask for the claim only with that value or one of those values
+	Value  interface{}   `json:"value,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+}
+
+// ClaimsRequest is the claims request parameter, naming the claims released in the ID token
+// and at the UserInfo endpoint in addition to those of the requested scopes (OIDC Core Section 5.5)
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+// ParseClaimsRequest parses the claims request parameter; an empty parameter requests nothing
+func ParseClaimsRequest(raw string) (*ClaimsRequest, error) {
+	request := &ClaimsRequest{}
+	if raw == "" {
+		return request, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return nil, fmt.Errorf("claims must be a JSON object with userinfo and id_token members: %w", err)
+	}
+	for _, member := range []map[string]*ClaimRequest{request.UserInfo, request.IDToken} {
+		for name, claim := range member {
+			if claim != nil && claim.Value != nil && len(claim.Values) > 0 {
+				return nil, errors.New("claim " + name + " must not have both value and values")
+			}
+		}
+	}
+	return request, nil
+}
+
+// ParseClaimsRequestMember parses one member of the claims request, such as the userinfo
+// member carried by an access token
+func ParseClaimsRequestMember(raw string) (map[string]*ClaimRequest, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	member := make(map[string]*ClaimRequest)
+	if err := json.Unmarshal([]byte(raw), &member); err != nil {
+		return nil, fmt.Errorf("invalid claims request: %w", err)
+	}
+	return member, nil
+}
+
+// EncodeClaimsRequestMember encodes one member of the claims request, or returns "" when it is empty
+func EncodeClaimsRequestMember(member map[string]*ClaimRequest) string {
+	if len(member) == 0 {
+		return ""
+	}
+	encoded, err := json.Marshal(member)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// RequestedACRValues returns the acr values an id_token acr claim request asks for, which
+// select the authentication context class like acr_values (OIDC Core Section 5.5.1.1)
+func (c *ClaimsRequest) RequestedACRValues() []string {
+	claim := c.IDToken["acr"]
+	if claim == nil {
+		return nil
+	}
+	values := make([]string, 0, len(claim.Values)+1)
+	if acr, ok := claim.Value.(string); ok {
+		values = append(values, acr)
+	}
+	for _, value := range claim.Values {
+		if acr, ok := value.(string); ok {
+			values = append(values, acr)
+		}
+	}
+	return values
+}
+
+// RequestedSubject returns the sub an id_token sub claim request is constrained to, or ""
+func (c *ClaimsRequest) RequestedSubject() string {
+	if claim := c.IDToken["sub"]; claim != nil {
+		sub, _ := claim.Value.(string)
+		return sub
+	}
+	return ""
+}
+
+// Matches reports whether a claim value satisfies the value or values of the request
+func (c *ClaimRequest) Matches(value interface{}) bool {
+	if c == nil || (c.Value == nil && len(c.Values) == 0) {
+		return true
+	}
+	if c.Value != nil {
+		return claimValuesEqual(c.Value, value)
+	}
+	for _, candidate := range c.Values {
+		if claimValuesEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// claimValuesEqual compares claim values by their JSON encoding, so numbers decoded from the
+// request compare equal to the integers stored for the user
+func claimValuesEqual(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// UnmetEssentialClaims lists the essential claims of a request that are missing from claims
+// or released with a value other than the one requested, sorted by name. Unmet essential claims
+// are not an error; the client decides whether it can continue without them.
+func UnmetEssentialClaims(requested map[string]*ClaimRequest, claims map[string]interface{}) []string {
+	unmet := make([]string, 0)
+	for name, claim := range requested {
+		if claim == nil || !claim.Essential {
+			continue
+		}
+		value, exists := claims[name]
+		if !exists || !claim.Matches(value) {
+			unmet = append(unmet, name)
+		}
+	}
+	sort.Strings(unmet)
+	return unmet
+}
+
+// SetAuthorizationCodeClaimsRequest records the claims request parameter of a code's authorization request
+func (idp *MockIdP) SetAuthorizationCodeClaimsRequest(code, claimsRequest string) {
+	idp.updateAuthorizationCode(code, func(authCode *models.AuthorizationCode) {
+		authCode.ClaimsRequest = claimsRequest
+	})
+}
+
+// SetRefreshTokenClaimsRequest records the claims request parameter of a refresh token's grant
+func (idp *MockIdP) SetRefreshTokenClaimsRequest(token, claimsRequest string) {
+	idp.updateRefreshToken(token, func(rt *models.RefreshToken) {
+		rt.ClaimsRequest = claimsRequest
+	})
+}
+
+// userClaim resolves an individually requested claim of a user. Standard claims are derived
+// from the user record and anything else from the user's custom claims.
+func userClaim(user *models.User, name string) (interface{}, bool) {
+	switch name {
+	case "sub":
+		return user.ID, true
+	case "name":
+		return user.Name, user.Name != ""
+	case "given_name":
+		given, _, _ := strings.Cut(user.Name, " ")
+		return given, given != ""
+	case "family_name":
+		_, family, found := strings.Cut(user.Name, " ")
+		return family, found && family != ""
+	case "preferred_username":
+		return user.ID, true
+	case "updated_at":
+		return user.CreatedAt.Unix(), true
+	case "email":
+		return user.Email, user.Email != ""
+	case "email_verified":
+		return user.Email != "", user.Email != ""
+	case "roles":
+		return user.Roles, len(user.Roles) > 0
+	case "groups":
+		return user.Groups, len(user.Groups) > 0
+	}
+	value, exists := user.Claims[name]
+	return value, exists
+}
@@ -0,0 +1,221 @@
+package mockidp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ClientAssertionType is the client_assertion_type for JWT client authentication (RFC 7523 Section 2.2)
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Client authentication methods (OIDC Core Section 9, RFC 7591 Section 2)
+const (
+	AuthMethodNone              = "none"
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodClientSecretJWT   = "client_secret_jwt"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+	// Mutual TLS client authentication (RFC 8705 Section 2)
+	AuthMethodTLSClientAuth           = "tls_client_auth"
+	AuthMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+// SupportedClientAuthMethods lists the client authentication methods accepted at back-channel endpoints
+var SupportedClientAuthMethods = []string{
+	AuthMethodClientSecretBasic,
+	AuthMethodClientSecretPost,
+	AuthMethodClientSecretJWT,
+	AuthMethodPrivateKeyJWT,
+	AuthMethodTLSClientAuth,
+	AuthMethodSelfSignedTLSClientAuth,
+	AuthMethodNone,
+}
+
+var (
+	clientSecretJWTAlgorithms = []string{"HS256", "HS384", "HS512"}
+	privateKeyJWTAlgorithms   = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+)
+
+// ClientAssertionSigningAlgorithms lists the algorithms accepted for client assertions
+var ClientAssertionSigningAlgorithms = append(append([]string{}, clientSecretJWTAlgorithms...), privateKeyJWTAlgorithms...)
+
+// clientAssertionLeeway tolerates clock skew when checking exp, nbf and iat
+const clientAssertionLeeway = 30 * time.Second
+
+// ClientAssertion is a verified client authentication JWT
+type ClientAssertion struct {
+	ClientID  string
+	Method    string // client_secret_jwt or private_key_jwt
+	Algorithm string
+	KeyID     string
+	JTI       string
+	ExpiresAt time.Time
+}
+
+// ValidateClientAssertion authenticates a client from a JWT assertion (RFC 7523 Section 3).
+// HMAC assertions are verified with the client secret (client_secret_jwt); asymmetric
+// assertions with a key from the client's registered jwks or jwks_uri (private_key_jwt).
+// The aud claim must contain one of audiences and each jti may only be used once.
+func (idp *MockIdP) ValidateClientAssertion(assertion string, audiences []string) (*models.Client, *ClientAssertion, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(assertion, jwt.MapClaims{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed client assertion: %w", err)
+	}
+	unverifiedClaims := unverified.Claims.(jwt.MapClaims)
+	clientID, _ := unverifiedClaims["sub"].(string)
+	if clientID == "" {
+		return nil, nil, errors.New("client assertion must contain a sub claim")
+	}
+
+	client, exists := idp.GetClient(clientID)
+	if !exists {
+		return nil, nil, errors.New("client not found")
+	}
+	if client.Public {
+		return nil, nil, errors.New("public clients cannot authenticate with a client assertion")
+	}
+
+	method, algorithms := AuthMethodPrivateKeyJWT, privateKeyJWTAlgorithms
+	if strings.HasPrefix(unverified.Method.Alg(), "HS") {
+		method, algorithms = AuthMethodClientSecretJWT, clientSecretJWTAlgorithms
+	}
+	if !clientAllowsAuthMethod(client, method) {
+		return nil, nil, fmt.Errorf("client is registered for %s, not %s", client.TokenEndpointAuthMethod, method)
+	}
+
+	token, err := jwt.Parse(assertion, func(token *jwt.Token) (interface{}, error) {
+		if method == AuthMethodClientSecretJWT {
+			return []byte(client.Secret), nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		return idp.clientVerificationKey(client, kid)
+	},
+		jwt.WithValidMethods(algorithms),
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clientAssertionLeeway),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid client assertion: %w", err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	aud, _ := claims.GetAudience()
+	if !audienceMatches(aud, audiences) {
+		return nil, nil, errors.New("client assertion aud does not identify this authorization server")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, nil, errors.New("client assertion must contain a jti claim")
+	}
+	exp, _ := claims.GetExpirationTime()
+	if !idp.recordClientAssertion(clientID, jti, exp.Add(clientAssertionLeeway)) {
+		return nil, nil, errors.New("client assertion has already been used")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	return client, &ClientAssertion{
+		ClientID:  clientID,
+		Method:    method,
+		Algorithm: token.Method.Alg(),
+		KeyID:     kid,
+		JTI:       jti,
+		ExpiresAt: exp.Time,
+	}, nil
+}
+
+// clientAllowsAuthMethod reports whether a client may authenticate with method. Clients
+// without a registered method keep the default of any secret-based method.
+func clientAllowsAuthMethod(client *models.Client, method string) bool {
+	switch client.TokenEndpointAuthMethod {
+	case "":
+		return method == AuthMethodClientSecretBasic || method == AuthMethodClientSecretPost || method == AuthMethodClientSecretJWT
+	case AuthMethodClientSecretBasic, AuthMethodClientSecretPost:
+		// Basic and post carry the same secret, so they are interchangeable
+		return method == AuthMethodClientSecretBasic || method == AuthMethodClientSecretPost
+	default:
+		return client.TokenEndpointAuthMethod == method
+	}
+}
+
+// clientVerificationKey resolves the public key for a private_key_jwt assertion
+func (idp *MockIdP) clientVerificationKey(client *models.Client, kid string) (interface{}, error) {
+	jwks, err := idp.clientJWKS(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if kid != "" {
+		key, err := jwks.GetKeyByID(kid)
+		if err != nil {
+			return nil, err
+		}
+		return key.ToPublicKey()
+	}
+	if len(jwks.Keys) != 1 {
+		return nil, errors.New("kid header is required when the client has more than one key")
+	}
+	return jwks.Keys[0].ToPublicKey()
+}
+
+// clientJWKS returns the client's registered jwks, or fetches its jwks_uri
+func (idp *MockIdP) clientJWKS(client *models.Client) (*crypto.JWKS, error) {
+	switch {
+	case client.JWKSURI != "":
+		return idp.jwksFetcher.Fetch(client.JWKSURI)
+	case client.JWKS != nil:
+		data, err := json.Marshal(client.JWKS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid registered jwks: %w", err)
+		}
+		jwks := &crypto.JWKS{}
+		if err := json.Unmarshal(data, jwks); err != nil {
+			return nil, fmt.Errorf("invalid registered jwks: %w", err)
+		}
+		return jwks, nil
+	default:
+		return nil, errors.New("client has no registered jwks or jwks_uri")
+	}
+}
+
+// recordClientAssertion records a client's assertion jti until expiresAt and reports false if it was already seen
+func (idp *MockIdP) recordClientAssertion(clientID, jti string, expiresAt time.Time) bool {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	key := clientID + ":" + jti
+	now := time.Now()
+	if seen, exists := idp.clientAssertions[key]; exists && now.Before(seen) {
+		return false
+	}
+	for id, until := range idp.clientAssertions {
+		if until.Before(now) {
+			delete(idp.clientAssertions, id)
+		}
+	}
+	idp.clientAssertions[key] = expiresAt
+
+	return true
+}
+
+// audienceMatches reports whether any aud value is one of the accepted audiences
+func audienceMatches(aud, accepted []string) bool {
+	for _, a := range aud {
+		for _, want := range accepted {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
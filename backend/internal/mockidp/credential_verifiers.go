@@ -0,0 +1,86 @@
+package mockidp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/url"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// CredentialVerifier checks an authentication factor the user supplies on the login page in
+// addition to their password, such as a TOTP code, a WebAuthn assertion or a magic link token.
+// Verifiers are registered for an authentication context class; the login pages render the
+// inputs of every verifier of the class the client requested and check each of them.
+type CredentialVerifier interface {
+	// Method is the authentication method reference of the factor (RFC 8176), added to amr
+	Method() string
+	// FormFields returns the HTML inputs the login form needs for the factor
+	FormFields() string
+	// Verify checks the submitted login form of a user whose password was correct
+	Verify(user *models.User, form url.Values) error
+}
+
+// RegisterCredentialVerifier requires a factor for logins at the acr authentication context class
+func (idp *MockIdP) RegisterCredentialVerifier(acr string, verifier CredentialVerifier) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.credentialVerifiers[acr] = append(idp.credentialVerifiers[acr], verifier)
+}
+
+// CredentialVerifiers returns the factors required, besides the password, for logins at acr
+func (idp *MockIdP) CredentialVerifiers(acr string) []CredentialVerifier {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+	return idp.credentialVerifiers[acr]
+}
+
+// VerifyCredentials checks every factor required at acr for a user who entered a valid password
+func (idp *MockIdP) VerifyCredentials(user *models.User, acr string, form url.Values) error {
+	for _, verifier := range idp.CredentialVerifiers(acr) {
+		if err := verifier.Verify(user, form); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AMRForACR returns the authentication method references (RFC 8176) of a login at acr: the
+// password, the method of each required factor and mfa when there is more than one factor
+func (idp *MockIdP) AMRForACR(acr string) []string {
+	amr := []string{"pwd"}
+	verifiers := idp.CredentialVerifiers(acr)
+	for _, verifier := range verifiers {
+		amr = append(amr, verifier.Method())
+	}
+	if len(verifiers) > 0 {
+		amr = append(amr, "mfa")
+	}
+	return amr
+}
+
+// DemoOneTimeCodeVerifier accepts DemoOneTimeCode as every user's one-time code. The code is the
+// same for everyone and shown on the login page, so it only demonstrates a second factor: the
+// urn:protocolsoup:acr:mfa class and otp amr it yields must not be trusted as real assurance.
+type DemoOneTimeCodeVerifier struct{}
+
+// Method reports the factor as a one-time password
+func (DemoOneTimeCodeVerifier) Method() string {
+	return "otp"
+}
+
+// FormFields renders the one-time code input, hinting at the demo code
+func (DemoOneTimeCodeVerifier) FormFields() string {
+	return `<div class="form-group">
+                <label for="otp">One-Time Code</label>
+                <input type="password" id="otp" name="otp" placeholder="` + DemoOneTimeCode + `" inputmode="numeric" autocomplete="one-time-code" required>
+            </div>`
+}
+
+// Verify checks the submitted one-time code
+func (DemoOneTimeCodeVerifier) Verify(user *models.User, form url.Values) error {
+	if subtle.ConstantTimeCompare([]byte(form.Get("otp")), []byte(DemoOneTimeCode)) != 1 {
+		return errors.New("invalid one-time code")
+	}
+	return nil
+}
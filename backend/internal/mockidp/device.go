@@ -0,0 +1,202 @@
+package mockidp
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// Device authorization polling errors (RFC 8628 Section 3.5)
+var (
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+	ErrAccessDenied         = errors.New("access_denied")
+	ErrExpiredToken         = errors.New("expired_token")
+	// ErrTooManyUserCodeAttempts is returned once a source has entered too many unknown user codes
+	ErrTooManyUserCodeAttempts = errors.New("too many invalid user codes, try again later")
+)
+
+const (
+	// deviceCodeLifetime is how long a device code remains valid
+	deviceCodeLifetime = 10 * time.Minute
+	// devicePollInterval is the default minimum polling interval in seconds
+	devicePollInterval = 5
+	// userCodeCharset excludes vowels and ambiguous characters (RFC 8628 Section 6.1)
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	// userCodeMaxFailures invalid user codes may be entered per source within userCodeFailureWindow
+	// before further attempts are refused (RFC 8628 Section 5.1)
+	userCodeMaxFailures   = 10
+	userCodeFailureWindow = 15 * time.Minute
+)
+
+// CreateDeviceAuthorization creates and stores a new device authorization request
+func (idp *MockIdP) CreateDeviceAuthorization(clientID, scope string) *models.DeviceAuthorization {
+	auth := &models.DeviceAuthorization{
+		DeviceCode: generateRandomString(43),
+		UserCode:   generateUserCode(),
+		ClientID:   clientID,
+		Scope:      scope,
+		Status:     models.DeviceStatusPending,
+		Interval:   devicePollInterval,
+		ExpiresAt:  time.Now().Add(deviceCodeLifetime),
+		CreatedAt:  time.Now(),
+	}
+
+	idp.mu.Lock()
+	idp.deviceCodes[auth.DeviceCode] = auth
+	idp.userCodes[NormalizeUserCode(auth.UserCode)] = auth.DeviceCode
+	idp.mu.Unlock()
+
+	return auth
+}
+
+// GetDeviceAuthorizationByUserCode looks up a pending device authorization by a user code entered
+// from source, the address of the user's browser. A user code has about 35 bits of entropy, so
+// each source may only enter a few invalid codes before it is refused (RFC 8628 Section 5.1).
+func (idp *MockIdP) GetDeviceAuthorizationByUserCode(userCode, source string) (*models.DeviceAuthorization, error) {
+	if idp.userCodeFailures.Exceeded(source) {
+		return nil, ErrTooManyUserCodeAttempts
+	}
+	auth, err := idp.lookupUserCode(userCode)
+	if err != nil {
+		idp.userCodeFailures.Allow(source)
+	}
+	return auth, err
+}
+
+// lookupUserCode returns the pending device authorization of a user code
+func (idp *MockIdP) lookupUserCode(userCode string) (*models.DeviceAuthorization, error) {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	deviceCode, exists := idp.userCodes[NormalizeUserCode(userCode)]
+	if !exists {
+		return nil, errors.New("unknown user code")
+	}
+	auth, exists := idp.deviceCodes[deviceCode]
+	if !exists {
+		return nil, errors.New("unknown user code")
+	}
+	if auth.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("user code expired")
+	}
+	if auth.Status != models.DeviceStatusPending {
+		return nil, errors.New("user code already used")
+	}
+	return auth, nil
+}
+
+// ApproveDeviceAuthorization marks a device authorization as approved by the given user
+func (idp *MockIdP) ApproveDeviceAuthorization(userCode, userID string) (*models.DeviceAuthorization, error) {
+	return idp.completeDeviceAuthorization(userCode, userID, models.DeviceStatusApproved)
+}
+
+// DenyDeviceAuthorization marks a device authorization as denied by the user
+func (idp *MockIdP) DenyDeviceAuthorization(userCode string) (*models.DeviceAuthorization, error) {
+	return idp.completeDeviceAuthorization(userCode, "", models.DeviceStatusDenied)
+}
+
+func (idp *MockIdP) completeDeviceAuthorization(userCode, userID, status string) (*models.DeviceAuthorization, error) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	normalized := NormalizeUserCode(userCode)
+	deviceCode, exists := idp.userCodes[normalized]
+	if !exists {
+		return nil, errors.New("unknown user code")
+	}
+	auth, exists := idp.deviceCodes[deviceCode]
+	if !exists || auth.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("user code expired")
+	}
+	if auth.Status != models.DeviceStatusPending {
+		return nil, errors.New("user code already used")
+	}
+
+	auth.Status = status
+	auth.UserID = userID
+	// User codes are single use
+	delete(idp.userCodes, normalized)
+
+	return auth, nil
+}
+
+// PollDeviceAuthorization is called by the token endpoint for each device_code poll.
+// The returned authorization is non-nil for pending and slow_down results so callers
+// can report the current polling interval.
+func (idp *MockIdP) PollDeviceAuthorization(deviceCode, clientID string) (*models.DeviceAuthorization, error) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	auth, exists := idp.deviceCodes[deviceCode]
+	if !exists {
+		return nil, errors.New("invalid device code")
+	}
+
+	if auth.ClientID != clientID {
+		return nil, errors.New("client ID mismatch")
+	}
+
+	now := time.Now()
+	if auth.ExpiresAt.Before(now) {
+		idp.deleteDeviceAuthorization(auth)
+		return nil, ErrExpiredToken
+	}
+
+	// Enforce the polling interval; each violation increases it by 5 seconds
+	if !auth.LastPolledAt.IsZero() && now.Sub(auth.LastPolledAt) < time.Duration(auth.Interval)*time.Second {
+		auth.Interval += 5
+		auth.LastPolledAt = now
+		return auth, ErrSlowDown
+	}
+	auth.LastPolledAt = now
+
+	switch auth.Status {
+	case models.DeviceStatusApproved:
+		// Device codes are single use once tokens are issued
+		idp.deleteDeviceAuthorization(auth)
+		return auth, nil
+	case models.DeviceStatusDenied:
+		idp.deleteDeviceAuthorization(auth)
+		return nil, ErrAccessDenied
+	default:
+		return auth, ErrAuthorizationPending
+	}
+}
+
+// deleteDeviceAuthorization removes a device authorization. Caller must hold the lock.
+func (idp *MockIdP) deleteDeviceAuthorization(auth *models.DeviceAuthorization) {
+	delete(idp.deviceCodes, auth.DeviceCode)
+	delete(idp.userCodes, NormalizeUserCode(auth.UserCode))
+}
+
+// NormalizeUserCode strips formatting from a user-entered code so "bcdf-ghjk" matches "BCDFGHJK"
+func NormalizeUserCode(userCode string) string {
+	replacer := strings.NewReplacer("-", "", " ", "")
+	return strings.ToUpper(replacer.Replace(userCode))
+}
+
+// generateUserCode returns an 8 character user code formatted as XXXX-XXXX. Random bytes that
+// would make some characters more likely than others are discarded (rejection sampling).
+func generateUserCode() string {
+	// The largest multiple of the charset size a byte can hold; bytes at or above it are redrawn
+	limit := byte(256 - 256%len(userCodeCharset))
+	code := make([]byte, 0, 9)
+	b := make([]byte, 16)
+	for len(code) < 9 {
+		rand.Read(b)
+		for _, v := range b {
+			if v >= limit || len(code) == 9 {
+				continue
+			}
+			if len(code) == 4 {
+				code = append(code, '-')
+			}
+			code = append(code, userCodeCharset[int(v)%len(userCodeCharset)])
+		}
+	}
+	return string(code)
+}
@@ -0,0 +1,51 @@
+package mockidp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateUserCodeIsUniform(t *testing.T) {
+	const codes = 10000
+	counts := make(map[rune]int)
+	for i := 0; i < codes; i++ {
+		code := generateUserCode()
+		if len(code) != 9 || code[4] != '-' {
+			t.Fatalf("user code %q is not formatted as XXXX-XXXX", code)
+		}
+		for _, c := range strings.Replace(code, "-", "", 1) {
+			if !strings.ContainsRune(userCodeCharset, c) {
+				t.Fatalf("user code %q contains %q outside the charset", code, c)
+			}
+			counts[c]++
+		}
+	}
+
+	// Reducing a byte modulo 20 favours the first 16 characters, leaving the last 4 with 15000 of
+	// 80000 draws instead of 16000 (standard deviation about 113)
+	tail := 0
+	for _, c := range userCodeCharset[16:] {
+		tail += counts[c]
+	}
+	if tail < 15500 || tail > 16500 {
+		t.Errorf("last four characters drawn %d times, want about 16000", tail)
+	}
+}
+
+func TestUserCodeAttemptsAreLimited(t *testing.T) {
+	idp := newTestIdP(t)
+	auth := idp.CreateDeviceAuthorization("device-app", "openid")
+
+	for i := 0; i < userCodeMaxFailures; i++ {
+		if _, err := idp.GetDeviceAuthorizationByUserCode("BBBB-BBBB", "203.0.113.7"); err == nil {
+			t.Fatal("unknown user code was accepted")
+		}
+	}
+	if _, err := idp.GetDeviceAuthorizationByUserCode(auth.UserCode, "203.0.113.7"); !errors.Is(err, ErrTooManyUserCodeAttempts) {
+		t.Fatalf("valid code after %d failures: got %v, want ErrTooManyUserCodeAttempts", userCodeMaxFailures, err)
+	}
+	if _, err := idp.GetDeviceAuthorizationByUserCode(strings.ToLower(auth.UserCode), "198.51.100.2"); err != nil {
+		t.Fatalf("another source was refused: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package mockidp
+
+import (
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// dpopNonceLifetime is how long a server-issued DPoP nonce is accepted
+const dpopNonceLifetime = 5 * time.Minute
+
+// IssueDPoPNonce creates a server nonce that clients must include in subsequent DPoP proofs (RFC 9449 Section 8)
+func (idp *MockIdP) IssueDPoPNonce() string {
+	nonce := generateRandomString(32)
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	now := time.Now()
+	for n, expiresAt := range idp.dpopNonces {
+		if expiresAt.Before(now) {
+			delete(idp.dpopNonces, n)
+		}
+	}
+	idp.dpopNonces[nonce] = now.Add(dpopNonceLifetime)
+
+	return nonce
+}
+
+// ValidateDPoPNonce reports whether a nonce was issued by this server and has not expired
+func (idp *MockIdP) ValidateDPoPNonce(nonce string) bool {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	expiresAt, exists := idp.dpopNonces[nonce]
+	return exists && time.Now().Before(expiresAt)
+}
+
+// RecordDPoPProof records a proof's jti until expiresAt and reports false if it was already seen
+func (idp *MockIdP) RecordDPoPProof(jti string, expiresAt time.Time) bool {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	now := time.Now()
+	if seen, exists := idp.dpopProofs[jti]; exists && now.Before(seen) {
+		return false
+	}
+	for id, until := range idp.dpopProofs {
+		if until.Before(now) {
+			delete(idp.dpopProofs, id)
+		}
+	}
+	idp.dpopProofs[jti] = expiresAt
+
+	return true
+}
+
+// BindRefreshToken binds a refresh token to a DPoP key thumbprint (RFC 9449 Section 5)
+func (idp *MockIdP) BindRefreshToken(token, jkt string) {
+	idp.updateRefreshToken(token, func(rt *models.RefreshToken) {
+		rt.JKT = jkt
+	})
+}
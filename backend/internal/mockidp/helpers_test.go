@@ -0,0 +1,21 @@
+package mockidp
+
+import (
+	"testing"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+// newTestIdP returns a provider with the demo users and clients in a memory store
+func newTestIdP(t *testing.T) *MockIdP {
+	t.Helper()
+	keySet, err := crypto.NewKeySet()
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	idp, err := NewMockIdP(keySet, NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewMockIdP: %v", err)
+	}
+	return idp
+}
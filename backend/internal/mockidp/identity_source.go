@@ -0,0 +1,76 @@
+package mockidp
+
+import (
+	"errors"
+	"log"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// IdentitySource is a directory of users managed outside the mock IdP, such as users
+// provisioned over SCIM. Its users sign in and receive tokens and assertions like the IdP's own
+// users, which take precedence when an ID or email address is in both.
+type IdentitySource interface {
+	// Name identifies the source, and is recorded as the Source of its users
+	Name() string
+	// LookupUser returns the active user with the given ID, or ErrNotFound
+	LookupUser(id string) (*models.User, error)
+	// LookupUserByLogin returns the active user with the given email address or user name, or ErrNotFound
+	LookupUserByLogin(login string) (*models.User, error)
+	// Authenticate checks a password of the user returned by LookupUserByLogin(login)
+	Authenticate(login, password string) (*models.User, error)
+}
+
+// AddIdentitySource adds a directory whose users can sign in. Sources are consulted in the order added.
+func (idp *MockIdP) AddIdentitySource(source IdentitySource) {
+	idp.sourcesMu.Lock()
+	defer idp.sourcesMu.Unlock()
+	idp.sources = append(idp.sources, source)
+}
+
+// identitySources returns the sources added so far
+func (idp *MockIdP) identitySources() []IdentitySource {
+	idp.sourcesMu.RLock()
+	defer idp.sourcesMu.RUnlock()
+	return idp.sources
+}
+
+// lookupSourceUser asks each identity source in turn for a user
+func (idp *MockIdP) lookupSourceUser(lookup func(IdentitySource) (*models.User, error)) (*models.User, bool) {
+	for _, source := range idp.identitySources() {
+		user, err := lookup(source)
+		if err == nil {
+			user.Source = source.Name()
+			return user, true
+		}
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("MockIdP identity source %s failed: %v", source.Name(), err)
+		}
+	}
+	return nil, false
+}
+
+// authenticateSourceUser verifies credentials against the first identity source that knows the
+// login. Failures count towards the lockout policy like those of the IdP's own users.
+func (idp *MockIdP) authenticateSourceUser(login, password string) (*models.User, error) {
+	for _, source := range idp.identitySources() {
+		user, err := source.LookupUserByLogin(login)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !idp.loginAttempts.Allow(user.ID) {
+			return nil, ErrAccountLocked
+		}
+		authenticated, err := source.Authenticate(login, password)
+		if err != nil {
+			return nil, ErrInvalidCredentials
+		}
+		idp.loginAttempts.Reset(user.ID)
+		authenticated.Source = source.Name()
+		return authenticated, nil
+	}
+	return nil, idp.rejectUnknownLogin(login, password)
+}
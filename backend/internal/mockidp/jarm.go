@@ -0,0 +1,44 @@
+package mockidp
+
+import (
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// JWT Secured Authorization Response Mode (JARM) response modes (JARM Section 2.3)
+const (
+	ResponseModeJWT         = "jwt"
+	ResponseModeQueryJWT    = "query.jwt"
+	ResponseModeFragmentJWT = "fragment.jwt"
+	ResponseModeFormPostJWT = "form_post.jwt"
+)
+
+// JWTResponseModes lists the JARM response modes
+var JWTResponseModes = []string{ResponseModeJWT, ResponseModeQueryJWT, ResponseModeFragmentJWT, ResponseModeFormPostJWT}
+
+// AuthorizationResponseSigningAlgorithms lists the algorithms JWT authorization responses can be signed with
+var AuthorizationResponseSigningAlgorithms = []string{"RS256", "ES256"}
+
+// authorizationResponseLifetime is the exp of a JWT authorization response; it only needs to survive the redirect
+const authorizationResponseLifetime = 10 * time.Minute
+
+// IsJWTResponseMode reports whether a response mode wraps the authorization response in a JWT
+func IsJWTResponseMode(mode string) bool {
+	switch mode {
+	case ResponseModeJWT, ResponseModeQueryJWT, ResponseModeFragmentJWT, ResponseModeFormPostJWT:
+		return true
+	default:
+		return false
+	}
+}
+
+// CreateAuthorizationResponse signs authorization response parameters for a client with its
+// registered authorization_signed_response_alg, defaulting to RS256 (JARM Section 3)
+func (idp *MockIdP) CreateAuthorizationResponse(client *models.Client, params map[string]string) (string, error) {
+	alg := client.AuthorizationSignedResponseAlg
+	if alg == "" {
+		alg = "RS256"
+	}
+	return idp.JWTService().CreateAuthorizationResponse(client.ID, params, alg, authorizationResponseLifetime)
+}
@@ -0,0 +1,39 @@
+package mockidp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+// LoadKeySet returns the key set kept in store, generating and storing one on first start. With
+// a persistent store the published JWKS stays the same across restarts, so tokens, software
+// statements and encrypted request objects made with earlier keys remain valid.
+func LoadKeySet(store Store) (*crypto.KeySet, error) {
+	data, err := store.GetKeySet()
+	if errors.Is(err, ErrNotFound) {
+		if err := addKeySet(store); err != nil {
+			return nil, err
+		}
+		// Another process may have stored its keys first; use whichever set won
+		data, err = store.GetKeySet()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key set: %w", err)
+	}
+	return crypto.UnmarshalKeySet(data)
+}
+
+// addKeySet generates a key set and stores it unless the store already has one
+func addKeySet(store Store) error {
+	keySet, err := crypto.NewKeySet()
+	if err != nil {
+		return err
+	}
+	encoded, err := crypto.MarshalKeySet(keySet)
+	if err != nil {
+		return err
+	}
+	return store.AddKeySet(encoded)
+}
@@ -0,0 +1,165 @@
+package mockidp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// logoutTokenLifetime is how long a client may take to accept a logout token. Logout tokens are
+// delivered immediately, so a short lifetime limits replay (OIDC Back-Channel Logout 1.0 Section 2.4).
+const logoutTokenLifetime = 2 * time.Minute
+
+// idTokenHintMaxExpiredAge is how long after it expires an ID token is still accepted as a hint,
+// the lifetime of the provider session it was issued in
+const idTokenHintMaxExpiredAge = 24 * time.Hour
+
+// IDTokenHint describes the login an id_token_hint was issued for
+type IDTokenHint struct {
+	User *models.User
+	// ClientID is the audience of the ID token
+	ClientID string
+	// SessionID is the sid claim, or empty for ID tokens issued without a session
+	SessionID string
+}
+
+// ParseIDTokenHint verifies an ID token this provider issued that a client passed back as a hint.
+// The signature, issuer, typ and audience are verified. An expired token is still accepted for
+// up to idTokenHintMaxExpiredAge, since the hint only names the user and does not authenticate
+// them (OpenID Connect Core 1.0 Section 3.1.2.1, OIDC RP-Initiated Logout 1.0 Section 2). A
+// client that receives encrypted ID tokens passes the hint back encrypted to one of this
+// provider's keys.
+func (idp *MockIdP) ParseIDTokenHint(hint string) (*IDTokenHint, error) {
+	if crypto.IsJWE(hint) {
+		plaintext, _, err := idp.keySet.DecryptJWE(hint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id_token_hint: %w", err)
+		}
+		hint = string(plaintext)
+	}
+	token, err := jwt.Parse(hint, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA:
+			return idp.keySet.RSAPublicKey(), nil
+		case *jwt.SigningMethodECDSA:
+			return idp.keySet.ECPublicKey(), nil
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+	}, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token_hint: %w", err)
+	}
+
+	// Access tokens, logout tokens and the other JWTs this provider signs are not ID tokens
+	if typ, _ := token.Header["typ"].(string); typ != crypto.IDTokenType {
+		return nil, errors.New("id_token_hint is not an ID token")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if iss, _ := claims.GetIssuer(); iss != idp.GetIssuer() {
+		return nil, errors.New("id_token_hint was not issued by this provider")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, errors.New("id_token_hint has no expiry")
+	}
+	if time.Since(exp.Time) > idTokenHintMaxExpiredAge {
+		return nil, errors.New("id_token_hint expired too long ago")
+	}
+	parsed := &IDTokenHint{}
+	if aud, _ := claims.GetAudience(); len(aud) > 0 {
+		parsed.ClientID = aud[0]
+	}
+	if _, exists := idp.GetClient(parsed.ClientID); !exists {
+		return nil, errors.New("id_token_hint audience is not a registered client")
+	}
+	// A pairwise client's ID tokens name the user by the sub calculated for its sector
+	sub, _ := claims.GetSubject()
+	user, exists := idp.GetUser(idp.ResolveSubject(parsed.ClientID, sub))
+	if !exists {
+		return nil, errors.New("id_token_hint subject is not a known user")
+	}
+	parsed.User = user
+	parsed.SessionID, _ = claims["sid"].(string)
+	return parsed, nil
+}
+
+// EndSession logs the user of a session out of the provider. The session is deleted and the
+// refresh tokens of grants made in it are revoked with their access tokens. The ended session is
+// returned so that the clients signed in to it can be notified.
+func (idp *MockIdP) EndSession(sessionID string) (*models.Session, bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	session, err := idp.store.GetSession(sessionID)
+	if err != nil {
+		logStoreError("get session", err)
+		return nil, false
+	}
+	tokens, err := idp.store.SessionRefreshTokens(session.ID)
+	logStoreError("list session refresh tokens", err)
+	revokedFamilies := make(map[string]bool)
+	for _, rt := range tokens {
+		if revokedFamilies[rt.FamilyID] {
+			continue
+		}
+		revokedFamilies[rt.FamilyID] = true
+		idp.revokeRefreshTokenFamily(rt)
+	}
+	logStoreError("delete session", idp.store.DeleteSession(session.ID))
+	return session, true
+}
+
+// ValidatePostLogoutRedirectURI checks that uri exactly matches one of the client's registered
+// post_logout_redirect_uris (OIDC RP-Initiated Logout 1.0 Section 3)
+func ValidatePostLogoutRedirectURI(client *models.Client, uri string) error {
+	if !slices.Contains(client.PostLogoutRedirectURIs, uri) {
+		return errors.New("post_logout_redirect_uri is not registered for this client")
+	}
+	return nil
+}
+
+// FrontchannelLogoutURL returns the URL a client's front-channel logout iframe loads for a
+// session, carrying the issuer and sid when the client registered that it needs them
+// (OIDC Front-Channel Logout 1.0 Section 2)
+func (idp *MockIdP) FrontchannelLogoutURL(client *models.Client, session *models.Session) string {
+	if !client.FrontchannelLogoutSessionRequired {
+		return client.FrontchannelLogoutURI
+	}
+	u, err := url.Parse(client.FrontchannelLogoutURI)
+	if err != nil {
+		return client.FrontchannelLogoutURI
+	}
+	q := u.Query()
+	q.Set("iss", idp.GetIssuer())
+	q.Set("sid", session.ID)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// CreateLogoutToken signs the logout token sent to a client's back-channel logout URI when a
+// session it was signed in to ends (OIDC Back-Channel Logout 1.0 Section 2.4)
+func (idp *MockIdP) CreateLogoutToken(client *models.Client, session *models.Session) (string, error) {
+	return idp.jwtService.CreateLogoutToken(idp.SubjectIdentifier(client.ID, session.UserID), client.ID, session.ID, logoutTokenLifetime)
+}
+
+// SetClientLogoutEndpoints registers a post-logout redirect URI and the front-channel and
+// back-channel logout URIs of a client, which all ask for the session ID
+func (idp *MockIdP) SetClientLogoutEndpoints(clientID, postLogoutRedirectURI, frontchannelURI, backchannelURI string) {
+	idp.updateClient(clientID, func(client *models.Client) {
+		if !slices.Contains(client.PostLogoutRedirectURIs, postLogoutRedirectURI) {
+			client.PostLogoutRedirectURIs = append(client.PostLogoutRedirectURIs, postLogoutRedirectURI)
+		}
+		client.FrontchannelLogoutURI = frontchannelURI
+		client.FrontchannelLogoutSessionRequired = true
+		client.BackchannelLogoutURI = backchannelURI
+		client.BackchannelLogoutSessionRequired = true
+	})
+}
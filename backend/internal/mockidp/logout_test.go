@@ -0,0 +1,85 @@
+package mockidp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+func TestParseIDTokenHint(t *testing.T) {
+	idp := newTestIdP(t)
+	idToken := func(audience string, lifetime time.Duration) string {
+		t.Helper()
+		token, err := idp.JWTService().CreateIDToken("alice", audience, "", time.Now(), lifetime, map[string]interface{}{"sid": "s1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for name, hint := range map[string]string{
+		"live":             idToken("demo-app", time.Hour),
+		"recently expired": idToken("demo-app", -time.Hour),
+	} {
+		parsed, err := idp.ParseIDTokenHint(hint)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if parsed.User.ID != "alice" || parsed.ClientID != "demo-app" || parsed.SessionID != "s1" {
+			t.Errorf("%s: parsed = %+v", name, parsed)
+		}
+	}
+
+	accessToken, err := idp.IssueAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "demo-app"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rejected := map[string]string{
+		"access token":      accessToken,
+		"long expired":      idToken("demo-app", -25*time.Hour),
+		"unknown audience":  idToken("no-such-client", time.Hour),
+		"no expiry":         signServerJWT(t, idp, crypto.IDTokenType, jwt.MapClaims{"iss": idp.GetIssuer(), "sub": "alice", "aud": "demo-app", "iat": now.Unix()}),
+		"other issuer":      signServerJWT(t, idp, crypto.IDTokenType, jwt.MapClaims{"iss": "https://elsewhere.example", "sub": "alice", "aud": "demo-app", "exp": now.Add(time.Hour).Unix()}),
+		"logout token type": signServerJWT(t, idp, crypto.LogoutTokenType, jwt.MapClaims{"iss": idp.GetIssuer(), "sub": "alice", "aud": "demo-app", "exp": now.Add(time.Hour).Unix()}),
+	}
+	for name, hint := range rejected {
+		if _, err := idp.ParseIDTokenHint(hint); err == nil {
+			t.Errorf("%s accepted as an id_token_hint", name)
+		}
+	}
+}
+
+func TestEndSessionRevokesItsRefreshTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	ended := idp.CreateSession("alice", "demo-app", ACRPassword)
+	kept := idp.CreateSession("alice", "demo-app", ACRPassword)
+	for _, session := range []string{ended.ID, kept.ID} {
+		token := "rt-" + session
+		idp.StoreRefreshToken(token, "demo-app", "alice", "openid", "", time.Now(), time.Now().Add(time.Hour))
+		idp.updateRefreshToken(token, func(rt *models.RefreshToken) { rt.SessionID = session })
+	}
+
+	if _, ok := idp.EndSession(ended.ID); !ok {
+		t.Fatal("EndSession found no session")
+	}
+	if _, exists := idp.GetSession(ended.ID); exists {
+		t.Error("ended session kept")
+	}
+	if _, exists := idp.GetSession(kept.ID); !exists {
+		t.Error("other session of the user ended")
+	}
+	if idp.IsRefreshTokenActive("rt-" + ended.ID) {
+		t.Error("refresh token of the ended session still active")
+	}
+	if !idp.IsRefreshTokenActive("rt-" + kept.ID) {
+		t.Error("refresh token of the other session revoked")
+	}
+	if _, ok := idp.EndSession(ended.ID); ok {
+		t.Error("session ended twice")
+	}
+}
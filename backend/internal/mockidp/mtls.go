@@ -0,0 +1,96 @@
+package mockidp
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ValidateClientCertificate authenticates a client from the certificate it presented over
+// mutual TLS (RFC 8705 Section 2). For tls_client_auth the certificate must have been issued
+// by a trusted CA, which the caller reports with chainVerified, and carry the registered
+// subject DN or SAN. For self_signed_tls_client_auth its public key must be one of the
+// client's registered keys, so no CA is involved.
+func (idp *MockIdP) ValidateClientCertificate(clientID string, cert *x509.Certificate, chainVerified bool) (*models.Client, error) {
+	client, exists := idp.GetClient(clientID)
+	if !exists {
+		return nil, errors.New("client not found")
+	}
+	if cert == nil {
+		return nil, errors.New("no client certificate presented")
+	}
+
+	switch client.TokenEndpointAuthMethod {
+	case AuthMethodTLSClientAuth:
+		if !chainVerified {
+			return nil, errors.New("client certificate was not issued by a trusted CA")
+		}
+		if err := matchCertificateIdentity(client, cert); err != nil {
+			return nil, err
+		}
+		return client, nil
+	case AuthMethodSelfSignedTLSClientAuth:
+		jwks, err := idp.clientJWKS(client)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range jwks.Keys {
+			publicKey, err := key.ToPublicKey()
+			if err != nil {
+				continue
+			}
+			// The standard library public key types all implement Equal
+			if pk, ok := publicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && pk.Equal(cert.PublicKey) {
+				return client, nil
+			}
+		}
+		return nil, errors.New("client certificate key is not one of the client's registered keys")
+	default:
+		return nil, fmt.Errorf("client is registered for %s, not mutual TLS", client.TokenEndpointAuthMethod)
+	}
+}
+
+// matchCertificateIdentity checks a certificate against the client's registered subject DN or SAN (RFC 8705 Section 2.1.2)
+func matchCertificateIdentity(client *models.Client, cert *x509.Certificate) error {
+	switch {
+	case client.TLSClientAuthSubjectDN != "":
+		if cert.Subject.String() == client.TLSClientAuthSubjectDN {
+			return nil
+		}
+		return fmt.Errorf("certificate subject %q does not match the registered subject DN", cert.Subject.String())
+	case client.TLSClientAuthSANDNS != "":
+		for _, name := range cert.DNSNames {
+			if name == client.TLSClientAuthSANDNS {
+				return nil
+			}
+		}
+		return errors.New("certificate has no dNSName SAN matching the registered value")
+	case client.TLSClientAuthSANURI != "":
+		for _, uri := range cert.URIs {
+			if uri.String() == client.TLSClientAuthSANURI {
+				return nil
+			}
+		}
+		return errors.New("certificate has no URI SAN matching the registered value")
+	default:
+		return errors.New("client has no registered certificate subject or SAN")
+	}
+}
+
+// UsesClientSecret reports whether clients registered for an authentication method are issued a client secret
+func UsesClientSecret(method string) bool {
+	switch method {
+	case AuthMethodNone, AuthMethodPrivateKeyJWT, AuthMethodTLSClientAuth, AuthMethodSelfSignedTLSClientAuth:
+		return false
+	default:
+		return true
+	}
+}
+
+// IsMTLSAuthMethod reports whether an authentication method uses the client's TLS certificate
+func IsMTLSAuthMethod(method string) bool {
+	return method == AuthMethodTLSClientAuth || method == AuthMethodSelfSignedTLSClientAuth
+}
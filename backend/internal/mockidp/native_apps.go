@@ -0,0 +1,102 @@
+package mockidp
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ApplicationTypeNative marks a client as a native app (OIDC Dynamic Client Registration Section 2)
+const ApplicationTypeNative = "native"
+
+// Redirect URI kinds (RFC 8252 Section 7)
+const (
+	// RedirectKindLoopback is an http URI on a loopback IP literal, served by the app itself
+	RedirectKindLoopback = "loopback"
+	// RedirectKindPrivateUse is a reverse domain name scheme claimed by the app on the device
+	RedirectKindPrivateUse = "private-use"
+	// RedirectKindClaimedHTTPS is an https URI the operating system routes to the app
+	RedirectKindClaimedHTTPS = "claimed-https"
+	// RedirectKindWeb is any other redirect URI
+	RedirectKindWeb = "web"
+)
+
+// IsNativeClient reports whether a client is a native app
+func IsNativeClient(client *models.Client) bool {
+	return client.ApplicationType == ApplicationTypeNative
+}
+
+// RedirectURIKind classifies the redirect URI of a native app
+func RedirectURIKind(redirectURI string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return RedirectKindWeb
+	}
+	switch u.Scheme {
+	case "http":
+		if isLoopbackIP(u.Hostname()) {
+			return RedirectKindLoopback
+		}
+		return RedirectKindWeb
+	case "https":
+		return RedirectKindClaimedHTTPS
+	}
+	if strings.Contains(u.Scheme, ".") {
+		return RedirectKindPrivateUse
+	}
+	return RedirectKindWeb
+}
+
+// redirectURIMatches reports whether a requested redirect URI matches a registered one.
+// Matching is exact, except that a native app's loopback IP redirect matches on any port,
+// because the app listens on an ephemeral port chosen when the request is made
+// (RFC 8252 Section 7.3).
+func redirectURIMatches(registered, requested string, native bool) bool {
+	if registered == requested {
+		return true
+	}
+	if !native || RedirectURIKind(registered) != RedirectKindLoopback {
+		return false
+	}
+
+	reg, err := url.Parse(registered)
+	if err != nil {
+		return false
+	}
+	req, err := url.Parse(requested)
+	if err != nil || req.User != nil || req.Fragment != "" {
+		return false
+	}
+	return req.Scheme == "http" &&
+		req.Hostname() == reg.Hostname() &&
+		req.Path == reg.Path &&
+		req.RawQuery == reg.RawQuery
+}
+
+// ValidateNativeAuthorizationRequest checks the requirements native apps have beyond redirect
+// URI matching: they must use the authorization code flow with S256 PKCE, since any app on the
+// device could register the same private-use scheme or listen on the loopback interface and
+// intercept the code (RFC 8252 Sections 8.1 and 8.2).
+func ValidateNativeAuthorizationRequest(client *models.Client, responseType, codeChallenge, codeChallengeMethod string) error {
+	if !IsNativeClient(client) {
+		return nil
+	}
+	if responseType != "code" {
+		return errors.New("native apps must use the authorization code flow")
+	}
+	if codeChallenge == "" {
+		return errors.New("native apps must use PKCE: code_challenge is required")
+	}
+	if codeChallengeMethod != "S256" {
+		return errors.New("native apps must use the S256 code_challenge_method")
+	}
+	return nil
+}
+
+func isLoopbackIP(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,68 @@
+package mockidp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+// jwksCacheTTL is how long a client's fetched jwks_uri document is reused
+const jwksCacheTTL = 5 * time.Minute
+
+// errPrivateAddress is returned when a client-supplied URL resolves to an internal address
+var errPrivateAddress = errors.New("refusing to connect to a loopback, private or link-local address")
+
+// newFetchClient returns the HTTP client that fetches documents hosted by clients, such as a
+// jwks_uri. Client metadata is attacker-controlled, so unless allowPrivate is set the client
+// refuses loopback, private and link-local addresses. The check runs on the resolved IP of
+// every connection, including redirects, so DNS names and rebinding cannot get around it.
+func newFetchClient(allowPrivate bool) *http.Client {
+	if allowPrivate {
+		return &http.Client{Timeout: 10 * time.Second}
+	}
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateAddress(ip) {
+				return fmt.Errorf("%s: %w", host, errPrivateAddress)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		// No proxy: the address check must see the real destination
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+}
+
+// isPrivateAddress reports whether ip is an address a public client should never make the
+// server connect to
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// SetPrivateNetworkFetches allows fetching client-hosted documents from loopback and private
+// addresses, for development setups where relying parties run on localhost. Call it before
+// serving requests.
+func (idp *MockIdP) SetPrivateNetworkFetches(allow bool) {
+	idp.fetchClient = newFetchClient(allow)
+	idp.jwksFetcher = crypto.NewJWKSFetcherWithClient(jwksCacheTTL, idp.fetchClient)
+}
+
+// OutboundClient returns the HTTP client for requests the server makes to URLs a client
+// registered, such as back-channel logout URIs and CIBA notification endpoints. It refuses the
+// same internal addresses as document fetches, unless SetPrivateNetworkFetches allowed them.
+func (idp *MockIdP) OutboundClient() *http.Client {
+	return idp.fetchClient
+}
@@ -0,0 +1,189 @@
+package mockidp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// Subject identifier types (OIDC Core Section 8)
+const (
+	SubjectTypePublic   = "public"
+	SubjectTypePairwise = "pairwise"
+)
+
+// SubjectTypesSupported lists the subject identifier types a client may register
+var SubjectTypesSupported = []string{SubjectTypePublic, SubjectTypePairwise}
+
+// sectorIdentifierMaxSize bounds a sector identifier document fetched at registration
+const sectorIdentifierMaxSize = 64 << 10
+
+// loadPairwiseSalt returns the pairwise salt kept in store, generating and storing one on first
+// start, so that clients keep the identifiers they were given across restarts
+func loadPairwiseSalt(store Store) (string, error) {
+	salt, err := store.GetPairwiseSalt()
+	if errors.Is(err, ErrNotFound) {
+		if err := store.AddPairwiseSalt(generateRandomString(32)); err != nil {
+			return "", err
+		}
+		salt, err = store.GetPairwiseSalt()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load pairwise salt: %w", err)
+	}
+	return salt, nil
+}
+
+// SetPairwiseSalt replaces the secret mixed into pairwise subject identifiers, which is otherwise
+// generated on first start and kept in the store. The salt is not stored: every start must set
+// the same one, or clients are given new identifiers for their users.
+func (idp *MockIdP) SetPairwiseSalt(salt string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.pairwiseSalt = salt
+}
+
+// SectorIdentifier returns the host a pairwise client's subject identifiers are calculated for:
+// the host of its sector_identifier_uri, or else the single host of its redirect URIs. Clients
+// of the same sector see the same sub for a user (OIDC Core Section 8.1).
+func SectorIdentifier(client *models.Client) string {
+	if client.SectorIdentifierURI != "" {
+		if u, err := url.Parse(client.SectorIdentifierURI); err == nil {
+			return u.Host
+		}
+	}
+	for _, uri := range client.RedirectURIs {
+		if u, err := url.Parse(uri); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	return client.ID
+}
+
+// SubjectIdentifier returns the sub a client is given for a user. Public clients see the user
+// ID; pairwise clients see a salted hash of it that differs per sector, so clients of different
+// sectors cannot correlate the user by comparing sub values (OIDC Core Section 8.1).
+func (idp *MockIdP) SubjectIdentifier(clientID, userID string) string {
+	client, exists := idp.LookupClient(clientID)
+	if !exists || client.SubjectType != SubjectTypePairwise {
+		return userID
+	}
+	sector := SectorIdentifier(client)
+	sub := idp.pairwiseSubject(sector, userID)
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.pairwiseSubjects[sector+" "+sub] = userID
+	return sub
+}
+
+// pairwiseSubject calculates sub = SHA-256(sector_identifier || local_account_id || salt)
+func (idp *MockIdP) pairwiseSubject(sector, userID string) string {
+	idp.mu.RLock()
+	salt := idp.pairwiseSalt
+	idp.mu.RUnlock()
+
+	hash := sha256.Sum256([]byte(sector + userID + salt))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// ResolveSubject returns the user ID of a sub a client was given, such as the sub of an
+// id_token_hint. Pairwise identifiers are looked up among those issued since start-up, then
+// recalculated for the provider's own users.
+func (idp *MockIdP) ResolveSubject(clientID, sub string) string {
+	client, exists := idp.LookupClient(clientID)
+	if !exists || client.SubjectType != SubjectTypePairwise {
+		return sub
+	}
+	sector := SectorIdentifier(client)
+
+	idp.mu.RLock()
+	userID, issued := idp.pairwiseSubjects[sector+" "+sub]
+	idp.mu.RUnlock()
+	if issued {
+		return userID
+	}
+	for _, user := range idp.ListUsers() {
+		if idp.pairwiseSubject(sector, user.ID) == sub {
+			return user.ID
+		}
+	}
+	return ""
+}
+
+// validateSubjectType checks the subject_type and sector_identifier_uri of a client. A pairwise
+// client whose redirect URIs are on several hosts has no single sector and must register a
+// sector_identifier_uri (OIDC Core Section 8.1, OIDC Dynamic Client Registration Section 2).
+func validateSubjectType(subjectType, sectorIdentifierURI string, redirectURIs []string) error {
+	if subjectType != "" && !slices.Contains(SubjectTypesSupported, subjectType) {
+		return fmt.Errorf("subject_type must be %s or %s", SubjectTypePublic, SubjectTypePairwise)
+	}
+	if sectorIdentifierURI != "" {
+		u, err := url.Parse(sectorIdentifierURI)
+		if err != nil || u.Host == "" || u.Fragment != "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname()))) {
+			return errors.New("sector_identifier_uri must be an https URL")
+		}
+		return nil
+	}
+	if subjectType != SubjectTypePairwise {
+		return nil
+	}
+
+	hosts := make(map[string]bool)
+	for _, uri := range redirectURIs {
+		if u, err := url.Parse(uri); err == nil {
+			hosts[u.Host] = true
+		}
+	}
+	if len(hosts) != 1 {
+		return errors.New("pairwise clients must register a sector_identifier_uri unless all redirect_uris share one host")
+	}
+	return nil
+}
+
+// checkSectorIdentifierURI fetches a sector identifier document, a JSON array of redirect URIs,
+// and checks that it lists every redirect URI of the client, so a client can only join the
+// sector of the party hosting the document (OIDC Dynamic Client Registration Section 5). The
+// URI is client metadata, so it is fetched like other client-hosted documents, refusing private
+// addresses unless SetPrivateNetworkFetches allowed them.
+func (idp *MockIdP) checkSectorIdentifierURI(sectorIdentifierURI string, redirectURIs []string) error {
+	if sectorIdentifierURI == "" {
+		return nil
+	}
+
+	resp, err := idp.fetchClient.Get(sectorIdentifierURI)
+	if err != nil {
+		return fmt.Errorf("failed to fetch sector_identifier_uri: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sector_identifier_uri returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, sectorIdentifierMaxSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read sector_identifier_uri: %w", err)
+	}
+	if len(body) > sectorIdentifierMaxSize {
+		return errors.New("sector identifier document is too large")
+	}
+
+	var listed []string
+	if err := json.Unmarshal(body, &listed); err != nil {
+		return errors.New("sector identifier document must be a JSON array of redirect URIs")
+	}
+	for _, uri := range redirectURIs {
+		if !slices.Contains(listed, uri) {
+			return fmt.Errorf("redirect_uri %s is not listed in the sector identifier document", uri)
+		}
+	}
+	return nil
+}
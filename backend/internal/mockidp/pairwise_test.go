@@ -0,0 +1,104 @@
+package mockidp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+func TestPairwiseSubjectsDifferPerSector(t *testing.T) {
+	idp := newTestIdP(t)
+
+	news := idp.SubjectIdentifier("news-app", "alice")
+	shop := idp.SubjectIdentifier("shop-app", "alice")
+	if news == "alice" || shop == "alice" || news == shop {
+		t.Fatalf("news sub = %q, shop sub = %q", news, shop)
+	}
+	if again := idp.SubjectIdentifier("news-app", "alice"); again != news {
+		t.Errorf("news sub changed from %q to %q", news, again)
+	}
+	if got := idp.ResolveSubject("news-app", news); got != "alice" {
+		t.Errorf("ResolveSubject = %q", got)
+	}
+	if got := idp.ResolveSubject("shop-app", news); got == "alice" {
+		t.Error("news sub resolved for shop-app")
+	}
+	if got := idp.SubjectIdentifier("demo-app", "alice"); got != "alice" {
+		t.Errorf("public client sub = %q", got)
+	}
+}
+
+func TestPairwiseIDTokenClaimsOmitUserID(t *testing.T) {
+	idp := newTestIdP(t)
+	scopes := []string{"openid", "profile", "email"}
+
+	claims := idp.IDTokenClaims("news-app", "alice", scopes, nil)
+	if claims["sub"] != idp.SubjectIdentifier("news-app", "alice") {
+		t.Errorf("sub = %v", claims["sub"])
+	}
+	if _, ok := claims["preferred_username"]; ok {
+		t.Errorf("pairwise client given preferred_username %v", claims["preferred_username"])
+	}
+	if public := idp.IDTokenClaims("demo-app", "alice", scopes, nil); public["preferred_username"] == nil {
+		t.Error("public client lost preferred_username")
+	}
+}
+
+func TestPairwiseClientsGetOpaqueAccessTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	if got := idp.AccessTokenFormat("news-app"); got != AccessTokenFormatOpaque {
+		t.Fatalf("AccessTokenFormat = %q", got)
+	}
+
+	token, err := idp.IssueAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "news-app", Scope: "openid"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !idp.IsReferenceToken(token) {
+		t.Errorf("pairwise client issued a JWT access token: %s", token)
+	}
+
+	md := newTestMetadata()
+	md.SubjectType = SubjectTypePairwise
+	client, err := idp.RegisterClient(md)
+	if err != nil {
+		t.Fatalf("RegisterClient: %v", err)
+	}
+	if client.AccessTokenFormat != AccessTokenFormatOpaque {
+		t.Errorf("registered access_token_format = %q", client.AccessTokenFormat)
+	}
+
+	md = newTestMetadata()
+	md.SubjectType = SubjectTypePairwise
+	md.AccessTokenFormat = AccessTokenFormatJWT
+	var regErr *RegistrationError
+	if _, err := idp.RegisterClient(md); !errors.As(err, &regErr) || regErr.Code != ErrorInvalidClientMetadata {
+		t.Errorf("pairwise client registered with JWT access tokens: %v", err)
+	}
+}
+
+func TestSectorIdentifierURIRefusesPrivateAddresses(t *testing.T) {
+	idp := newTestIdP(t)
+	redirectURIs := []string{"https://app.example/callback"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(redirectURIs)
+	}))
+	defer server.Close()
+
+	if err := idp.checkSectorIdentifierURI(server.URL, redirectURIs); !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("err = %v, want %v", err, errPrivateAddress)
+	}
+
+	idp.SetPrivateNetworkFetches(true)
+	if err := idp.checkSectorIdentifierURI(server.URL, redirectURIs); err != nil {
+		t.Errorf("fetch with private addresses allowed: %v", err)
+	}
+	if err := idp.checkSectorIdentifierURI(server.URL, []string{"https://other.example/callback"}); err == nil {
+		t.Error("unlisted redirect URI accepted")
+	}
+}
@@ -0,0 +1,69 @@
+package mockidp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+const (
+	// RequestURIPrefix is the URN prefix for PAR request URIs (RFC 9126 Section 2.2)
+	RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+	// pushedRequestLifetime is how long a pushed request remains usable
+	pushedRequestLifetime = 90 * time.Second
+)
+
+// CreatePushedAuthorizationRequest stores authorization request parameters and returns the request_uri handle
+func (idp *MockIdP) CreatePushedAuthorizationRequest(clientID string, params map[string]string) *models.PushedAuthorizationRequest {
+	now := time.Now()
+	par := &models.PushedAuthorizationRequest{
+		RequestURI: RequestURIPrefix + generateRandomString(32),
+		ClientID:   clientID,
+		Parameters: params,
+		ExpiresAt:  now.Add(pushedRequestLifetime),
+		CreatedAt:  now,
+	}
+
+	idp.mu.Lock()
+	idp.pushedRequests[par.RequestURI] = par
+	idp.mu.Unlock()
+
+	return par
+}
+
+// GetPushedAuthorizationRequest looks up a pushed request without consuming it
+func (idp *MockIdP) GetPushedAuthorizationRequest(requestURI, clientID string) (*models.PushedAuthorizationRequest, error) {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	return idp.lookupPushedRequest(requestURI, clientID)
+}
+
+// ConsumePushedAuthorizationRequest looks up a pushed request and removes it so it cannot be replayed
+func (idp *MockIdP) ConsumePushedAuthorizationRequest(requestURI, clientID string) (*models.PushedAuthorizationRequest, error) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	par, err := idp.lookupPushedRequest(requestURI, clientID)
+	if err != nil {
+		return nil, err
+	}
+	delete(idp.pushedRequests, requestURI)
+	return par, nil
+}
+
+// lookupPushedRequest validates a request_uri. Caller must hold the lock.
+func (idp *MockIdP) lookupPushedRequest(requestURI, clientID string) (*models.PushedAuthorizationRequest, error) {
+	par, exists := idp.pushedRequests[requestURI]
+	if !exists {
+		return nil, errors.New("unknown or already used request_uri")
+	}
+	if par.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("request_uri expired")
+	}
+	if par.ClientID != clientID {
+		return nil, errors.New("request_uri was not issued to this client")
+	}
+	return par, nil
+}
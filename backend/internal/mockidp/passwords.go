@@ -0,0 +1,316 @@
+package mockidp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Password hashing algorithms. Hashes are stored in the PHC string format, or bcrypt's own.
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashPBKDF2   = "pbkdf2-sha256"
+)
+
+// PasswordHashAlgorithms lists the algorithms new password hashes can be created with
+var PasswordHashAlgorithms = []string{PasswordHashArgon2id, PasswordHashBcrypt, PasswordHashPBKDF2}
+
+// Hashing parameters, following the OWASP Password Storage Cheat Sheet. A stored hash made
+// with weaker parameters is upgraded at the user's next successful login.
+const (
+	argon2Memory      = 19 * 1024 // KiB
+	argon2Iterations  = 2
+	argon2Parallelism = 1
+	argon2KeyLength   = 32
+	bcryptCost        = 12
+	pbkdf2Iterations  = 600000
+	passwordSaltBytes = 16
+)
+
+var (
+	// ErrInvalidCredentials is returned for an unknown login or a wrong password
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrAccountLocked is returned while an account is locked after repeated failed logins
+	ErrAccountLocked = errors.New("account is temporarily locked after too many failed logins")
+)
+
+// PasswordPolicy is the set of rules new passwords must satisfy
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength bounds the work of hashing a password
+	MaxLength int
+	// MinCharacterClasses is how many of lowercase, uppercase, digits and symbols are required
+	MinCharacterClasses int
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B Section 5.1.1.2 in favouring length and
+// rejecting common passwords, with a light composition rule
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 128, MinCharacterClasses: 2}
+
+// commonPasswords are rejected regardless of the policy's composition rules
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "passw0rd": true,
+	"12345678": true, "123456789": true, "1234567890": true, "qwerty123": true,
+	"iloveyou": true, "admin123": true, "letmein1": true, "welcome1": true,
+	"changeme": true, "trustno1": true, "abc12345": true, "11111111": true,
+}
+
+// LockoutPolicy locks an account once MaxFailures logins have failed within Duration. It stays
+// locked until the oldest of those failures is Duration old.
+type LockoutPolicy struct {
+	MaxFailures int
+	Duration    time.Duration
+}
+
+// DefaultLockoutPolicy keeps lockouts short, since anyone can lock out the public demo users
+var DefaultLockoutPolicy = LockoutPolicy{MaxFailures: 5, Duration: 5 * time.Minute}
+
+// Validate checks a new password for a user against the policy
+func (policy PasswordPolicy) Validate(user *models.User, password string) error {
+	length := len([]rune(password))
+	if length < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters", policy.MinLength)
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		return fmt.Errorf("password must be at most %d characters", policy.MaxLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < policy.MinCharacterClasses {
+		return fmt.Errorf("password must mix at least %d of lowercase, uppercase, digits and symbols", policy.MinCharacterClasses)
+	}
+
+	folded := strings.ToLower(password)
+	if commonPasswords[folded] {
+		return errors.New("password is too common")
+	}
+	if user != nil {
+		for _, identifier := range []string{user.ID, strings.Split(user.Email, "@")[0]} {
+			if len(identifier) >= 3 && strings.Contains(folded, strings.ToLower(identifier)) {
+				return errors.New("password must not contain the user's ID or email name")
+			}
+		}
+	}
+	return nil
+}
+
+// HashPassword hashes a password with a fresh salt using algorithm
+func HashPassword(algorithm, password string) (string, error) {
+	salt := make([]byte, passwordSaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	b64 := base64.RawStdEncoding
+
+	switch algorithm {
+	case PasswordHashArgon2id:
+		key := argon2.IDKey([]byte(password), salt, argon2Iterations, argon2Memory, argon2Parallelism, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argon2Memory, argon2Iterations, argon2Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	case PasswordHashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+		return string(hash), err
+	case PasswordHashPBKDF2:
+		key := pbkdf2.Key([]byte(password), salt, pbkdf2Iterations, sha256.Size, sha256.New)
+		return fmt.Sprintf("$pbkdf2-sha256$i=%d$%s$%s", pbkdf2Iterations, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	default:
+		return "", fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+	}
+}
+
+// VerifyPassword checks a password against a stored hash. needsRehash reports a hash that is
+// not made with algorithm and the current parameters, including a legacy plaintext password.
+func VerifyPassword(encoded, password, algorithm string) (ok, needsRehash bool) {
+	b64 := base64.RawStdEncoding
+
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		// $argon2id$v=19$m=...,t=...,p=...$salt$key
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 6 {
+			return false, false
+		}
+		var version int
+		var memory, iterations uint32
+		var parallelism uint8
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false, false
+		}
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+			return false, false
+		}
+		salt, err1 := b64.DecodeString(parts[4])
+		key, err2 := b64.DecodeString(parts[5])
+		if err1 != nil || err2 != nil || len(key) == 0 {
+			return false, false
+		}
+		computed := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+		ok = subtle.ConstantTimeCompare(computed, key) == 1
+		current := memory >= argon2Memory && iterations >= argon2Iterations
+		return ok, algorithm != PasswordHashArgon2id || !current
+
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		if bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return true, algorithm != PasswordHashBcrypt || err != nil || cost < bcryptCost
+
+	case strings.HasPrefix(encoded, "$pbkdf2-sha256$"):
+		// $pbkdf2-sha256$i=...$salt$key
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 5 || !strings.HasPrefix(parts[2], "i=") {
+			return false, false
+		}
+		iterations, err := strconv.Atoi(strings.TrimPrefix(parts[2], "i="))
+		if err != nil || iterations < 1 {
+			return false, false
+		}
+		salt, err1 := b64.DecodeString(parts[3])
+		key, err2 := b64.DecodeString(parts[4])
+		if err1 != nil || err2 != nil || len(key) == 0 {
+			return false, false
+		}
+		computed := pbkdf2.Key([]byte(password), salt, iterations, len(key), sha256.New)
+		ok = subtle.ConstantTimeCompare(computed, key) == 1
+		return ok, algorithm != PasswordHashPBKDF2 || iterations < pbkdf2Iterations
+
+	case encoded != "" && !strings.HasPrefix(encoded, "$"):
+		// A plaintext password stored before hashing was introduced
+		ok = subtle.ConstantTimeCompare([]byte(encoded), []byte(password)) == 1
+		return ok, true
+	}
+	return false, false
+}
+
+// SetPasswordHashAlgorithm selects the algorithm new and upgraded password hashes are made with
+func (idp *MockIdP) SetPasswordHashAlgorithm(algorithm string) error {
+	for _, supported := range PasswordHashAlgorithms {
+		if algorithm == supported {
+			idp.mu.Lock()
+			defer idp.mu.Unlock()
+			idp.passwordHashAlgorithm = algorithm
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+}
+
+// hashPassword hashes a password with the configured algorithm
+func (idp *MockIdP) hashPassword(password string) (string, error) {
+	idp.mu.RLock()
+	algorithm := idp.passwordHashAlgorithm
+	idp.mu.RUnlock()
+	return HashPassword(algorithm, password)
+}
+
+// checkPassword verifies a user's password, recording failures against the lockout policy and
+// upgrading an outdated hash after a successful login
+func (idp *MockIdP) checkPassword(user *models.User, password string) error {
+	// The attempt is counted before the password is hashed, so parallel guesses cannot all slip
+	// under the limit and a locked account costs no hashing
+	if !idp.loginAttempts.Allow(user.ID) {
+		return ErrAccountLocked
+	}
+
+	idp.mu.RLock()
+	algorithm := idp.passwordHashAlgorithm
+	idp.mu.RUnlock()
+
+	ok, needsRehash := VerifyPassword(user.Password, password, algorithm)
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	idp.loginAttempts.Reset(user.ID)
+
+	if needsRehash {
+		idp.rehashPassword(user.ID, password, algorithm)
+	}
+	return nil
+}
+
+// rejectUnknownLogin fails a login no user has. The attempt counts against the login like one
+// for an existing account, and a dummy hash is verified so that the response takes as long as a
+// wrong password and does not reveal which logins exist.
+func (idp *MockIdP) rejectUnknownLogin(login, password string) error {
+	if !idp.loginAttempts.Allow("login:" + strings.ToLower(login)) {
+		return ErrAccountLocked
+	}
+
+	idp.mu.RLock()
+	algorithm := idp.passwordHashAlgorithm
+	hash := idp.dummyPasswordHashes[algorithm]
+	idp.mu.RUnlock()
+
+	if hash == "" {
+		var err error
+		if hash, err = HashPassword(algorithm, generateRandomString(24)); err != nil {
+			return ErrInvalidCredentials
+		}
+		idp.mu.Lock()
+		idp.dummyPasswordHashes[algorithm] = hash
+		idp.mu.Unlock()
+	}
+	VerifyPassword(hash, password, algorithm)
+	return ErrInvalidCredentials
+}
+
+// rehashPassword replaces a stored password hash after the user proved they know the password
+func (idp *MockIdP) rehashPassword(userID, password, algorithm string) {
+	hash, err := HashPassword(algorithm, password)
+	if err != nil {
+		logStoreError("hash password", err)
+		return
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	user, err := idp.store.GetUser(userID)
+	if err != nil {
+		logStoreError("get user", err)
+		return
+	}
+	user.Password = hash
+	logStoreError("put user", idp.store.PutUser(user))
+}
+
+// UnlockUser lifts a lockout and resets the user's failed login count
+func (idp *MockIdP) UnlockUser(userID string) {
+	idp.loginAttempts.Reset(userID)
+}
+
+// LockedUntil returns when a user's lockout ends, or the zero time if the user is not locked out
+func (idp *MockIdP) LockedUntil(userID string) time.Time {
+	return idp.loginAttempts.RetryAt(userID)
+}
@@ -0,0 +1,81 @@
+package mockidp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockoutCountsParallelAttempts(t *testing.T) {
+	idp := newTestIdP(t)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := map[error]int{}
+	for i := 0; i < 3*DefaultLockoutPolicy.MaxFailures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := idp.ValidateCredentials("alice@example.com", "wrong-password")
+			mu.Lock()
+			results[err]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if results[ErrInvalidCredentials] != DefaultLockoutPolicy.MaxFailures {
+		t.Errorf("%d passwords checked, want %d: %v", results[ErrInvalidCredentials], DefaultLockoutPolicy.MaxFailures, results)
+	}
+
+	if _, err := idp.ValidateCredentials("alice@example.com", "password123"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("locked account: err = %v", err)
+	}
+	if until := idp.LockedUntil("alice"); time.Until(until) <= 0 || time.Until(until) > DefaultLockoutPolicy.Duration {
+		t.Errorf("LockedUntil = %v", until)
+	}
+
+	idp.UnlockUser("alice")
+	if _, err := idp.ValidateCredentials("alice@example.com", "password123"); err != nil {
+		t.Errorf("unlocked account: %v", err)
+	}
+	if !idp.LockedUntil("alice").IsZero() {
+		t.Error("account still locked after unlock")
+	}
+}
+
+func TestUnknownLoginsLookLikeWrongPasswords(t *testing.T) {
+	idp := newTestIdP(t)
+
+	for i := 0; i < DefaultLockoutPolicy.MaxFailures; i++ {
+		if _, err := idp.ValidateCredentials("nobody@example.com", "guess"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: err = %v", i+1, err)
+		}
+	}
+	if _, err := idp.ValidateCredentials("NOBODY@example.com", "guess"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("unknown login not locked like an account: err = %v", err)
+	}
+
+	// The unknown login was checked against a real hash of the configured algorithm
+	idp.mu.RLock()
+	hash := idp.dummyPasswordHashes[PasswordHashArgon2id]
+	idp.mu.RUnlock()
+	if hash == "" {
+		t.Error("no dummy hash verified for unknown logins")
+	}
+}
+
+func TestAttemptLimiterPrune(t *testing.T) {
+	limiter := newAttemptLimiter(2, time.Minute)
+	limiter.Allow("a")
+	limiter.Allow("b")
+	limiter.Allow("b")
+	if limiter.RetryAt("a") != (time.Time{}) || limiter.RetryAt("b").IsZero() {
+		t.Errorf("RetryAt: a = %v, b = %v", limiter.RetryAt("a"), limiter.RetryAt("b"))
+	}
+
+	limiter.Prune(time.Now().Add(2 * time.Minute))
+	if len(limiter.attempts) != 0 {
+		t.Errorf("attempts after prune = %v", limiter.attempts)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
@@ -13,35 +15,78 @@ import (
 
 // MockIdP provides a mock identity provider for demonstrations
 type MockIdP struct {
-	users         map[string]*models.User
-	clients       map[string]*models.Client
-	authCodes     map[string]*models.AuthorizationCode
-	sessions      map[string]*models.Session
-	refreshTokens map[string]*models.RefreshToken
-	keySet        *crypto.KeySet
-	jwtService    *crypto.JWTService
-	issuer        string
-	mu            sync.RWMutex
+	store                     Store                                         // users, clients, authorization codes, sessions and refresh tokens
+	deviceCodes               map[string]*models.DeviceAuthorization        // device_code -> authorization
+	userCodes                 map[string]string                             // user_code -> device_code
+	userCodeFailures          *attemptLimiter                               // source -> invalid user codes entered
+	pushedRequests            map[string]*models.PushedAuthorizationRequest // request_uri -> request
+	dpopNonces                map[string]time.Time                          // nonce -> expiry
+	dpopProofs                map[string]time.Time                          // proof jti -> replay window end
+	clientAssertions          map[string]time.Time                          // client_id:jti -> replay window end
+	usedRequestObjects        map[string]time.Time                          // client_id:jti -> replay window end
+	authorizationDetailsTypes map[string]map[string]interface{}             // RAR type -> JSON schema
+	resources                 map[string]*models.ProtectedResource          // resource indicator -> resource
+	backchannelRequests       map[string]*models.BackchannelAuthentication  // auth_req_id -> CIBA request
+	jwksFetcher               *crypto.JWKSFetcher
+	fetchClient               *http.Client // fetches client-hosted documents; see newFetchClient
+	keySet                    *crypto.KeySet
+	jwtService                *crypto.JWTService
+	issuer                    string
+	mu                        sync.RWMutex
+	sources                   []IdentitySource // directories of users managed elsewhere, such as SCIM
+	sourcesMu                 sync.RWMutex
+
+	passwordHashAlgorithm string                          // algorithm of new and upgraded password hashes
+	loginAttempts         *attemptLimiter                 // user ID, or "login:" + unknown login -> failed logins
+	dummyPasswordHashes   map[string]string               // algorithm -> hash verified for unknown logins
+	credentialVerifiers   map[string][]CredentialVerifier // acr -> factors required in addition to the password
+	pairwiseSalt          string                          // secret mixed into pairwise subject identifiers
+	pairwiseSubjects      map[string]string               // sector + " " + pairwise sub -> user ID
 }
 
-// NewMockIdP creates a new mock identity provider
-func NewMockIdP(keySet *crypto.KeySet) *MockIdP {
+// NewMockIdP creates a new mock identity provider backed by store. Demo users and clients missing
+// from the store are added; those already stored are left as they are, so changes made through
+// the admin API, such as a disabled client or a new password, survive a restart.
+func NewMockIdP(keySet *crypto.KeySet, store Store) (*MockIdP, error) {
 	idp := &MockIdP{
-		users:         make(map[string]*models.User),
-		clients:       make(map[string]*models.Client),
-		authCodes:     make(map[string]*models.AuthorizationCode),
-		sessions:      make(map[string]*models.Session),
-		refreshTokens: make(map[string]*models.RefreshToken),
-		keySet:        keySet,
-		issuer:        "http://localhost:8080",
+		store:                     store,
+		deviceCodes:               make(map[string]*models.DeviceAuthorization),
+		userCodes:                 make(map[string]string),
+		userCodeFailures:          newAttemptLimiter(userCodeMaxFailures, userCodeFailureWindow),
+		pushedRequests:            make(map[string]*models.PushedAuthorizationRequest),
+		dpopNonces:                make(map[string]time.Time),
+		dpopProofs:                make(map[string]time.Time),
+		clientAssertions:          make(map[string]time.Time),
+		usedRequestObjects:        make(map[string]time.Time),
+		authorizationDetailsTypes: make(map[string]map[string]interface{}),
+		resources:                 make(map[string]*models.ProtectedResource),
+		backchannelRequests:       make(map[string]*models.BackchannelAuthentication),
+		keySet:                    keySet,
+		issuer:                    "http://localhost:8080",
+		passwordHashAlgorithm:     PasswordHashArgon2id,
+		loginAttempts:             newAttemptLimiter(DefaultLockoutPolicy.MaxFailures, DefaultLockoutPolicy.Duration),
+		dummyPasswordHashes:       make(map[string]string),
+		credentialVerifiers:       make(map[string][]CredentialVerifier),
+		pairwiseSubjects:          make(map[string]string),
 	}
 
 	idp.jwtService = crypto.NewJWTService(keySet, idp.issuer)
+	idp.SetPrivateNetworkFetches(false)
+
+	salt, err := loadPairwiseSalt(store)
+	if err != nil {
+		return nil, err
+	}
+	idp.pairwiseSalt = salt
 
 	// Initialize demo users and clients
-	idp.initDemoData()
+	if err := idp.initDemoData(); err != nil {
+		return nil, err
+	}
+	idp.loadBuiltinAuthorizationDetailsTypes()
+	idp.RegisterCredentialVerifier(ACRMultiFactor, DemoOneTimeCodeVerifier{})
 
-	return idp
+	return idp, nil
 }
 
 // SetIssuer sets the issuer URL
@@ -59,39 +104,45 @@ func (idp *MockIdP) GetIssuer() string {
 	return idp.issuer
 }
 
-// initDemoData initializes demo users and clients
-func (idp *MockIdP) initDemoData() {
+// initDemoData initializes protected resources and adds the demo users and clients the store lacks
+func (idp *MockIdP) initDemoData() error {
+	users := make(map[string]*models.User)
+	clients := make(map[string]*models.Client)
+
 	// Demo users
-	idp.users["alice"] = &models.User{
+	users["alice"] = &models.User{
 		ID:       "alice",
 		Email:    "alice@example.com",
 		Name:     "Alice Johnson",
-		Password: "password123", // In a real system, this would be hashed
+		Password: "password123", // Hashed before it is stored
 		Roles:    []string{"user"},
+		Groups:   []string{"engineering"},
 		Claims: map[string]string{
 			"department": "Engineering",
 		},
 		CreatedAt: time.Now(),
 	}
 
-	idp.users["bob"] = &models.User{
+	users["bob"] = &models.User{
 		ID:       "bob",
 		Email:    "bob@example.com",
 		Name:     "Bob Smith",
 		Password: "password123",
 		Roles:    []string{"user"},
+		Groups:   []string{"marketing"},
 		Claims: map[string]string{
 			"department": "Marketing",
 		},
 		CreatedAt: time.Now(),
 	}
 
-	idp.users["admin"] = &models.User{
+	users["admin"] = &models.User{
 		ID:       "admin",
 		Email:    "admin@example.com",
 		Name:     "Admin User",
 		Password: "admin123",
 		Roles:    []string{"user", "admin"},
+		Groups:   []string{"it", "administrators"},
 		Claims: map[string]string{
 			"department": "IT",
 		},
@@ -100,7 +151,7 @@ func (idp *MockIdP) initDemoData() {
 
 	// Demo OAuth clients
 	// Note: Redirect URIs include local development, Fly.io, and custom domain URLs
-	idp.clients["demo-app"] = &models.Client{
+	clients["demo-app"] = &models.Client{
 		ID:     "demo-app",
 		Secret: "demo-secret",
 		Name:   "Demo Application",
@@ -117,7 +168,7 @@ func (idp *MockIdP) initDemoData() {
 		CreatedAt:  time.Now(),
 	}
 
-	idp.clients["public-app"] = &models.Client{
+	clients["public-app"] = &models.Client{
 		ID:     "public-app",
 		Secret: "",
 		Name:   "Public Application (SPA)",
@@ -134,7 +185,53 @@ func (idp *MockIdP) initDemoData() {
 		CreatedAt:  time.Now(),
 	}
 
-	idp.clients["machine-client"] = &models.Client{
+	clients["par-app"] = &models.Client{
+		ID:     "par-app",
+		Secret: "par-secret",
+		Name:   "High-Security Application (PAR Required)",
+		RedirectURIs: []string{
+			"http://localhost:3000/callback",
+			"http://localhost:5173/callback",
+			"https://protocolsoup.com/callback",
+			"https://www.protocolsoup.com/callback",
+			"https://protocolsoup.fly.dev/callback",
+		},
+		GrantTypes:                         []string{"authorization_code", "refresh_token"},
+		Scopes:                             []string{"openid", "profile", "email"},
+		Public:                             false,
+		RequirePushedAuthorizationRequests: true,
+		CreatedAt:                          time.Now(),
+	}
+
+	// Native app: loopback redirects match on any port, and PKCE is mandatory (RFC 8252)
+	clients["native-app"] = &models.Client{
+		ID:   "native-app",
+		Name: "Native Application (CLI / Desktop)",
+		RedirectURIs: []string{
+			"http://127.0.0.1/callback",
+			"http://[::1]/callback",
+			"com.protocolsoup.native:/callback",
+			"https://protocolsoup.com/native/callback",
+		},
+		GrantTypes:      []string{"authorization_code", "refresh_token"},
+		Scopes:          []string{"openid", "profile", "email"},
+		Public:          true,
+		ApplicationType: ApplicationTypeNative,
+		CreatedAt:       time.Now(),
+	}
+
+	clients["device-client"] = &models.Client{
+		ID:           "device-client",
+		Secret:       "",
+		Name:         "Smart TV / CLI (Device)",
+		RedirectURIs: []string{},
+		GrantTypes:   []string{"urn:ietf:params:oauth:grant-type:device_code", "refresh_token"},
+		Scopes:       []string{"openid", "profile", "email"},
+		Public:       true,
+		CreatedAt:    time.Now(),
+	}
+
+	clients["machine-client"] = &models.Client{
 		ID:           "machine-client",
 		Secret:       "machine-secret",
 		Name:         "Machine-to-Machine Client",
@@ -144,46 +241,316 @@ func (idp *MockIdP) initDemoData() {
 		Public:       false,
 		CreatedAt:    time.Now(),
 	}
+
+	clients["exchange-client"] = &models.Client{
+		ID:           "exchange-client",
+		Secret:       "exchange-secret",
+		Name:         "Token Exchange Service",
+		RedirectURIs: []string{},
+		GrantTypes:   []string{"urn:ietf:params:oauth:grant-type:token-exchange"},
+		Scopes:       []string{"openid", "profile", "email", "api:read", "api:write"},
+		Public:       false,
+		CreatedAt:    time.Now(),
+	}
+
+	clients["jwt-client"] = &models.Client{
+		ID:                      "jwt-client",
+		Secret:                  "jwt-client-secret-at-least-32-bytes",
+		Name:                    "JWT-Authenticated Service",
+		RedirectURIs:            []string{},
+		GrantTypes:              []string{"client_credentials"},
+		Scopes:                  []string{"api:read", "api:write"},
+		Public:                  false,
+		TokenEndpointAuthMethod: AuthMethodClientSecretJWT,
+		CreatedAt:               time.Now(),
+	}
+
+	clients["payments-app"] = &models.Client{
+		ID:     "payments-app",
+		Secret: "payments-secret",
+		Name:   "Payments Application (RAR)",
+		RedirectURIs: []string{
+			"http://localhost:3000/callback",
+			"http://localhost:5173/callback",
+			"https://protocolsoup.com/callback",
+			"https://www.protocolsoup.com/callback",
+			"https://protocolsoup.fly.dev/callback",
+		},
+		GrantTypes:                []string{"authorization_code", "refresh_token", "client_credentials"},
+		Scopes:                    []string{"openid", "profile", "email"},
+		Public:                    false,
+		AuthorizationDetailsTypes: []string{"payment_initiation", "account_information"},
+		CreatedAt:                 time.Now(),
+	}
+
+	// Pairwise subject clients in different sectors receive unrelated sub values for the same user
+	// (OIDC Core Section 8.1). Their sector identifier documents are trusted and not fetched.
+	clients["news-app"] = &models.Client{
+		ID:     "news-app",
+		Secret: "news-secret",
+		Name:   "News Reader (Pairwise Subject)",
+		RedirectURIs: []string{
+			"http://localhost:3000/callback",
+			"http://localhost:5173/callback",
+			"https://protocolsoup.com/callback",
+			"https://www.protocolsoup.com/callback",
+			"https://protocolsoup.fly.dev/callback",
+		},
+		GrantTypes:          []string{"authorization_code", "refresh_token"},
+		Scopes:              []string{"openid", "profile", "email"},
+		Public:              false,
+		SubjectType:         SubjectTypePairwise,
+		SectorIdentifierURI: "https://news.protocolsoup.com/sector_identifier.json",
+		CreatedAt:           time.Now(),
+	}
+
+	clients["shop-app"] = &models.Client{
+		ID:     "shop-app",
+		Secret: "shop-secret",
+		Name:   "Online Shop (Pairwise Subject)",
+		RedirectURIs: []string{
+			"http://localhost:3000/callback",
+			"http://localhost:5173/callback",
+			"https://protocolsoup.com/callback",
+			"https://www.protocolsoup.com/callback",
+			"https://protocolsoup.fly.dev/callback",
+		},
+		GrantTypes:          []string{"authorization_code", "refresh_token"},
+		Scopes:              []string{"openid", "profile", "email"},
+		Public:              false,
+		SubjectType:         SubjectTypePairwise,
+		SectorIdentifierURI: "https://shop.protocolsoup.com/sector_identifier.json",
+		CreatedAt:           time.Now(),
+	}
+
+	// JAR client: every authorization request must be an HS256 request object signed with its secret (RFC 9101)
+	clients["jar-app"] = &models.Client{
+		ID:     "jar-app",
+		Secret: "jar-app-secret-at-least-32-bytes",
+		Name:   "Signed Request Application (JAR/JARM)",
+		RedirectURIs: []string{
+			"http://localhost:3000/callback",
+			"http://localhost:5173/callback",
+			"https://protocolsoup.com/callback",
+			"https://www.protocolsoup.com/callback",
+			"https://protocolsoup.fly.dev/callback",
+		},
+		GrantTypes:                     []string{"authorization_code", "refresh_token"},
+		Scopes:                         []string{"openid", "profile", "email"},
+		Public:                         false,
+		RequestObjectSigningAlg:        "HS256",
+		RequireSignedRequestObject:     true,
+		AuthorizationSignedResponseAlg: "RS256",
+		CreatedAt:                      time.Now(),
+	}
+
+	// Encrypted response client: its JWKS holds the provider's own encryption keys, standing in for a
+	// relying party's keys, so its encrypted ID tokens can be passed back as id_token_hint
+	clients["jwe-app"] = &models.Client{
+		ID:     "jwe-app",
+		Secret: "jwe-secret",
+		Name:   "Regulated Records Portal (Encrypted ID Tokens)",
+		RedirectURIs: []string{
+			"http://localhost:3000/callback",
+			"http://localhost:5173/callback",
+			"https://protocolsoup.com/callback",
+			"https://www.protocolsoup.com/callback",
+			"https://protocolsoup.fly.dev/callback",
+		},
+		GrantTypes:                   []string{"authorization_code", "refresh_token"},
+		Scopes:                       []string{"openid", "profile", "email"},
+		Public:                       false,
+		JWKS:                         idp.providerEncryptionJWKS(),
+		IDTokenEncryptedResponseAlg:  crypto.KeyAlgRSAOAEP256,
+		IDTokenEncryptedResponseEnc:  crypto.EncA256GCM,
+		UserInfoSignedResponseAlg:    "RS256",
+		UserInfoEncryptedResponseAlg: crypto.KeyAlgECDHESA256KW,
+		UserInfoEncryptedResponseEnc: crypto.EncA256GCM,
+		CreatedAt:                    time.Now(),
+	}
+
+	clients["opaque-client"] = &models.Client{
+		ID:                "opaque-client",
+		Secret:            "opaque-secret",
+		Name:              "Reference Token Service",
+		RedirectURIs:      []string{},
+		GrantTypes:        []string{"client_credentials"},
+		Scopes:            []string{"api:read", "api:write"},
+		Public:            false,
+		AccessTokenFormat: AccessTokenFormatOpaque,
+		CreatedAt:         time.Now(),
+	}
+
+	// CIBA clients, one per token delivery mode. The ping and push notification endpoints are
+	// set by the OIDC plugin once its base URL is known.
+	clients["ciba-poll-app"] = &models.Client{
+		ID:                           "ciba-poll-app",
+		Secret:                       "ciba-poll-secret",
+		Name:                         "Call Center Agent (CIBA Poll)",
+		RedirectURIs:                 []string{},
+		GrantTypes:                   []string{GrantTypeCIBA, "refresh_token"},
+		Scopes:                       []string{"openid", "profile", "email"},
+		Public:                       false,
+		BackchannelTokenDeliveryMode: DeliveryModePoll,
+		CreatedAt:                    time.Now(),
+	}
+
+	clients["ciba-ping-app"] = &models.Client{
+		ID:                           "ciba-ping-app",
+		Secret:                       "ciba-ping-secret",
+		Name:                         "Point of Sale Terminal (CIBA Ping)",
+		RedirectURIs:                 []string{},
+		GrantTypes:                   []string{GrantTypeCIBA, "refresh_token"},
+		Scopes:                       []string{"openid", "profile", "email"},
+		Public:                       false,
+		BackchannelTokenDeliveryMode: DeliveryModePing,
+		CreatedAt:                    time.Now(),
+	}
+
+	clients["ciba-push-app"] = &models.Client{
+		ID:                           "ciba-push-app",
+		Secret:                       "ciba-push-secret",
+		Name:                         "Banking Back Office (CIBA Push)",
+		RedirectURIs:                 []string{},
+		GrantTypes:                   []string{GrantTypeCIBA, "refresh_token"},
+		Scopes:                       []string{"openid", "profile", "email"},
+		Public:                       false,
+		BackchannelTokenDeliveryMode: DeliveryModePush,
+		CreatedAt:                    time.Now(),
+	}
+
+	// Mutual TLS clients authenticate with a certificate from the test CA or an X509-SVID (RFC 8705)
+	clients["mtls-client"] = &models.Client{
+		ID:                                    "mtls-client",
+		Name:                                  "Certificate-Authenticated Service (mTLS)",
+		RedirectURIs:                          []string{},
+		GrantTypes:                            []string{"client_credentials"},
+		Scopes:                                []string{"api:read", "api:write"},
+		Public:                                false,
+		TokenEndpointAuthMethod:               AuthMethodTLSClientAuth,
+		TLSClientAuthSubjectDN:                "CN=mtls-client,O=ProtocolSoup Demo",
+		TLSClientCertificateBoundAccessTokens: true,
+		CreatedAt:                             time.Now(),
+	}
+
+	clients["spiffe-client"] = &models.Client{
+		ID:                                    "spiffe-client",
+		Name:                                  "SPIFFE Workload (X509-SVID)",
+		RedirectURIs:                          []string{},
+		GrantTypes:                            []string{"client_credentials"},
+		Scopes:                                []string{"api:read", "api:write"},
+		Public:                                false,
+		TokenEndpointAuthMethod:               AuthMethodTLSClientAuth,
+		TLSClientAuthSANURI:                   "spiffe://protocolsoup.com/workload/oauth-client",
+		TLSClientCertificateBoundAccessTokens: true,
+		CreatedAt:                             time.Now(),
+	}
+
+	// Demo protected resources that tokens can be audience-restricted to (RFC 8707)
+	idp.resources["https://api.protocolsoup.com/orders"] = &models.ProtectedResource{
+		URI:         "https://api.protocolsoup.com/orders",
+		Name:        "Orders API",
+		Description: "Reads and places orders",
+		Scopes:      []string{"api:read", "api:write"},
+	}
+
+	idp.resources["https://api.protocolsoup.com/reports"] = &models.ProtectedResource{
+		URI:         "https://api.protocolsoup.com/reports",
+		Name:        "Reports API",
+		Description: "Read-only reporting",
+		Scopes:      []string{"api:read"},
+	}
+
+	// UserInfo requires openid, so the profile resource accepts it too
+	idp.resources[ProfileResource] = &models.ProtectedResource{
+		URI:         ProfileResource,
+		Name:        "Profile API",
+		Description: "Returns the signed-in user's profile from the UserInfo endpoint",
+		Scopes:      []string{"openid", "profile", "email"},
+	}
+
+	idp.resources[AccountResource] = &models.ProtectedResource{
+		URI:         AccountResource,
+		Name:        "Account API",
+		Description: "Step-up protected account and transfer endpoints",
+		Scopes:      []string{"openid", "api:read", "api:write"},
+	}
+
+	for _, user := range users {
+		if _, err := idp.store.GetUser(user.ID); !errors.Is(err, ErrNotFound) {
+			if err != nil {
+				return fmt.Errorf("failed to look up demo user %s: %w", user.ID, err)
+			}
+			continue
+		}
+		hash, err := idp.hashPassword(user.Password)
+		if err != nil {
+			return err
+		}
+		user.Password = hash
+		if err := idp.store.PutUser(user); err != nil {
+			return fmt.Errorf("failed to store demo user %s: %w", user.ID, err)
+		}
+	}
+	for _, client := range clients {
+		if _, err := idp.store.GetClient(client.ID); !errors.Is(err, ErrNotFound) {
+			if err != nil {
+				return fmt.Errorf("failed to look up demo client %s: %w", client.ID, err)
+			}
+			continue
+		}
+		if err := idp.store.PutClient(client); err != nil {
+			return fmt.Errorf("failed to store demo client %s: %w", client.ID, err)
+		}
+	}
+	return nil
 }
 
 // GetUser retrieves a user by ID
 func (idp *MockIdP) GetUser(id string) (*models.User, bool) {
-	idp.mu.RLock()
-	defer idp.mu.RUnlock()
-	user, exists := idp.users[id]
-	return user, exists
+	user, err := idp.store.GetUser(id)
+	logStoreError("get user", err)
+	if err != nil {
+		return idp.lookupSourceUser(func(source IdentitySource) (*models.User, error) {
+			return source.LookupUser(id)
+		})
+	}
+	return user, true
 }
 
 // GetUserByEmail retrieves a user by email
 func (idp *MockIdP) GetUserByEmail(email string) (*models.User, bool) {
-	idp.mu.RLock()
-	defer idp.mu.RUnlock()
-	for _, user := range idp.users {
-		if user.Email == email {
-			return user, true
-		}
+	user, err := idp.store.GetUserByEmail(email)
+	logStoreError("get user by email", err)
+	if err != nil {
+		return idp.lookupSourceUser(func(source IdentitySource) (*models.User, error) {
+			return source.LookupUserByLogin(email)
+		})
 	}
-	return nil, false
+	return user, true
 }
 
-// ValidateCredentials validates user credentials
+// ValidateCredentials validates user credentials, falling back to the identity sources for
+// logins that are not the IdP's own users
 func (idp *MockIdP) ValidateCredentials(email, password string) (*models.User, error) {
-	user, exists := idp.GetUserByEmail(email)
-	if !exists {
-		return nil, errors.New("user not found")
+	user, err := idp.store.GetUserByEmail(email)
+	logStoreError("get user by email", err)
+	if err != nil {
+		return idp.authenticateSourceUser(email, password)
 	}
-	if user.Password != password {
-		return nil, errors.New("invalid password")
+	if err := idp.checkPassword(user, password); err != nil {
+		return nil, err
 	}
 	return user, nil
 }
 
-// GetClient retrieves a client by ID
+// GetClient retrieves an enabled client by ID
 func (idp *MockIdP) GetClient(id string) (*models.Client, bool) {
-	idp.mu.RLock()
-	defer idp.mu.RUnlock()
-	client, exists := idp.clients[id]
-	return client, exists
+	client, exists := idp.LookupClient(id)
+	if !exists || client.Disabled {
+		return nil, false
+	}
+	return client, true
 }
 
 // ValidateClient validates client credentials
@@ -192,20 +559,24 @@ func (idp *MockIdP) ValidateClient(clientID, clientSecret string) (*models.Clien
 	if !exists {
 		return nil, errors.New("client not found")
 	}
+	if !client.Public && !clientAllowsAuthMethod(client, AuthMethodClientSecretBasic) {
+		return nil, errors.New("client must authenticate with " + client.TokenEndpointAuthMethod)
+	}
 	if !client.Public && client.Secret != clientSecret {
 		return nil, errors.New("invalid client secret")
 	}
 	return client, nil
 }
 
-// ValidateRedirectURI validates a redirect URI for a client
+// ValidateRedirectURI validates a redirect URI for a client, allowing any loopback port for native apps
 func (idp *MockIdP) ValidateRedirectURI(clientID, redirectURI string) bool {
 	client, exists := idp.GetClient(clientID)
 	if !exists {
 		return false
 	}
+	native := IsNativeClient(client)
 	for _, uri := range client.RedirectURIs {
-		if uri == redirectURI {
+		if redirectURIMatches(uri, redirectURI, native) {
 			return true
 		}
 	}
@@ -233,26 +604,22 @@ func (idp *MockIdP) CreateAuthorizationCode(
 		CreatedAt:           time.Now(),
 	}
 
-	idp.mu.Lock()
-	idp.authCodes[code] = authCode
-	idp.mu.Unlock()
+	if err := idp.store.PutAuthorizationCode(authCode); err != nil {
+		return nil, err
+	}
 
 	return authCode, nil
 }
 
 // ValidateAuthorizationCode validates and consumes an authorization code
 func (idp *MockIdP) ValidateAuthorizationCode(code, clientID, redirectURI, codeVerifier string) (*models.AuthorizationCode, error) {
-	idp.mu.Lock()
-	defer idp.mu.Unlock()
-
-	authCode, exists := idp.authCodes[code]
-	if !exists {
+	// Delete code (one-time use)
+	authCode, err := idp.store.TakeAuthorizationCode(code)
+	if err != nil {
+		logStoreError("take authorization code", err)
 		return nil, errors.New("invalid authorization code")
 	}
 
-	// Delete code (one-time use)
-	delete(idp.authCodes, code)
-
 	if authCode.ExpiresAt.Before(time.Now()) {
 		return nil, errors.New("authorization code expired")
 	}
@@ -275,60 +642,73 @@ func (idp *MockIdP) ValidateAuthorizationCode(code, clientID, redirectURI, codeV
 	return authCode, nil
 }
 
-// CreateSession creates a new session
-func (idp *MockIdP) CreateSession(userID, clientID string) *models.Session {
+// CreateSession creates a new session for a user who has just authenticated at the acr level
+func (idp *MockIdP) CreateSession(userID, clientID, acr string) *models.Session {
+	now := time.Now()
 	session := &models.Session{
 		ID:        generateRandomString(32),
 		UserID:    userID,
 		ClientID:  clientID,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-		CreatedAt: time.Now(),
+		ExpiresAt: now.Add(24 * time.Hour),
+		CreatedAt: now,
+		AuthTime:  now,
+		ACR:       acr,
+		AMR:       idp.AMRForACR(acr),
+		Clients:   []string{clientID},
 	}
 
-	idp.mu.Lock()
-	idp.sessions[session.ID] = session
-	idp.mu.Unlock()
+	logStoreError("put session", idp.store.PutSession(session))
 
 	return session
 }
 
 // GetSession retrieves a session by ID
 func (idp *MockIdP) GetSession(id string) (*models.Session, bool) {
-	idp.mu.RLock()
-	defer idp.mu.RUnlock()
-	session, exists := idp.sessions[id]
-	if exists && session.ExpiresAt.Before(time.Now()) {
+	session, err := idp.store.GetSession(id)
+	logStoreError("get session", err)
+	if err != nil || session.ExpiresAt.Before(time.Now()) {
 		return nil, false
 	}
-	return session, exists
+	return session, true
 }
 
-// StoreRefreshToken stores a refresh token
-func (idp *MockIdP) StoreRefreshToken(token, clientID, userID, scope string, expiresAt time.Time) {
-	idp.mu.Lock()
-	defer idp.mu.Unlock()
-	idp.refreshTokens[token] = &models.RefreshToken{
-		Token:     token,
-		ClientID:  clientID,
-		UserID:    userID,
-		Scope:     scope,
-		ExpiresAt: expiresAt,
-		CreatedAt: time.Now(),
-	}
+// StoreRefreshToken stores a refresh token as the first generation of a new token family
+func (idp *MockIdP) StoreRefreshToken(token, clientID, userID, scope, accessTokenJTI string, authTime, expiresAt time.Time) {
+	now := time.Now()
+	logStoreError("put refresh token", idp.store.PutRefreshToken(&models.RefreshToken{
+		Token:          token,
+		ClientID:       clientID,
+		UserID:         userID,
+		Scope:          scope,
+		FamilyID:       generateRandomString(16),
+		Generation:     1,
+		AccessTokenJTI: accessTokenJTI,
+		AuthTime:       authTime,
+		ExpiresAt:      expiresAt,
+		CreatedAt:      now,
+	}))
 }
 
-// ValidateRefreshToken validates a refresh token
+// ValidateRefreshToken checks that a refresh token can be redeemed by clientID. It does not
+// rotate the token: call RotateRefreshToken once every other check has passed. Presenting a
+// token that was already rotated is treated as theft: the whole family is revoked and a
+// *RefreshTokenReuseError is returned.
 func (idp *MockIdP) ValidateRefreshToken(token, clientID string) (*models.RefreshToken, error) {
 	idp.mu.Lock()
 	defer idp.mu.Unlock()
 
-	rt, exists := idp.refreshTokens[token]
-	if !exists {
+	rt, err := idp.store.GetRefreshToken(token)
+	if err != nil {
+		logStoreError("get refresh token", err)
 		return nil, errors.New("invalid refresh token")
 	}
 
+	if !rt.RevokedAt.IsZero() {
+		return nil, errors.New("refresh token has been revoked")
+	}
+
 	if rt.ExpiresAt.Before(time.Now()) {
-		delete(idp.refreshTokens, token)
+		logStoreError("delete refresh token", idp.store.DeleteRefreshToken(token))
 		return nil, errors.New("refresh token expired")
 	}
 
@@ -336,17 +716,52 @@ func (idp *MockIdP) ValidateRefreshToken(token, clientID string) (*models.Refres
 		return nil, errors.New("client ID mismatch")
 	}
 
-	// Implement refresh token rotation - delete old token
-	delete(idp.refreshTokens, token)
+	if !rt.RotatedAt.IsZero() {
+		return nil, idp.revokeRefreshTokenFamily(rt)
+	}
 
 	return rt, nil
 }
 
-// RevokeRefreshToken revokes a refresh token
+// RotateRefreshToken marks a validated refresh token as used, right before its successor is
+// issued. The old token stays on record so a replay can be detected. If another request
+// rotated the token first, the family is revoked and a *RefreshTokenReuseError is returned.
+func (idp *MockIdP) RotateRefreshToken(rt *models.RefreshToken) error {
+	rotated, err := idp.store.MarkRefreshTokenRotated(rt.Token, time.Now())
+	if err == nil {
+		rt.RotatedAt = rotated.RotatedAt
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	// The token was rotated, revoked or deleted since it was validated
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	current, err := idp.store.GetRefreshToken(rt.Token)
+	if err != nil {
+		logStoreError("get refresh token", err)
+		return errors.New("invalid refresh token")
+	}
+	if !current.RevokedAt.IsZero() {
+		return errors.New("refresh token has been revoked")
+	}
+	if !current.RotatedAt.IsZero() {
+		return idp.revokeRefreshTokenFamily(current)
+	}
+	return errors.New("invalid refresh token")
+}
+
+// RevokeRefreshToken revokes a refresh token together with its family and their access tokens (RFC 7009 Section 2.1)
 func (idp *MockIdP) RevokeRefreshToken(token string) {
 	idp.mu.Lock()
 	defer idp.mu.Unlock()
-	delete(idp.refreshTokens, token)
+
+	if rt, err := idp.store.GetRefreshToken(token); err == nil {
+		idp.revokeRefreshTokenFamily(rt)
+	}
 }
 
 // JWTService returns the JWT service
@@ -361,23 +776,15 @@ func (idp *MockIdP) KeySet() *crypto.KeySet {
 
 // ListUsers returns all demo users (for the UI)
 func (idp *MockIdP) ListUsers() []*models.User {
-	idp.mu.RLock()
-	defer idp.mu.RUnlock()
-	users := make([]*models.User, 0, len(idp.users))
-	for _, u := range idp.users {
-		users = append(users, u)
-	}
+	users, err := idp.store.ListUsers()
+	logStoreError("list users", err)
 	return users
 }
 
 // ListClients returns all registered clients (for the UI)
 func (idp *MockIdP) ListClients() []*models.Client {
-	idp.mu.RLock()
-	defer idp.mu.RUnlock()
-	clients := make([]*models.Client, 0, len(idp.clients))
-	for _, c := range idp.clients {
-		clients = append(clients, c)
-	}
+	clients, err := idp.store.ListClients()
+	logStoreError("list clients", err)
 	return clients
 }
 
@@ -0,0 +1,111 @@
+package mockidp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// RefreshTokenReuseError reports that a rotated refresh token was presented again and its family was revoked
+type RefreshTokenReuseError struct {
+	FamilyID            string
+	Generation          int // generation of the replayed token
+	LatestGeneration    int
+	RevokedTokens       int
+	RevokedAccessTokens []string // jti values of the access tokens revoked with the family
+}
+
+func (e *RefreshTokenReuseError) Error() string {
+	return fmt.Sprintf("refresh token reuse detected: token family %s revoked", e.FamilyID)
+}
+
+// ContinueRefreshTokenFamily records token as the successor of previous in its token family
+func (idp *MockIdP) ContinueRefreshTokenFamily(token string, previous *models.RefreshToken) {
+	idp.updateRefreshToken(token, func(rt *models.RefreshToken) {
+		rt.FamilyID = previous.FamilyID
+		rt.Generation = previous.Generation + 1
+		rt.AuthTime = previous.AuthTime
+		rt.ACR = previous.ACR
+		rt.AMR = previous.AMR
+		rt.SessionID = previous.SessionID
+		// The grant is carried forward even if this refresh downscoped the access token
+		// (RFC 6749 Section 6, RFC 8707 Section 2.2)
+		rt.Scope = previous.Scope
+		rt.AuthorizationDetails = previous.AuthorizationDetails
+		rt.Resources = previous.Resources
+		rt.ClaimsRequest = previous.ClaimsRequest
+	})
+}
+
+// RefreshTokenFamily returns every stored token of a family, oldest first
+func (idp *MockIdP) RefreshTokenFamily(familyID string) []*models.RefreshToken {
+	family, err := idp.store.RefreshTokenFamily(familyID)
+	logStoreError("list refresh token family", err)
+	return family
+}
+
+// ResolveRefreshToken returns the claims of a refresh token issued by this server. The token must
+// be on record as well as validly signed, and its client still enabled; whether it can still be
+// redeemed is reported by IsRefreshTokenActive.
+func (idp *MockIdP) ResolveRefreshToken(token string) (map[string]interface{}, error) {
+	if _, err := idp.store.GetRefreshToken(token); err != nil {
+		return nil, errors.New("unknown refresh token")
+	}
+	claims, err := idp.JWTService().ValidateRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if t, _ := claims["type"].(string); t != "refresh" {
+		return nil, errors.New("not a refresh token")
+	}
+	if err := idp.checkTokenClient(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// IsRefreshTokenActive reports whether a refresh token can still be redeemed
+func (idp *MockIdP) IsRefreshTokenActive(token string) bool {
+	rt, err := idp.store.GetRefreshToken(token)
+	logStoreError("get refresh token", err)
+	return err == nil && rt.RotatedAt.IsZero() && rt.RevokedAt.IsZero() && time.Now().Before(rt.ExpiresAt)
+}
+
+// IsAccessTokenRevoked reports whether an access token was revoked along with its refresh token family
+func (idp *MockIdP) IsAccessTokenRevoked(jti string) bool {
+	revoked, err := idp.store.IsAccessTokenRevoked(jti)
+	logStoreError("check access token revocation", err)
+	return revoked
+}
+
+// revokeRefreshTokenFamily revokes every token in rt's family and the access tokens issued with them.
+// Caller must hold the lock.
+func (idp *MockIdP) revokeRefreshTokenFamily(rt *models.RefreshToken) *RefreshTokenReuseError {
+	now := time.Now()
+	result := &RefreshTokenReuseError{
+		FamilyID:            rt.FamilyID,
+		Generation:          rt.Generation,
+		RevokedAccessTokens: make([]string, 0),
+	}
+	family, err := idp.store.RefreshTokenFamily(rt.FamilyID)
+	logStoreError("list refresh token family", err)
+	for _, member := range family {
+		if member.Generation > result.LatestGeneration {
+			result.LatestGeneration = member.Generation
+		}
+		if !member.RevokedAt.IsZero() {
+			continue
+		}
+		member.RevokedAt = now
+		logStoreError("put refresh token", idp.store.PutRefreshToken(member))
+		result.RevokedTokens++
+		if member.AccessTokenJTI != "" {
+			// Access tokens never outlive the refresh token they were issued with
+			logStoreError("revoke access token", idp.store.RevokeAccessToken(member.AccessTokenJTI, member.ExpiresAt))
+			result.RevokedAccessTokens = append(result.RevokedAccessTokens, member.AccessTokenJTI)
+		}
+	}
+	return result
+}
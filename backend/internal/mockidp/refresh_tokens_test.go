@@ -0,0 +1,49 @@
+package mockidp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateRefreshTokenDoesNotRotate(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.StoreRefreshToken("rt-1", "demo-app", "alice", "openid", "", time.Now(), time.Now().Add(time.Hour))
+
+	for i := 0; i < 2; i++ {
+		if _, err := idp.ValidateRefreshToken("rt-1", "demo-app"); err != nil {
+			t.Fatalf("validation %d: %v", i+1, err)
+		}
+	}
+	if !idp.IsRefreshTokenActive("rt-1") {
+		t.Error("validation alone made the token inactive")
+	}
+}
+
+func TestRotateRefreshTokenDetectsReuse(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.StoreRefreshToken("rt-1", "demo-app", "alice", "openid", "", time.Now(), time.Now().Add(time.Hour))
+
+	rt, err := idp.ValidateRefreshToken("rt-1", "demo-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := *rt
+	if err := idp.RotateRefreshToken(rt); err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	idp.StoreRefreshToken("rt-2", "demo-app", "alice", "openid", "", time.Now(), time.Now().Add(time.Hour))
+	idp.ContinueRefreshTokenFamily("rt-2", rt)
+
+	// A concurrent request that validated before the rotation loses the race
+	var reuse *RefreshTokenReuseError
+	if err := idp.RotateRefreshToken(&stale); !errors.As(err, &reuse) {
+		t.Fatalf("second rotation err = %v, want reuse", err)
+	}
+	if idp.IsRefreshTokenActive("rt-2") {
+		t.Error("successor still active after reuse")
+	}
+	if _, err := idp.ValidateRefreshToken("rt-2", "demo-app"); err == nil {
+		t.Error("revoked successor validated")
+	}
+}
@@ -0,0 +1,571 @@
+package mockidp
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// Registration error codes (RFC 7591 Section 3.2.2)
+const (
+	ErrorInvalidRedirectURI          = "invalid_redirect_uri"
+	ErrorInvalidClientMetadata       = "invalid_client_metadata"
+	ErrorInvalidSoftwareStatement    = "invalid_software_statement"
+	ErrorUnapprovedSoftwareStatement = "unapproved_software_statement"
+)
+
+// RegistrationError is returned when client metadata is rejected
+type RegistrationError struct {
+	Code        string
+	Description string
+}
+
+func (e *RegistrationError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func metadataError(format string, args ...interface{}) error {
+	return &RegistrationError{Code: ErrorInvalidClientMetadata, Description: fmt.Sprintf(format, args...)}
+}
+
+// registrableGrantTypes lists the grant types a dynamically registered client may request.
+// The implicit and password grants are left out, as OAuth 2.0 Security BCP Section 2.1.2 and
+// 2.4 advise; those demos use the pre-registered clients.
+var registrableGrantTypes = map[string]bool{
+	"authorization_code": true,
+	"refresh_token":      true,
+	"client_credentials": true,
+	"urn:ietf:params:oauth:grant-type:device_code":    true,
+	"urn:ietf:params:oauth:grant-type:token-exchange": true,
+	"urn:openid:params:grant-type:ciba":               true,
+}
+
+// defaultRegisteredScope is granted when a registration request does not ask for a scope
+const defaultRegisteredScope = "openid profile email"
+
+// registrableScopes caps the scope of a dynamically registered client. Anyone can register, so
+// open registration gets identity claims and read access; write access and role or group
+// claims need a client created through the admin API.
+var registrableScopes = map[string]bool{
+	"openid":   true,
+	"profile":  true,
+	"email":    true,
+	"api:read": true,
+}
+
+// RegisterClient validates client metadata and creates a client that is usable immediately
+// (RFC 7591 Section 3). Values from a trusted software statement take precedence over the
+// plain JSON metadata.
+func (idp *MockIdP) RegisterClient(metadata *models.ClientMetadata) (*models.Client, error) {
+	if err := idp.applySoftwareStatement(metadata); err != nil {
+		return nil, err
+	}
+	if err := validateClientMetadata(metadata); err != nil {
+		return nil, err
+	}
+	if err := idp.checkAuthorizationDetailsTypes(metadata.AuthorizationDetailsTypes); err != nil {
+		return nil, err
+	}
+	if err := idp.checkSectorIdentifierURI(metadata.SectorIdentifierURI, metadata.RedirectURIs); err != nil {
+		return nil, metadataError("%v", err)
+	}
+
+	client := clientFromMetadata(metadata)
+	client.ID = "dyn-" + generateRandomString(24)
+	if UsesClientSecret(client.TokenEndpointAuthMethod) {
+		client.Secret = generateRandomString(48)
+	}
+	client.RegistrationAccessToken = generateRandomString(48)
+	client.CreatedAt = time.Now()
+
+	if err := idp.store.PutClient(client); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// UpdateClientRegistration replaces the metadata of a registered client (RFC 7592 Section 2.2).
+// Credentials, client_id and the registration access token are kept.
+func (idp *MockIdP) UpdateClientRegistration(clientID string, metadata *models.ClientMetadata) (*models.Client, error) {
+	if err := idp.applySoftwareStatement(metadata); err != nil {
+		return nil, err
+	}
+	if err := validateClientMetadata(metadata); err != nil {
+		return nil, err
+	}
+	if err := idp.checkAuthorizationDetailsTypes(metadata.AuthorizationDetailsTypes); err != nil {
+		return nil, err
+	}
+	if err := idp.checkSectorIdentifierURI(metadata.SectorIdentifierURI, metadata.RedirectURIs); err != nil {
+		return nil, metadataError("%v", err)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	existing, err := idp.store.GetClient(clientID)
+	if err != nil || existing.Registration == nil {
+		return nil, fmt.Errorf("client %s is not dynamically registered", clientID)
+	}
+
+	client := clientFromMetadata(metadata)
+	client.ID = existing.ID
+	client.Secret = existing.Secret
+	switch {
+	case !UsesClientSecret(client.TokenEndpointAuthMethod):
+		client.Secret = ""
+	case client.Secret == "":
+		client.Secret = generateRandomString(48)
+	}
+	client.RegistrationAccessToken = existing.RegistrationAccessToken
+	client.CreatedAt = existing.CreatedAt
+	if err := idp.store.PutClient(client); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// DeleteClientRegistration removes a registered client and its refresh tokens (RFC 7592 Section 2.3)
+func (idp *MockIdP) DeleteClientRegistration(clientID string) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	logStoreError("delete client", idp.store.DeleteClient(clientID))
+	logStoreError("delete client refresh tokens", idp.store.DeleteClientRefreshTokens(clientID))
+	logStoreError("delete client reference tokens", idp.store.DeleteClientReferenceTokens(clientID))
+}
+
+// AuthenticateRegistrationAccess returns the registered client if token is its registration access token
+func (idp *MockIdP) AuthenticateRegistrationAccess(clientID, token string) (*models.Client, bool) {
+	client, exists := idp.GetClient(clientID)
+	if !exists || client.Registration == nil || token == "" {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(client.RegistrationAccessToken), []byte(token)) != 1 {
+		return nil, false
+	}
+	return client, true
+}
+
+// CreateSoftwareStatement signs client metadata so it can be presented at registration.
+// Statements issued by this server are the only ones it trusts.
+func (idp *MockIdP) CreateSoftwareStatement(metadata map[string]interface{}) (string, error) {
+	return idp.JWTService().CreateSoftwareStatement(metadata, 24*time.Hour)
+}
+
+// applySoftwareStatement verifies a software statement and overlays its claims on metadata (RFC 7591 Section 2.3)
+func (idp *MockIdP) applySoftwareStatement(metadata *models.ClientMetadata) error {
+	statement := metadata.SoftwareStatement
+	if statement == "" {
+		return nil
+	}
+
+	unverified := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(statement, unverified); err != nil {
+		return &RegistrationError{Code: ErrorInvalidSoftwareStatement, Description: "software statement is not a valid JWT"}
+	}
+	if iss, _ := unverified.GetIssuer(); iss != idp.GetIssuer() {
+		return &RegistrationError{Code: ErrorUnapprovedSoftwareStatement, Description: fmt.Sprintf("software statement issuer %q is not trusted", iss)}
+	}
+
+	claims, err := idp.JWTService().ValidateSoftwareStatement(statement)
+	if err != nil {
+		return &RegistrationError{Code: ErrorInvalidSoftwareStatement, Description: err.Error()}
+	}
+
+	// Unmarshalling over the existing metadata replaces exactly the fields the statement asserts
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return &RegistrationError{Code: ErrorInvalidSoftwareStatement, Description: err.Error()}
+	}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return &RegistrationError{Code: ErrorInvalidSoftwareStatement, Description: "software statement claims are not valid client metadata"}
+	}
+	metadata.SoftwareStatement = statement
+	return nil
+}
+
+// validateClientMetadata applies registration defaults and checks metadata consistency
+func validateClientMetadata(md *models.ClientMetadata) error {
+	if md.ApplicationType == "" {
+		md.ApplicationType = "web"
+	}
+	if md.ApplicationType != "web" && md.ApplicationType != "native" {
+		return metadataError("application_type must be web or native")
+	}
+
+	if md.TokenEndpointAuthMethod == "" {
+		md.TokenEndpointAuthMethod = AuthMethodClientSecretBasic
+	}
+	supportedMethod := false
+	for _, method := range SupportedClientAuthMethods {
+		supportedMethod = supportedMethod || method == md.TokenEndpointAuthMethod
+	}
+	if !supportedMethod {
+		return metadataError("unsupported token_endpoint_auth_method %q", md.TokenEndpointAuthMethod)
+	}
+
+	if len(md.GrantTypes) == 0 {
+		md.GrantTypes = []string{"authorization_code"}
+	}
+	grants := make(map[string]bool)
+	for _, gt := range md.GrantTypes {
+		if !registrableGrantTypes[gt] {
+			return metadataError("unsupported grant_type %q", gt)
+		}
+		grants[gt] = true
+	}
+
+	if len(md.ResponseTypes) == 0 && grants["authorization_code"] {
+		md.ResponseTypes = []string{"code"}
+	}
+	if err := validateResponseTypes(md.ResponseTypes, grants); err != nil {
+		return err
+	}
+
+	if md.TokenEndpointAuthMethod == AuthMethodNone && (grants["client_credentials"] || grants["urn:ietf:params:oauth:grant-type:token-exchange"]) {
+		return metadataError("public clients cannot use the client_credentials or token-exchange grants")
+	}
+
+	if err := validateBackchannelMetadata(md, grants); err != nil {
+		return err
+	}
+	if err := validateMTLSMetadata(md); err != nil {
+		return err
+	}
+	if err := validateRequestObjectMetadata(md); err != nil {
+		return err
+	}
+	if err := validateLogoutMetadata(md); err != nil {
+		return err
+	}
+	if err := validateResponseMetadata(md); err != nil {
+		return err
+	}
+
+	if md.AccessTokenFormat == "" {
+		md.AccessTokenFormat = AccessTokenFormatJWT
+		if md.SubjectType == SubjectTypePairwise {
+			md.AccessTokenFormat = AccessTokenFormatOpaque
+		}
+	}
+	if md.AccessTokenFormat != AccessTokenFormatJWT && md.AccessTokenFormat != AccessTokenFormatOpaque {
+		return metadataError("access_token_format must be %s or %s", AccessTokenFormatJWT, AccessTokenFormatOpaque)
+	}
+	if md.SubjectType == SubjectTypePairwise && md.AccessTokenFormat != AccessTokenFormatOpaque {
+		return metadataError("pairwise clients receive %s access tokens, which do not reveal the user ID", AccessTokenFormatOpaque)
+	}
+
+	if err := validateClientKeys(md); err != nil {
+		return err
+	}
+
+	if grants["authorization_code"] || grants["implicit"] {
+		if len(md.RedirectURIs) == 0 {
+			return &RegistrationError{Code: ErrorInvalidRedirectURI, Description: "redirect_uris is required for redirect-based grant types"}
+		}
+	}
+	for _, uri := range md.RedirectURIs {
+		if err := validateRegisteredRedirectURI(uri, md.ApplicationType); err != nil {
+			return &RegistrationError{Code: ErrorInvalidRedirectURI, Description: fmt.Sprintf("%s: %v", uri, err)}
+		}
+	}
+
+	if md.SubjectType == "" {
+		md.SubjectType = SubjectTypePublic
+	}
+	if err := validateSubjectType(md.SubjectType, md.SectorIdentifierURI, md.RedirectURIs); err != nil {
+		return metadataError("%v", err)
+	}
+
+	for name, value := range map[string]string{"client_uri": md.ClientURI, "logo_uri": md.LogoURI, "tos_uri": md.TosURI, "policy_uri": md.PolicyURI} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return metadataError("%s must be an absolute http(s) URL", name)
+		}
+	}
+
+	if md.Scope == "" {
+		md.Scope = defaultRegisteredScope
+	}
+	for _, scope := range strings.Fields(md.Scope) {
+		if !registrableScopes[scope] {
+			return metadataError("scope %q cannot be registered dynamically", scope)
+		}
+	}
+	if md.ClientName == "" {
+		md.ClientName = "Dynamically Registered Client"
+	}
+	return nil
+}
+
+// validateResponseTypes enforces the grant/response type correspondence of RFC 7591 Section 2.1
+func validateResponseTypes(responseTypes []string, grants map[string]bool) error {
+	hasCode, hasImplicit := false, false
+	for _, rt := range responseTypes {
+		for _, part := range strings.Fields(rt) {
+			switch part {
+			case "code":
+				hasCode = true
+				if !grants["authorization_code"] {
+					return metadataError("response_type %q requires the authorization_code grant", rt)
+				}
+			case "token", "id_token":
+				hasImplicit = true
+				if !grants["implicit"] {
+					return metadataError("response_type %q requires the implicit grant", rt)
+				}
+			case "none":
+			default:
+				return metadataError("unsupported response_type %q", rt)
+			}
+		}
+	}
+	if grants["authorization_code"] && !hasCode {
+		return metadataError("the authorization_code grant requires the code response_type")
+	}
+	if grants["implicit"] && !hasImplicit {
+		return metadataError("the implicit grant requires the token or id_token response_type")
+	}
+	return nil
+}
+
+// validateBackchannelMetadata checks the CIBA registration parameters (OpenID CIBA Core 1.0 Section 4)
+func validateBackchannelMetadata(md *models.ClientMetadata, grants map[string]bool) error {
+	if !grants[GrantTypeCIBA] {
+		if md.BackchannelTokenDeliveryMode != "" || md.BackchannelClientNotificationEndpoint != "" {
+			return metadataError("backchannel parameters require the %s grant type", GrantTypeCIBA)
+		}
+		return nil
+	}
+
+	if md.TokenEndpointAuthMethod == AuthMethodNone {
+		return metadataError("public clients cannot use the CIBA grant")
+	}
+	switch md.BackchannelTokenDeliveryMode {
+	case DeliveryModePoll:
+		return nil
+	case DeliveryModePing, DeliveryModePush:
+	default:
+		return metadataError("backchannel_token_delivery_mode must be poll, ping or push")
+	}
+
+	u, err := url.Parse(md.BackchannelClientNotificationEndpoint)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return metadataError("backchannel_client_notification_endpoint is required for %s mode", md.BackchannelTokenDeliveryMode)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname())) {
+		return metadataError("backchannel_client_notification_endpoint must use https")
+	}
+	return nil
+}
+
+// validateMTLSMetadata checks the mutual TLS registration parameters (RFC 8705 Section 2.1.2)
+func validateMTLSMetadata(md *models.ClientMetadata) error {
+	identities := 0
+	for _, value := range []string{md.TLSClientAuthSubjectDN, md.TLSClientAuthSANDNS, md.TLSClientAuthSANURI} {
+		if value != "" {
+			identities++
+		}
+	}
+
+	switch md.TokenEndpointAuthMethod {
+	case AuthMethodTLSClientAuth:
+		if identities != 1 {
+			return metadataError("tls_client_auth requires exactly one of tls_client_auth_subject_dn, tls_client_auth_san_dns or tls_client_auth_san_uri")
+		}
+	case AuthMethodSelfSignedTLSClientAuth:
+		if md.JWKS == nil && md.JWKSURI == "" {
+			return metadataError("self_signed_tls_client_auth requires jwks or jwks_uri")
+		}
+		fallthrough
+	default:
+		if identities != 0 {
+			return metadataError("tls_client_auth_* parameters require the tls_client_auth method")
+		}
+	}
+	return nil
+}
+
+// validateRequestObjectMetadata checks the request object and JWT authorization response
+// parameters (RFC 9101 Section 10.5, JARM Section 3)
+func validateRequestObjectMetadata(md *models.ClientMetadata) error {
+	if alg := md.RequestObjectSigningAlg; alg != "" {
+		if !slices.Contains(RequestObjectSigningAlgorithms, alg) {
+			return metadataError("unsupported request_object_signing_alg %q", alg)
+		}
+		if strings.HasPrefix(alg, "HS") && !UsesClientSecret(md.TokenEndpointAuthMethod) {
+			return metadataError("request_object_signing_alg %s requires a client secret", alg)
+		}
+		if !strings.HasPrefix(alg, "HS") && md.JWKS == nil && md.JWKSURI == "" {
+			return metadataError("request_object_signing_alg %s requires jwks or jwks_uri", alg)
+		}
+	}
+	for _, raw := range md.RequestURIs {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname()))) {
+			return metadataError("request_uris must be https URLs")
+		}
+	}
+	if alg := md.AuthorizationSignedResponseAlg; alg != "" && !slices.Contains(AuthorizationResponseSigningAlgorithms, alg) {
+		return metadataError("unsupported authorization_signed_response_alg %q", alg)
+	}
+	return nil
+}
+
+// validateLogoutMetadata checks the logout registration parameters (OIDC RP-Initiated Logout 1.0
+// Section 3.1, Front-Channel Logout 1.0 Section 2.2, Back-Channel Logout 1.0 Section 2.2)
+func validateLogoutMetadata(md *models.ClientMetadata) error {
+	for _, uri := range md.PostLogoutRedirectURIs {
+		if err := validateRegisteredRedirectURI(uri, md.ApplicationType); err != nil {
+			return metadataError("post_logout_redirect_uris: %s: %v", uri, err)
+		}
+	}
+	for name, value := range map[string]string{"frontchannel_logout_uri": md.FrontchannelLogoutURI, "backchannel_logout_uri": md.BackchannelLogoutURI} {
+		if value == "" {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || u.Fragment != "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname()))) {
+			return metadataError("%s must be an https URL without a fragment", name)
+		}
+	}
+	if md.FrontchannelLogoutSessionRequired && md.FrontchannelLogoutURI == "" {
+		return metadataError("frontchannel_logout_session_required requires frontchannel_logout_uri")
+	}
+	if md.BackchannelLogoutSessionRequired && md.BackchannelLogoutURI == "" {
+		return metadataError("backchannel_logout_session_required requires backchannel_logout_uri")
+	}
+	return nil
+}
+
+// validateClientKeys checks jwks and jwks_uri, which are mutually exclusive (RFC 7591 Section 2)
+func validateClientKeys(md *models.ClientMetadata) error {
+	if md.JWKS != nil && md.JWKSURI != "" {
+		return metadataError("jwks and jwks_uri must not both be present")
+	}
+	if md.TokenEndpointAuthMethod == AuthMethodPrivateKeyJWT && md.JWKS == nil && md.JWKSURI == "" {
+		return metadataError("private_key_jwt requires jwks or jwks_uri")
+	}
+	if md.JWKSURI != "" {
+		u, err := url.Parse(md.JWKSURI)
+		if err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname()))) {
+			return metadataError("jwks_uri must be an https URL")
+		}
+	}
+	if md.JWKS != nil {
+		data, err := json.Marshal(md.JWKS)
+		if err != nil {
+			return metadataError("invalid jwks: %v", err)
+		}
+		var jwks crypto.JWKS
+		if err := json.Unmarshal(data, &jwks); err != nil || len(jwks.Keys) == 0 {
+			return metadataError("jwks must contain at least one key")
+		}
+		for _, key := range jwks.Keys {
+			if err := crypto.ValidateJWK(key); err != nil {
+				return metadataError("invalid jwks: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRegisteredRedirectURI applies redirect URI rules for web and native clients
+// (RFC 6749 Section 3.1.2, OIDC Dynamic Client Registration Section 2)
+func validateRegisteredRedirectURI(raw, applicationType string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("must be an absolute URI")
+	}
+	if u.Fragment != "" || strings.Contains(raw, "#") {
+		return fmt.Errorf("must not contain a fragment")
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("must include a host")
+		}
+		return nil
+	case "http":
+		if !isLoopbackHost(u.Hostname()) {
+			return fmt.Errorf("http is only allowed for localhost")
+		}
+		return nil
+	}
+
+	// Private-use URI schemes are only for native apps (RFC 8252 Section 7.1)
+	if applicationType != "native" {
+		return fmt.Errorf("web clients must use https")
+	}
+	if !strings.Contains(u.Scheme, ".") {
+		return fmt.Errorf("private-use schemes must be reverse domain names")
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// clientFromMetadata builds a client record from validated metadata
+func clientFromMetadata(md *models.ClientMetadata) *models.Client {
+	registration := *md
+	return &models.Client{
+		Name:                                  md.ClientName,
+		RedirectURIs:                          md.RedirectURIs,
+		GrantTypes:                            md.GrantTypes,
+		ResponseTypes:                         md.ResponseTypes,
+		Scopes:                                strings.Fields(md.Scope),
+		Public:                                md.TokenEndpointAuthMethod == AuthMethodNone,
+		ApplicationType:                       md.ApplicationType,
+		RequirePushedAuthorizationRequests:    md.RequirePushedAuthorizationRequests,
+		TokenEndpointAuthMethod:               md.TokenEndpointAuthMethod,
+		JWKS:                                  md.JWKS,
+		JWKSURI:                               md.JWKSURI,
+		AccessTokenFormat:                     md.AccessTokenFormat,
+		AuthorizationDetailsTypes:             md.AuthorizationDetailsTypes,
+		BackchannelTokenDeliveryMode:          md.BackchannelTokenDeliveryMode,
+		BackchannelClientNotificationEndpoint: md.BackchannelClientNotificationEndpoint,
+		TLSClientAuthSubjectDN:                md.TLSClientAuthSubjectDN,
+		TLSClientAuthSANDNS:                   md.TLSClientAuthSANDNS,
+		TLSClientAuthSANURI:                   md.TLSClientAuthSANURI,
+		TLSClientCertificateBoundAccessTokens: md.TLSClientCertificateBoundAccessTokens,
+		RequestURIs:                           md.RequestURIs,
+		RequestObjectSigningAlg:               md.RequestObjectSigningAlg,
+		RequireSignedRequestObject:            md.RequireSignedRequestObject,
+		AuthorizationSignedResponseAlg:        md.AuthorizationSignedResponseAlg,
+		PostLogoutRedirectURIs:                md.PostLogoutRedirectURIs,
+		FrontchannelLogoutURI:                 md.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired:     md.FrontchannelLogoutSessionRequired,
+		BackchannelLogoutURI:                  md.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:      md.BackchannelLogoutSessionRequired,
+		SubjectType:                           md.SubjectType,
+		SectorIdentifierURI:                   md.SectorIdentifierURI,
+		IDTokenEncryptedResponseAlg:           md.IDTokenEncryptedResponseAlg,
+		IDTokenEncryptedResponseEnc:           md.IDTokenEncryptedResponseEnc,
+		UserInfoSignedResponseAlg:             md.UserInfoSignedResponseAlg,
+		UserInfoEncryptedResponseAlg:          md.UserInfoEncryptedResponseAlg,
+		UserInfoEncryptedResponseEnc:          md.UserInfoEncryptedResponseEnc,
+		Registration:                          &registration,
+	}
+}
@@ -0,0 +1,117 @@
+package mockidp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+func newTestMetadata() *models.ClientMetadata {
+	return &models.ClientMetadata{
+		RedirectURIs: []string{"https://app.example/callback"},
+		ClientName:   "Test Client",
+	}
+}
+
+func TestSoftwareStatementOverridesMetadata(t *testing.T) {
+	idp := newTestIdP(t)
+	statement, err := idp.CreateSoftwareStatement(map[string]interface{}{"client_name": "Signed Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := newTestMetadata()
+	md.SoftwareStatement = statement
+	client, err := idp.RegisterClient(md)
+	if err != nil {
+		t.Fatalf("RegisterClient: %v", err)
+	}
+	if client.Name != "Signed Name" {
+		t.Errorf("client name = %q, want the statement's", client.Name)
+	}
+}
+
+func TestSoftwareStatementIsNotAToken(t *testing.T) {
+	idp := newTestIdP(t)
+	statement, err := idp.CreateSoftwareStatement(map[string]interface{}{
+		"sub":       "admin",
+		"client_id": "demo-app",
+		"scope":     "openid profile",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := idp.JWTService().ValidateToken(statement); err == nil {
+		t.Error("software statement validated as a token")
+	}
+	if _, err := idp.ResolveToken(statement); err == nil {
+		t.Error("software statement resolved as an access token")
+	}
+}
+
+func TestRegistrationRejectsTokensAsSoftwareStatements(t *testing.T) {
+	idp := newTestIdP(t)
+	token, err := idp.IssueAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "demo-app", Scope: "openid"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := newTestMetadata()
+	md.SoftwareStatement = token
+	var regErr *RegistrationError
+	if _, err := idp.RegisterClient(md); !errors.As(err, &regErr) || regErr.Code != ErrorInvalidSoftwareStatement {
+		t.Fatalf("err = %v, want %s", err, ErrorInvalidSoftwareStatement)
+	}
+}
+
+func TestRegistrationLimitsGrantsAndScope(t *testing.T) {
+	idp := newTestIdP(t)
+	cases := map[string]func(*models.ClientMetadata){
+		"implicit grant": func(md *models.ClientMetadata) {
+			md.GrantTypes = []string{"implicit"}
+			md.ResponseTypes = []string{"token"}
+		},
+		"password grant": func(md *models.ClientMetadata) { md.GrantTypes = []string{"authorization_code", "password"} },
+		"write scope":    func(md *models.ClientMetadata) { md.Scope = "openid api:write" },
+		"roles scope":    func(md *models.ClientMetadata) { md.Scope = "openid roles" },
+	}
+	for name, change := range cases {
+		md := newTestMetadata()
+		change(md)
+		var regErr *RegistrationError
+		if _, err := idp.RegisterClient(md); !errors.As(err, &regErr) || regErr.Code != ErrorInvalidClientMetadata {
+			t.Errorf("%s: err = %v, want %s", name, err, ErrorInvalidClientMetadata)
+		}
+	}
+
+	md := newTestMetadata()
+	md.Scope = "openid profile email api:read"
+	if _, err := idp.RegisterClient(md); err != nil {
+		t.Errorf("registrable scope rejected: %v", err)
+	}
+}
+
+func TestClientJWKSRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(crypto.JWKS{Keys: []crypto.JWK{}})
+	}))
+	defer server.Close()
+
+	idp := newTestIdP(t)
+	client := &models.Client{ID: "jwks-client", JWKSURI: server.URL}
+	if _, err := idp.clientJWKS(client); !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("err = %v, want %v", err, errPrivateAddress)
+	}
+
+	idp.SetPrivateNetworkFetches(true)
+	if _, err := idp.clientJWKS(client); err != nil {
+		t.Fatalf("fetch with private addresses allowed: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package mockidp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// RequestObjectType is the typ header of a JWT-secured authorization request (RFC 9101 Section 10.8)
+const RequestObjectType = "oauth-authz-req+jwt"
+
+// Authorization request errors for request objects (RFC 9101 Section 6.3, OIDC Core Section 3.1.2.6)
+const (
+	ErrorInvalidRequestObject = "invalid_request_object"
+	ErrorInvalidRequestURI    = "invalid_request_uri"
+)
+
+// RequestObjectSigningAlgorithms lists the algorithms accepted for request objects. HMAC
+// algorithms use the client secret and asymmetric ones the client's registered keys, as
+// for client assertions; unsigned request objects are never accepted.
+var RequestObjectSigningAlgorithms = ClientAssertionSigningAlgorithms
+
+const (
+	// requestObjectLeeway tolerates clock skew when checking exp and nbf
+	requestObjectLeeway = 30 * time.Second
+	// requestObjectMaxSize bounds a request object fetched from a request_uri
+	requestObjectMaxSize = 64 << 10
+)
+
+// requestObjectRegisteredClaims are JWT claims of a request object that are not authorization parameters
+var requestObjectRegisteredClaims = map[string]bool{
+	"iss": true, "aud": true, "exp": true, "iat": true, "nbf": true, "jti": true,
+}
+
+// RequestObject is a verified JWT-secured authorization request
+type RequestObject struct {
+	ClientID  string
+	Algorithm string
+	KeyID     string
+	// Encrypted is true when the signed request object was nested in a JWE encrypted to the server
+	Encrypted bool
+	// Signed is the signed request object, after decryption if it was encrypted
+	Signed string
+	// JTI and ExpiresAt identify the request object until it expires, so it can be used only once
+	JTI       string
+	ExpiresAt time.Time
+	Claims    map[string]interface{}
+	// Parameters are the claims as authorization request parameters, with arrays space-joined
+	// and JSON values such as authorization_details re-encoded as the client would send them
+	Parameters map[string]string
+}
+
+// VerifyRequestObject verifies a request object sent by value or fetched from a request_uri
+// (RFC 9101 Section 6). An encrypted request object is first decrypted with the server's
+// encryption key for its alg. The signature is then checked with the client's secret or registered keys,
+// and iss, client_id and aud must name the client and this server. The typ header must be
+// oauth-authz-req+jwt (RFC 9101 Section 10.8), and exp and a jti that has not been used by a
+// completed request are required.
+func (idp *MockIdP) VerifyRequestObject(clientID, requestObject string) (*RequestObject, error) {
+	client, exists := idp.GetClient(clientID)
+	if !exists {
+		return nil, errors.New("client not found")
+	}
+
+	result := &RequestObject{ClientID: clientID}
+	if crypto.IsJWE(requestObject) {
+		plaintext, _, err := idp.keySet.DecryptJWE(requestObject)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt request object: %w", err)
+		}
+		requestObject = string(plaintext)
+		result.Encrypted = true
+	}
+
+	unverified, _, err := jwt.NewParser().ParseUnverified(requestObject, jwt.MapClaims{})
+	if err != nil {
+		return nil, fmt.Errorf("malformed request object: %w", err)
+	}
+	alg := unverified.Method.Alg()
+	if alg == "none" {
+		return nil, errors.New("unsigned request objects are not accepted")
+	}
+	typ, _ := unverified.Header["typ"].(string)
+	if !strings.EqualFold(strings.TrimPrefix(strings.ToLower(typ), "application/"), RequestObjectType) {
+		return nil, fmt.Errorf("request object typ must be %s", RequestObjectType)
+	}
+	if client.RequestObjectSigningAlg != "" && alg != client.RequestObjectSigningAlg {
+		return nil, fmt.Errorf("client is registered for %s request objects, not %s", client.RequestObjectSigningAlg, alg)
+	}
+
+	token, err := jwt.Parse(requestObject, func(token *jwt.Token) (interface{}, error) {
+		if strings.HasPrefix(alg, "HS") {
+			if client.Public || client.Secret == "" {
+				return nil, errors.New("client has no secret to verify an HMAC request object")
+			}
+			return []byte(client.Secret), nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		return idp.clientVerificationKey(client, kid)
+	},
+		jwt.WithValidMethods(RequestObjectSigningAlgorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(requestObjectLeeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request object: %w", err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if iss, ok := claims["iss"]; ok && iss != clientID {
+		return nil, errors.New("request object iss must be the client_id")
+	}
+	if cid, ok := claims["client_id"]; ok && cid != clientID {
+		return nil, errors.New("request object client_id does not match the client_id parameter")
+	}
+	if _, ok := claims["aud"]; ok {
+		aud, _ := claims.GetAudience()
+		if !audienceMatches(aud, []string{idp.GetIssuer()}) {
+			return nil, errors.New("request object aud does not identify this authorization server")
+		}
+	}
+	if _, ok := claims["request"]; ok {
+		return nil, errors.New("request object must not contain a request claim")
+	}
+	if _, ok := claims["request_uri"]; ok {
+		return nil, errors.New("request object must not contain a request_uri claim")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, errors.New("request object must contain a jti claim")
+	}
+	if idp.requestObjectUsed(clientID, jti) {
+		return nil, errors.New("request object has already been used")
+	}
+	exp, _ := claims.GetExpirationTime()
+
+	params, err := requestObjectParameters(claims)
+	if err != nil {
+		return nil, err
+	}
+	params["client_id"] = clientID
+
+	result.Algorithm = alg
+	result.KeyID, _ = token.Header["kid"].(string)
+	result.Signed = requestObject
+	result.JTI = jti
+	result.ExpiresAt = exp.Time
+	result.Claims = claims
+	result.Parameters = params
+	return result, nil
+}
+
+// ConsumeRequestObject verifies a request object once more and marks its jti as used, so it
+// cannot start another authorization. Call it when the authorization request completes: the
+// login form carries the request object and verifies it again on every submission.
+func (idp *MockIdP) ConsumeRequestObject(clientID, requestObject string) error {
+	verified, err := idp.VerifyRequestObject(clientID, requestObject)
+	if err != nil {
+		return err
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	key := clientID + ":" + verified.JTI
+	now := time.Now()
+	if until, used := idp.usedRequestObjects[key]; used && now.Before(until) {
+		return errors.New("request object has already been used")
+	}
+	for id, until := range idp.usedRequestObjects {
+		if until.Before(now) {
+			delete(idp.usedRequestObjects, id)
+		}
+	}
+	idp.usedRequestObjects[key] = verified.ExpiresAt.Add(requestObjectLeeway)
+	return nil
+}
+
+// requestObjectUsed reports whether a completed authorization request already used the jti
+func (idp *MockIdP) requestObjectUsed(clientID, jti string) bool {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	until, used := idp.usedRequestObjects[clientID+":"+jti]
+	return used && time.Now().Before(until)
+}
+
+// requestObjectParameters converts request object claims to authorization request parameters
+func requestObjectParameters(claims jwt.MapClaims) (map[string]string, error) {
+	params := make(map[string]string, len(claims))
+	for name, value := range claims {
+		if requestObjectRegisteredClaims[name] {
+			continue
+		}
+		// resource may be an array of URIs; other arrays such as authorization_details stay JSON
+		if items, ok := value.([]interface{}); ok && name == "resource" {
+			values := make([]string, 0, len(items))
+			for _, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					return nil, errors.New("request object resource must be a string or an array of strings")
+				}
+				values = append(values, s)
+			}
+			params[name] = strings.Join(values, " ")
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			params[name] = v
+		case float64:
+			params[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			params[name] = strconv.FormatBool(v)
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid request object claim %s: %w", name, err)
+			}
+			params[name] = string(encoded)
+		}
+	}
+	return params, nil
+}
+
+// FetchRequestObject retrieves a request object passed by reference (RFC 9101 Section 5.2).
+// The request_uri must be one the client registered, so the server cannot be pointed at
+// arbitrary URLs, and it is fetched like other client-hosted documents, refusing internal
+// addresses.
+func (idp *MockIdP) FetchRequestObject(clientID, requestURI string) (string, error) {
+	client, exists := idp.GetClient(clientID)
+	if !exists {
+		return "", errors.New("client not found")
+	}
+	if !requestURIRegistered(client, requestURI) {
+		return "", errors.New("request_uri is not registered for this client")
+	}
+
+	resp, err := idp.fetchClient.Get(requestURI)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch request_uri: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request_uri returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, requestObjectMaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read request_uri: %w", err)
+	}
+	if len(body) > requestObjectMaxSize {
+		return "", errors.New("request object is too large")
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// requestURIRegistered reports whether requestURI matches one of the client's request_uris,
+// ignoring any fragment, which clients may use to force a fresh fetch (OIDC Core Section 6.2)
+func requestURIRegistered(client *models.Client, requestURI string) bool {
+	requestURI, _, _ = strings.Cut(requestURI, "#")
+	for _, registered := range client.RequestURIs {
+		registered, _, _ = strings.Cut(registered, "#")
+		if registered == requestURI {
+			return true
+		}
+	}
+	return false
+}
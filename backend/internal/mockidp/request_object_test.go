@@ -0,0 +1,132 @@
+package mockidp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const jarSecret = "jar-app-secret-at-least-32-bytes"
+
+// signRequestObject returns a jar-app request object for the claims, with exp and jti unless
+// the claims set them. typ is the typ header, omitted when empty.
+func signRequestObject(t *testing.T, idp *MockIdP, typ string, claims jwt.MapClaims) string {
+	t.Helper()
+	all := jwt.MapClaims{
+		"iss":   "jar-app",
+		"aud":   idp.GetIssuer(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"jti":   uuid.NewString(),
+		"scope": "openid",
+	}
+	for name, value := range claims {
+		if value == nil {
+			delete(all, name)
+			continue
+		}
+		all[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, all)
+	if typ == "" {
+		delete(token.Header, "typ")
+	} else {
+		token.Header["typ"] = typ
+	}
+	signed, err := token.SignedString([]byte(jarSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyRequestObject(t *testing.T) {
+	idp := newTestIdP(t)
+
+	for _, typ := range []string{RequestObjectType, "application/oauth-authz-req+jwt"} {
+		verified, err := idp.VerifyRequestObject("jar-app", signRequestObject(t, idp, typ, nil))
+		if err != nil {
+			t.Fatalf("typ %s: %v", typ, err)
+		}
+		if verified.Parameters["scope"] != "openid" || verified.Parameters["client_id"] != "jar-app" {
+			t.Errorf("parameters = %v", verified.Parameters)
+		}
+	}
+
+	rejected := map[string]string{
+		"no typ":     signRequestObject(t, idp, "", nil),
+		"typ JWT":    signRequestObject(t, idp, "JWT", nil),
+		"no exp":     signRequestObject(t, idp, RequestObjectType, jwt.MapClaims{"exp": nil}),
+		"expired":    signRequestObject(t, idp, RequestObjectType, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}),
+		"no jti":     signRequestObject(t, idp, RequestObjectType, jwt.MapClaims{"jti": nil}),
+		"other iss":  signRequestObject(t, idp, RequestObjectType, jwt.MapClaims{"iss": "demo-app"}),
+		"other aud":  signRequestObject(t, idp, RequestObjectType, jwt.MapClaims{"aud": "https://elsewhere.example"}),
+		"nested req": signRequestObject(t, idp, RequestObjectType, jwt.MapClaims{"request": "x"}),
+	}
+	for name, requestObject := range rejected {
+		if _, err := idp.VerifyRequestObject("jar-app", requestObject); err == nil {
+			t.Errorf("%s: request object accepted", name)
+		}
+	}
+}
+
+func TestConsumeRequestObjectRejectsReplay(t *testing.T) {
+	idp := newTestIdP(t)
+	requestObject := signRequestObject(t, idp, RequestObjectType, nil)
+
+	// The login form verifies the request object again before the request completes
+	for i := 0; i < 2; i++ {
+		if _, err := idp.VerifyRequestObject("jar-app", requestObject); err != nil {
+			t.Fatalf("verification %d: %v", i+1, err)
+		}
+	}
+	if err := idp.ConsumeRequestObject("jar-app", requestObject); err != nil {
+		t.Fatalf("ConsumeRequestObject: %v", err)
+	}
+
+	if _, err := idp.VerifyRequestObject("jar-app", requestObject); err == nil {
+		t.Error("used request object verified again")
+	}
+	if err := idp.ConsumeRequestObject("jar-app", requestObject); err == nil {
+		t.Error("request object consumed twice")
+	}
+	if _, err := idp.VerifyRequestObject("jar-app", signRequestObject(t, idp, RequestObjectType, nil)); err != nil {
+		t.Errorf("fresh request object rejected: %v", err)
+	}
+}
+
+func TestFetchRequestObjectRefusesPrivateAddresses(t *testing.T) {
+	idp := newTestIdP(t)
+	requestObject := signRequestObject(t, idp, RequestObjectType, nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestObject))
+	}))
+	defer server.Close()
+
+	client, _ := idp.GetClient("jar-app")
+	client.RequestURIs = []string{server.URL + "/request.jwt"}
+	if err := idp.store.PutClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := idp.FetchRequestObject("jar-app", server.URL+"/request.jwt"); !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("err = %v, want %v", err, errPrivateAddress)
+	}
+	if _, err := idp.FetchRequestObject("jar-app", server.URL+"/other.jwt"); err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("unregistered request_uri: err = %v", err)
+	}
+
+	idp.SetPrivateNetworkFetches(true)
+	fetched, err := idp.FetchRequestObject("jar-app", server.URL+"/request.jwt")
+	if err != nil {
+		t.Fatalf("fetch with private addresses allowed: %v", err)
+	}
+	if fetched != requestObject {
+		t.Errorf("fetched %q", fetched)
+	}
+}
@@ -0,0 +1,174 @@
+package mockidp
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ErrorInvalidTarget is the error code for a rejected resource parameter (RFC 8707 Section 2)
+const ErrorInvalidTarget = "invalid_target"
+
+// Resource indicators of the protected resources served by this server itself
+const (
+	// ProfileResource is served by the UserInfo endpoint
+	ProfileResource = "https://api.protocolsoup.com/profile"
+	// AccountResource is served by the step-up demo endpoints
+	AccountResource = "https://api.protocolsoup.com/account"
+)
+
+// RegisterResource adds or replaces a protected resource
+func (idp *MockIdP) RegisterResource(resource *models.ProtectedResource) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	idp.resources[resource.URI] = resource
+}
+
+// GetResource retrieves a protected resource by its resource indicator
+func (idp *MockIdP) GetResource(uri string) (*models.ProtectedResource, bool) {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	resource, exists := idp.resources[uri]
+	return resource, exists
+}
+
+// ListResources returns all protected resources, sorted by resource indicator
+func (idp *MockIdP) ListResources() []*models.ProtectedResource {
+	idp.mu.RLock()
+	defer idp.mu.RUnlock()
+
+	resources := make([]*models.ProtectedResource, 0, len(idp.resources))
+	for _, resource := range idp.resources {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].URI < resources[j].URI
+	})
+	return resources
+}
+
+// SupportedScopes returns the identity scopes plus every scope a registered protected resource accepts, sorted
+func (idp *MockIdP) SupportedScopes() []string {
+	seen := make(map[string]bool)
+	scopes := make([]string, 0)
+	add := func(scope string) {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	for _, scope := range IdentityScopes {
+		add(scope)
+	}
+	for _, resource := range idp.ListResources() {
+		for _, scope := range resource.Scopes {
+			add(scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// ValidateResources checks that every resource indicator is an absolute URI without a fragment
+// (RFC 8707 Section 2) and names a registered protected resource
+func (idp *MockIdP) ValidateResources(resources []string) error {
+	for _, resource := range resources {
+		u, err := url.Parse(resource)
+		if err != nil || !u.IsAbs() {
+			return fmt.Errorf("resource %q is not an absolute URI", resource)
+		}
+		if u.Fragment != "" || strings.Contains(resource, "#") {
+			return fmt.Errorf("resource %q must not contain a fragment", resource)
+		}
+		if _, exists := idp.GetResource(resource); !exists {
+			return fmt.Errorf("resource %q is not a known protected resource", resource)
+		}
+	}
+	return nil
+}
+
+// ResourceScope narrows scope to the scopes accepted by at least one of the resources. With no
+// resources the scope is returned unchanged.
+func (idp *MockIdP) ResourceScope(resources []string, scope string) string {
+	if len(resources) == 0 {
+		return scope
+	}
+
+	accepted := make(map[string]bool)
+	for _, uri := range resources {
+		if resource, exists := idp.GetResource(uri); exists {
+			for _, s := range resource.Scopes {
+				accepted[s] = true
+			}
+		}
+	}
+
+	narrowed := make([]string, 0)
+	for _, s := range strings.Fields(scope) {
+		if accepted[s] {
+			narrowed = append(narrowed, s)
+		}
+	}
+	return strings.Join(narrowed, " ")
+}
+
+// AudienceAccepts reports whether an access token may be used at resource. A token issued
+// without a resource indicator has its client as the only audience and is not bound to any
+// API; a token restricted to resources must name this one (RFC 8707 Section 2, RFC 9068 Section 4).
+func AudienceAccepts(claims map[string]interface{}, resource string) bool {
+	var audience []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []interface{}:
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	case []string:
+		audience = aud
+	}
+
+	for _, aud := range audience {
+		if aud == resource {
+			return true
+		}
+	}
+	clientID, _ := claims["client_id"].(string)
+	return len(audience) == 1 && clientID != "" && audience[0] == clientID
+}
+
+// GrantResources records the resource indicators an authorization code was issued for
+func (idp *MockIdP) GrantResources(code string, resources []string) {
+	idp.updateAuthorizationCode(code, func(authCode *models.AuthorizationCode) {
+		authCode.Resources = resources
+	})
+}
+
+// SetRefreshTokenResources records the resource indicators granted with a refresh token
+func (idp *MockIdP) SetRefreshTokenResources(token string, resources []string) {
+	idp.updateRefreshToken(token, func(rt *models.RefreshToken) {
+		rt.Resources = resources
+	})
+}
+
+// ResourcesCovered reports whether every requested resource indicator is in granted
+func ResourcesCovered(requested, granted []string) bool {
+	allowed := make(map[string]bool, len(granted))
+	for _, resource := range granted {
+		allowed[resource] = true
+	}
+	for _, resource := range requested {
+		if !allowed[resource] {
+			return false
+		}
+	}
+	return true
+}
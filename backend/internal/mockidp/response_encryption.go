@@ -0,0 +1,162 @@
+package mockidp
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// UserInfoSigningAlgorithms lists the algorithms UserInfo responses can be signed with
+var UserInfoSigningAlgorithms = []string{"RS256", "ES256"}
+
+// defaultResponseEncryptionEnc is the content encryption of a client that registers an
+// *_encrypted_response_alg without the matching *_enc (OIDC Dynamic Client Registration Section 2)
+const defaultResponseEncryptionEnc = crypto.EncA128CBCHS256
+
+// validateResponseEncryption checks an *_encrypted_response_alg and *_encrypted_response_enc pair,
+// defaulting enc when only alg is given. Encrypting to the client needs its public keys.
+func validateResponseEncryption(prefix, alg string, enc *string, hasKeys bool) error {
+	if alg == "" {
+		if *enc != "" {
+			return fmt.Errorf("%s_encrypted_response_enc requires %s_encrypted_response_alg", prefix, prefix)
+		}
+		return nil
+	}
+	if !slices.Contains(crypto.JWEKeyAlgorithms, alg) {
+		return fmt.Errorf("unsupported %s_encrypted_response_alg %q", prefix, alg)
+	}
+	if *enc == "" {
+		*enc = defaultResponseEncryptionEnc
+	}
+	if !slices.Contains(crypto.JWEContentEncryptionAlgorithms, *enc) {
+		return fmt.Errorf("unsupported %s_encrypted_response_enc %q", prefix, *enc)
+	}
+	if !hasKeys {
+		return fmt.Errorf("%s_encrypted_response_alg %s requires jwks or jwks_uri", prefix, alg)
+	}
+	return nil
+}
+
+// validateResponseMetadata checks the ID token and UserInfo response algorithms of a registration
+// request (OIDC Dynamic Client Registration Section 2)
+func validateResponseMetadata(md *models.ClientMetadata) error {
+	hasKeys := md.JWKS != nil || md.JWKSURI != ""
+	if err := validateResponseEncryption("id_token", md.IDTokenEncryptedResponseAlg, &md.IDTokenEncryptedResponseEnc, hasKeys); err != nil {
+		return metadataError("%v", err)
+	}
+	if alg := md.UserInfoSignedResponseAlg; alg != "" && !slices.Contains(UserInfoSigningAlgorithms, alg) {
+		return metadataError("unsupported userinfo_signed_response_alg %q", alg)
+	}
+	if err := validateResponseEncryption("userinfo", md.UserInfoEncryptedResponseAlg, &md.UserInfoEncryptedResponseEnc, hasKeys); err != nil {
+		return metadataError("%v", err)
+	}
+	return nil
+}
+
+// validateResponseAlgorithms checks the ID token and UserInfo response algorithms of a client
+// created or replaced through the admin API
+func validateResponseAlgorithms(client *models.Client) error {
+	hasKeys := client.JWKS != nil || client.JWKSURI != ""
+	if err := validateResponseEncryption("id_token", client.IDTokenEncryptedResponseAlg, &client.IDTokenEncryptedResponseEnc, hasKeys); err != nil {
+		return err
+	}
+	if alg := client.UserInfoSignedResponseAlg; alg != "" && !slices.Contains(UserInfoSigningAlgorithms, alg) {
+		return fmt.Errorf("unsupported userinfo_signed_response_alg %q", alg)
+	}
+	return validateResponseEncryption("userinfo", client.UserInfoEncryptedResponseAlg, &client.UserInfoEncryptedResponseEnc, hasKeys)
+}
+
+// UserInfoResponseIsJWT reports whether a client registered for signed or encrypted UserInfo
+// responses, which are returned as application/jwt instead of JSON (OIDC Core Section 5.3.2)
+func UserInfoResponseIsJWT(client *models.Client) bool {
+	return client.UserInfoSignedResponseAlg != "" || client.UserInfoEncryptedResponseAlg != ""
+}
+
+// EncryptIDToken encrypts a signed ID token to a client that registered an
+// id_token_encrypted_response_alg, and returns it unchanged otherwise. The result is a nested
+// JWT: the JWS is the JWE plaintext, so the client decrypts first and then verifies the
+// signature (OIDC Core Section 10.2).
+func (idp *MockIdP) EncryptIDToken(clientID, idToken string) (string, error) {
+	client, exists := idp.LookupClient(clientID)
+	if !exists || client.IDTokenEncryptedResponseAlg == "" {
+		return idToken, nil
+	}
+	return idp.encryptToClient(client, []byte(idToken), client.IDTokenEncryptedResponseAlg, client.IDTokenEncryptedResponseEnc, "JWT")
+}
+
+// CreateUserInfoJWT returns UserInfo claims as a JWT for a client that registered
+// userinfo_signed_response_alg and/or userinfo_encrypted_response_alg. A signed response carries
+// iss and aud; a response that is only encrypted has the JSON claims as its plaintext
+// (OIDC Core Section 5.3.2).
+func (idp *MockIdP) CreateUserInfoJWT(client *models.Client, claims map[string]interface{}) (string, error) {
+	var payload []byte
+	cty := ""
+	if client.UserInfoSignedResponseAlg != "" {
+		signed, err := idp.JWTService().CreateUserInfoJWT(client.ID, claims, client.UserInfoSignedResponseAlg)
+		if err != nil {
+			return "", err
+		}
+		if client.UserInfoEncryptedResponseAlg == "" {
+			return signed, nil
+		}
+		payload, cty = []byte(signed), "JWT"
+	} else {
+		encoded, err := json.Marshal(claims)
+		if err != nil {
+			return "", err
+		}
+		payload = encoded
+	}
+	return idp.encryptToClient(client, payload, client.UserInfoEncryptedResponseAlg, client.UserInfoEncryptedResponseEnc, cty)
+}
+
+// encryptToClient encrypts plaintext to the client's registered encryption key for alg
+func (idp *MockIdP) encryptToClient(client *models.Client, plaintext []byte, alg, enc, cty string) (string, error) {
+	if enc == "" {
+		enc = defaultResponseEncryptionEnc
+	}
+	jwk, err := idp.clientEncryptionKey(client, alg)
+	if err != nil {
+		return "", err
+	}
+	key, err := jwk.ToPublicKey()
+	if err != nil {
+		return "", fmt.Errorf("invalid client encryption key: %w", err)
+	}
+	return crypto.EncryptJWE(plaintext, key, jwk.Kid, alg, enc, cty)
+}
+
+// clientEncryptionKey picks the client's first key of the type alg encrypts to that is not
+// restricted to signatures (RFC 7517 Section 4.2)
+func (idp *MockIdP) clientEncryptionKey(client *models.Client, alg string) (*crypto.JWK, error) {
+	jwks, err := idp.clientJWKS(client)
+	if err != nil {
+		return nil, err
+	}
+	kty := crypto.JWEKeyType(alg)
+	for i := range jwks.Keys {
+		key := &jwks.Keys[i]
+		if key.Kty == kty && (key.Use == "" || key.Use == "enc") {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("client has no %s encryption key for %s", kty, alg)
+}
+
+// providerEncryptionJWKS returns the provider's public encryption keys as registered client
+// metadata, for the demo client whose responses are encrypted to keys the provider can decrypt
+func (idp *MockIdP) providerEncryptionJWKS() map[string]interface{} {
+	keys := []crypto.JWK{}
+	for _, key := range idp.keySet.PublicJWKS().Keys {
+		if key.Use == "enc" {
+			keys = append(keys, key)
+		}
+	}
+	data, _ := json.Marshal(crypto.JWKS{Keys: keys})
+	var jwks map[string]interface{}
+	json.Unmarshal(data, &jwks)
+	return jwks
+}
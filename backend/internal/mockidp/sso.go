@@ -0,0 +1,50 @@
+package mockidp
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// RecordSessionGrant records that the user signed in to a client with a session and approved
+// the requested scopes, so later requests of the client within the session need no consent
+func (idp *MockIdP) RecordSessionGrant(sessionID, clientID, scope string) {
+	idp.updateSession(sessionID, func(session *models.Session) {
+		if !slices.Contains(session.Clients, clientID) {
+			session.Clients = append(session.Clients, clientID)
+		}
+		if session.Consents == nil {
+			session.Consents = make(map[string][]string)
+		}
+		for _, value := range strings.Fields(scope) {
+			if !slices.Contains(session.Consents[clientID], value) {
+				session.Consents[clientID] = append(session.Consents[clientID], value)
+			}
+		}
+	})
+}
+
+// SessionHasConsent reports whether the user already approved every scope of a request from
+// the client during the session
+func SessionHasConsent(session *models.Session, clientID, scope string) bool {
+	granted, exists := session.Consents[clientID]
+	if !exists {
+		return false
+	}
+	for _, value := range strings.Fields(scope) {
+		if !slices.Contains(granted, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// SessionClients returns the clients signed in to with a session, which are told when it ends
+func SessionClients(session *models.Session) []string {
+	if len(session.Clients) == 0 {
+		// Sessions stored before clients were tracked only record the first client
+		return []string{session.ClientID}
+	}
+	return session.Clients
+}
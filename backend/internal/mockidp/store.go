@@ -0,0 +1,581 @@
+package mockidp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// Store backends selected by SHOWCASE_MOCKIDP_STORE
+const (
+	StoreMemory = "memory"
+	StoreSQLite = "sqlite"
+)
+
+// ErrNotFound is returned by a Store when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// Store persists the provider's keys, users, clients, authorization codes, sessions, refresh
+// tokens, reference access tokens and access token revocations. Records are returned by pointer; a caller that changes one must write it back with
+// the matching Put method, since persistent stores hand out copies.
+type Store interface {
+	GetUser(id string) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	ListUsers() ([]*models.User, error)
+	PutUser(user *models.User) error
+	DeleteUser(id string) error
+
+	GetClient(id string) (*models.Client, error)
+	ListClients() ([]*models.Client, error)
+	PutClient(client *models.Client) error
+	DeleteClient(id string) error
+
+	GetAuthorizationCode(code string) (*models.AuthorizationCode, error)
+	PutAuthorizationCode(authCode *models.AuthorizationCode) error
+	// TakeAuthorizationCode removes and returns a code in one step, so that a code is
+	// redeemed at most once even when concurrent requests present it
+	TakeAuthorizationCode(code string) (*models.AuthorizationCode, error)
+
+	GetSession(id string) (*models.Session, error)
+	PutSession(session *models.Session) error
+	DeleteSession(id string) error
+
+	GetRefreshToken(token string) (*models.RefreshToken, error)
+	PutRefreshToken(rt *models.RefreshToken) error
+	DeleteRefreshToken(token string) error
+	// MarkRefreshTokenRotated sets RotatedAt on a token that is neither rotated nor revoked and
+	// returns it, in one step, so that a token is rotated at most once even when several
+	// processes share the store. Otherwise it returns ErrNotFound.
+	MarkRefreshTokenRotated(token string, at time.Time) (*models.RefreshToken, error)
+	// RefreshTokenFamily returns every token of a family, oldest first
+	RefreshTokenFamily(familyID string) ([]*models.RefreshToken, error)
+	DeleteClientRefreshTokens(clientID string) error
+	// SessionRefreshTokens returns the refresh tokens of grants made in a session
+	SessionRefreshTokens(sessionID string) ([]*models.RefreshToken, error)
+
+	GetReferenceToken(token string) (*models.ReferenceToken, error)
+	PutReferenceToken(ref *models.ReferenceToken) error
+	DeleteReferenceToken(token string) error
+	DeleteClientReferenceTokens(clientID string) error
+
+	// RevokeAccessToken records the jti of a revoked JWT access token until the token expires
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+
+	// GetKeySet returns the key set encoded by crypto.MarshalKeySet
+	GetKeySet() ([]byte, error)
+	// AddKeySet stores an encoded key set unless one is stored already, so that processes
+	// starting together on a shared store settle on the same keys
+	AddKeySet(data []byte) error
+	// GetPairwiseSalt returns the secret mixed into pairwise subject identifiers
+	GetPairwiseSalt() (string, error)
+	// AddPairwiseSalt stores a pairwise salt unless one is stored already
+	AddPairwiseSalt(salt string) error
+
+	// DeleteExpired removes authorization codes, sessions, refresh tokens, reference tokens
+	// and revocations that expired before now and returns how many records were removed
+	DeleteExpired(now time.Time) (int, error)
+	Close() error
+}
+
+// OpenStore opens the store backend named by kind; dataDir holds the SQLite database
+func OpenStore(kind, dataDir string) (Store, error) {
+	switch kind {
+	case "", StoreMemory:
+		return NewMemoryStore(), nil
+	case StoreSQLite:
+		return NewSQLiteStore(dataDir)
+	default:
+		return nil, fmt.Errorf("unknown MockIdP store %q (use %s or %s)", kind, StoreMemory, StoreSQLite)
+	}
+}
+
+// MemoryStore keeps all records in process memory; they are lost on restart
+type MemoryStore struct {
+	users           map[string]*models.User
+	clients         map[string]*models.Client
+	authCodes       map[string]*models.AuthorizationCode
+	sessions        map[string]*models.Session
+	refreshTokens   map[string]*models.RefreshToken
+	referenceTokens map[string]*models.ReferenceToken
+	revokedJTIs     map[string]time.Time // jti -> expiry of the revoked access token
+	keySet          []byte
+	pairwiseSalt    string
+	mu              sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:           make(map[string]*models.User),
+		clients:         make(map[string]*models.Client),
+		authCodes:       make(map[string]*models.AuthorizationCode),
+		sessions:        make(map[string]*models.Session),
+		refreshTokens:   make(map[string]*models.RefreshToken),
+		referenceTokens: make(map[string]*models.ReferenceToken),
+		revokedJTIs:     make(map[string]time.Time),
+	}
+}
+
+// GetUser retrieves a user by ID
+func (s *MemoryStore) GetUser(id string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if user, exists := s.users[id]; exists {
+		return user, nil
+	}
+	return nil, ErrNotFound
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *MemoryStore) GetUserByEmail(email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListUsers returns all users ordered by ID
+func (s *MemoryStore) ListUsers() ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]*models.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// PutUser creates or replaces a user
+func (s *MemoryStore) PutUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.ID] = user
+	return nil
+}
+
+// DeleteUser removes a user
+func (s *MemoryStore) DeleteUser(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[id]; !exists {
+		return ErrNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// GetClient retrieves a client by ID
+func (s *MemoryStore) GetClient(id string) (*models.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if client, exists := s.clients[id]; exists {
+		return client, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ListClients returns all clients ordered by ID
+func (s *MemoryStore) ListClients() ([]*models.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clients := make([]*models.Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients, nil
+}
+
+// PutClient creates or replaces a client
+func (s *MemoryStore) PutClient(client *models.Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client.ID] = client
+	return nil
+}
+
+// DeleteClient removes a client
+func (s *MemoryStore) DeleteClient(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.clients[id]; !exists {
+		return ErrNotFound
+	}
+	delete(s.clients, id)
+	return nil
+}
+
+// GetAuthorizationCode retrieves an authorization code without consuming it
+func (s *MemoryStore) GetAuthorizationCode(code string) (*models.AuthorizationCode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if authCode, exists := s.authCodes[code]; exists {
+		return authCode, nil
+	}
+	return nil, ErrNotFound
+}
+
+// PutAuthorizationCode creates or replaces an authorization code
+func (s *MemoryStore) PutAuthorizationCode(authCode *models.AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authCodes[authCode.Code] = authCode
+	return nil
+}
+
+// TakeAuthorizationCode removes and returns an authorization code
+func (s *MemoryStore) TakeAuthorizationCode(code string) (*models.AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	authCode, exists := s.authCodes[code]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	delete(s.authCodes, code)
+	return authCode, nil
+}
+
+// GetSession retrieves a session by ID
+func (s *MemoryStore) GetSession(id string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if session, exists := s.sessions[id]; exists {
+		return session, nil
+	}
+	return nil, ErrNotFound
+}
+
+// PutSession creates or replaces a session
+func (s *MemoryStore) PutSession(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+	return nil
+}
+
+// DeleteSession removes a session
+func (s *MemoryStore) DeleteSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token record
+func (s *MemoryStore) GetRefreshToken(token string) (*models.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if rt, exists := s.refreshTokens[token]; exists {
+		return rt, nil
+	}
+	return nil, ErrNotFound
+}
+
+// PutRefreshToken creates or replaces a refresh token record
+func (s *MemoryStore) PutRefreshToken(rt *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens[rt.Token] = rt
+	return nil
+}
+
+// DeleteRefreshToken removes a refresh token record
+func (s *MemoryStore) DeleteRefreshToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.refreshTokens, token)
+	return nil
+}
+
+// MarkRefreshTokenRotated sets RotatedAt on a token that is neither rotated nor revoked
+func (s *MemoryStore) MarkRefreshTokenRotated(token string, at time.Time) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rt, exists := s.refreshTokens[token]
+	if !exists || !rt.RotatedAt.IsZero() || !rt.RevokedAt.IsZero() {
+		return nil, ErrNotFound
+	}
+	rt.RotatedAt = at
+	return rt, nil
+}
+
+// RefreshTokenFamily returns every token of a family, oldest first
+func (s *MemoryStore) RefreshTokenFamily(familyID string) ([]*models.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	family := make([]*models.RefreshToken, 0)
+	for _, rt := range s.refreshTokens {
+		if rt.FamilyID == familyID {
+			family = append(family, rt)
+		}
+	}
+	sort.Slice(family, func(i, j int) bool {
+		return family[i].Generation < family[j].Generation
+	})
+	return family, nil
+}
+
+// DeleteClientRefreshTokens removes every refresh token issued to a client
+func (s *MemoryStore) DeleteClientRefreshTokens(clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, rt := range s.refreshTokens {
+		if rt.ClientID == clientID {
+			delete(s.refreshTokens, token)
+		}
+	}
+	return nil
+}
+
+// SessionRefreshTokens returns the refresh tokens of grants made in a session
+func (s *MemoryStore) SessionRefreshTokens(sessionID string) ([]*models.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make([]*models.RefreshToken, 0)
+	for _, rt := range s.refreshTokens {
+		if rt.SessionID == sessionID {
+			tokens = append(tokens, rt)
+		}
+	}
+	return tokens, nil
+}
+
+// GetReferenceToken retrieves an opaque access token
+func (s *MemoryStore) GetReferenceToken(token string) (*models.ReferenceToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if ref, exists := s.referenceTokens[token]; exists {
+		return ref, nil
+	}
+	return nil, ErrNotFound
+}
+
+// PutReferenceToken creates or replaces an opaque access token
+func (s *MemoryStore) PutReferenceToken(ref *models.ReferenceToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.referenceTokens[ref.Token] = ref
+	return nil
+}
+
+// DeleteReferenceToken removes an opaque access token
+func (s *MemoryStore) DeleteReferenceToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.referenceTokens, token)
+	return nil
+}
+
+// DeleteClientReferenceTokens removes every opaque access token issued to a client
+func (s *MemoryStore) DeleteClientReferenceTokens(clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, ref := range s.referenceTokens {
+		if ref.ClientID == clientID {
+			delete(s.referenceTokens, token)
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken records a revoked access token's jti until expiresAt
+func (s *MemoryStore) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokedJTIs[jti] = expiresAt
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether an access token's jti was revoked
+func (s *MemoryStore) IsAccessTokenRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, revoked := s.revokedJTIs[jti]
+	return revoked, nil
+}
+
+// GetKeySet returns the stored key set
+func (s *MemoryStore) GetKeySet() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.keySet == nil {
+		return nil, ErrNotFound
+	}
+	return s.keySet, nil
+}
+
+// AddKeySet stores a key set unless one is stored already
+func (s *MemoryStore) AddKeySet(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keySet == nil {
+		s.keySet = data
+	}
+	return nil
+}
+
+// GetPairwiseSalt returns the stored pairwise salt
+func (s *MemoryStore) GetPairwiseSalt() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.pairwiseSalt == "" {
+		return "", ErrNotFound
+	}
+	return s.pairwiseSalt, nil
+}
+
+// AddPairwiseSalt stores a pairwise salt unless one is stored already
+func (s *MemoryStore) AddPairwiseSalt(salt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pairwiseSalt == "" {
+		s.pairwiseSalt = salt
+	}
+	return nil
+}
+
+// DeleteExpired removes expired authorization codes, sessions, refresh tokens, reference
+// tokens and revocations
+func (s *MemoryStore) DeleteExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for code, authCode := range s.authCodes {
+		if authCode.ExpiresAt.Before(now) {
+			delete(s.authCodes, code)
+			removed++
+		}
+	}
+	for id, session := range s.sessions {
+		if session.ExpiresAt.Before(now) {
+			delete(s.sessions, id)
+			removed++
+		}
+	}
+	for token, rt := range s.refreshTokens {
+		if rt.ExpiresAt.Before(now) {
+			delete(s.refreshTokens, token)
+			removed++
+		}
+	}
+	for token, ref := range s.referenceTokens {
+		if ref.ExpiresAt.Before(now) {
+			delete(s.referenceTokens, token)
+			removed++
+		}
+	}
+	for jti, expiresAt := range s.revokedJTIs {
+		if expiresAt.Before(now) {
+			delete(s.revokedJTIs, jti)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Close releases the store; the memory store holds no resources
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// StartExpirySweeper deletes expired authorization codes, sessions, tokens and revocations from
+// the store, and forgets old failed attempts, every interval until the returned stop function
+// is called
+func (idp *MockIdP) StartExpirySweeper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				idp.loginAttempts.Prune(now)
+				idp.userCodeFailures.Prune(now)
+				removed, err := idp.store.DeleteExpired(now)
+				if err != nil {
+					log.Printf("MockIdP expiry sweep failed: %v", err)
+				} else if removed > 0 {
+					log.Printf("MockIdP expiry sweep removed %d records", removed)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// updateAuthorizationCode applies change to a stored authorization code and writes it back
+func (idp *MockIdP) updateAuthorizationCode(code string, change func(*models.AuthorizationCode)) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	authCode, err := idp.store.GetAuthorizationCode(code)
+	if err != nil {
+		logStoreError("get authorization code", err)
+		return
+	}
+	change(authCode)
+	logStoreError("put authorization code", idp.store.PutAuthorizationCode(authCode))
+}
+
+// updateRefreshToken applies change to a stored refresh token and writes it back
+func (idp *MockIdP) updateRefreshToken(token string, change func(*models.RefreshToken)) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	rt, err := idp.store.GetRefreshToken(token)
+	if err != nil {
+		logStoreError("get refresh token", err)
+		return
+	}
+	change(rt)
+	logStoreError("put refresh token", idp.store.PutRefreshToken(rt))
+}
+
+// updateSession applies change to a stored session and writes it back
+func (idp *MockIdP) updateSession(id string, change func(*models.Session)) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	session, err := idp.store.GetSession(id)
+	if err != nil {
+		logStoreError("get session", err)
+		return
+	}
+	change(session)
+	logStoreError("put session", idp.store.PutSession(session))
+}
+
+// updateClient applies change to a stored client and writes it back
+func (idp *MockIdP) updateClient(clientID string, change func(*models.Client)) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	client, err := idp.store.GetClient(clientID)
+	if err != nil {
+		logStoreError("get client", err)
+		return
+	}
+	change(client)
+	logStoreError("put client", idp.store.PutClient(client))
+}
+
+// logStoreError reports store failures other than a missing record, which callers treat as absent
+func logStoreError(operation string, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("MockIdP store %s failed: %v", operation, err)
+	}
+}
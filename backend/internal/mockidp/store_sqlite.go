@@ -0,0 +1,592 @@
+package mockidp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver
+
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// SQLiteStore persists the provider's state, including its private keys, in a SQLite database,
+// so it survives restarts. It is meant for a single process: pushed authorization requests, CIBA
+// requests, client assertion jtis, pairwise subjects and login attempts stay in process memory.
+// Each record is stored as JSON, with the fields used for lookups and expiry in their own
+// columns. Secrets that the models never serialize are kept in separate columns.
+type SQLiteStore struct {
+	db   *sql.DB
+	path string
+}
+
+// NewSQLiteStore opens or creates mockidp.db in dataDir
+func NewSQLiteStore(dataDir string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	dbPath := filepath.Join(dataDir, "mockidp.db")
+
+	// busy_timeout lets other processes sharing the file wait for the write lock instead of failing
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1) // SQLite only supports one writer
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	store := &SQLiteStore{db: db, path: dbPath}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+	return store, nil
+}
+
+// migrate runs database schema migrations
+func (s *SQLiteStore) migrate() error {
+	migrations := []string{
+		`CREATE TABLE IF NOT EXISTS mockidp_users (
+			id TEXT PRIMARY KEY,
+			email TEXT NOT NULL,
+			password TEXT NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_users_email ON mockidp_users(email)`,
+
+		`CREATE TABLE IF NOT EXISTS mockidp_clients (
+			id TEXT PRIMARY KEY,
+			secret TEXT NOT NULL,
+			registration TEXT,
+			registration_access_token TEXT NOT NULL,
+			data TEXT NOT NULL
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS mockidp_authorization_codes (
+			code TEXT PRIMARY KEY,
+			expires_at INTEGER NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_codes_expires_at ON mockidp_authorization_codes(expires_at)`,
+
+		`CREATE TABLE IF NOT EXISTS mockidp_sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			expires_at INTEGER NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_sessions_expires_at ON mockidp_sessions(expires_at)`,
+
+		`CREATE TABLE IF NOT EXISTS mockidp_refresh_tokens (
+			token TEXT PRIMARY KEY,
+			client_id TEXT NOT NULL,
+			family_id TEXT NOT NULL,
+			generation INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_refresh_tokens_family ON mockidp_refresh_tokens(family_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_refresh_tokens_client ON mockidp_refresh_tokens(client_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_refresh_tokens_expires_at ON mockidp_refresh_tokens(expires_at)`,
+
+		`CREATE TABLE IF NOT EXISTS mockidp_reference_tokens (
+			token TEXT PRIMARY KEY,
+			client_id TEXT NOT NULL,
+			expires_at INTEGER NOT NULL,
+			data TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_reference_tokens_client ON mockidp_reference_tokens(client_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_reference_tokens_expires_at ON mockidp_reference_tokens(expires_at)`,
+
+		`CREATE TABLE IF NOT EXISTS mockidp_revoked_access_tokens (
+			jti TEXT PRIMARY KEY,
+			expires_at INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mockidp_revoked_access_tokens_expires_at ON mockidp_revoked_access_tokens(expires_at)`,
+
+		// A single row holding the signing and encryption keys
+		`CREATE TABLE IF NOT EXISTS mockidp_keys (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			data TEXT NOT NULL
+		)`,
+		// A single row holding the salt of pairwise subject identifiers
+		`CREATE TABLE IF NOT EXISTS mockidp_pairwise_salt (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			salt TEXT NOT NULL
+		)`,
+	}
+
+	for _, migration := range migrations {
+		if _, err := s.db.Exec(migration); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database connection
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// ================== Users ==================
+
+// GetUser retrieves a user by ID
+func (s *SQLiteStore) GetUser(id string) (*models.User, error) {
+	return s.scanUser(s.db.QueryRow(`SELECT password, data FROM mockidp_users WHERE id = ?`, id))
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *SQLiteStore) GetUserByEmail(email string) (*models.User, error) {
+	return s.scanUser(s.db.QueryRow(`SELECT password, data FROM mockidp_users WHERE email = ? ORDER BY id LIMIT 1`, email))
+}
+
+// ListUsers returns all users ordered by ID
+func (s *SQLiteStore) ListUsers() ([]*models.User, error) {
+	rows, err := s.db.Query(`SELECT password, data FROM mockidp_users ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]*models.User, 0)
+	for rows.Next() {
+		user, err := s.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// PutUser creates or replaces a user
+func (s *SQLiteStore) PutUser(user *models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO mockidp_users (id, email, password, data) VALUES (?, ?, ?, ?)`,
+		user.ID, user.Email, user.Password, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to store user: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser removes a user
+func (s *SQLiteStore) DeleteUser(id string) error {
+	return s.deleteOne(`DELETE FROM mockidp_users WHERE id = ?`, id)
+}
+
+// scanUser decodes a row of password and data columns
+func (s *SQLiteStore) scanUser(row rowScanner) (*models.User, error) {
+	var password, data string
+	if err := row.Scan(&password, &data); err != nil {
+		return nil, notFoundOr(err, "user")
+	}
+	var user models.User
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	user.Password = password
+	return &user, nil
+}
+
+// ================== Clients ==================
+
+// GetClient retrieves a client by ID
+func (s *SQLiteStore) GetClient(id string) (*models.Client, error) {
+	return s.scanClient(s.db.QueryRow(
+		`SELECT secret, registration, registration_access_token, data FROM mockidp_clients WHERE id = ?`, id))
+}
+
+// ListClients returns all clients ordered by ID
+func (s *SQLiteStore) ListClients() ([]*models.Client, error) {
+	rows, err := s.db.Query(`SELECT secret, registration, registration_access_token, data FROM mockidp_clients ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := make([]*models.Client, 0)
+	for rows.Next() {
+		client, err := s.scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// PutClient creates or replaces a client
+func (s *SQLiteStore) PutClient(client *models.Client) error {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client: %w", err)
+	}
+	var registration sql.NullString
+	if client.Registration != nil {
+		encoded, err := json.Marshal(client.Registration)
+		if err != nil {
+			return fmt.Errorf("failed to marshal client registration: %w", err)
+		}
+		registration = sql.NullString{String: string(encoded), Valid: true}
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO mockidp_clients (id, secret, registration, registration_access_token, data)
+		VALUES (?, ?, ?, ?, ?)`,
+		client.ID, client.Secret, registration, client.RegistrationAccessToken, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to store client: %w", err)
+	}
+	return nil
+}
+
+// DeleteClient removes a client
+func (s *SQLiteStore) DeleteClient(id string) error {
+	return s.deleteOne(`DELETE FROM mockidp_clients WHERE id = ?`, id)
+}
+
+// scanClient decodes a row of secret, registration, registration_access_token and data columns
+func (s *SQLiteStore) scanClient(row rowScanner) (*models.Client, error) {
+	var secret, registrationAccessToken, data string
+	var registration sql.NullString
+	if err := row.Scan(&secret, &registration, &registrationAccessToken, &data); err != nil {
+		return nil, notFoundOr(err, "client")
+	}
+	var client models.Client
+	if err := json.Unmarshal([]byte(data), &client); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal client: %w", err)
+	}
+	client.Secret = secret
+	client.RegistrationAccessToken = registrationAccessToken
+	if registration.Valid {
+		client.Registration = &models.ClientMetadata{}
+		if err := json.Unmarshal([]byte(registration.String), client.Registration); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal client registration: %w", err)
+		}
+	}
+	return &client, nil
+}
+
+// ================== Authorization Codes ==================
+
+// GetAuthorizationCode retrieves an authorization code without consuming it
+func (s *SQLiteStore) GetAuthorizationCode(code string) (*models.AuthorizationCode, error) {
+	var authCode models.AuthorizationCode
+	if err := s.getRecord(&authCode, "authorization code", `SELECT data FROM mockidp_authorization_codes WHERE code = ?`, code); err != nil {
+		return nil, err
+	}
+	return &authCode, nil
+}
+
+// PutAuthorizationCode creates or replaces an authorization code
+func (s *SQLiteStore) PutAuthorizationCode(authCode *models.AuthorizationCode) error {
+	return s.putRecord(authCode, "authorization code",
+		`INSERT OR REPLACE INTO mockidp_authorization_codes (code, expires_at, data) VALUES (?, ?, ?)`,
+		authCode.Code, authCode.ExpiresAt.Unix())
+}
+
+// TakeAuthorizationCode deletes and returns an authorization code in a single statement
+func (s *SQLiteStore) TakeAuthorizationCode(code string) (*models.AuthorizationCode, error) {
+	var authCode models.AuthorizationCode
+	if err := s.getRecord(&authCode, "authorization code", `DELETE FROM mockidp_authorization_codes WHERE code = ? RETURNING data`, code); err != nil {
+		return nil, err
+	}
+	return &authCode, nil
+}
+
+// ================== Sessions ==================
+
+// GetSession retrieves a session by ID
+func (s *SQLiteStore) GetSession(id string) (*models.Session, error) {
+	var session models.Session
+	if err := s.getRecord(&session, "session", `SELECT data FROM mockidp_sessions WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// PutSession creates or replaces a session
+func (s *SQLiteStore) PutSession(session *models.Session) error {
+	return s.putRecord(session, "session",
+		`INSERT OR REPLACE INTO mockidp_sessions (id, user_id, expires_at, data) VALUES (?, ?, ?, ?)`,
+		session.ID, session.UserID, session.ExpiresAt.Unix())
+}
+
+// DeleteSession removes a session
+func (s *SQLiteStore) DeleteSession(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM mockidp_sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// ================== Refresh Tokens ==================
+
+// GetRefreshToken retrieves a refresh token record
+func (s *SQLiteStore) GetRefreshToken(token string) (*models.RefreshToken, error) {
+	var rt models.RefreshToken
+	if err := s.getRecord(&rt, "refresh token", `SELECT data FROM mockidp_refresh_tokens WHERE token = ?`, token); err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// PutRefreshToken creates or replaces a refresh token record
+func (s *SQLiteStore) PutRefreshToken(rt *models.RefreshToken) error {
+	return s.putRecord(rt, "refresh token",
+		`INSERT OR REPLACE INTO mockidp_refresh_tokens (token, client_id, family_id, generation, expires_at, data)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		rt.Token, rt.ClientID, rt.FamilyID, rt.Generation, rt.ExpiresAt.Unix())
+}
+
+// DeleteRefreshToken removes a refresh token record
+func (s *SQLiteStore) DeleteRefreshToken(token string) error {
+	if _, err := s.db.Exec(`DELETE FROM mockidp_refresh_tokens WHERE token = ?`, token); err != nil {
+		return fmt.Errorf("failed to delete refresh token: %w", err)
+	}
+	return nil
+}
+
+// MarkRefreshTokenRotated sets rotated_at in a single conditional update, so concurrent
+// requests cannot both rotate the token. Go encodes an unset time as the zero time.
+func (s *SQLiteStore) MarkRefreshTokenRotated(token string, at time.Time) (*models.RefreshToken, error) {
+	var rt models.RefreshToken
+	err := s.getRecord(&rt, "refresh token", `UPDATE mockidp_refresh_tokens SET data = json_set(data, '$.rotated_at', ?)
+		WHERE token = ?
+		AND coalesce(json_extract(data, '$.rotated_at'), '0001-01-01T00:00:00Z') = '0001-01-01T00:00:00Z'
+		AND coalesce(json_extract(data, '$.revoked_at'), '0001-01-01T00:00:00Z') = '0001-01-01T00:00:00Z'
+		RETURNING data`, at.Format(time.RFC3339Nano), token)
+	if err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// RefreshTokenFamily returns every token of a family, oldest first
+func (s *SQLiteStore) RefreshTokenFamily(familyID string) ([]*models.RefreshToken, error) {
+	rows, err := s.db.Query(`SELECT data FROM mockidp_refresh_tokens WHERE family_id = ? ORDER BY generation`, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refresh token family: %w", err)
+	}
+	defer rows.Close()
+
+	family := make([]*models.RefreshToken, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan refresh token: %w", err)
+		}
+		var rt models.RefreshToken
+		if err := json.Unmarshal([]byte(data), &rt); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal refresh token: %w", err)
+		}
+		family = append(family, &rt)
+	}
+	return family, rows.Err()
+}
+
+// DeleteClientRefreshTokens removes every refresh token issued to a client
+func (s *SQLiteStore) DeleteClientRefreshTokens(clientID string) error {
+	if _, err := s.db.Exec(`DELETE FROM mockidp_refresh_tokens WHERE client_id = ?`, clientID); err != nil {
+		return fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// SessionRefreshTokens returns the refresh tokens of grants made in a session
+func (s *SQLiteStore) SessionRefreshTokens(sessionID string) ([]*models.RefreshToken, error) {
+	rows, err := s.db.Query(`SELECT data FROM mockidp_refresh_tokens WHERE json_extract(data, '$.session_id') = ?`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session refresh tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]*models.RefreshToken, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan refresh token: %w", err)
+		}
+		var rt models.RefreshToken
+		if err := json.Unmarshal([]byte(data), &rt); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal refresh token: %w", err)
+		}
+		tokens = append(tokens, &rt)
+	}
+	return tokens, rows.Err()
+}
+
+// ================== Reference Tokens ==================
+
+// GetReferenceToken retrieves an opaque access token
+func (s *SQLiteStore) GetReferenceToken(token string) (*models.ReferenceToken, error) {
+	var ref models.ReferenceToken
+	if err := s.getRecord(&ref, "reference token", `SELECT data FROM mockidp_reference_tokens WHERE token = ?`, token); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// PutReferenceToken creates or replaces an opaque access token
+func (s *SQLiteStore) PutReferenceToken(ref *models.ReferenceToken) error {
+	return s.putRecord(ref, "reference token",
+		`INSERT OR REPLACE INTO mockidp_reference_tokens (token, client_id, expires_at, data) VALUES (?, ?, ?, ?)`,
+		ref.Token, ref.ClientID, ref.ExpiresAt.Unix())
+}
+
+// DeleteReferenceToken removes an opaque access token
+func (s *SQLiteStore) DeleteReferenceToken(token string) error {
+	if _, err := s.db.Exec(`DELETE FROM mockidp_reference_tokens WHERE token = ?`, token); err != nil {
+		return fmt.Errorf("failed to delete reference token: %w", err)
+	}
+	return nil
+}
+
+// DeleteClientReferenceTokens removes every opaque access token issued to a client
+func (s *SQLiteStore) DeleteClientReferenceTokens(clientID string) error {
+	if _, err := s.db.Exec(`DELETE FROM mockidp_reference_tokens WHERE client_id = ?`, clientID); err != nil {
+		return fmt.Errorf("failed to delete reference tokens: %w", err)
+	}
+	return nil
+}
+
+// ================== Revoked Access Tokens ==================
+
+// RevokeAccessToken records a revoked access token's jti until expiresAt
+func (s *SQLiteStore) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO mockidp_revoked_access_tokens (jti, expires_at) VALUES (?, ?)`,
+		jti, expiresAt.Unix()); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether an access token's jti was revoked
+func (s *SQLiteStore) IsAccessTokenRevoked(jti string) (bool, error) {
+	var revoked int
+	err := s.db.QueryRow(`SELECT 1 FROM mockidp_revoked_access_tokens WHERE jti = ?`, jti).Scan(&revoked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check access token revocation: %w", err)
+	}
+	return true, nil
+}
+
+// ================== Keys ==================
+
+// GetKeySet returns the stored key set
+func (s *SQLiteStore) GetKeySet() ([]byte, error) {
+	var data string
+	if err := s.db.QueryRow(`SELECT data FROM mockidp_keys WHERE id = 1`).Scan(&data); err != nil {
+		return nil, notFoundOr(err, "key set")
+	}
+	return []byte(data), nil
+}
+
+// AddKeySet stores a key set unless one is stored already
+func (s *SQLiteStore) AddKeySet(data []byte) error {
+	if _, err := s.db.Exec(`INSERT OR IGNORE INTO mockidp_keys (id, data) VALUES (1, ?)`, string(data)); err != nil {
+		return fmt.Errorf("failed to store key set: %w", err)
+	}
+	return nil
+}
+
+// GetPairwiseSalt returns the stored pairwise salt
+func (s *SQLiteStore) GetPairwiseSalt() (string, error) {
+	var salt string
+	if err := s.db.QueryRow(`SELECT salt FROM mockidp_pairwise_salt WHERE id = 1`).Scan(&salt); err != nil {
+		return "", notFoundOr(err, "pairwise salt")
+	}
+	return salt, nil
+}
+
+// AddPairwiseSalt stores a pairwise salt unless one is stored already
+func (s *SQLiteStore) AddPairwiseSalt(salt string) error {
+	if _, err := s.db.Exec(`INSERT OR IGNORE INTO mockidp_pairwise_salt (id, salt) VALUES (1, ?)`, salt); err != nil {
+		return fmt.Errorf("failed to store pairwise salt: %w", err)
+	}
+	return nil
+}
+
+// ================== Expiry ==================
+
+// DeleteExpired removes expired authorization codes, sessions, refresh tokens, reference
+// tokens and revocations
+func (s *SQLiteStore) DeleteExpired(now time.Time) (int, error) {
+	removed := 0
+	for _, table := range []string{"mockidp_authorization_codes", "mockidp_sessions", "mockidp_refresh_tokens",
+		"mockidp_reference_tokens", "mockidp_revoked_access_tokens"} {
+		result, err := s.db.Exec(`DELETE FROM `+table+` WHERE expires_at < ?`, now.Unix())
+		if err != nil {
+			return removed, fmt.Errorf("failed to sweep %s: %w", table, err)
+		}
+		if rows, err := result.RowsAffected(); err == nil {
+			removed += int(rows)
+		}
+	}
+	return removed, nil
+}
+
+// ================== Helpers ==================
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// getRecord runs a query returning one data column and decodes it into dest
+func (s *SQLiteStore) getRecord(dest interface{}, kind, query string, args ...interface{}) error {
+	var data string
+	if err := s.db.QueryRow(query, args...).Scan(&data); err != nil {
+		return notFoundOr(err, kind)
+	}
+	if err := json.Unmarshal([]byte(data), dest); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", kind, err)
+	}
+	return nil
+}
+
+// putRecord encodes record and runs an upsert whose last parameter is the data column
+func (s *SQLiteStore) putRecord(record interface{}, kind, query string, args ...interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", kind, err)
+	}
+	if _, err := s.db.Exec(query, append(args, string(data))...); err != nil {
+		return fmt.Errorf("failed to store %s: %w", kind, err)
+	}
+	return nil
+}
+
+// deleteOne runs a delete and reports ErrNotFound when no row matched
+func (s *SQLiteStore) deleteOne(query string, args ...interface{}) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// notFoundOr maps sql.ErrNoRows to ErrNotFound and wraps other errors
+func notFoundOr(err error, kind string) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return fmt.Errorf("failed to get %s: %w", kind, err)
+}
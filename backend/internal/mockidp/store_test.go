@@ -0,0 +1,191 @@
+package mockidp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// openSQLiteStore opens the SQLite store in dir and closes it when the test ends
+func openSQLiteStore(t *testing.T, dir string) *SQLiteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(dir)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testStores returns a memory store and a SQLite store in a temporary directory
+func testStores(t *testing.T) map[string]Store {
+	return map[string]Store{
+		StoreMemory: NewMemoryStore(),
+		StoreSQLite: openSQLiteStore(t, t.TempDir()),
+	}
+}
+
+func TestMarkRefreshTokenRotatedOnce(t *testing.T) {
+	for kind, store := range testStores(t) {
+		rt := &models.RefreshToken{Token: "rt-1", ClientID: "demo-app", FamilyID: "f", ExpiresAt: time.Now().Add(time.Hour)}
+		if err := store.PutRefreshToken(rt); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		rotated := 0
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.MarkRefreshTokenRotated("rt-1", time.Now()); err == nil {
+					mu.Lock()
+					rotated++
+					mu.Unlock()
+				} else if !errors.Is(err, ErrNotFound) {
+					t.Errorf("%s: %v", kind, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if rotated != 1 {
+			t.Errorf("%s: token rotated %d times", kind, rotated)
+		}
+
+		stored, err := store.GetRefreshToken("rt-1")
+		if err != nil || stored.RotatedAt.IsZero() {
+			t.Errorf("%s: stored token not marked rotated: %v", kind, err)
+		}
+
+		revoked := &models.RefreshToken{Token: "rt-2", FamilyID: "f", RevokedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+		if err := store.PutRefreshToken(revoked); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.MarkRefreshTokenRotated("rt-2", time.Now()); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: revoked token rotated: %v", kind, err)
+		}
+		if _, err := store.MarkRefreshTokenRotated("missing", time.Now()); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: missing token rotated: %v", kind, err)
+		}
+	}
+}
+
+func TestSQLiteStoreKeepsTokenStateAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	first := openSQLiteStore(t, dir)
+	expiry := time.Now().Add(time.Hour)
+	if err := first.RevokeAccessToken("jti-1", expiry); err != nil {
+		t.Fatal(err)
+	}
+	ref := &models.ReferenceToken{Token: "opaque", ClientID: "demo-app", Claims: map[string]interface{}{"sub": "alice"}, ExpiresAt: expiry}
+	if err := first.PutReferenceToken(ref); err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+
+	second := openSQLiteStore(t, dir)
+	if revoked, err := second.IsAccessTokenRevoked("jti-1"); err != nil || !revoked {
+		t.Errorf("revocation lost: %v, %v", revoked, err)
+	}
+	if got, err := second.GetReferenceToken("opaque"); err != nil || got.Claims["sub"] != "alice" {
+		t.Errorf("reference token lost: %v, %v", got, err)
+	}
+
+	if _, err := second.DeleteExpired(expiry.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := second.IsAccessTokenRevoked("jti-1"); revoked {
+		t.Error("expired revocation kept")
+	}
+	if _, err := second.GetReferenceToken("opaque"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired reference token kept: %v", err)
+	}
+}
+
+func TestLoadKeySetPersistsKeys(t *testing.T) {
+	dir := t.TempDir()
+	first, err := LoadKeySet(openSQLiteStore(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadKeySet(openSQLiteStore(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.RSAKeyID() != second.RSAKeyID() || !first.RSAPrivateKey().Equal(second.RSAPrivateKey()) {
+		t.Error("signing key changed across restarts")
+	}
+	if first.StatementKeyID() != second.StatementKeyID() || !first.StatementPrivateKey().Equal(second.StatementPrivateKey()) {
+		t.Error("software statement key changed across restarts")
+	}
+
+	token, err := crypto.NewJWTService(first, "http://localhost:8080").CreateAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "demo-app"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crypto.NewJWTService(second, "http://localhost:8080").ValidateAccessToken(token); err != nil {
+		t.Errorf("token signed before the restart rejected: %v", err)
+	}
+}
+
+func TestDemoDataIsOnlySeededWhenMissing(t *testing.T) {
+	store := NewMemoryStore()
+	keySet, err := LoadKeySet(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp, err := NewMockIdP(keySet, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := idp.GetClient("demo-app")
+	client.Disabled = true
+	if err := store.PutClient(client); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	idp, err = NewMockIdP(keySet, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client, _ := idp.LookupClient("demo-app"); !client.Disabled {
+		t.Error("disabled demo client re-enabled on restart")
+	}
+	if _, exists := idp.GetUser("bob"); !exists {
+		t.Error("missing demo user not seeded")
+	}
+}
+
+func TestPairwiseSubjectsSurviveRestarts(t *testing.T) {
+	dir := t.TempDir()
+	start := func() *MockIdP {
+		store := openSQLiteStore(t, dir)
+		keySet, err := LoadKeySet(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idp, err := NewMockIdP(keySet, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idp
+	}
+
+	first := start().SubjectIdentifier("news-app", "alice")
+	second := start()
+	if got := second.SubjectIdentifier("news-app", "alice"); got != first {
+		t.Errorf("pairwise sub changed across restarts: %q, then %q", first, got)
+	}
+	if got := second.ResolveSubject("news-app", first); got != "alice" {
+		t.Errorf("sub issued before the restart resolved to %q", got)
+	}
+}
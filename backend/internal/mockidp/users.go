@@ -6,8 +6,13 @@ import (
 	"time"
 )
 
-// UserClaims returns OIDC claims for a user
-func (idp *MockIdP) UserClaims(userID string, scopes []string) map[string]interface{} {
+// IdentityScopes lists the scopes UserClaims releases claims for
+var IdentityScopes = []string{"openid", "profile", "email", "roles", "groups"}
+
+// UserClaims returns OIDC claims for a user: those of the scopes, plus the claims requested
+// individually with the claims request parameter (OIDC Core Section 5.5). A requested claim
+// constrained to a value or values is only released when the user's value matches.
+func (idp *MockIdP) UserClaims(userID string, scopes []string, requested map[string]*ClaimRequest) map[string]interface{} {
 	user, exists := idp.GetUser(userID)
 	if !exists {
 		return nil
@@ -30,6 +35,10 @@ func (idp *MockIdP) UserClaims(userID string, scopes []string) map[string]interf
 			claims["email_verified"] = true // Demo assumes verified
 		case "roles":
 			claims["roles"] = user.Roles
+		case "groups":
+			if len(user.Groups) > 0 {
+				claims["groups"] = user.Groups
+			}
 		}
 	}
 
@@ -38,12 +47,40 @@ func (idp *MockIdP) UserClaims(userID string, scopes []string) map[string]interf
 		claims[k] = v
 	}
 
+	// Individually requested claims; sub is always the authenticated user
+	for name, request := range requested {
+		value, ok := userClaim(user, name)
+		if !ok || name == "sub" {
+			continue
+		}
+		if !request.Matches(value) {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	return claims
+}
+
+// IDTokenClaims returns the claims of an ID token issued to a client, whose sub is the
+// subject identifier the client is given for the user. A pairwise client gets no
+// preferred_username, which is the user ID or another identifier shared by every sector.
+func (idp *MockIdP) IDTokenClaims(clientID, userID string, scopes []string, requested map[string]*ClaimRequest) map[string]interface{} {
+	claims := idp.UserClaims(userID, scopes, requested)
+	if claims != nil {
+		claims["sub"] = idp.SubjectIdentifier(clientID, userID)
+		if claims["sub"] != userID {
+			delete(claims, "preferred_username")
+		}
+	}
 	return claims
 }
 
-// CreateUserInfoResponse creates a UserInfo response for OIDC
-func (idp *MockIdP) CreateUserInfoResponse(userID string, scopes []string) map[string]interface{} {
-	return idp.UserClaims(userID, scopes)
+// CreateUserInfoResponse creates a UserInfo response for OIDC. Its sub matches the sub of the
+// ID tokens issued to the client (OIDC Core Section 5.3.2).
+func (idp *MockIdP) CreateUserInfoResponse(clientID, userID string, scopes []string, requested map[string]*ClaimRequest) map[string]interface{} {
+	return idp.IDTokenClaims(clientID, userID, scopes, requested)
 }
 
 // GetUserRoles returns the roles for a user
@@ -68,6 +105,9 @@ func (idp *MockIdP) HasRole(userID string, role string) bool {
 
 // PKCE utilities
 
+// CodeChallengeMethods lists the PKCE methods validatePKCE verifies (RFC 7636 Section 4.2)
+var CodeChallengeMethods = []string{"S256", "plain"}
+
 // validatePKCE validates the code verifier against the code challenge
 func validatePKCE(verifier, challenge, method string) bool {
 	if verifier == "" {
@@ -184,6 +224,31 @@ func (idp *MockIdP) GetDemoClientPresets() []DemoClientPreset {
 			GrantTypes:  []string{"authorization_code", "refresh_token"},
 			Scopes:      []string{"openid", "profile", "email"},
 		},
+		{
+			ID:          "par-app",
+			Name:        "High-Security Application (PAR Required)",
+			Description: "A confidential client that must push authorization requests to the PAR endpoint",
+			Type:        "confidential",
+			GrantTypes:  []string{"authorization_code", "refresh_token"},
+			Scopes:      []string{"openid", "profile", "email"},
+			Secret:      "par-secret",
+		},
+		{
+			ID:          "native-app",
+			Name:        "Native Application (CLI / Desktop)",
+			Description: "A public native app that receives the authorization response on a loopback port, a private-use scheme or a claimed https URI, and must use PKCE",
+			Type:        "public",
+			GrantTypes:  []string{"authorization_code", "refresh_token"},
+			Scopes:      []string{"openid", "profile", "email"},
+		},
+		{
+			ID:          "device-client",
+			Name:        "Smart TV / CLI (Device)",
+			Description: "An input-constrained public client using the device authorization grant",
+			Type:        "public",
+			GrantTypes:  []string{"urn:ietf:params:oauth:grant-type:device_code", "refresh_token"},
+			Scopes:      []string{"openid", "profile", "email"},
+		},
 		{
 			ID:          "machine-client",
 			Name:        "Machine-to-Machine Client",
@@ -193,6 +258,94 @@ func (idp *MockIdP) GetDemoClientPresets() []DemoClientPreset {
 			Scopes:      []string{"api:read", "api:write"},
 			Secret:      "machine-secret",
 		},
+		{
+			ID:          "exchange-client",
+			Name:        "Token Exchange Service",
+			Description: "A middle-tier service exchanging user tokens for downstream tokens",
+			Type:        "confidential",
+			GrantTypes:  []string{"urn:ietf:params:oauth:grant-type:token-exchange"},
+			Scopes:      []string{"openid", "profile", "email", "api:read", "api:write"},
+			Secret:      "exchange-secret",
+		},
+		{
+			ID:          "jwt-client",
+			Name:        "JWT-Authenticated Service",
+			Description: "A service that authenticates with an HMAC-signed client assertion (client_secret_jwt) instead of sending its secret",
+			Type:        "machine",
+			GrantTypes:  []string{"client_credentials"},
+			Scopes:      []string{"api:read", "api:write"},
+			Secret:      "jwt-client-secret-at-least-32-bytes",
+		},
+		{
+			ID:          "opaque-client",
+			Name:        "Reference Token Service",
+			Description: "A service that receives opaque access tokens which resource servers must resolve via introspection",
+			Type:        "machine",
+			GrantTypes:  []string{"client_credentials"},
+			Scopes:      []string{"api:read", "api:write"},
+			Secret:      "opaque-secret",
+		},
+		{
+			ID:          "payments-app",
+			Name:        "Payments Application (RAR)",
+			Description: "A confidential client that requests payment_initiation and account_information authorization details instead of broad scopes",
+			Type:        "confidential",
+			GrantTypes:  []string{"authorization_code", "refresh_token", "client_credentials"},
+			Scopes:      []string{"openid", "profile", "email"},
+			Secret:      "payments-secret",
+		},
+		{
+			ID:          "jar-app",
+			Name:        "Signed Request Application (JAR/JARM)",
+			Description: "A confidential client that sends every authorization request as a signed request object and can receive JWT-secured responses",
+			Type:        "confidential",
+			GrantTypes:  []string{"authorization_code", "refresh_token"},
+			Scopes:      []string{"openid", "profile", "email"},
+			Secret:      "jar-app-secret-at-least-32-bytes",
+		},
+		{
+			ID:          "ciba-poll-app",
+			Name:        "Call Center Agent (CIBA Poll)",
+			Description: "A confidential client that starts a backchannel authentication and polls the token endpoint until the user answers on their device",
+			Type:        "confidential",
+			GrantTypes:  []string{GrantTypeCIBA, "refresh_token"},
+			Scopes:      []string{"openid", "profile", "email"},
+			Secret:      "ciba-poll-secret",
+		},
+		{
+			ID:          "ciba-ping-app",
+			Name:        "Point of Sale Terminal (CIBA Ping)",
+			Description: "A confidential client that is pinged at its notification endpoint when the user answers, then fetches tokens once",
+			Type:        "confidential",
+			GrantTypes:  []string{GrantTypeCIBA, "refresh_token"},
+			Scopes:      []string{"openid", "profile", "email"},
+			Secret:      "ciba-ping-secret",
+		},
+		{
+			ID:          "ciba-push-app",
+			Name:        "Banking Back Office (CIBA Push)",
+			Description: "A confidential client whose tokens are pushed directly to its notification endpoint",
+			Type:        "confidential",
+			GrantTypes:  []string{GrantTypeCIBA, "refresh_token"},
+			Scopes:      []string{"openid", "profile", "email"},
+			Secret:      "ciba-push-secret",
+		},
+		{
+			ID:          "mtls-client",
+			Name:        "Certificate-Authenticated Service (mTLS)",
+			Description: "A service that authenticates with a client certificate (tls_client_auth) and receives certificate-bound access tokens",
+			Type:        "machine",
+			GrantTypes:  []string{"client_credentials"},
+			Scopes:      []string{"api:read", "api:write"},
+		},
+		{
+			ID:          "spiffe-client",
+			Name:        "SPIFFE Workload (X509-SVID)",
+			Description: "A workload whose X509-SVID is its OAuth client credential, matched on the SPIFFE ID URI SAN",
+			Type:        "machine",
+			GrantTypes:  []string{"client_credentials"},
+			Scopes:      []string{"api:read", "api:write"},
+		},
 	}
 }
 
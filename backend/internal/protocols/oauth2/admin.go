@@ -0,0 +1,353 @@
+package oauth2
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// adminTokenEnv names the environment variable holding the admin API bearer token. The admin
+// API is disabled when it is unset, since the demo users' passwords are public.
+const adminTokenEnv = "SHOWCASE_ADMIN_TOKEN"
+
+// adminUserRequest is the body of user create and update requests; omitted fields are left unchanged
+type adminUserRequest struct {
+	ID       string             `json:"id"`
+	Email    *string            `json:"email"`
+	Name     *string            `json:"name"`
+	Password *string            `json:"password"`
+	Roles    *[]string          `json:"roles"`
+	Groups   *[]string          `json:"groups"`
+	Claims   *map[string]string `json:"claims"`
+}
+
+// adminClientRequest is the body of client create and update requests; omitted fields are left unchanged
+type adminClientRequest struct {
+	ID                      string    `json:"client_id"`
+	Name                    *string   `json:"name"`
+	RedirectURIs            *[]string `json:"redirect_uris"`
+	GrantTypes              *[]string `json:"grant_types"`
+	Scopes                  *[]string `json:"scopes"`
+	Public                  *bool     `json:"public"`
+	ApplicationType         *string   `json:"application_type"`
+	TokenEndpointAuthMethod *string   `json:"token_endpoint_auth_method"`
+	Disabled                *bool     `json:"disabled"`
+}
+
+// adminClientResponse is a client as returned by the admin API. The secret is only included
+// when it was just generated, on create and rotation.
+type adminClientResponse struct {
+	*models.Client
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// adminUserResponse is a user as returned by the admin API, with their lockout status
+type adminUserResponse struct {
+	*models.User
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+// adminRoutes mounts the admin API for managing the mock IdP's users and clients
+func (p *Plugin) adminRoutes(router chi.Router) {
+	router.Use(p.requireAdmin)
+
+	router.Get("/users", p.handleAdminListUsers)
+	router.Post("/users", p.handleAdminCreateUser)
+	router.Get("/users/{id}", p.handleAdminGetUser)
+	router.Patch("/users/{id}", p.handleAdminUpdateUser)
+	router.Delete("/users/{id}", p.handleAdminDeleteUser)
+	router.Post("/users/{id}/unlock", p.handleAdminUnlockUser)
+
+	router.Get("/roles", p.handleAdminListRoles)
+
+	router.Get("/clients", p.handleAdminListClients)
+	router.Post("/clients", p.handleAdminCreateClient)
+	router.Get("/clients/{id}", p.handleAdminGetClient)
+	router.Patch("/clients/{id}", p.handleAdminUpdateClient)
+	router.Delete("/clients/{id}", p.handleAdminDeleteClient)
+	router.Post("/clients/{id}/secret", p.handleAdminRotateClientSecret)
+}
+
+// requireAdmin accepts only requests bearing the configured admin token
+func (p *Plugin) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.adminToken == "" {
+			writeAdminError(w, http.StatusServiceUnavailable, "admin_api_disabled", "Set "+adminTokenEnv+" to enable the admin API")
+			return
+		}
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "bearer") || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeAdminError(w, http.StatusUnauthorized, "invalid_token", "Admin bearer token required")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(p.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin", error="invalid_token"`)
+			writeAdminError(w, http.StatusUnauthorized, "invalid_token", "Invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Plugin) handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	users := p.mockIdP.ListUsers()
+	views := make([]adminUserResponse, 0, len(users))
+	for _, user := range users {
+		views = append(views, p.adminUserView(user))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"users": views,
+	})
+}
+
+func (p *Plugin) handleAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	user, exists := p.mockIdP.GetUser(chi.URLParam(r, "id"))
+	if !exists {
+		writeAdminResult(w, mockidp.ErrNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.adminUserView(user))
+}
+
+func (p *Plugin) handleAdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req adminUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request", "Request body must be a JSON user")
+		return
+	}
+	user := &models.User{ID: req.ID}
+	req.apply(user)
+
+	if err := p.mockIdP.CreateUser(user); err != nil {
+		writeAdminResult(w, err)
+		return
+	}
+	log.Printf("Admin API: created user %s", user.ID)
+	writeJSON(w, http.StatusCreated, p.adminUserView(user))
+}
+
+func (p *Plugin) handleAdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	existing, exists := p.mockIdP.GetUser(chi.URLParam(r, "id"))
+	if !exists {
+		writeAdminResult(w, mockidp.ErrNotFound)
+		return
+	}
+	var req adminUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request", "Request body must be a JSON user")
+		return
+	}
+	user := *existing
+	user.Password = ""
+	req.apply(&user)
+
+	if err := p.mockIdP.UpdateUser(&user); err != nil {
+		writeAdminResult(w, err)
+		return
+	}
+	log.Printf("Admin API: updated user %s", user.ID)
+	writeJSON(w, http.StatusOK, p.adminUserView(&user))
+}
+
+func (p *Plugin) handleAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, exists := p.mockIdP.GetUser(id); !exists {
+		writeAdminResult(w, mockidp.ErrNotFound)
+		return
+	}
+	if err := p.mockIdP.DeleteUser(id); err != nil {
+		writeAdminResult(w, err)
+		return
+	}
+	log.Printf("Admin API: deleted user %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Plugin) handleAdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, exists := p.mockIdP.GetUser(chi.URLParam(r, "id"))
+	if !exists {
+		writeAdminResult(w, mockidp.ErrNotFound)
+		return
+	}
+	p.mockIdP.UnlockUser(user.ID)
+	log.Printf("Admin API: unlocked user %s", user.ID)
+	writeJSON(w, http.StatusOK, p.adminUserView(user))
+}
+
+func (p *Plugin) handleAdminListRoles(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"roles": p.mockIdP.ListRoles(),
+	})
+}
+
+func (p *Plugin) handleAdminListClients(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"clients": p.mockIdP.ListClients(),
+	})
+}
+
+func (p *Plugin) handleAdminGetClient(w http.ResponseWriter, r *http.Request) {
+	client, exists := p.mockIdP.LookupClient(chi.URLParam(r, "id"))
+	if !exists {
+		writeAdminResult(w, mockidp.ErrNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, adminClientResponse{Client: client})
+}
+
+func (p *Plugin) handleAdminCreateClient(w http.ResponseWriter, r *http.Request) {
+	var req adminClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request", "Request body must be a JSON client")
+		return
+	}
+	client := &models.Client{ID: req.ID}
+	req.apply(client)
+
+	if err := p.mockIdP.CreateClient(client); err != nil {
+		writeAdminResult(w, err)
+		return
+	}
+	log.Printf("Admin API: created client %s", client.ID)
+	writeJSON(w, http.StatusCreated, adminClientResponse{Client: client, ClientSecret: client.Secret})
+}
+
+func (p *Plugin) handleAdminUpdateClient(w http.ResponseWriter, r *http.Request) {
+	existing, exists := p.mockIdP.LookupClient(chi.URLParam(r, "id"))
+	if !exists {
+		writeAdminResult(w, mockidp.ErrNotFound)
+		return
+	}
+	var req adminClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid_request", "Request body must be a JSON client")
+		return
+	}
+	client := *existing
+	req.apply(&client)
+
+	if err := p.mockIdP.UpdateClient(&client); err != nil {
+		writeAdminResult(w, err)
+		return
+	}
+	log.Printf("Admin API: updated client %s (disabled=%t)", client.ID, client.Disabled)
+
+	// A client made confidential is issued its first secret
+	response := adminClientResponse{Client: &client}
+	if existing.Secret == "" && client.Secret != "" {
+		response.ClientSecret = client.Secret
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (p *Plugin) handleAdminDeleteClient(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := p.mockIdP.DeleteClient(id); err != nil {
+		writeAdminResult(w, err)
+		return
+	}
+	log.Printf("Admin API: deleted client %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *Plugin) handleAdminRotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	secret, err := p.mockIdP.RotateClientSecret(id)
+	if err != nil {
+		writeAdminResult(w, err)
+		return
+	}
+	log.Printf("Admin API: rotated secret of client %s", id)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"client_id":     id,
+		"client_secret": secret,
+	})
+}
+
+// adminUserView adds the lockout status to a user
+func (p *Plugin) adminUserView(user *models.User) adminUserResponse {
+	view := adminUserResponse{User: user}
+	if lockedUntil := p.mockIdP.LockedUntil(user.ID); !lockedUntil.IsZero() {
+		view.LockedUntil = &lockedUntil
+	}
+	return view
+}
+
+// apply copies the fields present in the request onto user
+func (req *adminUserRequest) apply(user *models.User) {
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.Password != nil {
+		user.Password = *req.Password
+	}
+	if req.Roles != nil {
+		user.Roles = *req.Roles
+	}
+	if req.Groups != nil {
+		user.Groups = *req.Groups
+	}
+	if req.Claims != nil {
+		user.Claims = *req.Claims
+	}
+}
+
+// apply copies the fields present in the request onto client
+func (req *adminClientRequest) apply(client *models.Client) {
+	if req.Name != nil {
+		client.Name = *req.Name
+	}
+	if req.RedirectURIs != nil {
+		client.RedirectURIs = *req.RedirectURIs
+	}
+	if req.GrantTypes != nil {
+		client.GrantTypes = *req.GrantTypes
+	}
+	if req.Scopes != nil {
+		client.Scopes = *req.Scopes
+	}
+	if req.Public != nil {
+		client.Public = *req.Public
+	}
+	if req.ApplicationType != nil {
+		client.ApplicationType = *req.ApplicationType
+	}
+	if req.TokenEndpointAuthMethod != nil {
+		client.TokenEndpointAuthMethod = *req.TokenEndpointAuthMethod
+	}
+	if req.Disabled != nil {
+		client.Disabled = *req.Disabled
+	}
+}
+
+// writeAdminResult maps an error from the mock IdP to an admin API error response
+func writeAdminResult(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, mockidp.ErrNotFound):
+		writeAdminError(w, http.StatusNotFound, "not_found", "No such user or client")
+	case errors.Is(err, mockidp.ErrAlreadyExists):
+		writeAdminError(w, http.StatusConflict, "already_exists", err.Error())
+	default:
+		writeAdminError(w, http.StatusBadRequest, "invalid_request", err.Error())
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,62 @@
+package oauth2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+// adminRequest calls the admin API with the admin token
+func adminRequest(p *Plugin, method, path, body string) *httptest.ResponseRecorder {
+	router := chi.NewRouter()
+	router.Route("/admin", p.adminRoutes)
+	r := httptest.NewRequest(method, "/admin"+path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer admin-secret")
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminDisablesClientWithCertificateAuth(t *testing.T) {
+	p := newTestPlugin(t)
+	p.adminToken = "admin-secret"
+
+	w := adminRequest(p, http.MethodPatch, "/clients/mtls-client", `{"disabled":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if client, _ := p.mockIdP.LookupClient("mtls-client"); !client.Disabled || client.TokenEndpointAuthMethod != "tls_client_auth" {
+		t.Errorf("client = %+v", client)
+	}
+
+	w = adminRequest(p, http.MethodPatch, "/clients/demo-app", `{"token_endpoint_auth_method":"tls_client_auth"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("switch to tls_client_auth: status = %d, want 400", w.Code)
+	}
+}
+
+func TestIntrospectionReportsTokensOfDisabledClientsInactive(t *testing.T) {
+	p := newTestPlugin(t)
+	p.adminToken = "admin-secret"
+	token, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "demo-app", Scope: "openid"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := decodeJSON(t, introspect(p, token))["active"]; active != true {
+		t.Fatalf("active = %v before the client is disabled", active)
+	}
+
+	if w := adminRequest(p, http.MethodPatch, "/clients/demo-app", `{"disabled":true}`); w.Code != http.StatusOK {
+		t.Fatalf("disable: status = %d: %s", w.Code, w.Body.String())
+	}
+	if active := decodeJSON(t, introspect(p, token))["active"]; active != false {
+		t.Errorf("active = %v for a token of a disabled client", active)
+	}
+}
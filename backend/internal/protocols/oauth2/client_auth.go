@@ -0,0 +1,116 @@
+package oauth2
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// RequestClientID returns the client_id of a back-channel request, taken from the form,
+// the HTTP Basic username or the sub claim of a client assertion
+func RequestClientID(r *http.Request) string {
+	if clientID := r.FormValue("client_id"); clientID != "" {
+		return clientID
+	}
+	if clientID, _, ok := r.BasicAuth(); ok {
+		return clientID
+	}
+	if assertion := r.FormValue("client_assertion"); assertion != "" {
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err == nil {
+			sub, _ := claims.GetSubject()
+			return sub
+		}
+	}
+	return ""
+}
+
+// AuthenticateClient authenticates the client of a back-channel request using
+// client_secret_basic, client_secret_post, client_secret_jwt, private_key_jwt or,
+// for clients registered for it, mutual TLS. Public clients are returned without a
+// credential check.
+func (p *Plugin) AuthenticateClient(r *http.Request, sessionID string) (*models.Client, error) {
+	if client, exists := p.mockIdP.GetClient(RequestClientID(r)); exists && mockidp.IsMTLSAuthMethod(client.TokenEndpointAuthMethod) {
+		return p.authenticateTLSClient(r, sessionID, client.ID)
+	}
+
+	assertionType := r.FormValue("client_assertion_type")
+	assertion := r.FormValue("client_assertion")
+	if assertionType == "" && assertion == "" {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok {
+			clientID = r.FormValue("client_id")
+			clientSecret = r.FormValue("client_secret")
+		} else if formClientID := r.FormValue("client_id"); formClientID != "" && formClientID != clientID {
+			return nil, errors.New("client_id does not match the authenticated client")
+		}
+		return p.mockIdP.ValidateClient(clientID, clientSecret)
+	}
+
+	if assertionType != mockidp.ClientAssertionType {
+		return nil, errors.New("unsupported client_assertion_type")
+	}
+	if _, _, ok := r.BasicAuth(); ok || r.FormValue("client_secret") != "" {
+		return nil, errors.New("only one client authentication method may be used")
+	}
+
+	client, verified, err := p.mockIdP.ValidateClientAssertion(assertion, p.clientAssertionAudiences(r))
+	if err == nil {
+		if clientID := r.FormValue("client_id"); clientID != "" && clientID != client.ID {
+			err = errors.New("client_id does not match the client assertion subject")
+		}
+	}
+
+	data := map[string]interface{}{
+		"client_assertion_type": assertionType,
+	}
+	if decoded, decodeErr := lookingglass.NewDecoder().DecodeJWT(assertion); decodeErr == nil {
+		data["client_assertion"] = decoded
+	}
+
+	if err != nil {
+		data["error"] = err.Error()
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Assertion Rejected", data, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Invalid Client Assertion",
+			Description: "The assertion must be signed with the client's registered secret or key, name this server in aud, carry the client_id in iss and sub, be unexpired, and use a fresh jti",
+			Severity:    "warning",
+			Reference:   "RFC 7523 Section 3",
+		})
+		return nil, err
+	}
+
+	data["client_id"] = client.ID
+	data["auth_method"] = verified.Method
+	data["alg"] = verified.Algorithm
+	data["jti"] = verified.JTI
+
+	description := "The client signed a short-lived JWT with its shared secret. The secret itself never crosses the wire, and a captured assertion cannot be replayed."
+	if verified.Method == mockidp.AuthMethodPrivateKeyJWT {
+		description = "The client signed a short-lived JWT with its private key, verified against its registered public keys. The server holds no secret that could leak, and a captured assertion cannot be replayed."
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeCryptoOperation, "Client Assertion Verified", data, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "JWT Client Authentication (" + verified.Method + ")",
+		Description: description,
+		Reference:   "RFC 7523 Section 2.2",
+	})
+
+	return client, nil
+}
+
+// clientAssertionAudiences returns the aud values that identify this server: the issuer,
+// the token endpoints and the endpoint receiving the request
+func (p *Plugin) clientAssertionAudiences(r *http.Request) []string {
+	issuer := p.mockIdP.GetIssuer()
+	audiences := []string{issuer, p.baseURL + r.URL.Path, issuer + r.URL.Path}
+	for _, path := range []string{"/oauth2/token", "/oidc/token"} {
+		audiences = append(audiences, p.baseURL+path, issuer+path)
+	}
+	return audiences
+}
@@ -0,0 +1,60 @@
+package oauth2
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+)
+
+// WithCredentialFields adds the inputs of each additional authentication factor to a login page
+func WithCredentialFields(page string, verifiers []mockidp.CredentialVerifier) string {
+	fields := ""
+	for _, verifier := range verifiers {
+		fields += verifier.FormFields() + `
+
+            `
+	}
+	return strings.Replace(page, `<button type="submit">`, fields+`<button type="submit">`, 1)
+}
+
+// LoginErrorMessage is the message a login page shows when ValidateCredentials fails. Unknown
+// users and wrong passwords get the same message so logins cannot be enumerated.
+func LoginErrorMessage(err error) string {
+	if errors.Is(err, mockidp.ErrAccountLocked) {
+		return "Too many failed logins. This account is locked for a few minutes."
+	}
+	return "Invalid email or password"
+}
+
+// CredentialErrorMessage is the message a login page shows when an additional factor fails
+func CredentialErrorMessage(err error) string {
+	message := err.Error()
+	if message == "" {
+		return "Authentication failed"
+	}
+	return strings.ToUpper(message[:1]) + message[1:]
+}
+
+// EmitLoginFailure records a failed password check, explaining lockouts
+func (p *Plugin) EmitLoginFailure(sessionID, email string, err error) {
+	if errors.Is(err, mockidp.ErrAccountLocked) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Account Locked", map[string]interface{}{
+			"email":        email,
+			"max_failures": mockidp.DefaultLockoutPolicy.MaxFailures,
+			"lockout":      mockidp.DefaultLockoutPolicy.Duration.String(),
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Account Lockout",
+			Description: "After repeated failures within a short window the account refuses logins for a while, even with the right password, which limits online password guessing",
+			Severity:    "warning",
+			Reference:   "NIST SP 800-63B Section 5.2.2",
+		})
+		return
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Authentication Failed", map[string]interface{}{
+		"email":  email,
+		"reason": "Invalid credentials",
+	})
+}
@@ -0,0 +1,484 @@
+package oauth2
+
+import (
+	"errors"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// GrantTypeDeviceCode is the device authorization grant type (RFC 8628 Section 3.4)
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// RemoteHost returns the address a request came from, without its port. The server's RealIP
+// middleware has already replaced RemoteAddr with the client address reported by a proxy.
+func RemoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// Device authorization endpoint (RFC 8628 Section 3.1)
+func (p *Plugin) handleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuth2Error(w, "invalid_request", "Invalid form data", "")
+		return
+	}
+
+	clientID := RequestClientID(r)
+	scope := r.FormValue("scope")
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Device Authorization Request", map[string]interface{}{
+		"step":            1,
+		"from":            "Device",
+		"to":              "Authorization Server",
+		"client_id":       clientID,
+		"requested_scope": scope,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Device Authorization Request",
+		Description: "An input-constrained device asks the authorization server for a device code and a short user code the user can enter on a second device",
+		Reference:   "RFC 8628 Section 3.1",
+	})
+
+	client, exists := p.mockIdP.GetClient(clientID)
+	if !exists {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Unknown Client", map[string]interface{}{
+			"client_id": clientID,
+		})
+		writeOAuth2Error(w, "invalid_client", "Unknown client", "")
+		return
+	}
+
+	if !client.Public {
+		if _, err := p.AuthenticateClient(r, sessionID); err != nil {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
+				"client_id": clientID,
+			})
+			writeOAuth2Error(w, "invalid_client", "Client authentication failed", "")
+			return
+		}
+	}
+
+	if !ClientHasGrantType(client, GrantTypeDeviceCode) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Unauthorized Grant Type", map[string]interface{}{
+			"client_id":  clientID,
+			"grant_type": GrantTypeDeviceCode,
+		})
+		writeOAuth2Error(w, "unauthorized_client", "Client not authorized for the device authorization grant", "")
+		return
+	}
+
+	auth := p.mockIdP.CreateDeviceAuthorization(clientID, scope)
+
+	verificationURI := p.baseURL + "/oauth2/device"
+	response := models.DeviceAuthorizationResponse{
+		DeviceCode:              auth.DeviceCode,
+		UserCode:                auth.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(auth.UserCode),
+		ExpiresIn:               int(time.Until(auth.ExpiresAt).Seconds()),
+		Interval:                auth.Interval,
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Device Code Issued", map[string]interface{}{
+		"step":                      2,
+		"from":                      "Authorization Server",
+		"to":                        "Device",
+		"user_code":                 auth.UserCode,
+		"verification_uri":          response.VerificationURI,
+		"verification_uri_complete": response.VerificationURIComplete,
+		"expires_in":                response.ExpiresIn,
+		"interval":                  response.Interval,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeSecurityHint,
+		Title:       "User Code Entropy",
+		Description: "User codes are short for usability, so the server must rate-limit verification attempts and expire codes quickly to resist brute force",
+		Reference:   "RFC 8628 Section 5.1",
+		Severity:    "info",
+	})
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Device verification page - GET (RFC 8628 Section 3.3)
+func (p *Plugin) handleDeviceVerification(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+	userCode := r.URL.Query().Get("user_code")
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "User Visits Verification URI", map[string]interface{}{
+		"step":              3,
+		"from":              "User",
+		"to":                "Authorization Server",
+		"user_code_present": userCode != "",
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "User Interaction",
+		Description: "The user opens the verification URI on a device with a browser, enters the user code, and authenticates",
+		Reference:   "RFC 8628 Section 3.3",
+	})
+
+	page := p.generateDeviceVerificationPage(userCode, sessionID)
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(page))
+}
+
+// Device verification page - POST (user code, credentials and decision)
+func (p *Plugin) handleDeviceVerificationSubmit(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuth2Error(w, "invalid_request", "Invalid form data", "")
+		return
+	}
+
+	userCode := r.FormValue("user_code")
+	email := r.FormValue("email")
+	password := r.FormValue("password")
+	action := r.FormValue("action")
+
+	renderError := func(message string) {
+		page := p.generateDeviceVerificationPage(userCode, sessionID)
+		page = strings.Replace(page, "<!-- ERROR -->", `<div class="error">`+html.EscapeString(message)+`</div>`, 1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}
+
+	auth, err := p.mockIdP.GetDeviceAuthorizationByUserCode(userCode, RemoteHost(r))
+	if errors.Is(err, mockidp.ErrTooManyUserCodeAttempts) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "User Code Attempts Limited", map[string]interface{}{
+			"reason": err.Error(),
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "User Code Brute Force Protection",
+			Description: "User codes are short enough to type, so they are also short enough to guess. After repeated invalid codes from one address, further attempts are refused for a while.",
+			Severity:    "warning",
+			Reference:   "RFC 8628 Section 5.1",
+		})
+		renderError("Too many invalid codes. Wait a few minutes and try again")
+		return
+	}
+	if err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid User Code", map[string]interface{}{
+			"reason": err.Error(),
+		})
+		renderError("That code is invalid or has expired")
+		return
+	}
+
+	user, err := p.mockIdP.ValidateCredentials(email, password)
+	if err != nil {
+		p.EmitLoginFailure(sessionID, email, err)
+		renderError(LoginErrorMessage(err))
+		return
+	}
+
+	if action == "deny" {
+		if _, err := p.mockIdP.DenyDeviceAuthorization(userCode); err != nil {
+			renderError("That code is invalid or has expired")
+			return
+		}
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Device Authorization Denied", map[string]interface{}{
+			"step":      4,
+			"from":      "User",
+			"to":        "Authorization Server",
+			"user_id":   user.ID,
+			"client_id": auth.ClientID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Access Denied",
+			Description: "The user declined the request. The device's next poll will receive access_denied and must stop polling.",
+			Reference:   "RFC 8628 Section 3.5",
+		})
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(GenerateDeviceResultPage("Request Denied", "The device will not be granted access. You can close this window.")))
+		return
+	}
+
+	if _, err := p.mockIdP.ApproveDeviceAuthorization(userCode, user.ID); err != nil {
+		renderError("That code is invalid or has expired")
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Device Authorization Approved", map[string]interface{}{
+		"step":      4,
+		"from":      "User",
+		"to":        "Authorization Server",
+		"user_id":   user.ID,
+		"client_id": auth.ClientID,
+		"scope":     auth.Scope,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "User Approved Device",
+		Description: "The device code is now bound to the user. The device's next poll of the token endpoint will receive tokens.",
+		Reference:   "RFC 8628 Section 3.3",
+	})
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(GenerateDeviceResultPage("Device Connected", "You have approved the request. Return to your device to continue.")))
+}
+
+// handleDeviceCodeGrant handles token endpoint polling with a device code (RFC 8628 Section 3.4)
+func (p *Plugin) handleDeviceCodeGrant(w http.ResponseWriter, r *http.Request, sessionID string) {
+	deviceCode := r.FormValue("device_code")
+	clientID := RequestClientID(r)
+
+	client, exists := p.mockIdP.GetClient(clientID)
+	if !exists {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Unknown Client", map[string]interface{}{
+			"client_id": clientID,
+		})
+		writeOAuth2Error(w, "invalid_client", "Unknown client", "")
+		return
+	}
+
+	if !client.Public {
+		if _, err := p.AuthenticateClient(r, sessionID); err != nil {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
+				"client_id": clientID,
+			})
+			writeOAuth2Error(w, "invalid_client", "Client authentication failed", "")
+			return
+		}
+	}
+
+	auth, err := p.mockIdP.PollDeviceAuthorization(deviceCode, clientID)
+	switch {
+	case errors.Is(err, mockidp.ErrAuthorizationPending):
+		p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Device Poll: Authorization Pending", map[string]interface{}{
+			"step":      5,
+			"from":      "Device",
+			"to":        "Authorization Server",
+			"result":    "authorization_pending",
+			"interval":  auth.Interval,
+			"client_id": clientID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Authorization Pending",
+			Description: "The user has not yet completed the verification step. The device keeps polling at the advertised interval.",
+			Reference:   "RFC 8628 Section 3.5",
+		})
+		writeOAuth2Error(w, "authorization_pending", "The user has not yet approved the request", "")
+		return
+	case errors.Is(err, mockidp.ErrSlowDown):
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Device Poll: Slow Down", map[string]interface{}{
+			"step":         5,
+			"from":         "Device",
+			"to":           "Authorization Server",
+			"result":       "slow_down",
+			"new_interval": auth.Interval,
+			"client_id":    clientID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Polling Too Fast",
+			Description: "The device polled faster than the interval allows. It must increase its polling interval by 5 seconds for this and all subsequent requests.",
+			Severity:    "warning",
+			Reference:   "RFC 8628 Section 3.5",
+		})
+		writeOAuth2Error(w, "slow_down", "Polling too frequently; increase interval by 5 seconds", "")
+		return
+	case errors.Is(err, mockidp.ErrAccessDenied):
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Device Poll: Access Denied", map[string]interface{}{
+			"step":      5,
+			"from":      "Device",
+			"to":        "Authorization Server",
+			"result":    "access_denied",
+			"client_id": clientID,
+		})
+		writeOAuth2Error(w, "access_denied", "The user denied the authorization request", "")
+		return
+	case errors.Is(err, mockidp.ErrExpiredToken):
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Device Poll: Expired Token", map[string]interface{}{
+			"step":      5,
+			"from":      "Device",
+			"to":        "Authorization Server",
+			"result":    "expired_token",
+			"client_id": clientID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Device Code Expired",
+			Description: "The device code expired before the user approved it. The device must start a new device authorization request.",
+			Reference:   "RFC 8628 Section 3.5",
+		})
+		writeOAuth2Error(w, "expired_token", "The device code has expired", "")
+		return
+	case err != nil:
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Device Code Validation Failed", map[string]interface{}{
+			"error":  err.Error(),
+			"reason": "invalid_grant",
+		})
+		writeOAuth2Error(w, "invalid_grant", err.Error(), "")
+		return
+	}
+
+	tokenResponse, err := p.issueTokens(auth.UserID, clientID, auth.Scope, "", RequestTokenBinding(r), time.Now(), nil, nil)
+	if err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Generation Failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		writeOAuth2Error(w, "server_error", "Failed to issue tokens", "")
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeTokenIssued, "Device Poll: Tokens Issued", map[string]interface{}{
+		"step":              6,
+		"from":              "Authorization Server",
+		"to":                "Device",
+		"token_type":        tokenResponse.TokenType,
+		"expires_in":        tokenResponse.ExpiresIn,
+		"scope":             tokenResponse.Scope,
+		"has_refresh_token": tokenResponse.RefreshToken != "",
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Device Authorized",
+		Description: "The user approved the device, so the poll succeeds and the device code is consumed",
+		Reference:   "RFC 8628 Section 3.5",
+	})
+
+	writeJSON(w, http.StatusOK, tokenResponse)
+}
+
+// ClientHasGrantType checks whether a client is registered for a grant type
+func ClientHasGrantType(client *models.Client, grantType string) bool {
+	for _, gt := range client.GrantTypes {
+		if gt == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Plugin) generateDeviceVerificationPage(userCode, lgSession string) string {
+	action := "/oauth2/device"
+	if lgSession != "" {
+		action += "?lg_session=" + url.QueryEscape(lgSession)
+	}
+
+	return `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Device Login - Protocol Showcase</title>
+    <style>` + DevicePageStyles + `</style>
+</head>
+<body>
+    <div class="container">
+        <div class="logo">
+            <h1>Protocol Showcase</h1>
+            <p>Connect a Device</p>
+        </div>
+
+        <!-- ERROR -->
+
+        <form method="POST" action="` + html.EscapeString(action) + `">
+            <div class="form-group">
+                <label for="user_code">Code shown on your device</label>
+                <input type="text" id="user_code" name="user_code" class="code" placeholder="XXXX-XXXX" value="` + html.EscapeString(userCode) + `" autocomplete="off" required>
+            </div>
+
+            <div class="form-group">
+                <label for="email">Email</label>
+                <input type="email" id="email" name="email" placeholder="alice@example.com" required>
+            </div>
+
+            <div class="form-group">
+                <label for="password">Password</label>
+                <input type="password" id="password" name="password" placeholder="password" required>
+            </div>
+
+            <button type="submit" name="action" value="approve">Approve Device</button>
+            <button type="submit" name="action" value="deny" class="secondary">Deny</button>
+        </form>
+    </div>
+</body>
+</html>`
+}
+
+// GenerateDeviceResultPage renders the confirmation shown after the user answers on their second device
+func GenerateDeviceResultPage(title, message string) string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>` + html.EscapeString(title) + ` - Protocol Showcase</title>
+    <style>` + DevicePageStyles + `</style>
+</head>
+<body>
+    <div class="container">
+        <div class="logo">
+            <h1>` + html.EscapeString(title) + `</h1>
+            <p>` + html.EscapeString(message) + `</p>
+        </div>
+    </div>
+</body>
+</html>`
+}
+
+// DevicePageStyles styles the pages a user visits on their second device, shared with the OIDC CIBA authentication device
+const DevicePageStyles = `
+        * { box-sizing: border-box; margin: 0; padding: 0; }
+        body {
+            font-family: 'Segoe UI', system-ui, sans-serif;
+            background: linear-gradient(135deg, #1a1a2e 0%, #16213e 100%);
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            color: #e4e4e7;
+        }
+        .container {
+            background: rgba(255, 255, 255, 0.05);
+            border: 1px solid rgba(255, 255, 255, 0.1);
+            border-radius: 16px;
+            padding: 40px;
+            width: 100%;
+            max-width: 420px;
+        }
+        .logo { text-align: center; margin-bottom: 30px; }
+        .logo h1 { font-size: 24px; font-weight: 600; color: #fff; }
+        .logo p { color: #a1a1aa; font-size: 14px; margin-top: 8px; }
+        .form-group { margin-bottom: 20px; }
+        label { display: block; font-size: 14px; font-weight: 500; margin-bottom: 8px; color: #d4d4d8; }
+        input {
+            width: 100%;
+            padding: 12px 16px;
+            border: 1px solid rgba(255, 255, 255, 0.1);
+            border-radius: 8px;
+            background: rgba(0, 0, 0, 0.2);
+            color: #fff;
+            font-size: 16px;
+        }
+        input.code { font-family: monospace; font-size: 22px; letter-spacing: 4px; text-align: center; text-transform: uppercase; }
+        button {
+            width: 100%;
+            padding: 14px;
+            margin-bottom: 10px;
+            background: linear-gradient(135deg, #6366f1 0%, #8b5cf6 100%);
+            border: none;
+            border-radius: 8px;
+            color: #fff;
+            font-size: 16px;
+            font-weight: 600;
+            cursor: pointer;
+        }
+        button.secondary { background: rgba(255, 255, 255, 0.08); }
+        .error {
+            background: rgba(239, 68, 68, 0.1);
+            border: 1px solid rgba(239, 68, 68, 0.2);
+            color: #fca5a5;
+            padding: 12px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+            font-size: 14px;
+        }
+    `
@@ -0,0 +1,196 @@
+package oauth2
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+)
+
+// DPoP error codes (RFC 9449 Section 12.2)
+const (
+	ErrorInvalidDPoPProof = "invalid_dpop_proof"
+	ErrorUseDPoPNonce     = "use_dpop_nonce"
+)
+
+// dpopProofWindow is how far a proof's iat may be from the server clock
+const dpopProofWindow = 60 * time.Second
+
+// DPoPError is returned when a DPoP proof is missing or invalid
+type DPoPError struct {
+	Code        string
+	Description string
+	Nonce       string // fresh nonce to return in the DPoP-Nonce header
+}
+
+func (e *DPoPError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+type dpopBindingKey struct{}
+
+// WithDPoPBinding returns a request carrying the thumbprint of a validated DPoP proof
+func WithDPoPBinding(r *http.Request, jkt string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), dpopBindingKey{}, jkt))
+}
+
+// DPoPBinding returns the DPoP key thumbprint for the request, or "" for bearer requests
+func DPoPBinding(r *http.Request) string {
+	jkt, _ := r.Context().Value(dpopBindingKey{}).(string)
+	return jkt
+}
+
+// AccessTokenType returns the token_type for an access token with the given DPoP binding
+func AccessTokenType(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// TokenThumbprint returns the cnf.jkt claim of a validated access token
+func TokenThumbprint(claims map[string]interface{}) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
+
+// ValidateDPoPProof validates the DPoP header of r (RFC 9449 Section 4.3). At protected
+// resources accessToken is the presented token and the proof must carry a matching ath.
+// Every check is reported to Looking Glass alongside a breakdown of the proof.
+func (p *Plugin) ValidateDPoPProof(r *http.Request, sessionID, accessToken string) (*crypto.DPoPProof, error) {
+	results := make([]map[string]interface{}, 0)
+	pass := func(id string) {
+		results = append(results, map[string]interface{}{"check": id, "passed": true})
+	}
+	fail := func(id, code, description string) error {
+		results = append(results, map[string]interface{}{"check": id, "passed": false, "detail": description})
+		dpopErr := &DPoPError{Code: code, Description: description}
+		if code == ErrorUseDPoPNonce {
+			dpopErr.Nonce = p.mockIdP.IssueDPoPNonce()
+		}
+		p.emitDPoPValidation(sessionID, r.Header.Get("DPoP"), results, dpopErr)
+		return dpopErr
+	}
+
+	headers := r.Header.Values("DPoP")
+	if len(headers) != 1 {
+		return nil, fail("single_header", ErrorInvalidDPoPProof, "exactly one DPoP header is required")
+	}
+	pass("single_header")
+
+	proof, err := crypto.ParseDPoPProof(headers[0])
+	if err != nil {
+		return nil, fail("signature", ErrorInvalidDPoPProof, err.Error())
+	}
+	pass("typ")
+	pass("alg")
+	pass("jwk")
+	pass("signature")
+
+	if proof.HTM != r.Method {
+		return nil, fail("htm", ErrorInvalidDPoPProof, "htm does not match the request method")
+	}
+	pass("htm")
+
+	if proof.HTU != p.baseURL+r.URL.Path {
+		return nil, fail("htu", ErrorInvalidDPoPProof, "htu does not match the request URI")
+	}
+	pass("htu")
+
+	if age := time.Since(proof.IssuedAt); age > dpopProofWindow || age < -dpopProofWindow {
+		return nil, fail("iat", ErrorInvalidDPoPProof, "proof iat is outside the acceptance window")
+	}
+	pass("iat")
+
+	if proof.Nonce == "" || !p.mockIdP.ValidateDPoPNonce(proof.Nonce) {
+		return nil, fail("nonce", ErrorUseDPoPNonce, "Authorization server requires nonce in DPoP proof")
+	}
+	pass("nonce")
+
+	if accessToken != "" {
+		if proof.ATH != crypto.DPoPAccessTokenHash(accessToken) {
+			return nil, fail("ath", ErrorInvalidDPoPProof, "ath does not match the presented access token")
+		}
+		pass("ath")
+	}
+
+	if !p.mockIdP.RecordDPoPProof(proof.JTI, proof.IssuedAt.Add(dpopProofWindow)) {
+		return nil, fail("jti", ErrorInvalidDPoPProof, "DPoP proof has already been used")
+	}
+	pass("jti")
+
+	p.emitDPoPValidation(sessionID, proof.Raw, results, nil)
+	return proof, nil
+}
+
+// emitDPoPValidation reports a DPoP proof breakdown and check results to Looking Glass
+func (p *Plugin) emitDPoPValidation(sessionID, rawProof string, results []map[string]interface{}, dpopErr *DPoPError) {
+	data := map[string]interface{}{
+		"checks": results,
+	}
+	if decoded, err := lookingglass.NewDecoder().DecodeDPoPProof(rawProof); err == nil {
+		data["proof"] = decoded
+	}
+
+	if dpopErr != nil {
+		data["error"] = dpopErr.Code
+		data["error_description"] = dpopErr.Description
+		if dpopErr.Code == ErrorUseDPoPNonce {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "DPoP Nonce Challenge", data, lookingglass.Annotation{
+				Type:        lookingglass.AnnotationTypeExplanation,
+				Title:       "Server-Provided Nonce",
+				Description: "The server returns a fresh nonce in the DPoP-Nonce header. The client retries with a new proof containing it, which prevents proofs from being generated in advance by an attacker.",
+				Reference:   "RFC 9449 Section 8",
+			})
+			return
+		}
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "DPoP Proof Rejected", data, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Invalid DPoP Proof",
+			Description: dpopErr.Description,
+			Severity:    "warning",
+			Reference:   "RFC 9449 Section 4.3",
+		})
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeCryptoOperation, "DPoP Proof Validated", data, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Proof of Possession",
+		Description: "The client proved possession of the private key for this request. Tokens bound to the key are useless to anyone who steals them without the key.",
+		Reference:   "RFC 9449 Section 1",
+	})
+}
+
+// writeDPoPTokenError writes a DPoP error response from the token endpoint (RFC 9449 Section 5)
+func writeDPoPTokenError(w http.ResponseWriter, err error) {
+	dpopErr, ok := err.(*DPoPError)
+	if !ok {
+		writeOAuth2Error(w, ErrorInvalidDPoPProof, err.Error(), "")
+		return
+	}
+	if dpopErr.Nonce != "" {
+		w.Header().Set("DPoP-Nonce", dpopErr.Nonce)
+	}
+	writeOAuth2Error(w, dpopErr.Code, dpopErr.Description, "")
+}
+
+// WriteDPoPResourceError writes a DPoP error response from a protected resource (RFC 9449 Section 7.1)
+func WriteDPoPResourceError(w http.ResponseWriter, err error) {
+	code, description := ErrorInvalidDPoPProof, err.Error()
+	if dpopErr, ok := err.(*DPoPError); ok {
+		code, description = dpopErr.Code, dpopErr.Description
+		if dpopErr.Nonce != "" {
+			w.Header().Set("DPoP-Nonce", dpopErr.Nonce)
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `DPoP algs="`+strings.Join(crypto.DPoPSigningAlgorithms, " ")+`", error="`+code+`", error_description="`+description+`"`)
+	writeJSON(w, http.StatusUnauthorized, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
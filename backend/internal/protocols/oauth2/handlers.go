@@ -2,12 +2,15 @@ package oauth2
 
 import (
 	"encoding/json"
+	"html"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
 	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
 	"github.com/ParleSec/ProtocolSoup/pkg/models"
 )
 
@@ -36,6 +39,13 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	sessionID := p.getSessionFromRequest(r)
 
+	// JWT-secured authorization request (RFC 9101): signed parameters replace those in the query
+	requestObject, roErr := p.ApplyRequestObject(sessionID, query.Get("client_id"), query)
+	if roErr != nil {
+		writeOAuth2Error(w, roErr.Code, roErr.Description, "")
+		return
+	}
+
 	responseType := query.Get("response_type")
 	clientID := query.Get("client_id")
 	redirectURI := query.Get("redirect_uri")
@@ -43,6 +53,34 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 	state := query.Get("state")
 	codeChallenge := query.Get("code_challenge")
 	codeChallengeMethod := query.Get("code_challenge_method")
+	requestURI := query.Get("request_uri")
+	authorizationDetails := query.Get("authorization_details")
+	resources := query["resource"]
+	responseMode := query.Get("response_mode")
+
+	// Pushed authorization request (RFC 9126): parameters come from the back channel
+	if requestURI != "" {
+		par, err := p.mockIdP.GetPushedAuthorizationRequest(requestURI, clientID)
+		if err != nil {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid Request URI", map[string]interface{}{
+				"error":       "invalid_request_uri",
+				"request_uri": requestURI,
+				"reason":      err.Error(),
+			})
+			writeOAuth2Error(w, "invalid_request_uri", err.Error(), "")
+			return
+		}
+		responseType = par.Parameters["response_type"]
+		redirectURI = par.Parameters["redirect_uri"]
+		scope = par.Parameters["scope"]
+		state = par.Parameters["state"]
+		codeChallenge = par.Parameters["code_challenge"]
+		codeChallengeMethod = par.Parameters["code_challenge_method"]
+		authorizationDetails = par.Parameters["authorization_details"]
+		resources = strings.Fields(par.Parameters["resource"])
+		responseMode = par.Parameters["response_mode"]
+		p.emitPARResolved(sessionID, par)
+	}
 
 	// Emit authorization request event
 	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Authorization Request Received", map[string]interface{}{
@@ -73,6 +111,12 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Codes are returned in the query string, or as a JWT with the JARM response modes
+	if err := ValidateResponseMode(responseMode, responseType, []string{"query"}); err != nil {
+		writeOAuth2Error(w, "invalid_request", err.Error(), "")
+		return
+	}
+
 	if clientID == "" {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Missing Client ID", map[string]interface{}{
 			"error": "invalid_request",
@@ -92,6 +136,12 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if client.RequirePushedAuthorizationRequests && requestURI == "" {
+		p.EmitPARRequired(sessionID, clientID)
+		writeOAuth2Error(w, "invalid_request", "This client must use pushed authorization requests", "")
+		return
+	}
+
 	// Validate redirect URI
 	if !p.mockIdP.ValidateRedirectURI(clientID, redirectURI) {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid Redirect URI", map[string]interface{}{
@@ -108,6 +158,26 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Native apps must use PKCE (RFC 8252 Section 8.1)
+	if err := p.CheckNativeAppRequest(sessionID, client, redirectURI, responseType, codeChallenge, codeChallengeMethod); err != nil {
+		writeOAuth2Error(w, "invalid_request", err.Error(), "")
+		return
+	}
+
+	// Resource indicators (RFC 8707)
+	if err := p.ValidateResources(sessionID, resources); err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidTarget, err.Error(), "")
+		return
+	}
+
+	// Rich authorization request (RFC 9396)
+	details, err := p.ParseAuthorizationDetails(sessionID, clientID, authorizationDetails)
+	if err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidAuthorizationDetails, err.Error(), "")
+		return
+	}
+	p.EmitAuthorizationDetailsRequested(sessionID, details)
+
 	// Security annotations for PKCE
 	if codeChallenge != "" {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "PKCE Challenge Received", map[string]interface{}{
@@ -142,6 +212,12 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 
 	// For demo purposes, return a login page
 	loginPage := p.generateLoginPage(clientID, redirectURI, scope, state, codeChallenge, codeChallengeMethod, client.Name)
+	loginPage = WithRequestURIField(loginPage, requestURI)
+	loginPage = WithRequestObjectField(loginPage, requestObject)
+	loginPage = WithResponseModeField(loginPage, responseMode)
+	loginPage = WithAuthorizationDetails(loginPage, authorizationDetails, details)
+	loginPage = WithResourceFields(loginPage, resources)
+	loginPage = WithCredentialFields(loginPage, p.mockIdP.CredentialVerifiers(mockidp.ACRPassword))
 	w.Header().Set("Content-Type", "text/html")
 	w.Write([]byte(loginPage))
 }
@@ -155,6 +231,13 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A request object carried by the form is verified again and takes precedence over the other fields
+	requestObject, roErr := p.ApplyRequestObject(sessionID, r.FormValue("client_id"), r.Form)
+	if roErr != nil {
+		writeOAuth2Error(w, roErr.Code, roErr.Description, "")
+		return
+	}
+
 	// Get form values
 	email := r.FormValue("email")
 	password := r.FormValue("password")
@@ -165,6 +248,32 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 	codeChallenge := r.FormValue("code_challenge")
 	codeChallengeMethod := r.FormValue("code_challenge_method")
 	nonce := r.FormValue("nonce") // For OIDC
+	requestURI := r.FormValue("request_uri")
+	authorizationDetails := r.FormValue("authorization_details")
+	resources := r.Form["resource"]
+	responseMode := r.FormValue("response_mode")
+
+	// Pushed parameters take precedence over anything in the submitted form
+	if requestURI != "" {
+		par, err := p.mockIdP.GetPushedAuthorizationRequest(requestURI, clientID)
+		if err != nil {
+			writeOAuth2Error(w, "invalid_request_uri", err.Error(), "")
+			return
+		}
+		redirectURI = par.Parameters["redirect_uri"]
+		scope = par.Parameters["scope"]
+		state = par.Parameters["state"]
+		codeChallenge = par.Parameters["code_challenge"]
+		codeChallengeMethod = par.Parameters["code_challenge_method"]
+		nonce = par.Parameters["nonce"]
+		authorizationDetails = par.Parameters["authorization_details"]
+		resources = strings.Fields(par.Parameters["resource"])
+		responseMode = par.Parameters["response_mode"]
+	} else if client, exists := p.mockIdP.GetClient(clientID); exists && client.RequirePushedAuthorizationRequests {
+		p.EmitPARRequired(sessionID, clientID)
+		writeOAuth2Error(w, "invalid_request", "This client must use pushed authorization requests", "")
+		return
+	}
 
 	// Security: Re-validate redirect URI to prevent open redirect attacks via form tampering
 	if !p.mockIdP.ValidateRedirectURI(clientID, redirectURI) {
@@ -180,6 +289,23 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 		writeOAuth2Error(w, "invalid_request", "Invalid redirect_uri", "")
 		return
 	}
+	if client, exists := p.mockIdP.GetClient(clientID); exists {
+		if err := p.CheckNativeAppRequest(sessionID, client, redirectURI, "code", codeChallenge, codeChallengeMethod); err != nil {
+			writeOAuth2Error(w, "invalid_request", err.Error(), "")
+			return
+		}
+	}
+
+	// Re-validate resource indicators and authorization details, which travel through the form unless pushed
+	if err := p.ValidateResources(sessionID, resources); err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidTarget, err.Error(), "")
+		return
+	}
+	details, err := p.ParseAuthorizationDetails(sessionID, clientID, authorizationDetails)
+	if err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidAuthorizationDetails, err.Error(), "")
+		return
+	}
 
 	// Emit credential submission event (without password!)
 	p.emitEvent(sessionID, lookingglass.EventTypeRequestSent, "User Credentials Submitted", map[string]interface{}{
@@ -187,18 +313,33 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 		"client_id": clientID,
 	})
 
+	// Return to login page with error
+	renderLoginError := func(message string) {
+		loginPage := p.generateLoginPage(clientID, redirectURI, scope, state, codeChallenge, codeChallengeMethod, "")
+		loginPage = WithRequestURIField(loginPage, requestURI)
+		loginPage = WithRequestObjectField(loginPage, requestObject)
+		loginPage = WithResponseModeField(loginPage, responseMode)
+		loginPage = WithAuthorizationDetails(loginPage, authorizationDetails, details)
+		loginPage = WithResourceFields(loginPage, resources)
+		loginPage = WithCredentialFields(loginPage, p.mockIdP.CredentialVerifiers(mockidp.ACRPassword))
+		loginPage = strings.Replace(loginPage, "<!-- ERROR -->", `<div class="error">`+message+`</div>`, 1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(loginPage))
+	}
+
 	// Validate user credentials
 	user, err := p.mockIdP.ValidateCredentials(email, password)
 	if err != nil {
-		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Authentication Failed", map[string]interface{}{
-			"email":  email,
-			"reason": "Invalid credentials",
+		p.EmitLoginFailure(sessionID, email, err)
+		renderLoginError(LoginErrorMessage(err))
+		return
+	}
+	if err := p.mockIdP.VerifyCredentials(user, mockidp.ACRPassword, r.Form); err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Second Factor Failed", map[string]interface{}{
+			"user_id": user.ID,
+			"error":   err.Error(),
 		})
-		// Return to login page with error
-		loginPage := p.generateLoginPage(clientID, redirectURI, scope, state, codeChallenge, codeChallengeMethod, "")
-		loginPage = strings.Replace(loginPage, "<!-- ERROR -->", `<div class="error">Invalid email or password</div>`, 1)
-		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(loginPage))
+		renderLoginError(html.EscapeString(CredentialErrorMessage(err)))
 		return
 	}
 
@@ -216,6 +357,21 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 		Description: "The user has successfully authenticated. An authorization code will now be issued.",
 	})
 
+	// A pushed request is single use
+	if requestURI != "" {
+		if _, err := p.mockIdP.ConsumePushedAuthorizationRequest(requestURI, clientID); err != nil {
+			writeOAuth2Error(w, "invalid_request_uri", err.Error(), "")
+			return
+		}
+	}
+	// So is a request object
+	if requestObject != "" {
+		if err := p.mockIdP.ConsumeRequestObject(clientID, requestObject); err != nil {
+			writeOAuth2Error(w, mockidp.ErrorInvalidRequestObject, err.Error(), "")
+			return
+		}
+	}
+
 	// Create authorization code
 	authCode, err := p.mockIdP.CreateAuthorizationCode(
 		clientID, user.ID, redirectURI, scope, state, nonce,
@@ -228,6 +384,13 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 		writeOAuth2Error(w, "server_error", "Failed to create authorization code", state)
 		return
 	}
+	if len(details) > 0 {
+		p.mockIdP.GrantAuthorizationDetails(authCode.Code, details)
+		p.EmitAuthorizationDetailsGranted(sessionID, user.ID, details)
+	}
+	if len(resources) > 0 {
+		p.mockIdP.GrantResources(authCode.Code, resources)
+	}
 
 	// Emit authorization code issued event
 	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Authorization Code Issued", map[string]interface{}{
@@ -247,6 +410,19 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 		Reference:   "RFC 6749 Section 4.1.2",
 	})
 
+	// JARM: the code and state are returned inside a signed JWT
+	if mockidp.IsJWTResponseMode(responseMode) {
+		client, _ := p.mockIdP.GetClient(clientID)
+		params := map[string]string{"code": authCode.Code}
+		if state != "" {
+			params["state"] = state
+		}
+		if err := p.WriteJWTAuthorizationResponse(w, r, sessionID, client, redirectURI, responseMode, "code", params); err != nil {
+			writeOAuth2Error(w, "server_error", "Failed to sign authorization response", state)
+		}
+		return
+	}
+
 	// Build redirect URL
 	redirectURL, _ := url.Parse(redirectURI)
 	q := redirectURL.Query()
@@ -289,33 +465,47 @@ func (p *Plugin) handleToken(w http.ResponseWriter, r *http.Request) {
 		"endpoint":   "/oauth2/token",
 	})
 
-	switch grantType {
-	case "authorization_code":
-		p.handleAuthorizationCodeGrant(w, r, sessionID)
-	case "refresh_token":
-		p.handleRefreshTokenGrant(w, r, sessionID)
-	case "client_credentials":
-		p.handleClientCredentialsGrant(w, r, sessionID)
-	default:
+	// A DPoP proof binds the issued tokens to the client's key (RFC 9449 Section 5)
+	if r.Header.Get("DPoP") != "" {
+		proof, err := p.ValidateDPoPProof(r, sessionID, "")
+		if err != nil {
+			writeDPoPTokenError(w, err)
+			return
+		}
+		r = WithDPoPBinding(r, proof.Thumbprint)
+	}
+	// A client certificate binds them to the certificate instead (RFC 8705 Section 3)
+	r = p.BindClientCertificate(r)
+
+	handleGrant, supported := p.grantHandlers()[grantType]
+	if !supported {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Unsupported Grant Type", map[string]interface{}{
 			"grant_type": grantType,
 		})
 		writeOAuth2Error(w, "unsupported_grant_type", "Grant type not supported", "")
+		return
+	}
+	handleGrant(w, r, sessionID)
+}
+
+// grantHandlers maps each grant_type the token endpoint accepts to its handler.
+// The authorization server metadata advertises exactly these grant types.
+func (p *Plugin) grantHandlers() map[string]func(http.ResponseWriter, *http.Request, string) {
+	return map[string]func(http.ResponseWriter, *http.Request, string){
+		"authorization_code":   p.handleAuthorizationCodeGrant,
+		"refresh_token":        p.handleRefreshTokenGrant,
+		"client_credentials":   p.handleClientCredentialsGrant,
+		GrantTypeDeviceCode:    p.handleDeviceCodeGrant,
+		GrantTypeTokenExchange: p.handleTokenExchangeGrant,
 	}
 }
 
 func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request, sessionID string) {
 	code := r.FormValue("code")
 	redirectURI := r.FormValue("redirect_uri")
-	clientID := r.FormValue("client_id")
-	clientSecret := r.FormValue("client_secret")
+	clientID := RequestClientID(r)
 	codeVerifier := r.FormValue("code_verifier")
 
-	// Try to get client credentials from Authorization header
-	if clientID == "" {
-		clientID, clientSecret, _ = r.BasicAuth()
-	}
-
 	// Emit token exchange step
 	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Token Exchange Request", map[string]interface{}{
 		"step":          4,
@@ -343,7 +533,7 @@ func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Req
 	}
 
 	if !client.Public {
-		if _, err := p.mockIdP.ValidateClient(clientID, clientSecret); err != nil {
+		if _, err := p.AuthenticateClient(r, sessionID); err != nil {
 			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
 				"client_id": clientID,
 				"reason":    "invalid_credentials",
@@ -381,8 +571,23 @@ func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Req
 		})
 	}
 
+	// The access token may carry a subset of the granted authorization details and resources
+	details, err := p.TokenAuthorizationDetails(r, sessionID, clientID, authCode.AuthorizationDetails)
+	if err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidAuthorizationDetails, err.Error(), "")
+		return
+	}
+	resources, err := p.TokenResources(r, sessionID, authCode.Resources)
+	if err == nil {
+		_, err = p.ResourceScope(sessionID, resources, authCode.Scope)
+	}
+	if err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidTarget, err.Error(), "")
+		return
+	}
+
 	// Generate tokens
-	tokenResponse, err := p.issueTokens(authCode.UserID, clientID, authCode.Scope, authCode.Nonce)
+	tokenResponse, err := p.issueTokens(authCode.UserID, clientID, authCode.Scope, authCode.Nonce, RequestTokenBinding(r), authCode.CreatedAt, details, resources)
 	if err != nil {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Generation Failed", map[string]interface{}{
 			"error": err.Error(),
@@ -390,16 +595,24 @@ func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Req
 		writeOAuth2Error(w, "server_error", "Failed to issue tokens", "")
 		return
 	}
+	if len(authCode.AuthorizationDetails) > 0 {
+		p.mockIdP.SetRefreshTokenAuthorizationDetails(tokenResponse.RefreshToken, authCode.AuthorizationDetails)
+	}
+	if len(authCode.Resources) > 0 {
+		p.mockIdP.SetRefreshTokenResources(tokenResponse.RefreshToken, authCode.Resources)
+	}
+	p.EmitAudienceRestricted(sessionID, clientID, resources)
 
 	// Emit token issued event
 	p.emitEvent(sessionID, lookingglass.EventTypeTokenIssued, "Access Token Issued", map[string]interface{}{
-		"step":              5,
-		"from":              "Authorization Server",
-		"to":                "Client",
-		"token_type":        tokenResponse.TokenType,
-		"expires_in":        tokenResponse.ExpiresIn,
-		"scope":             tokenResponse.Scope,
-		"has_refresh_token": tokenResponse.RefreshToken != "",
+		"step":                5,
+		"from":                "Authorization Server",
+		"to":                  "Client",
+		"token_type":          tokenResponse.TokenType,
+		"expires_in":          tokenResponse.ExpiresIn,
+		"scope":               tokenResponse.Scope,
+		"has_refresh_token":   tokenResponse.RefreshToken != "",
+		"access_token_format": p.mockIdP.AccessTokenFormat(clientID),
 	}, lookingglass.Annotation{
 		Type:        lookingglass.AnnotationTypeExplanation,
 		Title:       "Tokens Issued",
@@ -412,15 +625,9 @@ func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Req
 
 func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request, sessionID string) {
 	refreshToken := r.FormValue("refresh_token")
-	clientID := r.FormValue("client_id")
-	clientSecret := r.FormValue("client_secret")
+	clientID := RequestClientID(r)
 	scope := r.FormValue("scope")
 
-	// Try to get client credentials from Authorization header
-	if clientID == "" {
-		clientID, clientSecret, _ = r.BasicAuth()
-	}
-
 	// Emit refresh token request
 	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Refresh Token Request", map[string]interface{}{
 		"grant_type":    "refresh_token",
@@ -444,7 +651,7 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 	}
 
 	if !client.Public {
-		if _, err := p.mockIdP.ValidateClient(clientID, clientSecret); err != nil {
+		if _, err := p.AuthenticateClient(r, sessionID); err != nil {
 			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
 				"client_id": clientID,
 			})
@@ -455,6 +662,11 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 
 	// Validate refresh token
 	rt, err := p.mockIdP.ValidateRefreshToken(refreshToken, clientID)
+	if reuse, ok := err.(*mockidp.RefreshTokenReuseError); ok {
+		p.EmitRefreshTokenReuse(sessionID, reuse)
+		writeOAuth2Error(w, "invalid_grant", "Refresh token has already been used; the token family has been revoked", "")
+		return
+	}
 	if err != nil {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Refresh Token Invalid", map[string]interface{}{
 			"error": err.Error(),
@@ -463,17 +675,67 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// Use original scope if not specified
+	// A DPoP-bound refresh token can only be used with proof of the same key
+	if rt.JKT != "" && rt.JKT != DPoPBinding(r) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Refresh Token Key Mismatch", map[string]interface{}{
+			"bound_jkt": rt.JKT,
+			"proof_jkt": DPoPBinding(r),
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Sender-Constrained Refresh Token",
+			Description: "Refresh tokens issued to public clients with DPoP are bound to the client's key, so a stolen refresh token cannot be redeemed",
+			Severity:    "warning",
+			Reference:   "RFC 9449 Section 5",
+		})
+		writeOAuth2Error(w, "invalid_grant", "Refresh token is bound to a different DPoP key", "")
+		return
+	}
+
+	// Use original scope if not specified; a refresh may downscope but never widen the grant
 	if scope == "" {
 		scope = rt.Scope
+	} else if !ScopeSubset(scope, rt.Scope) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Scope Escalation Rejected", map[string]interface{}{
+			"requested_scope": scope,
+			"granted_scope":   rt.Scope,
+		})
+		writeOAuth2Error(w, "invalid_scope", "Requested scope exceeds the scope originally granted", "")
+		return
+	}
+
+	details, err := p.TokenAuthorizationDetails(r, sessionID, clientID, rt.AuthorizationDetails)
+	if err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidAuthorizationDetails, err.Error(), "")
+		return
+	}
+	resources, err := p.TokenResources(r, sessionID, rt.Resources)
+	if err == nil {
+		_, err = p.ResourceScope(sessionID, resources, scope)
+	}
+	if err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidTarget, err.Error(), "")
+		return
+	}
+
+	// Rotate only now that every check has passed, so a rejected request leaves the token usable
+	if err := p.mockIdP.RotateRefreshToken(rt); err != nil {
+		if reuse, ok := err.(*mockidp.RefreshTokenReuseError); ok {
+			p.EmitRefreshTokenReuse(sessionID, reuse)
+			writeOAuth2Error(w, "invalid_grant", "Refresh token has already been used; the token family has been revoked", "")
+			return
+		}
+		writeOAuth2Error(w, "invalid_grant", err.Error(), "")
+		return
 	}
 
 	// Generate new tokens
-	tokenResponse, err := p.issueTokens(rt.UserID, clientID, scope, "")
+	tokenResponse, err := p.issueTokens(rt.UserID, clientID, scope, "", RequestTokenBinding(r), rt.AuthTime, details, resources)
 	if err != nil {
 		writeOAuth2Error(w, "server_error", "Failed to issue tokens", "")
 		return
 	}
+	p.mockIdP.ContinueRefreshTokenFamily(tokenResponse.RefreshToken, rt)
+	p.EmitAudienceRestricted(sessionID, clientID, resources)
 
 	// Emit token rotation event
 	p.emitEvent(sessionID, lookingglass.EventTypeTokenIssued, "Tokens Refreshed", map[string]interface{}{
@@ -481,26 +743,23 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 		"expires_in":           tokenResponse.ExpiresIn,
 		"new_refresh_token":    tokenResponse.RefreshToken != "",
 		"rotation_implemented": true,
+		"family_id":            rt.FamilyID,
+		"generation":           rt.Generation + 1,
 	}, lookingglass.Annotation{
 		Type:        lookingglass.AnnotationTypeBestPractice,
 		Title:       "Refresh Token Rotation",
 		Description: "A new refresh token is issued and the old one is invalidated, limiting the window of vulnerability if a refresh token is compromised",
 		Reference:   "RFC 6749 Section 10.4",
 	})
+	p.EmitRefreshTokenRotated(sessionID, rt)
 
 	writeJSON(w, http.StatusOK, tokenResponse)
 }
 
 func (p *Plugin) handleClientCredentialsGrant(w http.ResponseWriter, r *http.Request, sessionID string) {
-	clientID := r.FormValue("client_id")
-	clientSecret := r.FormValue("client_secret")
+	clientID := RequestClientID(r)
 	scope := r.FormValue("scope")
 
-	// Try to get client credentials from Authorization header
-	if clientID == "" {
-		clientID, clientSecret, _ = r.BasicAuth()
-	}
-
 	// Emit client credentials request
 	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Client Credentials Request", map[string]interface{}{
 		"step":            1,
@@ -517,7 +776,7 @@ func (p *Plugin) handleClientCredentialsGrant(w http.ResponseWriter, r *http.Req
 	})
 
 	// Validate client
-	client, err := p.mockIdP.ValidateClient(clientID, clientSecret)
+	client, err := p.AuthenticateClient(r, sessionID)
 	if err != nil {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
 			"client_id": clientID,
@@ -533,14 +792,7 @@ func (p *Plugin) handleClientCredentialsGrant(w http.ResponseWriter, r *http.Req
 	})
 
 	// Check if client is authorized for this grant type
-	hasGrant := false
-	for _, gt := range client.GrantTypes {
-		if gt == "client_credentials" {
-			hasGrant = true
-			break
-		}
-	}
-	if !hasGrant {
+	if !ClientHasGrantType(client, "client_credentials") {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Unauthorized Grant Type", map[string]interface{}{
 			"client_id":  clientID,
 			"grant_type": "client_credentials",
@@ -549,17 +801,31 @@ func (p *Plugin) handleClientCredentialsGrant(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	details, err := p.ParseAuthorizationDetails(sessionID, clientID, r.FormValue("authorization_details"))
+	if err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidAuthorizationDetails, err.Error(), "")
+		return
+	}
+	resources, err := p.TokenResources(r, sessionID, nil)
+	if err == nil {
+		scope, err = p.ResourceScope(sessionID, resources, scope)
+	}
+	if err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidTarget, err.Error(), "")
+		return
+	}
+
 	// Issue access token (no refresh token for client credentials)
-	jwtService := p.mockIdP.JWTService()
-	accessToken, err := jwtService.CreateAccessToken(
-		clientID, // Subject is the client itself
-		clientID,
-		scope,
-		time.Hour,
-		map[string]interface{}{
+	accessToken, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+		Subject:              clientID, // Subject is the client itself
+		ClientID:             clientID,
+		Audience:             resources,
+		Scope:                scope,
+		AuthorizationDetails: details,
+		Custom: RequestTokenBinding(r).BoundClaims(map[string]interface{}{
 			"client_name": client.Name,
-		},
-	)
+		}),
+	}, time.Hour)
 	if err != nil {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Generation Failed", map[string]interface{}{
 			"error": err.Error(),
@@ -569,21 +835,24 @@ func (p *Plugin) handleClientCredentialsGrant(w http.ResponseWriter, r *http.Req
 	}
 
 	tokenResponse := models.TokenResponse{
-		AccessToken: accessToken,
-		TokenType:   "Bearer",
-		ExpiresIn:   3600,
-		Scope:       scope,
+		AccessToken:          accessToken,
+		TokenType:            AccessTokenType(DPoPBinding(r)),
+		ExpiresIn:            3600,
+		Scope:                scope,
+		AuthorizationDetails: details,
 	}
+	p.EmitAudienceRestricted(sessionID, clientID, resources)
 
 	// Emit token issued event
 	p.emitEvent(sessionID, lookingglass.EventTypeTokenIssued, "Access Token Issued", map[string]interface{}{
-		"step":              2,
-		"from":              "Authorization Server",
-		"to":                "Client",
-		"token_type":        "Bearer",
-		"expires_in":        3600,
-		"scope":             scope,
-		"has_refresh_token": false,
+		"step":                2,
+		"from":                "Authorization Server",
+		"to":                  "Client",
+		"token_type":          tokenResponse.TokenType,
+		"expires_in":          3600,
+		"scope":               scope,
+		"has_refresh_token":   false,
+		"access_token_format": p.mockIdP.AccessTokenFormat(clientID),
 	}, lookingglass.Annotation{
 		Type:        lookingglass.AnnotationTypeSecurityHint,
 		Title:       "No Refresh Token",
@@ -618,13 +887,9 @@ func (p *Plugin) handleIntrospect(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Authenticate the client making the introspection request
-	clientID, clientSecret, _ := r.BasicAuth()
-	if clientID == "" {
-		clientID = r.FormValue("client_id")
-		clientSecret = r.FormValue("client_secret")
-	}
+	clientID := RequestClientID(r)
 
-	if _, err := p.mockIdP.ValidateClient(clientID, clientSecret); err != nil {
+	if _, err := p.AuthenticateClient(r, sessionID); err != nil {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Introspection Client Auth Failed", map[string]interface{}{
 			"client_id": clientID,
 		})
@@ -632,9 +897,18 @@ func (p *Plugin) handleIntrospect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate the token
-	jwtService := p.mockIdP.JWTService()
-	claims, err := jwtService.ValidateToken(token)
+	// Validate the token: reference tokens are looked up, JWTs are verified as an access token
+	// or, failing that, as a refresh token on record
+	isReference := p.mockIdP.IsReferenceToken(token)
+	claims, err := p.mockIdP.ResolveToken(token)
+	if err != nil {
+		if refreshClaims, refreshErr := p.mockIdP.ResolveRefreshToken(token); refreshErr == nil {
+			claims, err = refreshClaims, nil
+		}
+	}
+	if err == nil {
+		err = p.CheckTokenActive(token, claims)
+	}
 	if err != nil {
 		// Token is not active
 		p.emitEvent(sessionID, lookingglass.EventTypeResponseReceived, "Token Inactive", map[string]interface{}{
@@ -655,11 +929,24 @@ func (p *Plugin) handleIntrospect(w http.ResponseWriter, r *http.Request) {
 		response.Scope = scope
 	}
 	if sub, ok := claims["sub"].(string); ok {
+		// A pairwise client's user is named by the sub of its sector, as in its ID tokens.
+		// Refresh tokens already carry that sub.
+		if cid, _ := claims["client_id"].(string); cid != "" && cid != sub && claims["type"] != "refresh" {
+			sub = p.mockIdP.SubjectIdentifier(cid, sub)
+		}
 		response.Sub = sub
 		response.Username = sub
 	}
+	if cid, ok := claims["client_id"].(string); ok {
+		response.ClientID = cid
+	}
 	if audClaim, ok := claims["aud"].(string); ok {
-		response.ClientID = audClaim
+		response.Aud = audClaim
+		if response.ClientID == "" {
+			response.ClientID = audClaim
+		}
+	} else if audClaim, ok := claims["aud"].([]interface{}); ok {
+		response.Aud = audClaim
 	}
 	if exp, ok := claims["exp"].(float64); ok {
 		response.Exp = int64(exp)
@@ -673,11 +960,29 @@ func (p *Plugin) handleIntrospect(w http.ResponseWriter, r *http.Request) {
 	if jti, ok := claims["jti"].(string); ok {
 		response.Jti = jti
 	}
+	binding := TokenBinding{JKT: TokenThumbprint(claims), X5TS256: TokenCertificateThumbprint(claims)}
+	response.TokenType = AccessTokenType(binding.JKT)
+	response.Cnf = binding.Confirmation()
+	response.AuthorizationDetails = authorizationDetailsFromClaims(claims)
+
+	if isReference {
+		p.emitEvent(sessionID, lookingglass.EventTypeTokenValidated, "Reference Token Resolved", map[string]interface{}{
+			"client_id": response.ClientID,
+			"jti":       response.Jti,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Opaque Access Token",
+			Description: "The token is a random handle with no readable content. Its claims live only on the authorization server, so resource servers must introspect it on every use, and revocation takes effect immediately.",
+			Reference:   "RFC 7662 Section 1",
+		})
+	}
 
 	// Emit introspection response
 	p.emitEvent(sessionID, lookingglass.EventTypeTokenValidated, "Token Introspection Result", map[string]interface{}{
 		"active":     true,
-		"token_type": "Bearer",
+		"reference":  isReference,
+		"token_type": response.TokenType,
+		"cnf":        response.Cnf,
 		"sub":        response.Sub,
 		"scope":      response.Scope,
 		"exp":        response.Exp,
@@ -714,11 +1019,7 @@ func (p *Plugin) handleRevoke(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Authenticate the client
-	clientID, clientSecret, _ := r.BasicAuth()
-	if clientID == "" {
-		clientID = r.FormValue("client_id")
-		clientSecret = r.FormValue("client_secret")
-	}
+	clientID := RequestClientID(r)
 
 	client, exists := p.mockIdP.GetClient(clientID)
 	if !exists {
@@ -730,7 +1031,7 @@ func (p *Plugin) handleRevoke(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !client.Public {
-		if _, err := p.mockIdP.ValidateClient(clientID, clientSecret); err != nil {
+		if _, err := p.AuthenticateClient(r, sessionID); err != nil {
 			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Auth Failed", map[string]interface{}{
 				"client_id": clientID,
 			})
@@ -743,6 +1044,10 @@ func (p *Plugin) handleRevoke(w http.ResponseWriter, r *http.Request) {
 	if tokenTypeHint == "refresh_token" || tokenTypeHint == "" {
 		p.mockIdP.RevokeRefreshToken(token)
 	}
+	// Reference tokens exist only on the server, so revoking one takes effect immediately
+	if tokenTypeHint == "access_token" || tokenTypeHint == "" {
+		p.mockIdP.RevokeReferenceToken(token, clientID)
+	}
 
 	// Emit revocation success
 	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Token Revoked", map[string]interface{}{
@@ -775,29 +1080,41 @@ func (p *Plugin) handleListClients(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Demo endpoint - list protected resources usable as resource indicators
+func (p *Plugin) handleListResources(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"resources": p.mockIdP.ListResources(),
+	})
+}
+
 // issueTokens creates access token and refresh token
-func (p *Plugin) issueTokens(userID, clientID, scope, nonce string) (*models.TokenResponse, error) {
+func (p *Plugin) issueTokens(userID, clientID, scope, nonce string, binding TokenBinding, authTime time.Time, details []map[string]interface{}, resources []string) (*models.TokenResponse, error) {
 	jwtService := p.mockIdP.JWTService()
 
 	// Get user claims
 	scopes := strings.Split(scope, " ")
-	userClaims := p.mockIdP.UserClaims(userID, scopes)
-
-	// Create access token
-	accessToken, err := jwtService.CreateAccessToken(
-		userID,
-		clientID,
-		scope,
-		time.Hour,
-		userClaims,
-	)
+	userClaims := p.mockIdP.UserClaims(userID, scopes, nil)
+
+	// The access token only carries the scopes its audience accepts; the refresh token keeps the full grant
+	tokenScope := p.mockIdP.ResourceScope(resources, scope)
+
+	// Create access token in the client's format, sender-constrained when a DPoP key or client certificate is presented
+	accessToken, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+		Subject:              userID,
+		ClientID:             clientID,
+		Audience:             resources,
+		Scope:                tokenScope,
+		AuthTime:             authTime,
+		AuthorizationDetails: details,
+		Custom:               binding.BoundClaims(userClaims),
+	}, time.Hour)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create refresh token
+	// Create refresh token, naming the user as the client knows them
 	refreshToken, err := jwtService.CreateRefreshToken(
-		userID,
+		p.mockIdP.SubjectIdentifier(clientID, userID),
 		clientID,
 		scope,
 		7*24*time.Hour,
@@ -807,14 +1124,20 @@ func (p *Plugin) issueTokens(userID, clientID, scope, nonce string) (*models.Tok
 	}
 
 	// Store refresh token
-	p.mockIdP.StoreRefreshToken(refreshToken, clientID, userID, scope, time.Now().Add(7*24*time.Hour))
+	p.mockIdP.StoreRefreshToken(refreshToken, clientID, userID, scope, p.mockIdP.AccessTokenJTI(accessToken), authTime, time.Now().Add(7*24*time.Hour))
+
+	// Public clients cannot authenticate, so their refresh tokens are bound to the DPoP key instead
+	if client, exists := p.mockIdP.GetClient(clientID); exists && client.Public && binding.JKT != "" {
+		p.mockIdP.BindRefreshToken(refreshToken, binding.JKT)
+	}
 
 	response := &models.TokenResponse{
-		AccessToken:  accessToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    3600,
-		RefreshToken: refreshToken,
-		Scope:        scope,
+		AccessToken:          accessToken,
+		TokenType:            AccessTokenType(binding.JKT),
+		ExpiresIn:            3600,
+		RefreshToken:         refreshToken,
+		Scope:                tokenScope,
+		AuthorizationDetails: details,
 	}
 
 	return response, nil
@@ -0,0 +1,68 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/plugin"
+)
+
+const testBaseURL = "http://localhost:8080"
+
+// newTestPlugin returns an initialized plugin backed by a provider with the demo users and
+// clients in a memory store
+func newTestPlugin(t *testing.T) *Plugin {
+	t.Helper()
+	keySet, err := crypto.NewKeySet()
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	idp, err := mockidp.NewMockIdP(keySet, mockidp.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewMockIdP: %v", err)
+	}
+	p := NewPlugin()
+	if err := p.Initialize(context.Background(), testPluginConfig(keySet, idp)); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return p
+}
+
+func testPluginConfig(keySet *crypto.KeySet, idp *mockidp.MockIdP) plugin.PluginConfig {
+	return plugin.PluginConfig{BaseURL: testBaseURL, KeySet: keySet, MockIdP: idp}
+}
+
+// postToken sends a token request authenticated with client_secret_basic
+func postToken(p *Plugin, clientID, secret string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(clientID, secret)
+	w := httptest.NewRecorder()
+	p.handleToken(w, r)
+	return w
+}
+
+// decodeJSON decodes a JSON response body
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, w.Body.String())
+	}
+	return body
+}
+
+// expectOAuth2Error fails the test unless the response is the given OAuth 2.0 error
+func expectOAuth2Error(t *testing.T, w *httptest.ResponseRecorder, code string) {
+	t.Helper()
+	if got := decodeJSON(t, w)["error"]; got != code {
+		t.Fatalf("error = %v, want %s (status %d: %s)", got, code, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+package oauth2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+func introspect(p *Plugin, token string) *httptest.ResponseRecorder {
+	form := url.Values{"token": {token}}
+	r := httptest.NewRequest(http.MethodPost, "/oauth2/introspect", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("exchange-client", "exchange-secret")
+	w := httptest.NewRecorder()
+	p.handleIntrospect(w, r)
+	return w
+}
+
+func TestIntrospectionReportsRefreshTokenState(t *testing.T) {
+	p := newTestPlugin(t)
+	token, err := p.mockIdP.JWTService().CreateRefreshToken("alice", "exchange-client", "api:read", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mockIdP.StoreRefreshToken(token, "exchange-client", "alice", "api:read", "", time.Now(), time.Now().Add(time.Hour))
+
+	if active := decodeJSON(t, introspect(p, token))["active"]; active != true {
+		t.Fatalf("active = %v for a live refresh token", active)
+	}
+	p.mockIdP.RevokeRefreshToken(token)
+	if active := decodeJSON(t, introspect(p, token))["active"]; active != false {
+		t.Errorf("active = %v for a revoked refresh token", active)
+	}
+}
+
+func TestIntrospectionRejectsIDTokens(t *testing.T) {
+	p := newTestPlugin(t)
+	idToken, err := p.mockIdP.JWTService().CreateIDToken("alice", "exchange-client", "", time.Now(), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := decodeJSON(t, introspect(p, idToken))["active"]; active != false {
+		t.Errorf("active = %v for an ID token", active)
+	}
+}
+
+func TestCheckAccessTokenActiveRejectsRefreshTokens(t *testing.T) {
+	p := newTestPlugin(t)
+	if err := p.CheckAccessTokenActive(map[string]interface{}{"type": "refresh", "sub": "alice"}); err == nil {
+		t.Error("refresh token claims accepted as an access token")
+	}
+
+	token, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "exchange-client"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.mockIdP.ResolveToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.CheckAccessTokenActive(claims); err != nil {
+		t.Errorf("live access token rejected: %v", err)
+	}
+}
+
+func TestPairwiseClientTokensNameThePairwiseSubject(t *testing.T) {
+	p := newTestPlugin(t)
+	p.mockIdP.StoreRefreshToken("rt-news", "news-app", "alice", "openid profile", "", time.Now(), time.Now().Add(time.Hour))
+	w := postToken(p, "news-app", "news-secret", refreshForm("rt-news", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: status = %d: %s", w.Code, w.Body.String())
+	}
+	body := decodeJSON(t, w)
+	accessToken, _ := body["access_token"].(string)
+	refreshToken, _ := body["refresh_token"].(string)
+
+	if !p.mockIdP.IsReferenceToken(accessToken) {
+		t.Errorf("pairwise client issued a JWT access token: %s", accessToken)
+	}
+	sub := p.mockIdP.SubjectIdentifier("news-app", "alice")
+	refreshClaims, err := p.mockIdP.ResolveRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshClaims["sub"] != sub {
+		t.Errorf("refresh token sub = %v, want the pairwise sub", refreshClaims["sub"])
+	}
+	for name, token := range map[string]string{"access token": accessToken, "refresh token": refreshToken} {
+		if got := decodeJSON(t, introspect(p, token))["sub"]; got != sub {
+			t.Errorf("%s introspected with sub %v, want %s", name, got, sub)
+		}
+	}
+}
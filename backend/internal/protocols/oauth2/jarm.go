@@ -0,0 +1,114 @@
+package oauth2
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ValidateResponseMode checks the response_mode of an authorization request. plain lists the
+// modes without a JWT that the endpoint supports; the JARM modes are always accepted, except
+// query.jwt for response types that return tokens, which must not appear in a query string
+// (JARM Section 2.3.1).
+func ValidateResponseMode(responseMode, responseType string, plain []string) error {
+	if responseMode == "" {
+		return nil
+	}
+	if mockidp.IsJWTResponseMode(responseMode) {
+		if responseMode == mockidp.ResponseModeQueryJWT && responseType != "code" {
+			return errors.New("query.jwt must not be used with response types that return tokens")
+		}
+		return nil
+	}
+	for _, mode := range plain {
+		if mode == responseMode {
+			return nil
+		}
+	}
+	return errors.New("unsupported response_mode " + responseMode)
+}
+
+// jwtResponseDelivery resolves the jwt response mode to query.jwt for the code response type
+// and fragment.jwt for any response type that returns tokens (JARM Section 2.3.4)
+func jwtResponseDelivery(responseMode, responseType string) string {
+	if responseMode != mockidp.ResponseModeJWT {
+		return responseMode
+	}
+	if responseType == "code" {
+		return mockidp.ResponseModeQueryJWT
+	}
+	return mockidp.ResponseModeFragmentJWT
+}
+
+// WriteJWTAuthorizationResponse signs the authorization response parameters as a JWT and
+// returns it to the client's redirect_uri in the single response parameter, using the query,
+// fragment or an auto-submitted form as the JARM response mode selects (JARM Section 2.3).
+func (p *Plugin) WriteJWTAuthorizationResponse(w http.ResponseWriter, r *http.Request, sessionID string, client *models.Client, redirectURI, responseMode, responseType string, params map[string]string) error {
+	response, err := p.mockIdP.CreateAuthorizationResponse(client, params)
+	if err != nil {
+		return err
+	}
+	redirectURL, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+	delivery := jwtResponseDelivery(responseMode, responseType)
+
+	data := map[string]interface{}{
+		"client_id":     client.ID,
+		"response_mode": responseMode,
+		"delivery":      delivery,
+		"redirect_uri":  redirectURI,
+	}
+	if decoded, err := lookingglass.NewDecoder().DecodeJWT(response); err == nil {
+		data["response"] = decoded
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeCryptoOperation, "JWT Authorization Response Issued", data, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "JWT Secured Authorization Response Mode",
+		Description: "The authorization response is signed by the server with the client as its audience and a short expiry. The client verifies it before using the code, which detects responses injected, altered or replayed from another flow.",
+		Reference:   "JARM Section 2.1",
+	})
+
+	switch delivery {
+	case mockidp.ResponseModeFormPostJWT:
+		// The browser POSTs the response, so it never appears in a URL or the Referer header
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(`<!DOCTYPE html>
+<html>
+<head><title>Submitting Authorization Response</title></head>
+<body onload="document.forms[0].submit()">
+    <form method="POST" action="` + html.EscapeString(redirectURL.String()) + `">
+        <input type="hidden" name="response" value="` + html.EscapeString(response) + `">
+        <noscript><button type="submit">Continue</button></noscript>
+    </form>
+</body>
+</html>`))
+		return nil
+	case mockidp.ResponseModeFragmentJWT:
+		redirectURL.Fragment = url.Values{"response": {response}}.Encode()
+	default:
+		q := redirectURL.Query()
+		q.Set("response", response)
+		redirectURL.RawQuery = q.Encode()
+	}
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+	return nil
+}
+
+// WithResponseModeField adds the response_mode to the login form so the submit handler delivers the response with it
+func WithResponseModeField(page, responseMode string) string {
+	if responseMode == "" {
+		return page
+	}
+	field := `<input type="hidden" name="response_mode" value="` + html.EscapeString(responseMode) + `">
+            <input type="hidden" name="client_id"`
+	return strings.Replace(page, `<input type="hidden" name="client_id"`, field, 1)
+}
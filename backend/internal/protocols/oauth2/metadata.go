@@ -0,0 +1,165 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// handleAuthorizationServerMetadata serves the authorization server metadata (RFC 8414 Section 3)
+func (p *Plugin) handleAuthorizationServerMetadata(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	metadata := p.AuthorizationServerMetadata()
+	signed, err := p.SignMetadata(metadata)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error":             "server_error",
+			"error_description": "Failed to sign metadata",
+		})
+		return
+	}
+	metadata.SignedMetadata = signed
+
+	p.emitEvent(sessionID, lookingglass.EventTypeResponseReceived, "Authorization Server Metadata", map[string]interface{}{
+		"issuer":      metadata.Issuer,
+		"grant_types": metadata.GrantTypesSupported,
+		"endpoint":    "/oauth2/.well-known/oauth-authorization-server",
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Signed Metadata",
+		Description: "signed_metadata asserts the same values in a JWT signed with the issuer's key. A client that verifies it and compares iss with the issuer it expected cannot be pointed at an attacker's token endpoint by tampered metadata.",
+		Reference:   "RFC 8414 Section 2.1",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(metadata)
+}
+
+// handleJWKS returns the public keys referenced by jwks_uri
+func (p *Plugin) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(p.keySet.PublicJWKS())
+}
+
+// AuthorizationServerMetadata describes the OAuth 2.0 endpoints from the live configuration, so it
+// cannot drift from the handlers: an endpoint is listed only if its route is mounted, the grant
+// types are those the token endpoint dispatches, and the authentication methods, PKCE methods and
+// algorithms are the lists the validation code enforces.
+func (p *Plugin) AuthorizationServerMetadata() models.AuthorizationServerMetadata {
+	issuer := p.mockIdP.GetIssuer()
+	routes := MountedRoutes(p.routes)
+	endpoint := func(method, path string) string {
+		if !routes[method+" "+path] {
+			return ""
+		}
+		return issuer + "/oauth2" + path
+	}
+
+	metadata := models.AuthorizationServerMetadata{
+		Issuer:                             issuer,
+		AuthorizationEndpoint:              endpoint(http.MethodGet, "/authorize"),
+		TokenEndpoint:                      endpoint(http.MethodPost, "/token"),
+		JwksURI:                            endpoint(http.MethodGet, "/.well-known/jwks.json"),
+		RegistrationEndpoint:               endpoint(http.MethodPost, "/register"),
+		RevocationEndpoint:                 endpoint(http.MethodPost, "/revoke"),
+		IntrospectionEndpoint:              endpoint(http.MethodPost, "/introspect"),
+		DeviceAuthorizationEndpoint:        endpoint(http.MethodPost, "/device_authorization"),
+		PushedAuthorizationRequestEndpoint: endpoint(http.MethodPost, "/par"),
+		ScopesSupported:                    p.mockIdP.SupportedScopes(),
+		// handleAuthorize only issues authorization codes, returned in the query string or as a JARM JWT
+		ResponseTypesSupported:             []string{"code"},
+		ResponseModesSupported:             append([]string{"query"}, mockidp.JWTResponseModes...),
+		GrantTypesSupported:                GrantTypes(p.grantHandlers()),
+		AuthorizationDetailsTypesSupported: p.mockIdP.AuthorizationDetailsTypes(),
+		DPoPSigningAlgValuesSupported:      crypto.DPoPSigningAlgorithms,
+	}
+
+	if metadata.AuthorizationEndpoint != "" {
+		metadata.CodeChallengeMethodsSupported = mockidp.CodeChallengeMethods
+		metadata.RequestParameterSupported = true
+		metadata.RequestURIParameterSupported = true
+		metadata.RequireRequestURIRegistration = true
+		metadata.RequestObjectSigningAlgValuesSupported = mockidp.RequestObjectSigningAlgorithms
+		metadata.RequestObjectEncryptionAlgValuesSupported = crypto.JWEKeyAlgorithms
+		metadata.RequestObjectEncryptionEncValuesSupported = crypto.JWEContentEncryptionAlgorithms
+		metadata.AuthorizationSigningAlgValuesSupported = mockidp.AuthorizationResponseSigningAlgorithms
+	}
+	authMethods := p.clientAuthMethods()
+	if metadata.TokenEndpoint != "" {
+		metadata.TokenEndpointAuthMethodsSupported = authMethods
+		metadata.TokenEndpointAuthSigningAlgValuesSupported = mockidp.ClientAssertionSigningAlgorithms
+	}
+	if metadata.IntrospectionEndpoint != "" {
+		metadata.IntrospectionEndpointAuthMethodsSupported = authMethods
+	}
+	if metadata.RevocationEndpoint != "" {
+		metadata.RevocationEndpointAuthMethodsSupported = authMethods
+	}
+
+	// Certificate-bound tokens and mTLS authentication need the mutual TLS listener
+	metadata.TLSClientCertificateBoundAccessTokens = p.mtlsBaseURL != ""
+	metadata.MTLSEndpointAliases = p.MTLSEndpointAliases(metadata)
+	return metadata
+}
+
+// clientAuthMethods returns the client authentication methods usable with the current listeners
+func (p *Plugin) clientAuthMethods() []string {
+	if p.mtlsBaseURL != "" {
+		return mockidp.SupportedClientAuthMethods
+	}
+	methods := make([]string, 0, len(mockidp.SupportedClientAuthMethods))
+	for _, method := range mockidp.SupportedClientAuthMethods {
+		if !mockidp.IsMTLSAuthMethod(method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// SignMetadata returns the signed_metadata JWT for a metadata document (RFC 8414 Section 2.1).
+// The claims are the document's own JSON members, so both always carry the same values.
+func (p *Plugin) SignMetadata(metadata interface{}) (string, error) {
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", err
+	}
+	delete(claims, "signed_metadata")
+	return p.mockIdP.JWTService().SignMetadata(claims)
+}
+
+// MountedRoutes returns the "METHOD /pattern" of every route registered on a plugin router
+func MountedRoutes(routes chi.Routes) map[string]bool {
+	mounted := make(map[string]bool)
+	if routes == nil {
+		return mounted
+	}
+	chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		mounted[method+" "+route] = true
+		return nil
+	})
+	return mounted
+}
+
+// GrantTypes returns the grant types of a token endpoint dispatch table, sorted
+func GrantTypes[H any](handlers map[string]H) []string {
+	grantTypes := make([]string, 0, len(handlers))
+	for grantType := range handlers {
+		grantTypes = append(grantTypes, grantType)
+	}
+	sort.Strings(grantTypes)
+	return grantTypes
+}
@@ -0,0 +1,38 @@
+package oauth2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+func TestSignedMetadataIsTypedAndExpires(t *testing.T) {
+	p := newTestPlugin(t)
+	signed, err := p.SignMetadata(map[string]interface{}{
+		"issuer":         p.mockIdP.GetIssuer(),
+		"token_endpoint": testBaseURL + "/oauth2/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := crypto.DecodeTokenWithoutValidation(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := decoded.Header["typ"]; typ != crypto.MetadataType {
+		t.Errorf("typ = %v, want %s", typ, crypto.MetadataType)
+	}
+	exp, ok := decoded.Payload["exp"].(float64)
+	if !ok {
+		t.Fatal("signed_metadata has no exp")
+	}
+	if lifetime := time.Until(time.Unix(int64(exp), 0)); lifetime <= 0 || lifetime > crypto.MetadataLifetime {
+		t.Errorf("exp is %v from now", lifetime)
+	}
+
+	if _, err := p.mockIdP.ResolveToken(signed); err == nil {
+		t.Error("signed_metadata resolved as an access token")
+	}
+}
@@ -0,0 +1,355 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ClientCertificateVerifier verifies a client certificate chain presented over mutual TLS.
+// crypto.TestCA and the SPIFFE workload client satisfy this interface.
+type ClientCertificateVerifier interface {
+	VerifyClientCertificate(chain []*x509.Certificate) error
+}
+
+// EnableMTLS advertises the mutual TLS listener at baseURL and trusts client certificates
+// issued by ca, which also issues the demo client certificates
+func (p *Plugin) EnableMTLS(baseURL string, ca *crypto.TestCA) {
+	p.mtlsBaseURL = baseURL
+	p.testCA = ca
+	p.TrustClientCertificates(ca)
+}
+
+// MTLSBaseURL returns the base URL of the mutual TLS listener, or "" when mTLS is disabled
+func (p *Plugin) MTLSBaseURL() string {
+	return p.mtlsBaseURL
+}
+
+// TrustClientCertificates adds a trust anchor for tls_client_auth client certificates
+func (p *Plugin) TrustClientCertificates(v ClientCertificateVerifier) {
+	p.certVerifiers = append(p.certVerifiers, v)
+}
+
+// ClientCertificate returns the leaf certificate the client presented in the TLS handshake, or nil
+func ClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+type certificateBindingKey struct{}
+
+// WithCertificateBinding returns a request carrying the thumbprint of the client's mTLS certificate
+func WithCertificateBinding(r *http.Request, x5t string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), certificateBindingKey{}, x5t))
+}
+
+// CertificateBinding returns the certificate thumbprint issued tokens are bound to, or ""
+func CertificateBinding(r *http.Request) string {
+	x5t, _ := r.Context().Value(certificateBindingKey{}).(string)
+	return x5t
+}
+
+// BindClientCertificate binds the tokens of a token request to the client's certificate when
+// the client is registered for certificate-bound access tokens (RFC 8705 Section 3.4)
+func (p *Plugin) BindClientCertificate(r *http.Request) *http.Request {
+	cert := ClientCertificate(r)
+	if cert == nil {
+		return r
+	}
+	client, exists := p.mockIdP.GetClient(RequestClientID(r))
+	if !exists || !client.TLSClientCertificateBoundAccessTokens {
+		return r
+	}
+	return WithCertificateBinding(r, crypto.CertificateThumbprint(cert))
+}
+
+// TokenBinding identifies the keys an issued token is sender-constrained to
+type TokenBinding struct {
+	JKT     string // DPoP proof key thumbprint, cnf.jkt (RFC 9449)
+	X5TS256 string // mutual TLS client certificate thumbprint, cnf.x5t#S256 (RFC 8705)
+}
+
+// RequestTokenBinding returns the bindings established for a token request
+func RequestTokenBinding(r *http.Request) TokenBinding {
+	return TokenBinding{JKT: DPoPBinding(r), X5TS256: CertificateBinding(r)}
+}
+
+// BoundClaims returns a copy of claims with a cnf confirmation for each binding
+func (b TokenBinding) BoundClaims(claims map[string]interface{}) map[string]interface{} {
+	if b.JKT == "" && b.X5TS256 == "" {
+		return claims
+	}
+	bound := make(map[string]interface{}, len(claims)+1)
+	for k, v := range claims {
+		bound[k] = v
+	}
+	bound["cnf"] = b.Confirmation()
+	return bound
+}
+
+// Confirmation returns the cnf claim value for the binding, or nil when the token is a plain bearer token
+func (b TokenBinding) Confirmation() map[string]interface{} {
+	if b.JKT == "" && b.X5TS256 == "" {
+		return nil
+	}
+	cnf := make(map[string]interface{})
+	if b.JKT != "" {
+		cnf["jkt"] = b.JKT
+	}
+	if b.X5TS256 != "" {
+		cnf["x5t#S256"] = b.X5TS256
+	}
+	return cnf
+}
+
+// TokenCertificateThumbprint returns the cnf.x5t#S256 claim of a validated access token
+func TokenCertificateThumbprint(claims map[string]interface{}) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	x5t, _ := cnf["x5t#S256"].(string)
+	return x5t
+}
+
+// authenticateTLSClient authenticates a tls_client_auth or self_signed_tls_client_auth client
+// from the certificate it presented to the mTLS listener (RFC 8705 Section 2)
+func (p *Plugin) authenticateTLSClient(r *http.Request, sessionID, clientID string) (*models.Client, error) {
+	cert := ClientCertificate(r)
+
+	var err error
+	var client *models.Client
+	switch {
+	case r.FormValue("client_secret") != "" || r.FormValue("client_assertion") != "":
+		err = errors.New("only one client authentication method may be used")
+	case cert == nil:
+		err = errors.New("client must present its certificate to the mutual TLS endpoint")
+	default:
+		client, err = p.mockIdP.ValidateClientCertificate(clientID, cert, p.verifyClientCertificate(r.TLS.PeerCertificates))
+	}
+
+	data := map[string]interface{}{
+		"client_id": clientID,
+	}
+	if cert != nil {
+		data["subject"] = cert.Subject.String()
+		data["issuer"] = cert.Issuer.String()
+		data["san_dns"] = cert.DNSNames
+		uris := make([]string, 0, len(cert.URIs))
+		for _, uri := range cert.URIs {
+			uris = append(uris, uri.String())
+		}
+		data["san_uri"] = uris
+		data["x5t#S256"] = crypto.CertificateThumbprint(cert)
+	}
+
+	if err != nil {
+		data["error"] = err.Error()
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Certificate Rejected", data, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Mutual TLS Client Authentication Failed",
+			Description: "tls_client_auth certificates must chain to a trusted CA and carry the registered subject DN or SAN. self_signed_tls_client_auth certificates must hold one of the client's registered public keys.",
+			Severity:    "warning",
+			Reference:   "RFC 8705 Section 2",
+		})
+		return nil, err
+	}
+
+	data["auth_method"] = client.TokenEndpointAuthMethod
+	description := "The client proved possession of the private key for a certificate from a trusted CA whose subject matches its registration. No secret is sent, and the TLS handshake cannot be replayed."
+	if client.TokenEndpointAuthMethod == mockidp.AuthMethodSelfSignedTLSClientAuth {
+		description = "The client presented a self-signed certificate whose public key is one of its registered keys. No CA is involved; the registration itself pins the key."
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeCryptoOperation, "Client Certificate Verified", data, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Mutual TLS Client Authentication (" + client.TokenEndpointAuthMethod + ")",
+		Description: description,
+		Reference:   "RFC 8705 Section 2",
+	})
+	return client, nil
+}
+
+// verifyClientCertificate reports whether any trust anchor accepts a presented certificate chain
+func (p *Plugin) verifyClientCertificate(chain []*x509.Certificate) bool {
+	for _, verifier := range p.certVerifiers {
+		if verifier.VerifyClientCertificate(chain) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyCertificateBinding checks that a certificate-bound access token is presented over mutual
+// TLS with the certificate it is bound to (RFC 8705 Section 3). Tokens without cnf.x5t#S256 pass.
+func (p *Plugin) VerifyCertificateBinding(r *http.Request, sessionID string, claims map[string]interface{}) error {
+	tokenX5T := TokenCertificateThumbprint(claims)
+	if tokenX5T == "" {
+		return nil
+	}
+
+	presentedX5T := ""
+	if cert := ClientCertificate(r); cert != nil {
+		presentedX5T = crypto.CertificateThumbprint(cert)
+	}
+	if presentedX5T != tokenX5T {
+		reason := "client certificate does not match the token's cnf.x5t#S256"
+		if presentedX5T == "" {
+			reason = "certificate-bound token presented without a client certificate"
+		}
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Certificate Binding Check Failed", map[string]interface{}{
+			"token_x5t#S256":     tokenX5T,
+			"presented_x5t#S256": presentedX5T,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeVulnerability,
+			Title:       "Sender Constraint Enforced",
+			Description: reason + ". Without this check a stolen certificate-bound token could be replayed by anyone.",
+			Severity:    "warning",
+			Reference:   "RFC 8705 Section 3",
+		})
+		return errors.New(reason)
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeTokenValidated, "Certificate Token Binding Verified", map[string]interface{}{
+		"x5t#S256": tokenX5T,
+	})
+	return nil
+}
+
+// MTLSEndpointAliases returns the mutual TLS aliases of the back-channel endpoints in metadata,
+// or nil when no mTLS listener is configured (RFC 8705 Section 5)
+func (p *Plugin) MTLSEndpointAliases(metadata models.AuthorizationServerMetadata) map[string]string {
+	if p.mtlsBaseURL == "" {
+		return nil
+	}
+	issuer := p.mockIdP.GetIssuer()
+	aliases := make(map[string]string)
+	for name, endpoint := range map[string]string{
+		"token_endpoint":                        metadata.TokenEndpoint,
+		"revocation_endpoint":                   metadata.RevocationEndpoint,
+		"introspection_endpoint":                metadata.IntrospectionEndpoint,
+		"device_authorization_endpoint":         metadata.DeviceAuthorizationEndpoint,
+		"pushed_authorization_request_endpoint": metadata.PushedAuthorizationRequestEndpoint,
+		"registration_endpoint":                 metadata.RegistrationEndpoint,
+	} {
+		if endpoint != "" {
+			aliases[name] = p.mtlsBaseURL + strings.TrimPrefix(endpoint, issuer)
+		}
+	}
+	return aliases
+}
+
+// handleIssueClientCertificate issues a test CA certificate carrying a client's registered
+// tls_client_auth identity, so the mutual TLS flow can be tried without a PKI. The certificate
+// authenticates as the client, so the caller must own it: see mayIssueCertificate.
+func (p *Plugin) handleIssueClientCertificate(w http.ResponseWriter, r *http.Request) {
+	if p.testCA == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error":             "not_found",
+			"error_description": "Mutual TLS is not enabled; set SHOWCASE_MTLS_LISTEN_ADDR",
+		})
+		return
+	}
+
+	var req struct {
+		ClientID string `json:"client_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOAuth2Error(w, "invalid_request", "Request body must be a JSON object", "")
+		return
+	}
+	client, exists := p.mockIdP.GetClient(req.ClientID)
+	if !exists || client.TokenEndpointAuthMethod != mockidp.AuthMethodTLSClientAuth {
+		writeOAuth2Error(w, "invalid_request", "client_id must identify a tls_client_auth client", "")
+		return
+	}
+	if !p.mayIssueCertificate(r, client.ID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error":             "invalid_token",
+			"error_description": "A client certificate requires the client's registration access token or the admin token",
+		})
+		return
+	}
+
+	subject := pkix.Name{CommonName: client.ID}
+	var dnsNames []string
+	var uris []*url.URL
+	switch {
+	case client.TLSClientAuthSubjectDN != "":
+		subject = parseSubjectDN(client.TLSClientAuthSubjectDN)
+	case client.TLSClientAuthSANDNS != "":
+		dnsNames = []string{client.TLSClientAuthSANDNS}
+	case client.TLSClientAuthSANURI != "":
+		uri, err := url.Parse(client.TLSClientAuthSANURI)
+		if err != nil {
+			writeOAuth2Error(w, "invalid_request", "Registered tls_client_auth_san_uri is not a URI", "")
+			return
+		}
+		uris = []*url.URL{uri}
+	}
+
+	certPEM, keyPEM, err := p.testCA.IssueClientCertificate(subject, dnsNames, uris)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"client_id":         client.ID,
+		"certificate":       string(certPEM),
+		"private_key":       string(keyPEM),
+		"ca_certificate":    string(p.testCA.CertificatePEM()),
+		"token_endpoint":    p.mtlsBaseURL + "/oauth2/token",
+		"userinfo_endpoint": p.mtlsBaseURL + "/oidc/userinfo",
+	})
+}
+
+// mayIssueCertificate reports whether the request's bearer token is the registration access
+// token of the client (RFC 7592 Section 3), held by whoever registered it, or the admin token
+func (p *Plugin) mayIssueCertificate(r *http.Request, clientID string) bool {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "bearer") || token == "" {
+		return false
+	}
+	if p.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.adminToken)) == 1 {
+		return true
+	}
+	_, ok := p.mockIdP.AuthenticateRegistrationAccess(clientID, token)
+	return ok
+}
+
+// parseSubjectDN parses a comma-separated RFC 4514 distinguished name without escaped characters
+func parseSubjectDN(dn string) pkix.Name {
+	var name pkix.Name
+	for _, rdn := range strings.Split(dn, ",") {
+		attr, value, ok := strings.Cut(strings.TrimSpace(rdn), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(attr) {
+		case "CN":
+			name.CommonName = value
+		case "O":
+			name.Organization = append(name.Organization, value)
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, value)
+		case "L":
+			name.Locality = append(name.Locality, value)
+		case "ST":
+			name.Province = append(name.Province, value)
+		case "C":
+			name.Country = append(name.Country, value)
+		}
+	}
+	return name
+}
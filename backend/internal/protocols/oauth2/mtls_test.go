@@ -0,0 +1,67 @@
+package oauth2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+func registerTLSClient(t *testing.T, p *Plugin, dnsName string) *models.Client {
+	t.Helper()
+	client, err := p.mockIdP.RegisterClient(&models.ClientMetadata{
+		ClientName:              "mTLS " + dnsName,
+		GrantTypes:              []string{"client_credentials"},
+		ResponseTypes:           []string{},
+		TokenEndpointAuthMethod: mockidp.AuthMethodTLSClientAuth,
+		TLSClientAuthSANDNS:     dnsName,
+	})
+	if err != nil {
+		t.Fatalf("RegisterClient: %v", err)
+	}
+	return client
+}
+
+func TestClientCertificateRequiresOwnership(t *testing.T) {
+	p := newTestPlugin(t)
+	ca, err := crypto.NewTestCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.EnableMTLS("https://localhost:8443", ca)
+	p.adminToken = "admin-secret"
+	mine := registerTLSClient(t, p, "mine.example")
+	other := registerTLSClient(t, p, "other.example")
+
+	issue := func(clientID, token string) int {
+		r := httptest.NewRequest(http.MethodPost, "/oauth2/demo/client-certificate", strings.NewReader(`{"client_id":"`+clientID+`"}`))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		p.handleIssueClientCertificate(w, r)
+		return w.Code
+	}
+
+	cases := []struct {
+		name     string
+		clientID string
+		token    string
+		want     int
+	}{
+		{"anonymous", mine.ID, "", http.StatusUnauthorized},
+		{"another client's token", mine.ID, other.RegistrationAccessToken, http.StatusUnauthorized},
+		{"own registration token", mine.ID, mine.RegistrationAccessToken, http.StatusOK},
+		{"built-in client without admin", "mtls-client", mine.RegistrationAccessToken, http.StatusUnauthorized},
+		{"built-in client as admin", "mtls-client", "admin-secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		if got := issue(c.clientID, c.token); got != c.want {
+			t.Errorf("%s: status = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
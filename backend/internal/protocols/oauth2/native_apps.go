@@ -0,0 +1,75 @@
+package oauth2
+
+import (
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// nativeRedirectAnnotations explain each kind of native app redirect URI (RFC 8252 Section 7)
+var nativeRedirectAnnotations = map[string]lookingglass.Annotation{
+	mockidp.RedirectKindLoopback: {
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Loopback Interface Redirection",
+		Description: "The app listens on an ephemeral port of a loopback IP address and receives the code there. The port is chosen at request time, so the server accepts any port for a registered loopback redirect URI.",
+		Reference:   "RFC 8252 Section 7.3",
+	},
+	mockidp.RedirectKindPrivateUse: {
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Private-Use URI Scheme Redirection",
+		Description: "The operating system hands the redirect to the app that claimed this reverse domain name scheme. Another app could claim the same scheme, so PKCE is what keeps an intercepted code useless.",
+		Reference:   "RFC 8252 Section 7.1",
+	},
+	mockidp.RedirectKindClaimedHTTPS: {
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Claimed HTTPS Scheme Redirection",
+		Description: "The operating system opens this https URI in the app that proved ownership of the domain, the most secure redirect option for native apps",
+		Reference:   "RFC 8252 Section 7.2",
+	},
+}
+
+// CheckNativeAppRequest applies the native app rules to an authorization request. For clients
+// registered with application_type native it reports which redirect mechanism is in use and
+// rejects requests without S256 PKCE, since the redirect alone cannot guarantee the code
+// reaches the right app (RFC 8252 Section 8.1). Other clients pass unchecked.
+func (p *Plugin) CheckNativeAppRequest(sessionID string, client *models.Client, redirectURI, responseType, codeChallenge, codeChallengeMethod string) error {
+	if !mockidp.IsNativeClient(client) {
+		return nil
+	}
+
+	if err := mockidp.ValidateNativeAuthorizationRequest(client, responseType, codeChallenge, codeChallengeMethod); err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Native App Request Rejected", map[string]interface{}{
+			"error":                 "invalid_request",
+			"client_id":             client.ID,
+			"response_type":         responseType,
+			"code_challenge":        codeChallenge != "",
+			"code_challenge_method": codeChallengeMethod,
+			"reason":                err.Error(),
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "PKCE Required for Native Apps",
+			Description: "Native apps cannot keep a secret and their redirects can be intercepted by other apps on the device, so the authorization server requires the code flow with S256 PKCE",
+			Severity:    "warning",
+			Reference:   "RFC 8252 Section 8.1",
+		})
+		return err
+	}
+
+	kind := mockidp.RedirectURIKind(redirectURI)
+	annotation, ok := nativeRedirectAnnotations[kind]
+	if !ok {
+		annotation = lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Native App Redirect",
+			Description: "The redirect URI matched one the native app registered",
+			Reference:   "RFC 8252 Section 7",
+		}
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Native App Redirect", map[string]interface{}{
+		"client_id":     client.ID,
+		"redirect_uri":  redirectURI,
+		"redirect_kind": kind,
+		"pkce":          codeChallengeMethod,
+	}, annotation)
+	return nil
+}
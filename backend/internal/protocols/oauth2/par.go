@@ -0,0 +1,198 @@
+package oauth2
+
+import (
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// PARValidator performs protocol-specific validation of pushed authorization parameters.
+// It returns an OAuth 2.0 error code and description, or empty strings if the request is acceptable.
+type PARValidator func(client *models.Client, params map[string]string) (errorCode, description string)
+
+// handlePushedAuthorizationRequest handles the OAuth 2.0 PAR endpoint
+func (p *Plugin) handlePushedAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
+	p.HandlePushedAuthorizationRequest(w, r, func(client *models.Client, params map[string]string) (string, string) {
+		if params["response_type"] != "code" {
+			return "unsupported_response_type", "Only 'code' response type is supported"
+		}
+		return "", ""
+	})
+}
+
+// HandlePushedAuthorizationRequest implements the PAR endpoint (RFC 9126 Section 2). The client
+// authenticates and pushes its authorization parameters over the back channel, receiving a
+// short-lived request_uri to use at the authorization endpoint. The OIDC plugin reuses this
+// with its own parameter validation.
+func (p *Plugin) HandlePushedAuthorizationRequest(w http.ResponseWriter, r *http.Request, validate PARValidator) {
+	sessionID := p.getSessionFromRequest(r)
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuth2Error(w, "invalid_request", "Invalid form data", "")
+		return
+	}
+
+	clientID := RequestClientID(r)
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Pushed Authorization Request", map[string]interface{}{
+		"step":          1,
+		"from":          "Client",
+		"to":            "Authorization Server",
+		"channel":       "back-channel",
+		"client_id":     clientID,
+		"response_type": r.PostForm.Get("response_type"),
+		"redirect_uri":  r.PostForm.Get("redirect_uri"),
+		"scope":         r.PostForm.Get("scope"),
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Pushed Authorization Request",
+		Description: "The client sends its authorization parameters directly to the server over an authenticated TLS connection instead of through the browser",
+		Reference:   "RFC 9126 Section 2.1",
+	})
+
+	// Confidential clients authenticate exactly as they would at the token endpoint
+	client, exists := p.mockIdP.GetClient(clientID)
+	if exists && !client.Public {
+		client, exists = nil, false
+		if c, err := p.AuthenticateClient(r, sessionID); err == nil {
+			client, exists = c, true
+		}
+	}
+	if !exists {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
+			"client_id": clientID,
+		})
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error":             "invalid_client",
+			"error_description": "Client authentication failed",
+		})
+		return
+	}
+
+	if r.PostForm.Get("request_uri") != "" {
+		writeOAuth2Error(w, "invalid_request", "request_uri must not be provided at the PAR endpoint", "")
+		return
+	}
+
+	// A pushed request object replaces the plain parameters it contains (RFC 9126 Section 3)
+	requestObject, roErr := p.ApplyRequestObject(sessionID, clientID, r.PostForm)
+	if roErr != nil {
+		writeOAuth2Error(w, roErr.Code, roErr.Description, "")
+		return
+	}
+	// Its parameters now live behind the request_uri, so the request object cannot be pushed again
+	if requestObject != "" {
+		if err := p.mockIdP.ConsumeRequestObject(clientID, requestObject); err != nil {
+			writeOAuth2Error(w, mockidp.ErrorInvalidRequestObject, err.Error(), "")
+			return
+		}
+	}
+
+	params := make(map[string]string)
+	for key := range r.PostForm {
+		switch key {
+		case "client_secret", "client_assertion", "client_assertion_type":
+			continue
+		case "resource":
+			// resource may repeat; URIs cannot contain spaces
+			params[key] = strings.Join(r.PostForm[key], " ")
+			continue
+		}
+		params[key] = r.PostForm.Get(key)
+	}
+	params["client_id"] = clientID
+
+	if !p.mockIdP.ValidateRedirectURI(clientID, params["redirect_uri"]) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid Redirect URI", map[string]interface{}{
+			"redirect_uri": params["redirect_uri"],
+		})
+		writeOAuth2Error(w, "invalid_request", "Invalid redirect_uri", "")
+		return
+	}
+
+	if err := p.CheckNativeAppRequest(sessionID, client, params["redirect_uri"], params["response_type"], params["code_challenge"], params["code_challenge_method"]); err != nil {
+		writeOAuth2Error(w, "invalid_request", err.Error(), "")
+		return
+	}
+
+	if err := p.ValidateResources(sessionID, strings.Fields(params["resource"])); err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidTarget, err.Error(), "")
+		return
+	}
+
+	if _, err := p.ParseAuthorizationDetails(sessionID, clientID, params["authorization_details"]); err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidAuthorizationDetails, err.Error(), "")
+		return
+	}
+
+	if errorCode, description := validate(client, params); errorCode != "" {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Pushed Request Rejected", map[string]interface{}{
+			"error":             errorCode,
+			"error_description": description,
+		})
+		writeOAuth2Error(w, errorCode, description, "")
+		return
+	}
+
+	par := p.mockIdP.CreatePushedAuthorizationRequest(clientID, params)
+	expiresIn := int(par.ExpiresAt.Sub(par.CreatedAt).Seconds())
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Request URI Issued", map[string]interface{}{
+		"step":        2,
+		"from":        "Authorization Server",
+		"to":          "Client",
+		"request_uri": par.RequestURI,
+		"expires_in":  expiresIn,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Integrity and Confidentiality of Authorization Parameters",
+		Description: "The browser now carries only client_id and an opaque, single-use request_uri. Scopes, redirect_uri and PKCE challenges cannot be read or tampered with in the front channel.",
+		Reference:   "RFC 9126 Section 1",
+	})
+
+	writeJSON(w, http.StatusCreated, models.PushedAuthorizationResponse{
+		RequestURI: par.RequestURI,
+		ExpiresIn:  expiresIn,
+	})
+}
+
+// EmitPARRequired reports an authorization request rejected because the client must use PAR
+func (p *Plugin) EmitPARRequired(sessionID, clientID string) {
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Pushed Authorization Request Required", map[string]interface{}{
+		"client_id": clientID,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeSecurityHint,
+		Title:       "Front-Channel Request Rejected",
+		Description: "This client is registered with require_pushed_authorization_requests, so authorization parameters sent through the browser are refused",
+		Severity:    "warning",
+		Reference:   "RFC 9126 Section 6",
+	})
+}
+
+// emitPARResolved reports that the authorization endpoint loaded parameters from a pushed request
+func (p *Plugin) emitPARResolved(sessionID string, par *models.PushedAuthorizationRequest) {
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Pushed Authorization Request Resolved", map[string]interface{}{
+		"request_uri": par.RequestURI,
+		"client_id":   par.ClientID,
+		"scope":       par.Parameters["scope"],
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Parameters Loaded from request_uri",
+		Description: "Only the parameters pushed over the back channel are used; any other query parameters in the browser request are ignored",
+		Reference:   "RFC 9126 Section 4",
+	})
+}
+
+// WithRequestURIField adds the request_uri to the login form so the pushed request can be consumed on submit
+func WithRequestURIField(page, requestURI string) string {
+	if requestURI == "" {
+		return page
+	}
+	field := `<input type="hidden" name="request_uri" value="` + html.EscapeString(requestURI) + `">
+            <input type="hidden" name="client_id"`
+	return strings.Replace(page, `<input type="hidden" name="client_id"`, field, 1)
+}
@@ -0,0 +1,22 @@
+package oauth2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithRequestURIField(t *testing.T) {
+	page := `<form><input type="hidden" name="client_id" value="demo-app"></form>`
+
+	if got := WithRequestURIField(page, ""); got != page {
+		t.Errorf("page changed without a request_uri: %s", got)
+	}
+
+	got := WithRequestURIField(page, `urn:ietf:params:oauth:request_uri:"><script>`)
+	if !strings.Contains(got, `name="request_uri" value="urn:ietf:params:oauth:request_uri:&#34;&gt;&lt;script&gt;"`) {
+		t.Errorf("request_uri field missing or not escaped: %s", got)
+	}
+	if !strings.Contains(got, `name="client_id" value="demo-app"`) {
+		t.Errorf("client_id field lost: %s", got)
+	}
+}
@@ -2,6 +2,7 @@ package oauth2
 
 import (
 	"context"
+	"os"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/ParleSec/ProtocolSoup/internal/crypto"
@@ -13,10 +14,22 @@ import (
 // Plugin implements the OAuth 2.0 protocol plugin
 type Plugin struct {
 	*plugin.BasePlugin
-	mockIdP      *mockidp.MockIdP
-	keySet       *crypto.KeySet
-	lookingGlass *lookingglass.Engine
-	baseURL      string
+	mockIdP       *mockidp.MockIdP
+	keySet        *crypto.KeySet
+	lookingGlass  *lookingglass.Engine
+	baseURL       string
+	svidValidator JWTSVIDValidator      // nil means JWT-SVID subject tokens are rejected
+	samlVerifier  SAMLAssertionVerifier // nil means SAML assertion subject tokens are rejected
+	routes        chi.Routes            // mounted routes, from which the server metadata is derived
+
+	// Mutual TLS (RFC 8705): the listener's base URL, the CA issuing demo client
+	// certificates and the trust anchors for tls_client_auth
+	mtlsBaseURL   string
+	testCA        *crypto.TestCA
+	certVerifiers []ClientCertificateVerifier
+
+	// adminToken authenticates callers of the admin API; empty disables it
+	adminToken string
 }
 
 // NewPlugin creates a new OAuth 2.0 plugin
@@ -27,8 +40,8 @@ func NewPlugin() *Plugin {
 			Name:        "OAuth 2.0",
 			Version:     "1.0.0",
 			Description: "OAuth 2.0 Authorization Framework implementation with PKCE support",
-			Tags:        []string{"authorization", "tokens", "pkce"},
-			RFCs:        []string{"RFC 6749", "RFC 7636", "RFC 7009", "RFC 7662"},
+			Tags:        []string{"authorization", "tokens", "pkce", "device", "token-exchange", "par", "dpop", "client-authentication", "registration", "jwt-access-token", "rar", "resource-indicators", "metadata", "mtls"},
+			RFCs:        []string{"RFC 6749", "RFC 7636", "RFC 7009", "RFC 7662", "RFC 8628", "RFC 8693", "RFC 9126", "RFC 9449", "RFC 7523", "RFC 7591", "RFC 7592", "RFC 9068", "RFC 9396", "RFC 8707", "RFC 8414", "RFC 8705"},
 		}),
 	}
 }
@@ -50,6 +63,8 @@ func (p *Plugin) Initialize(ctx context.Context, config plugin.PluginConfig) err
 		p.lookingGlass = lg
 	}
 
+	p.adminToken = os.Getenv(adminTokenEnv)
+
 	return nil
 }
 
@@ -60,6 +75,12 @@ func (p *Plugin) Shutdown(ctx context.Context) error {
 
 // RegisterRoutes registers the plugin's HTTP routes
 func (p *Plugin) RegisterRoutes(router chi.Router) {
+	p.routes = router
+
+	// Authorization server metadata (RFC 8414)
+	router.Get("/.well-known/oauth-authorization-server", p.handleAuthorizationServerMetadata)
+	router.Get("/.well-known/jwks.json", p.handleJWKS)
+
 	// Authorization endpoint
 	router.Get("/authorize", p.handleAuthorize)
 	router.Post("/authorize", p.handleAuthorizeSubmit)
@@ -73,9 +94,29 @@ func (p *Plugin) RegisterRoutes(router chi.Router) {
 	// Token revocation (RFC 7009)
 	router.Post("/revoke", p.handleRevoke)
 
+	// Pushed authorization requests (RFC 9126)
+	router.Post("/par", p.handlePushedAuthorizationRequest)
+
+	// Device authorization grant (RFC 8628)
+	router.Post("/device_authorization", p.handleDeviceAuthorization)
+	router.Get("/device", p.handleDeviceVerification)
+	router.Post("/device", p.handleDeviceVerificationSubmit)
+
+	// Dynamic client registration and management (RFC 7591, RFC 7592)
+	router.Post("/register", p.handleRegister)
+	router.Get("/register/{client_id}", p.handleGetRegistration)
+	router.Put("/register/{client_id}", p.handleUpdateRegistration)
+	router.Delete("/register/{client_id}", p.handleDeleteRegistration)
+
 	// Demo/utility endpoints
 	router.Get("/demo/users", p.handleListUsers)
 	router.Get("/demo/clients", p.handleListClients)
+	router.Get("/demo/resources", p.handleListResources)
+	router.Post("/demo/software-statement", p.handleCreateSoftwareStatement)
+	router.Post("/demo/client-certificate", p.handleIssueClientCertificate)
+
+	// Admin API for managing the mock IdP's users and clients
+	router.Route("/admin", p.adminRoutes)
 }
 
 // GetInspectors returns the protocol's inspectors
@@ -298,11 +339,585 @@ func (p *Plugin) GetFlowDefinitions() []plugin.FlowDefinition {
 				{
 					Order:       2,
 					Name:        "Token Response",
-					Description: "Server returns new access token (and optionally new refresh token)",
+					Description: "Server returns new access token and a rotated refresh token in the same family",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Security:    []string{"Implement refresh token rotation", "The previous refresh token is retired but remembered"},
+				},
+				{
+					Order:       3,
+					Name:        "Reuse Detection",
+					Description: "Presenting a rotated refresh token again revokes the whole token family and the access tokens issued with it",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Parameters: map[string]string{
+						"error": "invalid_grant",
+					},
+					Security: []string{"Detects theft when attacker and client both hold the same refresh token", "User must re-authenticate"},
+				},
+			},
+		},
+		{
+			ID:          "device_code",
+			Name:        "Device Authorization Grant",
+			Description: "Authorization for input-constrained devices such as smart TVs and CLIs, completed by the user on a second device",
+			Executable:  true,
+			Category:    "authorization",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Device Authorization Request",
+					Description: "Device requests a device code and user code",
+					From:        "Device",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"client_id": "required",
+						"scope":     "optional",
+					},
+				},
+				{
+					Order:       2,
+					Name:        "Device Authorization Response",
+					Description: "Server returns device_code, user_code and verification URI",
+					From:        "Authorization Server",
+					To:          "Device",
+					Type:        "response",
+					Parameters: map[string]string{
+						"device_code":               "secret polling handle",
+						"user_code":                 "short code shown to the user",
+						"verification_uri":          "where the user enters the code",
+						"verification_uri_complete": "optional, includes the user code",
+						"interval":                  "minimum seconds between polls",
+					},
+				},
+				{
+					Order:       3,
+					Name:        "User Verification",
+					Description: "User visits the verification URI on another device, enters the code and authenticates",
+					From:        "User",
+					To:          "Authorization Server",
+					Type:        "internal",
+					Security:    []string{"User codes must expire quickly and verification attempts should be rate limited"},
+				},
+				{
+					Order:       4,
+					Name:        "Token Polling",
+					Description: "Device polls the token endpoint until the user completes verification",
+					From:        "Device",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"grant_type":  GrantTypeDeviceCode,
+						"device_code": "from step 2",
+						"client_id":   "required",
+					},
+					Security: []string{"Respect the interval; slow_down adds 5 seconds", "Stop polling on access_denied or expired_token"},
+				},
+				{
+					Order:       5,
+					Name:        "Token Response",
+					Description: "Once approved, the server returns tokens to the device",
+					From:        "Authorization Server",
+					To:          "Device",
+					Type:        "response",
+				},
+			},
+		},
+		{
+			ID:          "token_exchange",
+			Name:        "Token Exchange",
+			Description: "Exchange a subject token (and optionally an actor token) for a new token with a different audience or narrower scope",
+			Executable:  true,
+			Category:    "delegation",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Token Exchange Request",
+					Description: "Client presents the token it holds and describes the token it wants",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"grant_type":           GrantTypeTokenExchange,
+						"subject_token":        "required",
+						"subject_token_type":   "required (access_token, id_token, jwt or saml2)",
+						"actor_token":          "optional, for delegation",
+						"actor_token_type":     "required if actor_token is present",
+						"requested_token_type": "optional",
+						"audience":             "optional, target service",
+						"resource":             "optional, target URI",
+						"scope":                "optional, must not exceed subject token scope",
+					},
+					Security: []string{"Authenticate the client", "Validate subject and actor tokens against their issuer"},
+				},
+				{
+					Order:       2,
+					Name:        "Token Validation",
+					Description: "Server validates the subject and actor tokens and checks any may_act restriction",
+					From:        "Authorization Server",
+					To:          "Authorization Server",
+					Type:        "internal",
+					Security:    []string{"Never issue a token with broader scope than the subject token"},
+				},
+				{
+					Order:       3,
+					Name:        "Token Exchange Response",
+					Description: "Server returns the new token; with an actor token it carries an act claim recording the delegation",
 					From:        "Authorization Server",
 					To:          "Client",
 					Type:        "response",
-					Security:    []string{"Implement refresh token rotation"},
+					Parameters: map[string]string{
+						"access_token":      "the issued token",
+						"issued_token_type": "type of the issued token",
+						"token_type":        "Bearer or N_A",
+					},
+				},
+			},
+		},
+		{
+			ID:          "dpop",
+			Name:        "DPoP Sender-Constrained Tokens",
+			Description: "Bind access and refresh tokens to a client-held key so stolen tokens cannot be replayed",
+			Executable:  true,
+			Category:    "token-management",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Token Request with DPoP Proof",
+					Description: "Client signs a proof JWT for this request with its private key and sends it in the DPoP header",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"DPoP": "header: JWT with typ dpop+jwt, jwk header, and jti/htm/htu/iat claims",
+					},
+				},
+				{
+					Order:       2,
+					Name:        "Nonce Challenge",
+					Description: "Server rejects a proof without its nonce with use_dpop_nonce and a DPoP-Nonce header",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Parameters: map[string]string{
+						"error":      "use_dpop_nonce",
+						"DPoP-Nonce": "header: server nonce to include in the next proof",
+					},
+				},
+				{
+					Order:       3,
+					Name:        "Bound Token Response",
+					Description: "Client retries with the nonce; the access token carries cnf.jkt and token_type DPoP",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Security:    []string{"Public client refresh tokens are bound to the same key"},
+				},
+				{
+					Order:       4,
+					Name:        "Resource Request",
+					Description: "Client presents the token with the DPoP scheme and a fresh proof containing ath",
+					From:        "Client",
+					To:          "Resource Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"Authorization": "DPoP <access_token>",
+						"DPoP":          "header: proof with ath = base64url(SHA-256(access_token))",
+					},
+					Security: []string{"Resource server checks the proof key matches cnf.jkt", "Proof jti values are tracked to detect replay"},
+				},
+			},
+		},
+		{
+			ID:          "pushed_authorization_request",
+			Name:        "Pushed Authorization Request",
+			Description: "Authorization code flow where the client pushes its authorization parameters over the back channel before redirecting the user",
+			Executable:  true,
+			Category:    "authorization",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Push Authorization Request",
+					Description: "Client authenticates and posts the full authorization request to the PAR endpoint",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"client_id":             "required",
+						"client_secret":         "required for confidential clients",
+						"response_type":         "code",
+						"redirect_uri":          "required",
+						"scope":                 "optional",
+						"state":                 "recommended",
+						"code_challenge":        "recommended",
+						"code_challenge_method": "S256",
+					},
+					Security: []string{"Parameters never pass through the browser", "Client is authenticated before the user is involved"},
+				},
+				{
+					Order:       2,
+					Name:        "Request URI Response",
+					Description: "Server stores the request and returns a short-lived, single-use request_uri",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Parameters: map[string]string{
+						"request_uri": "urn:ietf:params:oauth:request_uri:...",
+						"expires_in":  "seconds until the request_uri expires",
+					},
+				},
+				{
+					Order:       3,
+					Name:        "Authorization Request",
+					Description: "Client redirects the user with only client_id and request_uri",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "redirect",
+					Parameters: map[string]string{
+						"client_id":   "required",
+						"request_uri": "from step 2",
+					},
+					Security: []string{"Clients registered with require_pushed_authorization_requests cannot skip PAR"},
+				},
+				{
+					Order:       4,
+					Name:        "User Authentication",
+					Description: "User authenticates; the pushed request is consumed",
+					From:        "User",
+					To:          "Authorization Server",
+					Type:        "internal",
+				},
+				{
+					Order:       5,
+					Name:        "Authorization Response and Token Exchange",
+					Description: "Continues as the standard authorization code flow",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "redirect",
+				},
+			},
+		},
+		{
+			ID:          "jwt_client_authentication",
+			Name:        "JWT Client Authentication",
+			Description: "Client authenticates with a signed assertion (client_secret_jwt or private_key_jwt) instead of sending a static secret",
+			Executable:  true,
+			Category:    "authorization",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Create Client Assertion",
+					Description: "Client signs a short-lived JWT identifying itself, with HMAC over its secret or with its private key",
+					From:        "Client",
+					To:          "Client",
+					Type:        "internal",
+					Parameters: map[string]string{
+						"iss": "client_id",
+						"sub": "client_id",
+						"aud": "token endpoint URL or issuer",
+						"jti": "unique identifier",
+						"exp": "short expiry",
+					},
+				},
+				{
+					Order:       2,
+					Name:        "Token Request",
+					Description: "Client sends the assertion in place of client_secret",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"grant_type":            "client_credentials",
+						"client_assertion_type": "urn:ietf:params:oauth:client-assertion-type:jwt-bearer",
+						"client_assertion":      "signed JWT from step 1",
+					},
+					Security: []string{"The secret or private key never leaves the client", "Each jti is accepted only once"},
+				},
+				{
+					Order:       3,
+					Name:        "Assertion Verification",
+					Description: "Server verifies the signature against the client secret or registered jwks/jwks_uri, then checks iss, sub, aud, exp and jti",
+					From:        "Authorization Server",
+					To:          "Authorization Server",
+					Type:        "internal",
+				},
+				{
+					Order:       4,
+					Name:        "Token Response",
+					Description: "Authorization server returns access token",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+				},
+			},
+		},
+		{
+			ID:          "dynamic_client_registration",
+			Name:        "Dynamic Client Registration",
+			Description: "Register a client at runtime, then read, update or delete it with the registration access token",
+			Executable:  true,
+			Category:    "admin",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Registration Request",
+					Description: "Client posts its metadata, optionally with a signed software statement",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"redirect_uris":              "required for authorization_code",
+						"grant_types":                "default authorization_code; implicit and password cannot be registered",
+						"response_types":             "must be consistent with grant_types",
+						"scope":                      "default openid profile email; at most openid profile email api:read",
+						"token_endpoint_auth_method": "default client_secret_basic",
+						"software_statement":         "optional signed JWT of metadata",
+					},
+					Security: []string{"Web clients must use https redirect URIs (http only for localhost)", "Software statement values override plain metadata", "jwks_uri must not point at loopback or private addresses"},
+				},
+				{
+					Order:       2,
+					Name:        "Client Information Response",
+					Description: "Server returns the client_id, any client_secret, and a registration access token",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Parameters: map[string]string{
+						"client_id":                 "issued identifier",
+						"client_secret":             "issued for confidential clients",
+						"registration_access_token": "bearer token for managing this registration",
+						"registration_client_uri":   "URL of the management endpoint",
+					},
+				},
+				{
+					Order:       3,
+					Name:        "Manage Registration",
+					Description: "Client reads (GET), replaces (PUT) or deletes (DELETE) its registration at registration_client_uri",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"Authorization": "Bearer <registration_access_token>",
+					},
+					Security: []string{"Unknown clients and bad tokens both get 401 so client_ids cannot be probed"},
+				},
+			},
+		},
+		{
+			ID:          "access_token_formats",
+			Name:        "JWT vs Opaque Access Tokens",
+			Description: "Compare self-contained at+jwt access tokens with opaque reference tokens that must be introspected",
+			Executable:  true,
+			Category:    "token-management",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Token Request",
+					Description: "Client obtains an access token; the format is chosen by the client's access_token_format setting",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"grant_type": "client_credentials or authorization_code",
+					},
+				},
+				{
+					Order:       2,
+					Name:        "JWT Access Token",
+					Description: "Signed JWT with typ at+jwt carrying iss, sub, aud, client_id, scope, jti and, for users, auth_time, acr, groups and roles",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Security:    []string{"Resource servers must reject JWTs whose typ is not at+jwt", "Revocation only takes effect at expiry unless the resource server also introspects"},
+				},
+				{
+					Order:       3,
+					Name:        "Opaque Access Token",
+					Description: "Random reference string whose claims are held only by the authorization server",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Security:    []string{"Reveals nothing to the client or anyone who intercepts it", "Revocation takes effect immediately"},
+				},
+				{
+					Order:       4,
+					Name:        "Introspection",
+					Description: "Resource server resolves an opaque token to its claims at the introspection endpoint",
+					From:        "Resource Server",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"token": "the opaque access token",
+					},
+				},
+			},
+		},
+		{
+			ID:          "rich_authorization_requests",
+			Name:        "Rich Authorization Requests",
+			Description: "Request fine-grained permissions such as a specific payment with authorization_details instead of scopes",
+			Executable:  true,
+			Category:    "authorization",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Authorization Request",
+					Description: "Client sends a JSON array of typed authorization details, directly or via PAR",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "redirect",
+					Parameters: map[string]string{
+						"authorization_details": `[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":"123.50"},"creditorName":"Merchant A","creditorAccount":{"iban":"DE02100100109307118603"}}]`,
+					},
+					Security: []string{"Each type is validated against its registered JSON schema", "Clients may only request the types they are registered for", "Use PAR to keep payment details out of the browser"},
+				},
+				{
+					Order:       2,
+					Name:        "Consent",
+					Description: "The user approves the exact payment or account access shown on the consent page",
+					From:        "User",
+					To:          "Authorization Server",
+					Type:        "internal",
+				},
+				{
+					Order:       3,
+					Name:        "Token Request",
+					Description: "Client redeems the code and may send authorization_details again to narrow the grant for this token",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Security:    []string{"Details that exceed the grant are rejected with invalid_authorization_details"},
+				},
+				{
+					Order:       4,
+					Name:        "Token Response",
+					Description: "The granted authorization_details are returned with the token, embedded in the access token and reported by introspection",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+				},
+			},
+		},
+		{
+			ID:          "resource_indicators",
+			Name:        "Resource Indicators",
+			Description: "Restrict access tokens to the APIs they are meant for with the resource parameter",
+			Executable:  true,
+			Category:    "token-management",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Authorization Request",
+					Description: "Client names every API it will call with one resource parameter each",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "redirect",
+					Parameters: map[string]string{
+						"resource": "https://api.protocolsoup.com/orders (repeatable)",
+						"scope":    "openid profile api:read api:write",
+					},
+					Security: []string{"Resources must be absolute URIs without a fragment", "Unknown resources are rejected with invalid_target"},
+				},
+				{
+					Order:       2,
+					Name:        "Token Request",
+					Description: "Client asks for a token for one of the granted resources",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"grant_type": "authorization_code, refresh_token or client_credentials",
+						"resource":   "a subset of the granted resources",
+					},
+				},
+				{
+					Order:       3,
+					Name:        "Audience-Restricted Token",
+					Description: "The access token's aud is exactly the requested resources and its scope is limited to what they accept",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "response",
+					Security:    []string{"Other APIs reject the token, so it cannot be replayed across resource servers"},
+				},
+				{
+					Order:       4,
+					Name:        "Downscoped Refresh",
+					Description: "Refresh requests may name a different granted resource or a narrower scope; the refresh token keeps the full grant",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"grant_type": "refresh_token",
+						"resource":   "https://api.protocolsoup.com/reports",
+					},
+				},
+			},
+		},
+		{
+			ID:          "native_app",
+			Name:        "Native Apps",
+			Description: "Authorization code flow with PKCE for CLI, desktop and mobile apps using loopback, private-use scheme or claimed https redirects",
+			Executable:  true,
+			Category:    "authorization",
+			Steps: []plugin.FlowStep{
+				{
+					Order:       1,
+					Name:        "Start Loopback Listener",
+					Description: "The app opens a listener on an ephemeral port of 127.0.0.1 or [::1] and generates a PKCE verifier",
+					From:        "Client",
+					To:          "Client",
+					Type:        "internal",
+					Security:    []string{"Use a loopback IP literal rather than localhost", "Bind only to the loopback interface"},
+				},
+				{
+					Order:       2,
+					Name:        "Authorization Request",
+					Description: "The app opens the system browser with a redirect_uri naming its port",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "redirect",
+					Parameters: map[string]string{
+						"redirect_uri":          "http://127.0.0.1:{port}/callback",
+						"code_challenge":        "BASE64URL(SHA256(code_verifier))",
+						"code_challenge_method": "S256",
+					},
+					Security: []string{"Any port matches the registered loopback redirect URI", "Requests without S256 PKCE are rejected", "Use the system browser, not an embedded web view"},
+				},
+				{
+					Order:       3,
+					Name:        "User Authentication",
+					Description: "The user signs in within the browser, where the app cannot see the credentials",
+					From:        "User",
+					To:          "Authorization Server",
+					Type:        "internal",
+				},
+				{
+					Order:       4,
+					Name:        "Redirect to the App",
+					Description: "The browser delivers the code to the loopback listener, the private-use scheme handler or the claimed https URI",
+					From:        "Authorization Server",
+					To:          "Client",
+					Type:        "redirect",
+					Parameters: map[string]string{
+						"code":  "Authorization code",
+						"state": "Must match the request",
+					},
+				},
+				{
+					Order:       5,
+					Name:        "Token Exchange",
+					Description: "The app redeems the code with its code_verifier; it has no client secret",
+					From:        "Client",
+					To:          "Authorization Server",
+					Type:        "request",
+					Parameters: map[string]string{
+						"grant_type":    "authorization_code",
+						"code_verifier": "The original random verifier",
+					},
+					Security: []string{"An intercepted code is useless without the verifier"},
 				},
 			},
 		},
@@ -354,6 +969,81 @@ func (p *Plugin) GetDemoScenarios() []plugin.DemoScenario {
 				{Order: 2, Name: "Wait for Expiry", Description: "Simulate token expiration", Auto: true},
 				{Order: 3, Name: "Refresh Token", Description: "Use refresh token to get new access token", Auto: true},
 				{Order: 4, Name: "Verify Rotation", Description: "See that refresh token was rotated", Auto: true},
+				{Order: 5, Name: "Replay Old Token", Description: "Reuse the rotated refresh token and watch the family get revoked", Auto: true},
+			},
+		},
+		{
+			ID:          "device_code_flow",
+			Name:        "Device Authorization Demo",
+			Description: "Sign in a TV or CLI by entering a user code on a second device",
+			Steps: []plugin.DemoStep{
+				{Order: 1, Name: "Request Device Code", Description: "Device calls the device authorization endpoint", Endpoint: "/oauth2/device_authorization", Method: "POST", Auto: true},
+				{Order: 2, Name: "Start Polling", Description: "Device polls the token endpoint and receives authorization_pending", Endpoint: "/oauth2/token", Method: "POST", Auto: true},
+				{Order: 3, Name: "Enter User Code", Description: "Open the verification page, enter the code and sign in", Endpoint: "/oauth2/device", Method: "GET", Auto: false},
+				{Order: 4, Name: "Receive Tokens", Description: "The next poll returns tokens to the device", Endpoint: "/oauth2/token", Method: "POST", Auto: true},
+			},
+			Config: map[string]string{
+				"client_id": "device-client",
+			},
+		},
+		{
+			ID:          "token_exchange_flow",
+			Name:        "Token Exchange Demo",
+			Description: "Trade a user's access token for a downstream token, with and without an actor",
+			Steps: []plugin.DemoStep{
+				{Order: 1, Name: "Obtain Subject Token", Description: "Get an access token for a demo user", Auto: true},
+				{Order: 2, Name: "Impersonation Exchange", Description: "Exchange the subject token for a token scoped to a downstream audience", Endpoint: "/oauth2/token", Method: "POST", Auto: true},
+				{Order: 3, Name: "Delegation Exchange", Description: "Add an actor token and see the act claim in the issued token", Endpoint: "/oauth2/token", Method: "POST", Auto: true},
+				{Order: 4, Name: "Inspect Tokens", Description: "Compare the subject and exchanged tokens", Auto: false},
+			},
+			Config: map[string]string{
+				"client_id": "exchange-client",
+			},
+		},
+		{
+			ID:          "dpop_flow",
+			Name:        "DPoP Demo",
+			Description: "Obtain a DPoP-bound token, answer the nonce challenge and call UserInfo with proof of possession",
+			Steps: []plugin.DemoStep{
+				{Order: 1, Name: "Generate Key Pair", Description: "Create the client's ephemeral DPoP key", Auto: true},
+				{Order: 2, Name: "Token Request", Description: "Send a proof and receive a use_dpop_nonce challenge", Endpoint: "/oidc/token", Method: "POST", Auto: true},
+				{Order: 3, Name: "Retry with Nonce", Description: "Include the server nonce and receive a DPoP-bound token", Endpoint: "/oidc/token", Method: "POST", Auto: true},
+				{Order: 4, Name: "Call UserInfo", Description: "Present the token with the DPoP scheme and an ath-bearing proof", Endpoint: "/oidc/userinfo", Method: "GET", Auto: true},
+				{Order: 5, Name: "Replay as Bearer", Description: "See the bound token rejected without its proof", Endpoint: "/oidc/userinfo", Method: "GET", Auto: true},
+			},
+			Config: map[string]string{
+				"client_id": "public-app",
+			},
+		},
+		{
+			ID:          "par_flow",
+			Name:        "Pushed Authorization Request Demo",
+			Description: "Push authorization parameters over the back channel and redirect with only a request_uri",
+			Steps: []plugin.DemoStep{
+				{Order: 1, Name: "Push Request", Description: "Authenticate and post the authorization parameters", Endpoint: "/oauth2/par", Method: "POST", Auto: true},
+				{Order: 2, Name: "Redirect with request_uri", Description: "Open the authorization endpoint with client_id and request_uri only", Endpoint: "/oauth2/authorize", Method: "GET", Auto: true},
+				{Order: 3, Name: "Authenticate User", Description: "Login as a demo user", Auto: false},
+				{Order: 4, Name: "Exchange Code for Tokens", Description: "Request tokens from token endpoint", Endpoint: "/oauth2/token", Method: "POST", Auto: true},
+				{Order: 5, Name: "Try Without PAR", Description: "See a front-channel request from the same client rejected", Endpoint: "/oauth2/authorize", Method: "GET", Auto: true},
+			},
+			Config: map[string]string{
+				"client_id": "par-app",
+			},
+		},
+		{
+			ID:          "native_app_flow",
+			Name:        "Native App Demo",
+			Description: "Run the native-client CLI, which receives the authorization code on a loopback listener",
+			Steps: []plugin.DemoStep{
+				{Order: 1, Name: "Start Listener", Description: "Listen on an ephemeral 127.0.0.1 port and create a PKCE verifier", Auto: true},
+				{Order: 2, Name: "Open Browser", Description: "Open the authorization URL with the loopback redirect_uri", Endpoint: "/oauth2/authorize", Method: "GET", Auto: true},
+				{Order: 3, Name: "Authenticate User", Description: "Login as a demo user", Auto: false},
+				{Order: 4, Name: "Receive Callback", Description: "The listener receives the code and checks state", Auto: true},
+				{Order: 5, Name: "Exchange Code for Tokens", Description: "Redeem the code with the code_verifier", Endpoint: "/oauth2/token", Method: "POST", Auto: true},
+			},
+			Config: map[string]string{
+				"client_id": "native-app",
+				"command":   "go run ./cmd/native-client",
 			},
 		},
 	}
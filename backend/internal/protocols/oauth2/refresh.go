@@ -0,0 +1,88 @@
+package oauth2
+
+import (
+	"errors"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// EmitRefreshTokenRotated reports that a refresh token was exchanged for its successor in the same family
+func (p *Plugin) EmitRefreshTokenRotated(sessionID string, previous *models.RefreshToken) {
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Refresh Token Rotated", map[string]interface{}{
+		"family_id":           previous.FamilyID,
+		"previous_generation": previous.Generation,
+		"new_generation":      previous.Generation + 1,
+		"previous_token":      "rotated - any further use revokes the family",
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Refresh Token Rotation",
+		Description: "Every refresh issues a new refresh token in the same family. The old token is kept on record rather than deleted, so if an attacker and the legitimate client both hold it, whichever uses it second exposes the theft.",
+		Severity:    "info",
+		Reference:   "RFC 9700 Section 4.14.2",
+	})
+}
+
+// EmitRefreshTokenReuse reports replay of a rotated refresh token and the resulting family revocation
+func (p *Plugin) EmitRefreshTokenReuse(sessionID string, reuse *mockidp.RefreshTokenReuseError) {
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Refresh Token Reuse Detected", map[string]interface{}{
+		"family_id":           reuse.FamilyID,
+		"replayed_generation": reuse.Generation,
+		"latest_generation":   reuse.LatestGeneration,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeVulnerability,
+		Title:       "Replayed Refresh Token",
+		Description: "A refresh token that was already rotated has been presented again. The server cannot tell whether the legitimate client or an attacker is replaying it, so it treats the whole family as compromised.",
+		Severity:    "critical",
+		Reference:   "RFC 9700 Section 4.14.2",
+	})
+
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Family Revoked", map[string]interface{}{
+		"family_id":      reuse.FamilyID,
+		"revoked_tokens": reuse.RevokedTokens,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeSecurityHint,
+		Title:       "Refresh Token Family Revocation",
+		Description: "Every refresh token descended from the original grant is revoked, including the newest one the attacker may have obtained. The user must sign in again.",
+		Severity:    "warning",
+		Reference:   "RFC 9700 Section 4.14.2",
+	})
+
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Linked Access Tokens Revoked", map[string]interface{}{
+		"family_id":     reuse.FamilyID,
+		"revoked_jti":   reuse.RevokedAccessTokens,
+		"revoked_count": len(reuse.RevokedAccessTokens),
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeSecurityHint,
+		Title:       "Access Tokens Invalidated",
+		Description: "Access tokens issued with the family's refresh tokens are rejected by introspection and the UserInfo endpoint even though their signatures and exp are still valid",
+		Severity:    "warning",
+		Reference:   "RFC 7009 Section 2.1",
+	})
+}
+
+// CheckTokenActive rejects refresh tokens that were rotated or revoked, and access tokens revoked
+// with their refresh token family. claims must come from ResolveToken or ResolveRefreshToken.
+// Where only an access token is acceptable, use CheckAccessTokenActive.
+func (p *Plugin) CheckTokenActive(token string, claims map[string]interface{}) error {
+	if t, _ := claims["type"].(string); t == "refresh" {
+		if !p.mockIdP.IsRefreshTokenActive(token) {
+			return errors.New("refresh token has been rotated or revoked")
+		}
+		return nil
+	}
+	return p.CheckAccessTokenActive(claims)
+}
+
+// CheckAccessTokenActive rejects access tokens revoked with their refresh token family, and any
+// refresh token presented in place of an access token. claims must come from ResolveToken.
+func (p *Plugin) CheckAccessTokenActive(claims map[string]interface{}) error {
+	if t, _ := claims["type"].(string); t == "refresh" {
+		return errors.New("a refresh token is not an access token")
+	}
+	if jti, _ := claims["jti"].(string); jti != "" && p.mockIdP.IsAccessTokenRevoked(jti) {
+		return errors.New("access token has been revoked")
+	}
+	return nil
+}
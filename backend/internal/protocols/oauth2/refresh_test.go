@@ -0,0 +1,36 @@
+package oauth2
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func refreshForm(token, scope string) url.Values {
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token}}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	return form
+}
+
+func TestRefreshRejectedRequestKeepsTokenUsable(t *testing.T) {
+	p := newTestPlugin(t)
+	p.mockIdP.StoreRefreshToken("rt-1", "exchange-client", "alice", "api:read", "", time.Now(), time.Now().Add(time.Hour))
+
+	expectOAuth2Error(t, postToken(p, "exchange-client", "exchange-secret", refreshForm("rt-1", "api:read api:write")), "invalid_scope")
+
+	w := postToken(p, "exchange-client", "exchange-secret", refreshForm("rt-1", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh after a rejected request: status = %d: %s", w.Code, w.Body.String())
+	}
+	next, _ := decodeJSON(t, w)["refresh_token"].(string)
+	if next == "" {
+		t.Fatal("no rotated refresh token issued")
+	}
+
+	// Replaying the rotated token revokes the family, including its successor
+	expectOAuth2Error(t, postToken(p, "exchange-client", "exchange-secret", refreshForm("rt-1", "")), "invalid_grant")
+	expectOAuth2Error(t, postToken(p, "exchange-client", "exchange-secret", refreshForm(next, "")), "invalid_grant")
+}
@@ -0,0 +1,230 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// handleRegister handles dynamic client registration (RFC 7591 Section 3.1). Registration is
+// open: any caller may register a client, which is usable immediately at every endpoint.
+func (p *Plugin) handleRegister(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	var metadata models.ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidClientMetadata, "Request body must be a JSON client metadata document", "")
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Client Registration Request", map[string]interface{}{
+		"step":                       1,
+		"from":                       "Client",
+		"to":                         "Authorization Server",
+		"client_name":                metadata.ClientName,
+		"redirect_uris":              metadata.RedirectURIs,
+		"grant_types":                metadata.GrantTypes,
+		"token_endpoint_auth_method": metadata.TokenEndpointAuthMethod,
+		"has_software_statement":     metadata.SoftwareStatement != "",
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Dynamic Client Registration",
+		Description: "The client describes itself with a JSON metadata document and receives a client_id, credentials and a registration access token for later management",
+		Reference:   "RFC 7591 Section 3.1",
+	})
+
+	client, err := p.mockIdP.RegisterClient(&metadata)
+	if err != nil {
+		p.writeRegistrationError(w, sessionID, err)
+		return
+	}
+
+	if client.Registration.SoftwareStatement != "" {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Software Statement Verified", map[string]interface{}{
+			"software_id": client.Registration.SoftwareID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeBestPractice,
+			Title:       "Software Statement",
+			Description: "Metadata asserted in the signed software statement overrides the values sent as plain JSON, so a client cannot claim redirect URIs or grants its publisher did not approve",
+			Reference:   "RFC 7591 Section 2.3",
+		})
+	}
+
+	response := p.clientInformation(client)
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Client Registered", map[string]interface{}{
+		"step":                       2,
+		"from":                       "Authorization Server",
+		"to":                         "Client",
+		"client_id":                  client.ID,
+		"token_endpoint_auth_method": client.TokenEndpointAuthMethod,
+		"grant_types":                client.GrantTypes,
+		"registration_client_uri":    response.RegistrationClientURI,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeSecurityHint,
+		Title:       "Registration Access Token",
+		Description: "The registration_access_token is a bearer credential for reading, updating and deleting this registration. Store it as carefully as the client secret.",
+		Severity:    "info",
+		Reference:   "RFC 7592 Section 1",
+	})
+
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// handleGetRegistration returns the current registration of a client (RFC 7592 Section 2.1)
+func (p *Plugin) handleGetRegistration(w http.ResponseWriter, r *http.Request) {
+	client, ok := p.authorizeRegistrationAccess(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, p.clientInformation(client))
+}
+
+// handleUpdateRegistration replaces the metadata of a client (RFC 7592 Section 2.2)
+func (p *Plugin) handleUpdateRegistration(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	client, ok := p.authorizeRegistrationAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var update struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		models.ClientMetadata
+	}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeOAuth2Error(w, mockidp.ErrorInvalidClientMetadata, "Request body must be a JSON client metadata document", "")
+		return
+	}
+	if update.ClientID != client.ID {
+		writeOAuth2Error(w, "invalid_request", "client_id in the request body must match the registration", "")
+		return
+	}
+	if update.ClientSecret != "" && update.ClientSecret != client.Secret {
+		writeOAuth2Error(w, "invalid_request", "client_secret does not match the registration", "")
+		return
+	}
+
+	updated, err := p.mockIdP.UpdateClientRegistration(client.ID, &update.ClientMetadata)
+	if err != nil {
+		p.writeRegistrationError(w, sessionID, err)
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Client Registration Updated", map[string]interface{}{
+		"client_id":     updated.ID,
+		"redirect_uris": updated.RedirectURIs,
+		"grant_types":   updated.GrantTypes,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Full Replacement",
+		Description: "An update replaces the whole registration; metadata fields omitted from the request are reset to their defaults",
+		Reference:   "RFC 7592 Section 2.2",
+	})
+
+	writeJSON(w, http.StatusOK, p.clientInformation(updated))
+}
+
+// handleDeleteRegistration deregisters a client (RFC 7592 Section 2.3)
+func (p *Plugin) handleDeleteRegistration(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	client, ok := p.authorizeRegistrationAccess(w, r)
+	if !ok {
+		return
+	}
+
+	p.mockIdP.DeleteClientRegistration(client.ID)
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Client Deregistered", map[string]interface{}{
+		"client_id": client.ID,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Client Deleted",
+		Description: "The client_id, its credentials, registration access token, refresh tokens and reference access tokens are no longer valid",
+		Reference:   "RFC 7592 Section 2.3",
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeRegistrationAccess checks the registration access token for the client in the URL
+func (p *Plugin) authorizeRegistrationAccess(w http.ResponseWriter, r *http.Request) (*models.Client, bool) {
+	clientID := chi.URLParam(r, "client_id")
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	client, ok := p.mockIdP.AuthenticateRegistrationAccess(clientID, token)
+	if !ok {
+		p.emitEvent(p.getSessionFromRequest(r), lookingglass.EventTypeSecurityWarning, "Registration Access Denied", map[string]interface{}{
+			"client_id": clientID,
+		})
+		// The same response is used for unknown clients so client_ids cannot be probed
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error":             "invalid_token",
+			"error_description": "Invalid registration access token",
+		})
+		return nil, false
+	}
+	return client, true
+}
+
+// clientInformation builds the client information response for a registered client
+func (p *Plugin) clientInformation(client *models.Client) models.ClientInformationResponse {
+	return models.ClientInformationResponse{
+		ClientID:                client.ID,
+		ClientSecret:            client.Secret,
+		ClientIDIssuedAt:        client.CreatedAt.Unix(),
+		ClientSecretExpiresAt:   0, // secrets do not expire
+		RegistrationAccessToken: client.RegistrationAccessToken,
+		RegistrationClientURI:   p.baseURL + "/oauth2/register/" + client.ID,
+		ClientMetadata:          *client.Registration,
+	}
+}
+
+// writeRegistrationError writes a registration error response (RFC 7591 Section 3.2.2)
+func (p *Plugin) writeRegistrationError(w http.ResponseWriter, sessionID string, err error) {
+	code, description := mockidp.ErrorInvalidClientMetadata, err.Error()
+	if regErr, ok := err.(*mockidp.RegistrationError); ok {
+		code, description = regErr.Code, regErr.Description
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Registration Rejected", map[string]interface{}{
+		"error":             code,
+		"error_description": description,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeSecurityHint,
+		Title:       "Metadata Validation",
+		Description: "The server validates redirect URIs and the consistency of grant and response types before any client is created",
+		Severity:    "warning",
+		Reference:   "RFC 7591 Section 2",
+	})
+
+	writeOAuth2Error(w, code, description, "")
+}
+
+// handleCreateSoftwareStatement signs posted client metadata as a software statement for demos
+func (p *Plugin) handleCreateSoftwareStatement(w http.ResponseWriter, r *http.Request) {
+	var metadata map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		writeOAuth2Error(w, "invalid_request", "Request body must be a JSON object", "")
+		return
+	}
+
+	statement, err := p.mockIdP.CreateSoftwareStatement(metadata)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"software_statement": statement,
+	})
+}
@@ -0,0 +1,180 @@
+package oauth2
+
+import (
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+)
+
+// RequestObjectError is returned when an authorization request's request object cannot be used
+type RequestObjectError struct {
+	Code        string
+	Description string
+}
+
+func (e *RequestObjectError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// authorizationRequestParameters are the authorization request parameters a request object
+// replaces. Other fields, such as the credentials of the login form, are left alone.
+var authorizationRequestParameters = []string{
+	"response_type", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method",
+	"response_mode", "prompt", "max_age", "acr_values", "login_hint", "id_token_hint", "claims",
+	"claims_locales", "ui_locales", "display", "resource", "authorization_details", "dpop_jkt", "registration",
+}
+
+// ApplyRequestObject resolves a JWT-secured authorization request (RFC 9101). A request object
+// passed by value in request, or by reference in a request_uri that is not a PAR handle, is
+// verified and replaces the authorization request parameters in params: only the parameters
+// inside the request object are used, and plain ones other than client_id are discarded
+// (RFC 9101 Section 6.3), so nothing can be added or altered in the browser.
+//
+// It returns the signed request object as received, so the login form can carry it to the
+// submit handler, where it is verified and applied again. Clients registered with
+// require_signed_request_object must send one unless they use a pushed request_uri.
+func (p *Plugin) ApplyRequestObject(sessionID, clientID string, params url.Values) (string, *RequestObjectError) {
+	requestObject := params.Get("request")
+	requestURI := params.Get("request_uri")
+	byReference := requestURI != "" && !strings.HasPrefix(requestURI, mockidp.RequestURIPrefix)
+
+	if requestObject == "" && !byReference {
+		if client, exists := p.mockIdP.GetClient(clientID); exists && client.RequireSignedRequestObject && requestURI == "" {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Signed Request Object Required", map[string]interface{}{
+				"client_id": clientID,
+			}, lookingglass.Annotation{
+				Type:        lookingglass.AnnotationTypeSecurityHint,
+				Title:       "Plain Authorization Request Rejected",
+				Description: "This client is registered with require_signed_request_object, so every authorization request must be a request object or a pushed request",
+				Severity:    "warning",
+				Reference:   "RFC 9101 Section 10.5",
+			})
+			return "", &RequestObjectError{Code: "invalid_request", Description: "This client must send a signed request object"}
+		}
+		return "", nil
+	}
+
+	if requestObject != "" && requestURI != "" {
+		return "", &RequestObjectError{Code: "invalid_request", Description: "request and request_uri must not both be present"}
+	}
+	if clientID == "" {
+		return "", &RequestObjectError{Code: "invalid_request", Description: "client_id is required with a request object"}
+	}
+
+	if byReference {
+		fetched, err := p.mockIdP.FetchRequestObject(clientID, requestURI)
+		if err != nil {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Request URI Rejected", map[string]interface{}{
+				"client_id":   clientID,
+				"request_uri": requestURI,
+				"reason":      err.Error(),
+			}, lookingglass.Annotation{
+				Type:        lookingglass.AnnotationTypeSecurityHint,
+				Title:       "Request Object by Reference",
+				Description: "The server only fetches request_uri values the client pre-registered, so it cannot be used to make requests to arbitrary hosts",
+				Severity:    "warning",
+				Reference:   "RFC 9101 Section 10.4",
+			})
+			return "", &RequestObjectError{Code: mockidp.ErrorInvalidRequestURI, Description: err.Error()}
+		}
+		p.emitEvent(sessionID, lookingglass.EventTypeRequestSent, "Request Object Fetched", map[string]interface{}{
+			"client_id":   clientID,
+			"request_uri": requestURI,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Request Object by Reference",
+			Description: "The browser carried only a URL; the authorization server downloaded the request object from the client",
+			Reference:   "RFC 9101 Section 5.2",
+		})
+		requestObject = fetched
+	}
+
+	verified, err := p.mockIdP.VerifyRequestObject(clientID, requestObject)
+	if err != nil {
+		data := map[string]interface{}{
+			"client_id": clientID,
+			"error":     err.Error(),
+		}
+		if decoded, decodeErr := lookingglass.NewDecoder().DecodeJWT(requestObject); decodeErr == nil {
+			data["request_object"] = decoded
+		}
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Request Object Rejected", data, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Invalid Request Object",
+			Description: "A request object must be signed with the client's secret or registered key, name the client in iss and this server in aud, carry the oauth-authz-req+jwt typ, and be unexpired and unused",
+			Severity:    "warning",
+			Reference:   "RFC 9101 Section 6.3",
+		})
+		return "", &RequestObjectError{Code: mockidp.ErrorInvalidRequestObject, Description: err.Error()}
+	}
+
+	overridden := make([]string, 0)
+	for _, name := range authorizationRequestParameters {
+		if _, signed := verified.Parameters[name]; !signed && params.Has(name) {
+			overridden = append(overridden, name)
+			params.Del(name)
+		}
+	}
+	for name, value := range verified.Parameters {
+		if params.Has(name) && params.Get(name) != value {
+			overridden = append(overridden, name)
+		}
+		if name == "resource" {
+			params[name] = strings.Fields(value)
+			continue
+		}
+		params.Set(name, value)
+	}
+	params.Del("request")
+	params.Del("request_uri")
+	sort.Strings(overridden)
+
+	data := map[string]interface{}{
+		"client_id":    clientID,
+		"alg":          verified.Algorithm,
+		"kid":          verified.KeyID,
+		"encrypted":    verified.Encrypted,
+		"by_reference": byReference,
+		"overridden":   overridden,
+	}
+	if decoded, err := lookingglass.NewDecoder().DecodeJWT(verified.Signed); err == nil {
+		data["request_object"] = decoded
+	}
+	description := "The authorization parameters were signed by the client, so they could not be read or altered by the browser or anyone observing the redirect. Only the signed parameters are used."
+	if verified.Encrypted {
+		description = "The request object was encrypted to the authorization server's public key and signed by the client, so the parameters are both confidential and tamper-proof. Only the signed parameters are used."
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeCryptoOperation, "Request Object Verified", data, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "JWT-Secured Authorization Request",
+		Description: description,
+		Reference:   "RFC 9101 Section 6",
+	})
+	if len(overridden) > 0 {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Query Parameters Overridden", map[string]interface{}{
+			"parameters": overridden,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Request Object Takes Precedence",
+			Description: "Query parameters that differ from or are missing in the signed request object were replaced or discarded, so tampering in the front channel has no effect",
+			Severity:    "info",
+			Reference:   "RFC 9101 Section 6.3",
+		})
+	}
+
+	return requestObject, nil
+}
+
+// WithRequestObjectField adds the request object to the login form so it is verified and applied again on submit
+func WithRequestObjectField(page, requestObject string) string {
+	if requestObject == "" {
+		return page
+	}
+	field := `<input type="hidden" name="request" value="` + html.EscapeString(requestObject) + `">
+            <input type="hidden" name="client_id"`
+	return strings.Replace(page, `<input type="hidden" name="client_id"`, field, 1)
+}
@@ -0,0 +1,107 @@
+package oauth2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+)
+
+const jarCallback = "http://localhost:3000/callback"
+
+// signJARRequest returns a request object signed by jar-app carrying the parameters
+func signJARRequest(t *testing.T, p *Plugin, params map[string]interface{}) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"iss": "jar-app",
+		"aud": p.mockIdP.GetIssuer(),
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+		"jti": uuid.NewString(),
+	}
+	for name, value := range params {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["typ"] = mockidp.RequestObjectType
+	signed, err := token.SignedString([]byte("jar-app-secret-at-least-32-bytes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestRequestObjectDiscardsUnsignedParameters(t *testing.T) {
+	p := newTestPlugin(t)
+	requestObject := signJARRequest(t, p, map[string]interface{}{
+		"response_type": "code",
+		"redirect_uri":  jarCallback,
+		"scope":         "openid",
+	})
+	params := url.Values{
+		"client_id":     {"jar-app"},
+		"request":       {requestObject},
+		"scope":         {"openid profile email"},
+		"redirect_uri":  {"https://attacker.example/callback"},
+		"state":         {"injected"},
+		"response_mode": {"fragment"},
+		"email":         {"alice@example.com"},
+	}
+
+	if _, roErr := p.ApplyRequestObject("", "jar-app", params); roErr != nil {
+		t.Fatalf("ApplyRequestObject: %v", roErr)
+	}
+	if got := params.Get("scope"); got != "openid" {
+		t.Errorf("scope = %q, want the signed value", got)
+	}
+	if got := params.Get("redirect_uri"); got != jarCallback {
+		t.Errorf("redirect_uri = %q, want the signed value", got)
+	}
+	for _, name := range []string{"state", "response_mode", "request"} {
+		if params.Has(name) {
+			t.Errorf("unsigned %s kept: %q", name, params.Get(name))
+		}
+	}
+	if params.Get("client_id") != "jar-app" || params.Get("email") != "alice@example.com" {
+		t.Errorf("non-authorization parameters changed: %v", params)
+	}
+}
+
+func TestRequestObjectIsSingleUse(t *testing.T) {
+	p := newTestPlugin(t)
+	requestObject := signJARRequest(t, p, map[string]interface{}{
+		"response_type": "code",
+		"redirect_uri":  jarCallback,
+		"scope":         "openid",
+		"state":         "s1",
+	})
+	submit := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"client_id": {"jar-app"},
+			"request":   {requestObject},
+			"email":     {"alice@example.com"},
+			"password":  {password},
+		}
+		r := httptest.NewRequest(http.MethodPost, "/oauth2/authorize", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		p.handleAuthorizeSubmit(w, r)
+		return w
+	}
+
+	// A failed login shows the form again, which still carries the request object
+	if w := submit("wrong"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="request"`) {
+		t.Fatalf("failed login: status = %d: %s", w.Code, w.Body.String())
+	}
+	w := submit("password123")
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), jarCallback+"?code=") {
+		t.Fatalf("login: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+	expectOAuth2Error(t, submit("password123"), mockidp.ErrorInvalidRequestObject)
+}
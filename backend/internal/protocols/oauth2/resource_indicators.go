@@ -0,0 +1,120 @@
+package oauth2
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+)
+
+// ValidateResources checks the resource indicators of an authorization, PAR or token request
+// (RFC 8707 Section 2). Callers reject the request with invalid_target on error.
+func (p *Plugin) ValidateResources(sessionID string, resources []string) error {
+	if err := p.mockIdP.ValidateResources(resources); err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid Resource Indicator", map[string]interface{}{
+			"resource": resources,
+			"error":    err.Error(),
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "invalid_target",
+			Description: "Resource indicators must be absolute URIs without a fragment that identify a protected resource known to the authorization server",
+			Severity:    "warning",
+			Reference:   "RFC 8707 Section 2",
+		})
+		return err
+	}
+	return nil
+}
+
+// TokenResources returns the audience for a token request. Clients may name a subset of the
+// granted resources to obtain a token for just those; with no grant, any known resource may be named.
+func (p *Plugin) TokenResources(r *http.Request, sessionID string, granted []string) ([]string, error) {
+	requested := r.Form["resource"]
+	if len(requested) == 0 {
+		return granted, nil
+	}
+
+	if err := p.ValidateResources(sessionID, requested); err != nil {
+		return nil, err
+	}
+	if len(granted) > 0 && !mockidp.ResourcesCovered(requested, granted) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Resource Not Granted", map[string]interface{}{
+			"requested": requested,
+			"granted":   granted,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeVulnerability,
+			Title:       "Audience Escalation Blocked",
+			Description: "The token request named a resource the user never authorized for this grant",
+			Severity:    "warning",
+			Reference:   "RFC 8707 Section 2.2",
+		})
+		return nil, errors.New("requested resource was not part of the authorization grant")
+	}
+	return requested, nil
+}
+
+// ResourceScope returns the scope of an access token restricted to resources. Scopes the
+// resources do not accept are dropped; if none remain the request is rejected.
+func (p *Plugin) ResourceScope(sessionID string, resources []string, scope string) (string, error) {
+	narrowed := p.mockIdP.ResourceScope(resources, scope)
+	if narrowed == scope {
+		return scope, nil
+	}
+	if narrowed == "" {
+		return "", errors.New("none of the requested scopes are accepted by the requested resources")
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Access Token Downscoped", map[string]interface{}{
+		"resource":        resources,
+		"requested_scope": scope,
+		"token_scope":     narrowed,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Scope Restricted to Audience",
+		Description: "Scopes the target resource does not accept are left out of the access token, so it carries only what that API needs",
+		Reference:   "RFC 8707 Section 2.2",
+	})
+	return narrowed, nil
+}
+
+// EmitAudienceRestricted reports an access token issued for specific resource indicators
+func (p *Plugin) EmitAudienceRestricted(sessionID, clientID string, resources []string) {
+	if len(resources) == 0 {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Access Token Without Resource Indicator", map[string]interface{}{
+			"aud": clientID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Unrestricted Audience",
+			Description: "Without a resource parameter the token is not bound to a particular API. Any resource server that receives it can replay it against every other API that trusts this authorization server.",
+			Severity:    "info",
+			Reference:   "RFC 9700 Section 2.3",
+		})
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Audience-Restricted Access Token", map[string]interface{}{
+		"aud": resources,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Token Replay Across APIs Prevented",
+		Description: "The aud claim names exactly the requested resources. Any other API must reject the token, so a compromised or malicious resource server cannot reuse tokens it receives elsewhere.",
+		Reference:   "RFC 8707 Section 1",
+	})
+}
+
+// WithResourceFields adds the resource indicators to a login form so they survive the submit
+func WithResourceFields(page string, resources []string) string {
+	if len(resources) == 0 {
+		return page
+	}
+	var fields strings.Builder
+	for _, resource := range resources {
+		fields.WriteString(`<input type="hidden" name="resource" value="` + html.EscapeString(resource) + `">
+            `)
+	}
+	fields.WriteString(`<input type="hidden" name="client_id"`)
+	return strings.Replace(page, `<input type="hidden" name="client_id"`, fields.String(), 1)
+}
@@ -0,0 +1,477 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/saml"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+)
+
+// GrantTypeTokenExchange is the token exchange grant type (RFC 8693 Section 2.1)
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token type identifiers (RFC 8693 Section 3)
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeSAML2       = "urn:ietf:params:oauth:token-type:saml2"
+)
+
+// JWTSVIDValidator validates SPIFFE JWT-SVIDs presented as subject or actor tokens.
+// The SPIFFE workload client satisfies this interface.
+type JWTSVIDValidator interface {
+	ValidateJWTSVID(ctx context.Context, token string, expectedAudiences []string) (*jwtsvid.SVID, error)
+}
+
+// SetJWTSVIDValidator enables cryptographic JWT-SVID validation for token exchange
+func (p *Plugin) SetJWTSVIDValidator(v JWTSVIDValidator) {
+	p.svidValidator = v
+}
+
+// SAMLAssertionVerifier verifies the XML signature of SAML assertions presented as subject or
+// actor tokens. The SAML plugin satisfies this interface.
+type SAMLAssertionVerifier interface {
+	VerifyAssertion(data []byte) (*saml.Assertion, error)
+}
+
+// SetSAMLAssertionVerifier sets the trusted SAML identity provider for token exchange
+func (p *Plugin) SetSAMLAssertionVerifier(v SAMLAssertionVerifier) {
+	p.samlVerifier = v
+}
+
+// exchangeToken is a validated subject or actor token
+type exchangeToken struct {
+	Subject string
+	Issuer  string
+	Scope   string
+	Kind    string // "access_token", "id_token", "jwt", "saml2", "jwt-svid"
+	Claims  map[string]interface{}
+}
+
+// handleTokenExchangeGrant handles RFC 8693 token exchange requests
+func (p *Plugin) handleTokenExchangeGrant(w http.ResponseWriter, r *http.Request, sessionID string) {
+	clientID := RequestClientID(r)
+	subjectToken := r.FormValue("subject_token")
+	subjectTokenType := r.FormValue("subject_token_type")
+	actorToken := r.FormValue("actor_token")
+	actorTokenType := r.FormValue("actor_token_type")
+	requestedTokenType := r.FormValue("requested_token_type")
+	audience := r.FormValue("audience")
+	resource := r.FormValue("resource")
+	scope := r.FormValue("scope")
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Token Exchange Request", map[string]interface{}{
+		"step":                 1,
+		"from":                 "Client",
+		"to":                   "Authorization Server",
+		"client_id":            clientID,
+		"subject_token_type":   subjectTokenType,
+		"actor_token_type":     actorTokenType,
+		"requested_token_type": requestedTokenType,
+		"audience":             audience,
+		"resource":             resource,
+		"requested_scope":      scope,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "OAuth 2.0 Token Exchange",
+		Description: "The client presents a security token it already holds and asks for a new token, optionally acting on behalf of the subject",
+		Reference:   "RFC 8693 Section 2.1",
+	})
+
+	client, err := p.AuthenticateClient(r, sessionID)
+	if err != nil || client.Public {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
+			"client_id": clientID,
+		})
+		writeOAuth2Error(w, "invalid_client", "Client authentication failed", "")
+		return
+	}
+
+	if !ClientHasGrantType(client, GrantTypeTokenExchange) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Unauthorized Grant Type", map[string]interface{}{
+			"client_id":  clientID,
+			"grant_type": GrantTypeTokenExchange,
+		})
+		writeOAuth2Error(w, "unauthorized_client", "Client not authorized for token exchange", "")
+		return
+	}
+
+	if subjectToken == "" || subjectTokenType == "" {
+		writeOAuth2Error(w, "invalid_request", "subject_token and subject_token_type are required", "")
+		return
+	}
+	if actorToken != "" && actorTokenType == "" {
+		writeOAuth2Error(w, "invalid_request", "actor_token_type is required when actor_token is present", "")
+		return
+	}
+
+	switch requestedTokenType {
+	case "", TokenTypeAccessToken, TokenTypeJWT:
+	default:
+		writeOAuth2Error(w, "invalid_request", "Unsupported requested_token_type", "")
+		return
+	}
+	if requestedTokenType == "" {
+		requestedTokenType = TokenTypeAccessToken
+	}
+
+	subject, err := p.validateExchangeToken(r.Context(), subjectToken, subjectTokenType)
+	if err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Subject Token Rejected", map[string]interface{}{
+			"subject_token_type": subjectTokenType,
+			"error":              err.Error(),
+		})
+		writeOAuth2Error(w, "invalid_grant", "Invalid subject_token: "+err.Error(), "")
+		return
+	}
+	p.emitExchangeTokenValidated(sessionID, "Subject Token Validated", subject)
+
+	var actor *exchangeToken
+	if actorToken != "" {
+		actor, err = p.validateExchangeToken(r.Context(), actorToken, actorTokenType)
+		if err != nil {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Actor Token Rejected", map[string]interface{}{
+				"actor_token_type": actorTokenType,
+				"error":            err.Error(),
+			})
+			writeOAuth2Error(w, "invalid_grant", "Invalid actor_token: "+err.Error(), "")
+			return
+		}
+		p.emitExchangeTokenValidated(sessionID, "Actor Token Validated", actor)
+
+		// The subject token may restrict who is allowed to act for it (RFC 8693 Section 4.4)
+		if mayAct, ok := subject.Claims["may_act"].(map[string]interface{}); ok {
+			if allowed, _ := mayAct["sub"].(string); allowed != "" && allowed != actor.Subject {
+				p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Delegation Not Permitted", map[string]interface{}{
+					"may_act_sub": allowed,
+					"actor_sub":   actor.Subject,
+				}, lookingglass.Annotation{
+					Type:        lookingglass.AnnotationTypeSecurityHint,
+					Title:       "may_act Restriction",
+					Description: "The subject token names the only party allowed to act on its behalf, and the presented actor does not match",
+					Severity:    "warning",
+					Reference:   "RFC 8693 Section 4.4",
+				})
+				writeOAuth2Error(w, "invalid_grant", "Actor is not permitted to act for the subject", "")
+				return
+			}
+		}
+	}
+
+	// Never widen the subject token's scope. A subject token without scope, such as a SAML
+	// assertion or JWT-SVID, grants none.
+	if scope == "" {
+		scope = subject.Scope
+	} else if !ScopeSubset(scope, subject.Scope) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Scope Escalation Rejected", map[string]interface{}{
+			"requested_scope": scope,
+			"subject_scope":   subject.Scope,
+		})
+		writeOAuth2Error(w, "invalid_scope", "Requested scope exceeds the subject token's scope", "")
+		return
+	}
+
+	if resource != "" {
+		if err := p.ValidateResources(sessionID, []string{resource}); err != nil {
+			writeOAuth2Error(w, mockidp.ErrorInvalidTarget, err.Error(), "")
+			return
+		}
+	}
+
+	if audience == "" {
+		audience = resource
+	}
+	if audience == "" {
+		audience = clientID
+	}
+
+	claims := map[string]interface{}{
+		"subject_token_type": subjectTokenType,
+	}
+	if subject.Issuer != "" && subject.Issuer != p.mockIdP.GetIssuer() {
+		claims["subject_issuer"] = subject.Issuer
+	}
+
+	semantics := "impersonation"
+	if actor != nil {
+		// Delegation: the current actor is outermost, prior actors are nested (RFC 8693 Section 4.1)
+		act := map[string]interface{}{"sub": actor.Subject}
+		if actor.Issuer != "" {
+			act["iss"] = actor.Issuer
+		}
+		if prior, ok := subject.Claims["act"]; ok {
+			act["act"] = prior
+		}
+		claims["act"] = act
+		semantics = "delegation"
+	} else if prior, ok := subject.Claims["act"]; ok {
+		claims["act"] = prior
+	}
+
+	accessToken, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+		Subject:  subject.Subject,
+		ClientID: clientID,
+		Audience: []string{audience},
+		Scope:    scope,
+		Custom:   RequestTokenBinding(r).BoundClaims(claims),
+	}, time.Hour)
+	if err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Generation Failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		writeOAuth2Error(w, "server_error", "Failed to issue token", "")
+		return
+	}
+
+	tokenType := AccessTokenType(DPoPBinding(r))
+	if requestedTokenType != TokenTypeAccessToken {
+		tokenType = "N_A"
+	}
+
+	response := models.TokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: requestedTokenType,
+		TokenType:       tokenType,
+		ExpiresIn:       3600,
+		Scope:           scope,
+	}
+
+	annotation := lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Impersonation",
+		Description: "No actor token was presented, so the new token is indistinguishable from one issued directly to the subject",
+		Reference:   "RFC 8693 Section 1.1",
+	}
+	if actor != nil {
+		annotation = lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeBestPractice,
+			Title:       "Delegation with act Claim",
+			Description: "The act claim records that " + actor.Subject + " is acting for " + subject.Subject + ", so resource servers can audit and authorize the full delegation chain",
+			Reference:   "RFC 8693 Section 4.1",
+		}
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeTokenIssued, "Exchanged Token Issued", map[string]interface{}{
+		"step":              2,
+		"from":              "Authorization Server",
+		"to":                "Client",
+		"issued_token_type": requestedTokenType,
+		"subject":           subject.Subject,
+		"subject_kind":      subject.Kind,
+		"semantics":         semantics,
+		"act":               claims["act"],
+		"audience":          audience,
+		"scope":             scope,
+	}, annotation)
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// validateExchangeToken validates a subject or actor token according to its declared type
+func (p *Plugin) validateExchangeToken(ctx context.Context, token, tokenType string) (*exchangeToken, error) {
+	switch tokenType {
+	case TokenTypeAccessToken, TokenTypeIDToken:
+		return p.validateLocalJWT(token, tokenType)
+	case TokenTypeJWT:
+		// JWT-SVIDs are identified by their SPIFFE ID subject
+		decoded, err := decodeJWTPayload(token)
+		if err != nil {
+			return nil, err
+		}
+		if sub, _ := decoded["sub"].(string); strings.HasPrefix(sub, "spiffe://") {
+			return p.validateJWTSVID(ctx, token)
+		}
+		return p.validateLocalJWT(token, tokenType)
+	case TokenTypeSAML2:
+		return p.validateSAMLAssertion(token)
+	default:
+		return nil, fmt.Errorf("unsupported token type %q", tokenType)
+	}
+}
+
+// validateLocalJWT validates an access token or ID token issued by this authorization server.
+// A generic JWT may be either. Only an access token grants a scope; an ID token names the user
+// and nothing more.
+func (p *Plugin) validateLocalJWT(token, tokenType string) (*exchangeToken, error) {
+	// A refresh token is redeemed at the refresh grant, where rotation and revocation apply, and
+	// is never exchanged, whether it is live, rotated or revoked
+	if _, err := p.mockIdP.ResolveRefreshToken(token); err == nil {
+		return nil, errors.New("refresh tokens cannot be exchanged")
+	}
+
+	var claims map[string]interface{}
+	var err error
+	isIDToken := tokenType == TokenTypeIDToken
+	if !isIDToken {
+		claims, err = p.mockIdP.ResolveToken(token)
+		if err == nil {
+			err = p.CheckAccessTokenActive(claims)
+		}
+	}
+	if isIDToken || (tokenType == TokenTypeJWT && err != nil) {
+		claims, err = p.mockIdP.ValidateIDToken(token)
+		isIDToken = err == nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	// An ID token issued to a pairwise client names the user by the sub of the client's sector
+	if aud, _ := claims["aud"].(string); isIDToken && aud != "" {
+		sub = p.mockIdP.ResolveSubject(aud, sub)
+	}
+	if sub == "" {
+		return nil, errors.New("token has no subject")
+	}
+	iss, _ := claims["iss"].(string)
+	scope := ""
+	if !isIDToken {
+		scope, _ = claims["scope"].(string)
+	}
+
+	kind := "jwt"
+	switch tokenType {
+	case TokenTypeAccessToken:
+		kind = "access_token"
+	case TokenTypeIDToken:
+		kind = "id_token"
+	}
+
+	return &exchangeToken{
+		Subject: sub,
+		Issuer:  iss,
+		Scope:   scope,
+		Kind:    kind,
+		Claims:  claims,
+	}, nil
+}
+
+// validateJWTSVID validates a SPIFFE JWT-SVID against the trust bundle of the SPIFFE workload
+// connection. Without one the signature cannot be verified, so the token is rejected.
+func (p *Plugin) validateJWTSVID(ctx context.Context, token string) (*exchangeToken, error) {
+	if p.svidValidator == nil {
+		return nil, errors.New("JWT-SVIDs cannot be verified without a SPIFFE trust bundle")
+	}
+	audiences := []string{p.baseURL + "/oauth2/token", p.mockIdP.GetIssuer(), "protocolsoup"}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	svid, err := p.svidValidator.ValidateJWTSVID(ctx, token, audiences)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exchangeToken{
+		Subject: svid.ID.String(),
+		Issuer:  "spiffe://" + svid.ID.TrustDomain().String(),
+		Kind:    "jwt-svid",
+		Claims:  svid.Claims,
+	}, nil
+}
+
+// validateSAMLAssertion validates a base64url-encoded SAML 2.0 assertion (RFC 8693 Section 3)
+// signed by this server's SAML identity provider
+func (p *Plugin) validateSAMLAssertion(token string) (*exchangeToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(token, "="))
+	if err != nil {
+		return nil, errors.New("SAML assertion must be base64url encoded")
+	}
+
+	if p.samlVerifier == nil {
+		return nil, errors.New("no trusted SAML identity provider is configured")
+	}
+	assertion, err := p.samlVerifier.VerifyAssertion(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML assertion: %w", err)
+	}
+
+	samlIssuer := p.baseURL + "/saml"
+	if assertion.Issuer == nil || assertion.Issuer.Value != samlIssuer {
+		return nil, errors.New("assertion was not issued by the trusted SAML identity provider")
+	}
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, errors.New("assertion has no subject NameID")
+	}
+
+	if c := assertion.Conditions; c != nil {
+		now := time.Now().UTC()
+		if c.NotBefore != "" {
+			if nb, err := time.Parse(saml.SAMLTimeFormat, c.NotBefore); err == nil && now.Add(time.Minute).Before(nb) {
+				return nil, errors.New("assertion is not yet valid")
+			}
+		}
+		if c.NotOnOrAfter != "" {
+			if exp, err := time.Parse(saml.SAMLTimeFormat, c.NotOnOrAfter); err == nil && !now.Before(exp) {
+				return nil, errors.New("assertion has expired")
+			}
+		}
+	}
+
+	// Map the NameID back to a local user when possible
+	subject := assertion.Subject.NameID.Value
+	if user, ok := p.mockIdP.GetUserByEmail(subject); ok {
+		subject = user.ID
+	}
+
+	claims := map[string]interface{}{
+		"name_id":        assertion.Subject.NameID.Value,
+		"name_id_format": assertion.Subject.NameID.Format,
+		"assertion_id":   assertion.ID,
+	}
+
+	return &exchangeToken{
+		Subject: subject,
+		Issuer:  samlIssuer,
+		Kind:    "saml2",
+		Claims:  claims,
+	}, nil
+}
+
+func (p *Plugin) emitExchangeTokenValidated(sessionID, title string, t *exchangeToken) {
+	p.emitEvent(sessionID, lookingglass.EventTypeTokenValidated, title, map[string]interface{}{
+		"kind":    t.Kind,
+		"subject": t.Subject,
+		"issuer":  t.Issuer,
+		"scope":   t.Scope,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Signature Verified",
+		Description: "The token's signature was verified against its issuer's trust anchor before any of its claims were used",
+		Reference:   "RFC 8693 Section 5",
+	})
+}
+
+// decodeJWTPayload decodes a JWT payload without verifying its signature
+func decodeJWTPayload(token string) (map[string]interface{}, error) {
+	decoded, err := crypto.DecodeTokenWithoutValidation(token)
+	if err != nil {
+		return nil, err
+	}
+	return decoded.Payload, nil
+}
+
+// ScopeSubset reports whether every scope in requested is present in granted
+func ScopeSubset(requested, granted string) bool {
+	grantedSet := make(map[string]bool)
+	for _, s := range strings.Fields(granted) {
+		grantedSet[s] = true
+	}
+	for _, s := range strings.Fields(requested) {
+		if !grantedSet[s] {
+			return false
+		}
+	}
+	return true
+}
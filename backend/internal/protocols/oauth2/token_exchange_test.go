@@ -0,0 +1,187 @@
+package oauth2
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/saml"
+)
+
+// newExchangePlugin returns a plugin that trusts the assertions of a SAML identity provider
+// sharing its key set
+func newExchangePlugin(t *testing.T) (*Plugin, *saml.Plugin) {
+	t.Helper()
+	p := newTestPlugin(t)
+	samlPlugin := saml.NewPlugin()
+	if err := samlPlugin.Initialize(context.Background(), testPluginConfig(p.keySet, p.mockIdP)); err != nil {
+		t.Fatalf("saml Initialize: %v", err)
+	}
+	p.SetSAMLAssertionVerifier(samlPlugin)
+	return p, samlPlugin
+}
+
+func newTestAssertion(samlPlugin *saml.Plugin) *saml.Assertion {
+	return saml.NewAssertion(samlPlugin.EntityID(), testBaseURL, "alice@example.com", saml.NameIDFormatEmail, saml.GenerateID(), nil)
+}
+
+func exchangeSAML(p *Plugin, assertion []byte, scope string) *httptest.ResponseRecorder {
+	form := url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {base64.RawURLEncoding.EncodeToString(assertion)},
+		"subject_token_type": {TokenTypeSAML2},
+	}
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+	return postToken(p, "exchange-client", "exchange-secret", form)
+}
+
+func TestTokenExchangeAcceptsSignedSAMLAssertion(t *testing.T) {
+	p, samlPlugin := newExchangePlugin(t)
+	signed, err := saml.SignAssertion(newTestAssertion(samlPlugin), p.keySet.RSAPrivateKey(), samlPlugin.SigningCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := exchangeSAML(p, signed, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	body := decodeJSON(t, w)
+	if body["scope"] != nil && body["scope"] != "" {
+		t.Errorf("scope = %v, want none from an assertion without scope", body["scope"])
+	}
+	claims, err := p.mockIdP.ResolveToken(body["access_token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "alice" {
+		t.Errorf("sub = %v, want alice", claims["sub"])
+	}
+}
+
+func TestTokenExchangeRejectsUnsignedSAMLAssertion(t *testing.T) {
+	p, samlPlugin := newExchangePlugin(t)
+	unsigned, err := xml.Marshal(newTestAssertion(samlPlugin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOAuth2Error(t, exchangeSAML(p, unsigned, ""), "invalid_grant")
+}
+
+func TestTokenExchangeRejectsTamperedSAMLAssertion(t *testing.T) {
+	p, samlPlugin := newExchangePlugin(t)
+	signed, err := saml.SignAssertion(newTestAssertion(samlPlugin), p.keySet.RSAPrivateKey(), samlPlugin.SigningCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(signed, []byte("alice@example.com"), []byte("admin@example.com"), 1)
+	expectOAuth2Error(t, exchangeSAML(p, tampered, ""), "invalid_grant")
+}
+
+func TestTokenExchangeRejectsSAMLWithoutTrustedIdP(t *testing.T) {
+	p, samlPlugin := newExchangePlugin(t)
+	signed, err := saml.SignAssertion(newTestAssertion(samlPlugin), p.keySet.RSAPrivateKey(), samlPlugin.SigningCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetSAMLAssertionVerifier(nil)
+	expectOAuth2Error(t, exchangeSAML(p, signed, ""), "invalid_grant")
+}
+
+func TestTokenExchangeDeniesScopeWhenSubjectHasNone(t *testing.T) {
+	p, samlPlugin := newExchangePlugin(t)
+	signed, err := saml.SignAssertion(newTestAssertion(samlPlugin), p.keySet.RSAPrivateKey(), samlPlugin.SigningCertificate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOAuth2Error(t, exchangeSAML(p, signed, "api:write"), "invalid_scope")
+}
+
+func TestTokenExchangeRejectsUnverifiedJWTSVID(t *testing.T) {
+	p := newTestPlugin(t)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JWT","kid":"k"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"spiffe://example.org/admin","aud":["protocolsoup"],"exp":%d}`,
+		time.Now().Add(time.Hour).Unix())))
+	svid := header + "." + payload + "." + base64.RawURLEncoding.EncodeToString([]byte("forged"))
+
+	w := postToken(p, "exchange-client", "exchange-secret", url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {svid},
+		"subject_token_type": {TokenTypeJWT},
+	})
+	expectOAuth2Error(t, w, "invalid_grant")
+}
+
+func TestTokenExchangeNeverWidensScope(t *testing.T) {
+	p := newTestPlugin(t)
+	subject, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+		Subject:  "alice",
+		ClientID: "exchange-client",
+		Scope:    "api:read",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := postToken(p, "exchange-client", "exchange-secret", url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {subject},
+		"subject_token_type": {TokenTypeAccessToken},
+		"scope":              {"api:read api:write"},
+	})
+	expectOAuth2Error(t, w, "invalid_scope")
+}
+
+func TestTokenExchangeChecksIDTokenType(t *testing.T) {
+	p := newTestPlugin(t)
+	idToken, err := p.mockIdP.JWTService().CreateIDToken("alice", "exchange-client", "", time.Now(), time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{Subject: "alice", ClientID: "exchange-client"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange := func(token, tokenType string) *httptest.ResponseRecorder {
+		return postToken(p, "exchange-client", "exchange-secret", url.Values{
+			"grant_type":         {GrantTypeTokenExchange},
+			"subject_token":      {token},
+			"subject_token_type": {tokenType},
+		})
+	}
+
+	if w := exchange(idToken, TokenTypeIDToken); w.Code != http.StatusOK {
+		t.Fatalf("ID token exchange: status = %d: %s", w.Code, w.Body.String())
+	}
+	expectOAuth2Error(t, exchange(accessToken, TokenTypeIDToken), "invalid_grant")
+	expectOAuth2Error(t, exchange(idToken, TokenTypeAccessToken), "invalid_grant")
+}
+
+func TestTokenExchangeRejectsRefreshTokens(t *testing.T) {
+	p := newTestPlugin(t)
+	refreshToken, err := p.mockIdP.JWTService().CreateRefreshToken("alice", "demo-app", "openid profile api:read", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mockIdP.StoreRefreshToken(refreshToken, "demo-app", "alice", "openid profile api:read", "", time.Now(), time.Now().Add(time.Hour))
+	p.mockIdP.RevokeRefreshToken(refreshToken)
+
+	for _, tokenType := range []string{TokenTypeIDToken, TokenTypeJWT, TokenTypeAccessToken} {
+		w := postToken(p, "exchange-client", "exchange-secret", url.Values{
+			"grant_type":         {GrantTypeTokenExchange},
+			"subject_token":      {refreshToken},
+			"subject_token_type": {tokenType},
+		})
+		expectOAuth2Error(t, w, "invalid_grant")
+	}
+}
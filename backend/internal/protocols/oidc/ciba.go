@@ -0,0 +1,912 @@
+package oidc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/oauth2"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// authReqIDClaim binds a pushed ID token to its authentication request (OpenID CIBA Core 1.0 Section 10.3.1)
+const authReqIDClaim = "urn:openid:params:jwt:claim:auth_req_id"
+
+const (
+	// errorUnknownUserID is returned when the hint does not identify a user (OpenID CIBA Core 1.0 Section 13)
+	errorUnknownUserID = "unknown_user_id"
+	// maxBindingMessageLength keeps the binding message short enough to show on a phone screen
+	maxBindingMessageLength = 64
+	// maxCIBANotifications is how many callbacks the demo client notification endpoint keeps
+	maxCIBANotifications = 50
+)
+
+// cibaNotification is a callback received by the demo client notification endpoint
+type cibaNotification struct {
+	ReceivedAt    time.Time              `json:"received_at"`
+	Mode          string                 `json:"mode"`
+	AuthReqID     string                 `json:"auth_req_id"`
+	ClientID      string                 `json:"client_id"`
+	TokenVerified bool                   `json:"client_notification_token_verified"`
+	Body          map[string]interface{} `json:"body"`
+}
+
+// handleBackchannelAuthentication handles the backchannel authentication endpoint (OpenID CIBA Core 1.0 Section 7)
+func (p *Plugin) handleBackchannelAuthentication(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	if err := r.ParseForm(); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
+		return
+	}
+
+	clientID := oauth2.RequestClientID(r)
+	scope := r.FormValue("scope")
+	loginHint := r.FormValue("login_hint")
+	idTokenHint := r.FormValue("id_token_hint")
+	bindingMessage := r.FormValue("binding_message")
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Backchannel Authentication Request", map[string]interface{}{
+		"step":            1,
+		"from":            "Client",
+		"to":              "OpenID Provider",
+		"client_id":       clientID,
+		"scope":           scope,
+		"login_hint":      loginHint,
+		"has_id_token":    idTokenHint != "",
+		"binding_message": bindingMessage,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Client-Initiated Backchannel Authentication",
+		Description: "The client asks the OpenID Provider to authenticate a user it can identify but cannot redirect, such as a caller at a help desk or a shopper at a till. The user answers on their own authentication device.",
+		Reference:   "OpenID CIBA Core 1.0 Section 7.1",
+	})
+
+	client, err := p.oauth2Plugin.AuthenticateClient(r, sessionID)
+	if err != nil || client.Public {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
+			"client_id": clientID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Confidential Clients Only",
+			Description: "Anyone who knows a user's identifier could otherwise start authentication requests in their name, so the backchannel endpoint only accepts authenticated confidential clients",
+			Severity:    "warning",
+			Reference:   "OpenID CIBA Core 1.0 Section 7.1",
+		})
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	reject := func(code, description string) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Backchannel Authentication Rejected", map[string]interface{}{
+			"client_id": client.ID,
+			"error":     code,
+			"reason":    description,
+		})
+		writeOIDCError(w, http.StatusBadRequest, code, description)
+	}
+
+	if !oauth2.ClientHasGrantType(client, mockidp.GrantTypeCIBA) {
+		reject("unauthorized_client", "Client is not registered for the CIBA grant")
+		return
+	}
+	if !hasScope(scope, "openid") {
+		reject("invalid_scope", "openid scope is required for CIBA")
+		return
+	}
+
+	hints := 0
+	for _, hint := range []string{loginHint, idTokenHint, r.FormValue("login_hint_token")} {
+		if hint != "" {
+			hints++
+		}
+	}
+	if hints != 1 {
+		reject("invalid_request", "Exactly one of login_hint, id_token_hint or login_hint_token is required")
+		return
+	}
+	if r.FormValue("login_hint_token") != "" {
+		reject("invalid_request", "login_hint_token is not supported; use login_hint or id_token_hint")
+		return
+	}
+
+	if len(bindingMessage) > maxBindingMessageLength {
+		reject("invalid_binding_message", fmt.Sprintf("binding_message must be at most %d characters", maxBindingMessageLength))
+		return
+	}
+
+	var requestedExpiry time.Duration
+	if raw := r.FormValue("requested_expiry"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 {
+			reject("invalid_request", "requested_expiry must be a positive integer")
+			return
+		}
+		requestedExpiry = time.Duration(seconds) * time.Second
+	}
+
+	mode := client.BackchannelTokenDeliveryMode
+	if mode == "" {
+		mode = mockidp.DeliveryModePoll
+	}
+	notificationToken := r.FormValue("client_notification_token")
+	if mode != mockidp.DeliveryModePoll {
+		if notificationToken == "" {
+			reject("invalid_request", "client_notification_token is required for "+mode+" mode")
+			return
+		}
+		if client.BackchannelClientNotificationEndpoint == "" {
+			reject("unauthorized_client", "Client has no registered backchannel_client_notification_endpoint")
+			return
+		}
+	}
+
+	var user *models.User
+	hintType := "login_hint"
+	if idTokenHint != "" {
+		hintType = "id_token_hint"
+		user, err = p.mockIdP.UserFromIDTokenHint(idTokenHint)
+	} else {
+		user, err = p.mockIdP.ResolveLoginHint(loginHint)
+	}
+	if err != nil {
+		reject(errorUnknownUserID, err.Error())
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "User Identified from Hint", map[string]interface{}{
+		"hint_type": hintType,
+		"user_id":   user.ID,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Hint Resolution",
+		Description: "The hint only says which user to ask; it proves nothing about them. The user still has to authenticate and consent on their own device.",
+		Reference:   "OpenID CIBA Core 1.0 Section 7.1",
+	})
+
+	req := p.mockIdP.CreateBackchannelAuthentication(&models.BackchannelAuthentication{
+		ClientID:                client.ID,
+		UserID:                  user.ID,
+		Scope:                   scope,
+		BindingMessage:          bindingMessage,
+		DeliveryMode:            mode,
+		ClientNotificationToken: notificationToken,
+		LookingGlassSession:     sessionID,
+	}, requestedExpiry)
+
+	response := models.BackchannelAuthenticationResponse{
+		AuthReqID: req.AuthReqID,
+		ExpiresIn: int(time.Until(req.ExpiresAt).Seconds()),
+		Interval:  req.Interval,
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Authentication Request Acknowledged", map[string]interface{}{
+		"step":          2,
+		"from":          "OpenID Provider",
+		"to":            "Client",
+		"auth_req_id":   req.AuthReqID,
+		"delivery_mode": mode,
+		"expires_in":    response.ExpiresIn,
+		"interval":      response.Interval,
+		"device_uri":    p.baseURL + "/oidc/ciba/device?auth_req_id=" + url.QueryEscape(req.AuthReqID),
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Token Delivery: " + mode,
+		Description: deliveryModeDescription(mode),
+		Reference:   "OpenID CIBA Core 1.0 Section 5",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleCIBAGrant redeems an auth_req_id at the token endpoint in poll and ping mode (OpenID CIBA Core 1.0 Section 10.1)
+func (p *Plugin) handleCIBAGrant(w http.ResponseWriter, r *http.Request, sessionID string) {
+	authReqID := r.FormValue("auth_req_id")
+
+	client, err := p.oauth2Plugin.AuthenticateClient(r, sessionID)
+	if err != nil || client.Public {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Authentication Failed", map[string]interface{}{
+			"client_id": oauth2.RequestClientID(r),
+		})
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+	if !oauth2.ClientHasGrantType(client, mockidp.GrantTypeCIBA) {
+		writeOIDCError(w, http.StatusBadRequest, "unauthorized_client", "Client is not registered for the CIBA grant")
+		return
+	}
+	if client.BackchannelTokenDeliveryMode == mockidp.DeliveryModePush {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Push Mode Client Polled", map[string]interface{}{
+			"client_id": client.ID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Tokens Are Only Pushed",
+			Description: "A push mode client receives its tokens at the notification endpoint and never redeems auth_req_id at the token endpoint",
+			Severity:    "warning",
+			Reference:   "OpenID CIBA Core 1.0 Section 10.3",
+		})
+		writeOIDCError(w, http.StatusBadRequest, "unauthorized_client", "Push mode clients receive tokens at their notification endpoint")
+		return
+	}
+
+	// Transitions are also reported to the session that started the request
+	if req, exists := p.mockIdP.GetBackchannelAuthentication(authReqID); exists && sessionID == "" {
+		sessionID = req.LookingGlassSession
+	}
+
+	req, err := p.mockIdP.PollBackchannelAuthentication(authReqID, client.ID)
+	switch {
+	case errors.Is(err, mockidp.ErrAuthorizationPending):
+		p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "CIBA Poll: Authorization Pending", map[string]interface{}{
+			"step":        5,
+			"from":        "Client",
+			"to":          "OpenID Provider",
+			"result":      "authorization_pending",
+			"auth_req_id": authReqID,
+			"interval":    req.Interval,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Authorization Pending",
+			Description: "The user has not answered on their authentication device yet",
+			Reference:   "OpenID CIBA Core 1.0 Section 11",
+		})
+		writeOIDCError(w, http.StatusBadRequest, "authorization_pending", "The user has not yet been authenticated")
+		return
+	case errors.Is(err, mockidp.ErrSlowDown):
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "CIBA Poll: Slow Down", map[string]interface{}{
+			"step":         5,
+			"from":         "Client",
+			"to":           "OpenID Provider",
+			"result":       "slow_down",
+			"auth_req_id":  authReqID,
+			"new_interval": req.Interval,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Polling Too Fast",
+			Description: "The client polled faster than the interval allows and must wait 5 seconds longer between polls from now on",
+			Severity:    "warning",
+			Reference:   "OpenID CIBA Core 1.0 Section 11",
+		})
+		writeOIDCError(w, http.StatusBadRequest, "slow_down", "Polling too frequently; increase interval by 5 seconds")
+		return
+	case errors.Is(err, mockidp.ErrAccessDenied):
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "CIBA Poll: Access Denied", map[string]interface{}{
+			"step":        5,
+			"from":        "Client",
+			"to":          "OpenID Provider",
+			"result":      "access_denied",
+			"auth_req_id": authReqID,
+		})
+		writeOIDCError(w, http.StatusBadRequest, "access_denied", "The user denied the authentication request")
+		return
+	case errors.Is(err, mockidp.ErrExpiredToken):
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "CIBA Poll: Expired Token", map[string]interface{}{
+			"step":        5,
+			"from":        "Client",
+			"to":          "OpenID Provider",
+			"result":      "expired_token",
+			"auth_req_id": authReqID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Authentication Request Expired",
+			Description: "The user did not answer before auth_req_id expired. The client must start a new backchannel authentication request.",
+			Reference:   "OpenID CIBA Core 1.0 Section 11",
+		})
+		writeOIDCError(w, http.StatusBadRequest, "expired_token", "The auth_req_id has expired")
+		return
+	case err != nil:
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "auth_req_id Validation Failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		writeOIDCError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+
+	tokenResponse, err := p.issueOIDCTokens(&models.AuthorizationCode{
+		ClientID:  client.ID,
+		UserID:    req.UserID,
+		Scope:     req.Scope,
+		CreatedAt: req.AuthTime,
+	}, oauth2.RequestTokenBinding(r), nil, nil)
+	if err != nil {
+		writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to issue tokens")
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeTokenIssued, "CIBA Tokens Issued", map[string]interface{}{
+		"step":          6,
+		"from":          "OpenID Provider",
+		"to":            "Client",
+		"delivery_mode": req.DeliveryMode,
+		"token_type":    tokenResponse.TokenType,
+		"has_id_token":  tokenResponse.IDToken != "",
+		"scope":         tokenResponse.Scope,
+		"expires_in":    tokenResponse.ExpiresIn,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "auth_req_id Redeemed",
+		Description: "The user approved the request, so the token endpoint returns tokens and the auth_req_id is consumed",
+		Reference:   "OpenID CIBA Core 1.0 Section 10.1.1",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(w).Encode(tokenResponse)
+}
+
+// handleAuthenticationDevice shows the simulated authentication device: a single request with
+// ?auth_req_id, or else the pending requests of the users signed in to this browser
+func (p *Plugin) handleAuthenticationDevice(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+	pending := p.devicePending(r, r.URL.Query().Get("auth_req_id"))
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Authentication Device Opened", map[string]interface{}{
+		"step":          3,
+		"from":          "User",
+		"to":            "Authentication Device",
+		"pending_count": len(pending),
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Decoupled Authentication",
+		Description: "The user authenticates on a device the OpenID Provider trusts, such as a banking app on their phone, not on the client's device",
+		Reference:   "OpenID CIBA Core 1.0 Section 1",
+	})
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pending": pending,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(p.generateAuthenticationDevicePage(pending, sessionID, "")))
+}
+
+// handleAuthenticationDeviceSubmit records the user's approve or deny decision for an auth_req_id
+// and delivers the result to ping and push mode clients
+func (p *Plugin) handleAuthenticationDeviceSubmit(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	if err := r.ParseForm(); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
+		return
+	}
+
+	authReqID := r.FormValue("auth_req_id")
+	action := r.FormValue("action")
+
+	fail := func(status int, message string) {
+		if wantsJSON(r) {
+			writeOIDCError(w, status, "invalid_request", message)
+			return
+		}
+		page := p.generateAuthenticationDevicePage(p.devicePending(r, authReqID), sessionID, message)
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(status)
+		w.Write([]byte(page))
+	}
+
+	req, exists := p.mockIdP.GetBackchannelAuthentication(authReqID)
+	if !exists {
+		fail(http.StatusBadRequest, "That authentication request is unknown or has expired")
+		return
+	}
+	if req.LookingGlassSession != "" {
+		sessionID = req.LookingGlassSession
+	}
+
+	user, exists := p.mockIdP.GetUser(req.UserID)
+	if !exists {
+		fail(http.StatusBadRequest, "That authentication request is unknown or has expired")
+		return
+	}
+	if _, err := p.mockIdP.ValidateCredentials(user.Email, r.FormValue("password")); err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Authentication Device: Login Failed", map[string]interface{}{
+			"auth_req_id": authReqID,
+			"user_id":     user.ID,
+			"locked":      errors.Is(err, mockidp.ErrAccountLocked),
+		})
+		if errors.Is(err, mockidp.ErrAccountLocked) {
+			fail(http.StatusUnauthorized, oauth2.LoginErrorMessage(err))
+			return
+		}
+		fail(http.StatusUnauthorized, "Incorrect password")
+		return
+	}
+
+	if action == "deny" {
+		req, err := p.mockIdP.DenyBackchannelAuthentication(authReqID, user.ID)
+		if err != nil {
+			fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "User Denied Authentication Request", map[string]interface{}{
+			"step":          4,
+			"from":          "User",
+			"to":            "OpenID Provider",
+			"auth_req_id":   authReqID,
+			"user_id":       user.ID,
+			"delivery_mode": req.DeliveryMode,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Access Denied",
+			Description: "The user declined on their device. The client learns this as access_denied: on its next poll, after a ping, or in the push callback.",
+			Reference:   "OpenID CIBA Core 1.0 Section 12",
+		})
+		p.deliverBackchannelResult(req)
+		p.writeDeviceResult(w, r, req, "Request Denied", "The client will not be granted access. You can close this window.")
+		return
+	}
+
+	req, err := p.mockIdP.ApproveBackchannelAuthentication(authReqID, user.ID)
+	if err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "User Approved Authentication Request", map[string]interface{}{
+		"step":            4,
+		"from":            "User",
+		"to":              "OpenID Provider",
+		"auth_req_id":     authReqID,
+		"user_id":         user.ID,
+		"scope":           req.Scope,
+		"binding_message": req.BindingMessage,
+		"delivery_mode":   req.DeliveryMode,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Binding Message",
+		Description: "Showing the same binding message on the client and the authentication device lets the user confirm they are approving the transaction in front of them and not one started by an attacker",
+		Reference:   "OpenID CIBA Core 1.0 Section 7.1",
+	})
+	p.deliverBackchannelResult(req)
+	p.writeDeviceResult(w, r, req, "Request Approved", "You have signed in. Return to the application to continue.")
+}
+
+// devicePending returns the pending requests the authentication device may show: the one named
+// by authReqID, which only the client and the device it was sent to know, or else those of the
+// users signed in to this browser. Other users' requests are never listed.
+func (p *Plugin) devicePending(r *http.Request, authReqID string) []*models.BackchannelAuthentication {
+	pending := make([]*models.BackchannelAuthentication, 0)
+	if authReqID != "" {
+		for _, req := range p.mockIdP.ListPendingBackchannelAuthentications("") {
+			if req.AuthReqID == authReqID {
+				pending = append(pending, req)
+			}
+		}
+		return pending
+	}
+	for _, session := range p.browserSessions(r) {
+		pending = append(pending, p.mockIdP.ListPendingBackchannelAuthentications(session.UserID)...)
+	}
+	return pending
+}
+
+// deliverBackchannelResult notifies ping and push mode clients that the user has answered.
+// Poll mode clients find out on their next token request. The callbacks run in the background,
+// so they are given a copy of the request.
+func (p *Plugin) deliverBackchannelResult(req *models.BackchannelAuthentication) {
+	delivered := *req
+	switch req.DeliveryMode {
+	case mockidp.DeliveryModePing:
+		go p.sendPing(&delivered)
+	case mockidp.DeliveryModePush:
+		go p.sendPush(&delivered)
+	default:
+		p.emitEvent(req.LookingGlassSession, lookingglass.EventTypeFlowStep, "Waiting for Client Poll", map[string]interface{}{
+			"step":        5,
+			"auth_req_id": req.AuthReqID,
+			"status":      req.Status,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Poll Mode",
+			Description: "The OpenID Provider does not contact the client. The result is returned on the client's next token request with auth_req_id.",
+			Reference:   "OpenID CIBA Core 1.0 Section 10.1",
+		})
+	}
+}
+
+// sendPing tells a ping mode client that auth_req_id can be redeemed (OpenID CIBA Core 1.0 Section 10.2)
+func (p *Plugin) sendPing(req *models.BackchannelAuthentication) {
+	endpoint := p.notificationEndpoint(req.ClientID)
+
+	status, err := p.notifyClient(endpoint, req.ClientNotificationToken, map[string]string{
+		"auth_req_id": req.AuthReqID,
+	})
+	if err != nil {
+		p.emitNotificationFailed(req, endpoint, err)
+		return
+	}
+
+	p.emitEvent(req.LookingGlassSession, lookingglass.EventTypeRequestSent, "Ping Callback Sent", map[string]interface{}{
+		"step":        5,
+		"from":        "OpenID Provider",
+		"to":          "Client",
+		"endpoint":    endpoint,
+		"auth_req_id": req.AuthReqID,
+		"status":      status,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Ping Delivery",
+		Description: "The callback carries only auth_req_id, authenticated with the client_notification_token. The client then fetches the result from the token endpoint exactly as in poll mode.",
+		Reference:   "OpenID CIBA Core 1.0 Section 10.2",
+	})
+}
+
+// sendPush delivers tokens, or the denial, directly to a push mode client (OpenID CIBA Core 1.0 Section 10.3)
+func (p *Plugin) sendPush(req *models.BackchannelAuthentication) {
+	// The result can only be delivered once
+	defer p.mockIdP.DeleteBackchannelAuthentication(req.AuthReqID)
+
+	endpoint := p.notificationEndpoint(req.ClientID)
+
+	if req.Status == models.DeviceStatusDenied {
+		status, err := p.notifyClient(endpoint, req.ClientNotificationToken, map[string]string{
+			"auth_req_id":       req.AuthReqID,
+			"error":             "access_denied",
+			"error_description": "The user denied the authentication request",
+		})
+		if err != nil {
+			p.emitNotificationFailed(req, endpoint, err)
+			return
+		}
+		p.emitEvent(req.LookingGlassSession, lookingglass.EventTypeRequestSent, "Push Error Callback Sent", map[string]interface{}{
+			"step":        5,
+			"from":        "OpenID Provider",
+			"to":          "Client",
+			"endpoint":    endpoint,
+			"auth_req_id": req.AuthReqID,
+			"error":       "access_denied",
+			"status":      status,
+		})
+		return
+	}
+
+	tokens, err := p.issueOIDCTokens(&models.AuthorizationCode{
+		ClientID:  req.ClientID,
+		UserID:    req.UserID,
+		Scope:     req.Scope,
+		CreatedAt: req.AuthTime,
+	}, oauth2.TokenBinding{}, nil, nil)
+	if err == nil {
+		tokens.IDToken, err = p.pushedIDToken(req, tokens)
+	}
+	if err != nil {
+		p.emitNotificationFailed(req, endpoint, err)
+		return
+	}
+
+	status, err := p.notifyClient(endpoint, req.ClientNotificationToken, struct {
+		AuthReqID string `json:"auth_req_id"`
+		*models.TokenResponse
+	}{req.AuthReqID, tokens})
+	if err != nil {
+		p.emitNotificationFailed(req, endpoint, err)
+		return
+	}
+
+	p.emitEvent(req.LookingGlassSession, lookingglass.EventTypeTokenIssued, "Tokens Pushed to Client", map[string]interface{}{
+		"step":        6,
+		"from":        "OpenID Provider",
+		"to":          "Client",
+		"endpoint":    endpoint,
+		"auth_req_id": req.AuthReqID,
+		"scope":       tokens.Scope,
+		"status":      status,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeSecurityHint,
+		Title:       "Pushed ID Token Binding",
+		Description: "The pushed ID token carries the auth_req_id claim plus at_hash and rt_hash. The client must check them so a forged callback cannot swap in tokens from a different request.",
+		Severity:    "info",
+		Reference:   "OpenID CIBA Core 1.0 Section 10.3.1",
+	})
+}
+
+// pushedIDToken creates the ID token of a push mode token delivery, which must be bound to the
+// auth_req_id and to the access and refresh tokens delivered with it, and encrypts it like any
+// other ID token of the client
+func (p *Plugin) pushedIDToken(req *models.BackchannelAuthentication, tokens *models.TokenResponse) (string, error) {
+	claims := p.mockIdP.IDTokenClaims(req.ClientID, req.UserID, strings.Fields(req.Scope), nil)
+	claims[authReqIDClaim] = req.AuthReqID
+	claims["at_hash"] = tokenHash(tokens.AccessToken)
+	if tokens.RefreshToken != "" {
+		claims["rt_hash"] = tokenHash(tokens.RefreshToken)
+	}
+	idToken, err := p.mockIdP.JWTService().CreateIDToken(p.mockIdP.SubjectIdentifier(req.ClientID, req.UserID), req.ClientID, "", req.AuthTime, time.Hour, claims)
+	if err != nil {
+		return "", err
+	}
+	return p.mockIdP.EncryptIDToken(req.ClientID, idToken)
+}
+
+// notificationEndpoint returns the registered backchannel notification endpoint of a client
+func (p *Plugin) notificationEndpoint(clientID string) string {
+	if client, exists := p.mockIdP.GetClient(clientID); exists {
+		return client.BackchannelClientNotificationEndpoint
+	}
+	return ""
+}
+
+// emitNotificationFailed reports a ping or push callback that could not be delivered
+func (p *Plugin) emitNotificationFailed(req *models.BackchannelAuthentication, endpoint string, err error) {
+	p.emitEvent(req.LookingGlassSession, lookingglass.EventTypeSecurityWarning, "Client Notification Failed", map[string]interface{}{
+		"endpoint":      endpoint,
+		"auth_req_id":   req.AuthReqID,
+		"delivery_mode": req.DeliveryMode,
+		"error":         err.Error(),
+	})
+}
+
+// handleClientNotification is the demo client's backchannel notification endpoint. It plays the part
+// of the ping and push clients so the callbacks can be inspected (OpenID CIBA Core 1.0 Section 10.2, 10.3).
+func (p *Plugin) handleClientNotification(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Notification body must be JSON")
+		return
+	}
+
+	notification := cibaNotification{
+		ReceivedAt: time.Now(),
+		Mode:       mockidp.DeliveryModePing,
+		Body:       body,
+	}
+	notification.AuthReqID, _ = body["auth_req_id"].(string)
+	if _, hasTokens := body["access_token"]; hasTokens {
+		notification.Mode = mockidp.DeliveryModePush
+	} else if _, hasError := body["error"]; hasError {
+		notification.Mode = mockidp.DeliveryModePush
+	}
+
+	sessionID := p.getSessionFromRequest(r)
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if req, exists := p.mockIdP.GetBackchannelAuthentication(notification.AuthReqID); exists {
+		sessionID = req.LookingGlassSession
+		notification.ClientID = req.ClientID
+		notification.TokenVerified = req.ClientNotificationToken != "" &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(req.ClientNotificationToken)) == 1
+	}
+
+	if !notification.TokenVerified {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Notification Rejected", map[string]interface{}{
+			"auth_req_id": notification.AuthReqID,
+			"mode":        notification.Mode,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeVulnerability,
+			Title:       "Unauthenticated Callback",
+			Description: "The bearer token did not match the client_notification_token sent with the authentication request, so the callback may be forged",
+			Severity:    "warning",
+			Reference:   "OpenID CIBA Core 1.0 Section 10.2",
+		})
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", "Invalid client_notification_token")
+		return
+	}
+
+	p.recordCIBANotification(notification)
+
+	p.emitEvent(sessionID, lookingglass.EventTypeResponseReceived, "Client Notification Received", map[string]interface{}{
+		"auth_req_id": notification.AuthReqID,
+		"mode":        notification.Mode,
+		"has_tokens":  body["access_token"] != nil,
+		"error":       body["error"],
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeBestPractice,
+		Title:       "Notification Token Verified",
+		Description: "The client checks the bearer token against the client_notification_token it chose, proving the callback came from the OpenID Provider",
+		Reference:   "OpenID CIBA Core 1.0 Section 10.2",
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListClientNotifications returns the callbacks received by the demo client notification
+// endpoint. Pushed callbacks carry tokens, so a client must authenticate and sees only its own.
+func (p *Plugin) handleListClientNotifications(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+	client, err := p.oauth2Plugin.AuthenticateClient(r, sessionID)
+	if err != nil {
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+	authReqID := r.URL.Query().Get("auth_req_id")
+
+	p.notificationsMu.Lock()
+	notifications := make([]cibaNotification, 0, len(p.cibaNotifications))
+	for _, n := range p.cibaNotifications {
+		if n.ClientID == client.ID && (authReqID == "" || n.AuthReqID == authReqID) {
+			notifications = append(notifications, n)
+		}
+	}
+	p.notificationsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+	})
+}
+
+// recordCIBANotification keeps a received callback, dropping the oldest beyond maxCIBANotifications
+func (p *Plugin) recordCIBANotification(n cibaNotification) {
+	p.notificationsMu.Lock()
+	defer p.notificationsMu.Unlock()
+
+	p.cibaNotifications = append(p.cibaNotifications, n)
+	if len(p.cibaNotifications) > maxCIBANotifications {
+		p.cibaNotifications = p.cibaNotifications[len(p.cibaNotifications)-maxCIBANotifications:]
+	}
+}
+
+// writeDeviceResult answers an authentication device decision as JSON or a result page
+func (p *Plugin) writeDeviceResult(w http.ResponseWriter, r *http.Request, req *models.BackchannelAuthentication, title, message string) {
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]string{
+			"auth_req_id":   req.AuthReqID,
+			"status":        req.Status,
+			"delivery_mode": req.DeliveryMode,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(oauth2.GenerateDeviceResultPage(title, message)))
+}
+
+// notifyClient POSTs a JSON callback to a client notification endpoint, authenticated with the
+// client_notification_token as a bearer token
+func (p *Plugin) notifyClient(endpoint, token string, payload interface{}) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	// Notification endpoints are client metadata, so they are reached through the guarded outbound client
+	resp, err := p.mockIdP.OutboundClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return resp.StatusCode, fmt.Errorf("notification endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// tokenHash computes at_hash and rt_hash: the left half of the SHA-256 digest, base64url encoded
+// (OpenID Connect Core 1.0 Section 3.1.3.6)
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// hasScope reports whether a space-separated scope string contains scope
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsJSON reports whether the caller asked for a JSON response instead of a page
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// deliveryModeDescription explains how a client in the given mode learns the result
+func deliveryModeDescription(mode string) string {
+	switch mode {
+	case mockidp.DeliveryModePing:
+		return "Once the user answers, the OpenID Provider pings the client's notification endpoint with auth_req_id and the client then fetches the tokens from the token endpoint"
+	case mockidp.DeliveryModePush:
+		return "Once the user answers, the OpenID Provider pushes the tokens straight to the client's notification endpoint; the client never calls the token endpoint"
+	default:
+		return "The client polls the token endpoint with auth_req_id, no faster than the interval, until the user answers"
+	}
+}
+
+// generateAuthenticationDevicePage renders the simulated authentication device
+func (p *Plugin) generateAuthenticationDevicePage(pending []*models.BackchannelAuthentication, lgSession, errorMessage string) string {
+	action := "/oidc/ciba/device"
+	if lgSession != "" {
+		action += "?lg_session=" + url.QueryEscape(lgSession)
+	}
+
+	var body strings.Builder
+	if errorMessage != "" {
+		body.WriteString(`<div class="error">` + html.EscapeString(errorMessage) + `</div>`)
+	}
+	if len(pending) == 0 {
+		body.WriteString(`
+        <div class="logo"><p>No authentication requests are waiting.</p></div>`)
+	}
+	for _, req := range pending {
+		clientName := req.ClientID
+		if client, exists := p.mockIdP.GetClient(req.ClientID); exists {
+			clientName = client.Name
+		}
+		userLabel := req.UserID
+		if user, exists := p.mockIdP.GetUser(req.UserID); exists {
+			userLabel = user.Email
+		}
+
+		body.WriteString(`
+        <form method="POST" action="` + html.EscapeString(action) + `" class="request">
+            <h2>` + html.EscapeString(clientName) + `</h2>
+            <p class="meta">Sign in as <strong>` + html.EscapeString(userLabel) + `</strong></p>
+            <p class="meta">Scope: ` + html.EscapeString(req.Scope) + `</p>`)
+		if req.BindingMessage != "" {
+			body.WriteString(`
+            <div class="binding">` + html.EscapeString(req.BindingMessage) + `</div>`)
+		}
+		body.WriteString(`
+            <input type="hidden" name="auth_req_id" value="` + html.EscapeString(req.AuthReqID) + `">
+            <div class="form-group">
+                <label>Password</label>
+                <input type="password" name="password" placeholder="password" required>
+            </div>
+            <button type="submit" name="action" value="approve">Approve</button>
+            <button type="submit" name="action" value="deny" class="secondary">Deny</button>
+        </form>`)
+	}
+
+	return `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Authentication Device - Protocol Showcase</title>
+    <style>` + oauth2.DevicePageStyles + cibaDeviceStyles + `</style>
+</head>
+<body>
+    <div class="container">
+        <div class="logo">
+            <h1>Protocol Showcase</h1>
+            <p>Authentication Device</p>
+        </div>
+` + body.String() + `
+    </div>
+</body>
+</html>`
+}
+
+const cibaDeviceStyles = `
+        .request { border-top: 1px solid rgba(255, 255, 255, 0.1); padding-top: 20px; margin-top: 20px; }
+        .request h2 { font-size: 18px; color: #fff; margin-bottom: 8px; }
+        .request .meta { font-size: 13px; color: #a1a1aa; margin-bottom: 4px; }
+        .binding {
+            font-family: monospace;
+            font-size: 20px;
+            text-align: center;
+            color: #fde68a;
+            background: rgba(234, 179, 8, 0.08);
+            border: 1px solid rgba(234, 179, 8, 0.25);
+            border-radius: 8px;
+            padding: 12px;
+            margin: 16px 0;
+        }
+    `
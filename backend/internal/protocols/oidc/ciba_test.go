@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+func newBackchannelRequest(p *Plugin, clientID, userID string) *models.BackchannelAuthentication {
+	return p.mockIdP.CreateBackchannelAuthentication(&models.BackchannelAuthentication{
+		ClientID:     clientID,
+		UserID:       userID,
+		Scope:        "openid",
+		DeliveryMode: mockidp.DeliveryModePoll,
+	}, 0)
+}
+
+func devicePendingCount(t *testing.T, p *Plugin, r *http.Request) int {
+	t.Helper()
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	p.handleAuthenticationDevice(w, r)
+	pending, _ := decodeJSON(t, w)["pending"].([]interface{})
+	return len(pending)
+}
+
+func TestAuthenticationDeviceListsOnlyOwnRequests(t *testing.T) {
+	p := newTestPlugin(t)
+	alice := newBackchannelRequest(p, "ciba-poll-app", "alice")
+	newBackchannelRequest(p, "ciba-poll-app", "bob")
+
+	if n := devicePendingCount(t, p, httptest.NewRequest(http.MethodGet, "/oidc/ciba/device", nil)); n != 0 {
+		t.Errorf("anonymous device lists %d requests", n)
+	}
+	if n := devicePendingCount(t, p, httptest.NewRequest(http.MethodGet, "/oidc/ciba/device?user_id=bob", nil)); n != 0 {
+		t.Errorf("user_id lists %d requests", n)
+	}
+	if n := devicePendingCount(t, p, httptest.NewRequest(http.MethodGet, "/oidc/ciba/device?auth_req_id="+alice.AuthReqID, nil)); n != 1 {
+		t.Errorf("auth_req_id lists %d requests, want 1", n)
+	}
+
+	session := p.mockIdP.CreateSession("alice", "demo-app", mockidp.ACRPassword)
+	r := httptest.NewRequest(http.MethodGet, "/oidc/ciba/device", nil)
+	r.AddCookie(&http.Cookie{Name: ssoCookieName, Value: session.ID})
+	if n := devicePendingCount(t, p, r); n != 1 {
+		t.Errorf("signed-in device lists %d requests, want alice's only", n)
+	}
+}
+
+func TestClientNotificationsRequireClientAuthentication(t *testing.T) {
+	p := newTestPlugin(t)
+	p.recordCIBANotification(cibaNotification{ReceivedAt: time.Now(), Mode: mockidp.DeliveryModePush, AuthReqID: "push-req", ClientID: "ciba-push-app",
+		Body: map[string]interface{}{"auth_req_id": "push-req", "access_token": "secret-token"}})
+	p.recordCIBANotification(cibaNotification{ReceivedAt: time.Now(), Mode: mockidp.DeliveryModePing, AuthReqID: "ping-req", ClientID: "ciba-ping-app",
+		Body: map[string]interface{}{"auth_req_id": "ping-req"}})
+
+	list := func(clientID, secret string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/oidc/ciba/client-notify", nil)
+		if clientID != "" {
+			r.SetBasicAuth(clientID, secret)
+		}
+		w := httptest.NewRecorder()
+		p.handleListClientNotifications(w, r)
+		return w
+	}
+
+	if w := list("", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous listing: status = %d", w.Code)
+	}
+	if w := list("ciba-push-app", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: status = %d", w.Code)
+	}
+	w := list("ciba-ping-app", "ciba-ping-secret")
+	notifications, _ := decodeJSON(t, w)["notifications"].([]interface{})
+	if len(notifications) != 1 || notifications[0].(map[string]interface{})["auth_req_id"] != "ping-req" {
+		t.Errorf("ping client sees %v, want only its own notification", notifications)
+	}
+}
+
+func TestCIBANotificationRefusesPrivateAddresses(t *testing.T) {
+	p := newTestPlugin(t)
+	notified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified++
+	}))
+	defer server.Close()
+
+	payload := map[string]string{"auth_req_id": "req-1"}
+	if _, err := p.notifyClient(server.URL, "token", payload); err == nil || notified != 0 {
+		t.Fatalf("notified a loopback address: err = %v", err)
+	}
+	p.mockIdP.SetPrivateNetworkFetches(true)
+	if status, err := p.notifyClient(server.URL, "token", payload); err != nil || status != http.StatusOK || notified != 1 {
+		t.Errorf("notification with private addresses allowed: status = %d, err = %v", status, err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
 	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
 )
 
 // handleUserInfo handles the UserInfo endpoint
@@ -25,35 +27,8 @@ func (p *Plugin) handleUserInfo(w http.ResponseWriter, r *http.Request) {
 		Reference:   "OpenID Connect Core 1.0 Section 5.3",
 	})
 
-	// Extract access token from Authorization header
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Missing Authorization", map[string]interface{}{
-			"error": "invalid_token",
-		})
-		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", "Missing Authorization header")
-		return
-	}
-
-	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid Authorization Format", map[string]interface{}{
-			"error": "expected_bearer",
-		})
-		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", "Invalid Authorization header format")
-		return
-	}
-
-	accessToken := parts[1]
-
-	// Validate the access token
-	jwtService := p.mockIdP.JWTService()
-	claims, err := jwtService.ValidateToken(accessToken)
-	if err != nil {
-		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Validation Failed", map[string]interface{}{
-			"error": err.Error(),
-		})
-		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", "Token validation failed")
+	claims, ok := p.authorizeResourceRequest(w, r, sessionID, mockidp.ProfileResource)
+	if !ok {
 		return
 	}
 
@@ -68,12 +43,19 @@ func (p *Plugin) handleUserInfo(w http.ResponseWriter, r *http.Request) {
 	scopeStr, _ := claims["scope"].(string)
 	scopes := strings.Split(scopeStr, " ")
 
+	// Claims requested individually for the UserInfo response travel in the access token
+	rawRequest, _ := claims[crypto.UserInfoClaimsClaim].(string)
+	requested, _ := mockidp.ParseClaimsRequestMember(rawRequest)
+
 	// Get user claims based on scopes
-	userClaims := p.mockIdP.CreateUserInfoResponse(userID, scopes)
+	// Pairwise clients are given the sub of their sector, as in their ID tokens
+	clientID, _ := claims["client_id"].(string)
+	userClaims := p.mockIdP.CreateUserInfoResponse(clientID, userID, scopes, requested)
 	if userClaims == nil {
 		writeOIDCError(w, http.StatusNotFound, "invalid_request", "User not found")
 		return
 	}
+	p.emitUnmetEssentialClaims(sessionID, "userinfo", requested, userClaims)
 
 	// Emit UserInfo response
 	p.emitEvent(sessionID, lookingglass.EventTypeResponseReceived, "UserInfo Response", map[string]interface{}{
@@ -87,6 +69,11 @@ func (p *Plugin) handleUserInfo(w http.ResponseWriter, r *http.Request) {
 		Reference:   "OpenID Connect Core 1.0 Section 5.4",
 	})
 
+	if client, exists := p.mockIdP.GetClient(clientID); exists && mockidp.UserInfoResponseIsJWT(client) {
+		p.writeUserInfoJWT(w, sessionID, client, userClaims)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(userClaims)
 }
@@ -350,6 +337,12 @@ var ScopeDefinitions = map[string]ScopeDefinition{
 		Required:    false,
 		Claims:      []string{"phone_number", "phone_number_verified"},
 	},
+	"groups": {
+		Name:        "groups",
+		Description: "Requests access to the groups Claim, the End-User's group memberships such as those provisioned over SCIM.",
+		Required:    false,
+		Claims:      []string{"groups"},
+	},
 }
 
 // ScopeDefinition defines metadata about an OIDC scope
@@ -0,0 +1,77 @@
+package oidc
+
+import (
+	"html"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// parseClaimsParameter parses the claims request parameter of an authentication request. When
+// acr_values is absent, an acr claim requested with values selects the authentication context
+// class instead (OIDC Core Section 5.5.1.1).
+func parseClaimsParameter(claims, acrValues string) (*mockidp.ClaimsRequest, string, error) {
+	claimsRequest, err := mockidp.ParseClaimsRequest(claims)
+	if err != nil {
+		return nil, acrValues, err
+	}
+	if acrValues == "" {
+		acrValues = strings.Join(claimsRequest.RequestedACRValues(), " ")
+	}
+	return claimsRequest, acrValues, nil
+}
+
+// withClaimsField carries the claims request parameter through the login form
+func withClaimsField(page, claims string) string {
+	if claims == "" {
+		return page
+	}
+	field := `<input type="hidden" name="claims" value="` + html.EscapeString(claims) + `">
+            `
+	return strings.Replace(page, `<input type="hidden" name="client_id"`, field+`<input type="hidden" name="client_id"`, 1)
+}
+
+// emitClaimsRequested reports the claims a client asked for individually
+func (p *Plugin) emitClaimsRequested(sessionID string, claimsRequest *mockidp.ClaimsRequest) {
+	if len(claimsRequest.UserInfo) == 0 && len(claimsRequest.IDToken) == 0 {
+		return
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Claims Requested", map[string]interface{}{
+		"userinfo": claimsRequest.UserInfo,
+		"id_token": claimsRequest.IDToken,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Claims Request Parameter",
+		Description: "Instead of whole scope bundles, the client names individual claims for the ID token and the UserInfo response. essential marks claims it needs, and value or values ask for a claim only with a particular value, such as an acr the login must reach.",
+		Reference:   "OpenID Connect Core 1.0 Section 5.5",
+	})
+}
+
+// emitUnmetEssentialClaims reports essential claims that a response does not contain with the requested value
+func (p *Plugin) emitUnmetEssentialClaims(sessionID, member string, requested map[string]*mockidp.ClaimRequest, claims map[string]interface{}) {
+	unmet := mockidp.UnmetEssentialClaims(requested, claims)
+	if len(unmet) == 0 {
+		return
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Essential Claims Not Released", map[string]interface{}{
+		"member": member,
+		"claims": unmet,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeSecurityHint,
+		Title:       "Unmet Essential Claims",
+		Description: "The provider has no value, or not the requested value, for these essential claims. This is not an error: the response is still issued and the client must check which claims it received before relying on them.",
+		Severity:    "warning",
+		Reference:   "OpenID Connect Core 1.0 Section 5.5.1",
+	})
+}
+
+// emitIDTokenClaims reports unmet essential claims of the ID token a user is about to receive
+func (p *Plugin) emitIDTokenClaims(sessionID string, claimsRequest *mockidp.ClaimsRequest, user *models.User, scope string, auth mockidp.Authentication) {
+	if len(claimsRequest.IDToken) == 0 {
+		return
+	}
+	userClaims := p.mockIdP.UserClaims(user.ID, strings.Fields(scope), claimsRequest.IDToken)
+	p.emitUnmetEssentialClaims(sessionID, "id_token", claimsRequest.IDToken, authenticationClaims(userClaims, auth))
+}
@@ -3,40 +3,102 @@ package oidc
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/oauth2"
 	"github.com/ParleSec/ProtocolSoup/pkg/models"
 )
 
 // handleDiscovery returns the OpenID Connect discovery document
 func (p *Plugin) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	discovery := p.DiscoveryDocument()
+	signed, err := p.oauth2Plugin.SignMetadata(discovery)
+	if err != nil {
+		writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to sign metadata")
+		return
+	}
+	discovery.SignedMetadata = signed
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(discovery)
+}
+
+// DiscoveryDocument builds the OpenID Provider metadata on top of the OAuth 2.0 authorization
+// server metadata. Endpoints this plugin serves replace the OAuth 2.0 ones when their routes are
+// mounted, and the grant and response types are the ones the OIDC handlers accept.
+func (p *Plugin) DiscoveryDocument() models.DiscoveryDocument {
 	issuer := p.mockIdP.GetIssuer()
+	routes := oauth2.MountedRoutes(p.routes)
+	endpoint := func(method, path string) string {
+		if !routes[method+" "+path] {
+			return ""
+		}
+		return issuer + "/oidc" + path
+	}
+
+	metadata := p.oauth2Plugin.AuthorizationServerMetadata()
+	metadata.AuthorizationEndpoint = endpoint(http.MethodGet, "/authorize")
+	metadata.TokenEndpoint = endpoint(http.MethodPost, "/token")
+	metadata.JwksURI = endpoint(http.MethodGet, "/.well-known/jwks.json")
+	metadata.PushedAuthorizationRequestEndpoint = endpoint(http.MethodPost, "/par")
+	// The device authorization grant is only redeemable at the OAuth 2.0 token endpoint
+	metadata.DeviceAuthorizationEndpoint = ""
+
+	responseTypes := make([]string, 0, len(validOIDCResponseTypes))
+	for responseType := range validOIDCResponseTypes {
+		responseTypes = append(responseTypes, responseType)
+	}
+	sort.Strings(responseTypes)
+	metadata.ResponseTypesSupported = responseTypes
+	metadata.ResponseModesSupported = append([]string{"query", "fragment"}, mockidp.JWTResponseModes...)
+	// Response types containing token or id_token are the implicit grant, issued by the authorization endpoint
+	metadata.GrantTypesSupported = append(oauth2.GrantTypes(p.grantHandlers()), "implicit")
 
 	discovery := models.DiscoveryDocument{
-		Issuer:                           issuer,
-		AuthorizationEndpoint:            issuer + "/oidc/authorize",
-		TokenEndpoint:                    issuer + "/oidc/token",
-		UserinfoEndpoint:                 issuer + "/oidc/userinfo",
-		JwksURI:                          issuer + "/oidc/.well-known/jwks.json",
-		RevocationEndpoint:               issuer + "/oauth2/revoke",
-		IntrospectionEndpoint:            issuer + "/oauth2/introspect",
-		ScopesSupported:                  []string{"openid", "profile", "email", "roles"},
-		ResponseTypesSupported:           []string{"code", "token", "id_token", "code token", "code id_token", "token id_token", "code token id_token"},
-		ResponseModesSupported:           []string{"query", "fragment"},
-		GrantTypesSupported:              []string{"authorization_code", "refresh_token", "client_credentials"},
-		SubjectTypesSupported:            []string{"public"},
-		IDTokenSigningAlgValuesSupported: []string{"RS256", "ES256"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		AuthorizationServerMetadata:      metadata,
+		UserinfoEndpoint:                 endpoint(http.MethodGet, "/userinfo"),
+		SubjectTypesSupported:            mockidp.SubjectTypesSupported,
+		IDTokenSigningAlgValuesSupported: p.mockIdP.JWTService().SigningAlgorithms(),
 		ClaimsSupported: []string{
 			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
 			"name", "given_name", "family_name", "preferred_username",
-			"email", "email_verified", "roles",
+			"email", "email_verified", "roles", "groups", "acr", "amr", "sid",
 		},
-		CodeChallengeMethodsSupported: []string{"S256", "plain"},
+		ACRValuesSupported:                mockidp.ACRValues,
+		PromptValuesSupported:             []string{"none", "login", "consent", "select_account"},
+		ClaimsParameterSupported:          true,
+		BackchannelAuthenticationEndpoint: endpoint(http.MethodPost, "/bc-authorize"),
+		EndSessionEndpoint:                endpoint(http.MethodGet, "/logout"),
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
-	json.NewEncoder(w).Encode(discovery)
+	// Endpoint aliases follow the OIDC endpoints that replaced the OAuth 2.0 ones
+	discovery.MTLSEndpointAliases = p.oauth2Plugin.MTLSEndpointAliases(metadata)
+	if discovery.MTLSEndpointAliases != nil && discovery.UserinfoEndpoint != "" {
+		discovery.MTLSEndpointAliases["userinfo_endpoint"] = p.oauth2Plugin.MTLSBaseURL() + "/oidc/userinfo"
+	}
+	if discovery.BackchannelAuthenticationEndpoint != "" {
+		discovery.BackchannelTokenDeliveryModesSupported = mockidp.SupportedDeliveryModes
+		// user_code is not supported, so the user is only asked to authenticate on their device
+		discovery.BackchannelUserCodeParameterSupported = false
+	}
+	if discovery.EndSessionEndpoint != "" {
+		// Logout tokens and front-channel logout URLs carry the sid of the ended session
+		discovery.FrontchannelLogoutSupported = true
+		discovery.FrontchannelLogoutSessionSupported = true
+		discovery.BackchannelLogoutSupported = true
+		discovery.BackchannelLogoutSessionSupported = true
+	}
+	// ID tokens and UserInfo responses are encrypted to the keys of clients that register for it
+	discovery.IDTokenEncryptionAlgValuesSupported = crypto.JWEKeyAlgorithms
+	discovery.IDTokenEncryptionEncValuesSupported = crypto.JWEContentEncryptionAlgorithms
+	if discovery.UserinfoEndpoint != "" {
+		discovery.UserInfoSigningAlgValuesSupported = mockidp.UserInfoSigningAlgorithms
+		discovery.UserInfoEncryptionAlgValuesSupported = crypto.JWEKeyAlgorithms
+		discovery.UserInfoEncryptionEncValuesSupported = crypto.JWEContentEncryptionAlgorithms
+	}
+	return discovery
 }
 
 // handleJWKS returns the JSON Web Key Set
@@ -60,10 +122,41 @@ func DiscoveryAnnotations() map[string]string {
 		"scopes_supported":                   "List of OAuth 2.0 scope values supported. Must include 'openid'.",
 		"response_types_supported":           "List of OAuth 2.0 response_type values supported.",
 		"grant_types_supported":              "List of OAuth 2.0 Grant Type values supported.",
-		"subject_types_supported":            "List of Subject Identifier types supported (public or pairwise).",
+		"subject_types_supported":            "List of Subject Identifier types supported. Pairwise clients receive a different sub per sector, so relying parties cannot correlate users by comparing identifiers.",
 		"id_token_signing_alg_values_supported": "List of JWS signing algorithms supported for ID Tokens.",
+		"token_endpoint_auth_methods_supported": "Client authentication methods accepted at the token endpoint. client_secret_jwt and private_key_jwt authenticate with a signed assertion instead of sending a secret (RFC 7523).",
+		"token_endpoint_auth_signing_alg_values_supported": "JWS algorithms accepted for client_secret_jwt (HMAC) and private_key_jwt (asymmetric) client assertions.",
 		"claims_supported":                   "List of Claim Names that may be returned in ID Tokens or UserInfo responses.",
 		"code_challenge_methods_supported":   "PKCE code challenge methods supported. S256 is recommended.",
+		"pushed_authorization_request_endpoint": "URL of the Pushed Authorization Request endpoint, where clients send authorization parameters over the back channel (RFC 9126).",
+		"require_pushed_authorization_requests": "Whether every client must use PAR. Individual clients can also be registered to require it.",
+		"dpop_signing_alg_values_supported":     "JWS algorithms accepted for DPoP proofs, which sender-constrain tokens to the client's key (RFC 9449).",
+		"authorization_details_types_supported": "Types accepted in the authorization_details parameter. Each type is validated against a registered JSON schema (RFC 9396).",
+		"backchannel_authentication_endpoint":        "URL where a client starts Client-Initiated Backchannel Authentication for a user identified by a hint (OpenID CIBA Core 1.0).",
+		"backchannel_token_delivery_modes_supported": "How CIBA results reach the client: poll the token endpoint, ping the client then let it fetch the tokens, or push the tokens to the client.",
+		"backchannel_user_code_parameter_supported":  "Whether the client may send a user_code the user must enter on their authentication device.",
+		"tls_client_certificate_bound_access_tokens": "Whether access tokens can be bound to the client's mutual TLS certificate with cnf.x5t#S256 (RFC 8705 Section 3).",
+		"mtls_endpoint_aliases":                      "Alternative endpoint URLs on the mutual TLS listener, where clients authenticate with tls_client_auth or obtain certificate-bound tokens (RFC 8705 Section 5).",
+		"request_parameter_supported":                    "Whether authorization requests may be sent as a signed request object in the request parameter (RFC 9101 Section 5.1).",
+		"request_uri_parameter_supported":                "Whether a request object may be passed by reference in request_uri. Only URLs the client registered in request_uris are fetched.",
+		"request_object_signing_alg_values_supported":    "JWS algorithms accepted for request objects: HMAC with the client secret, or asymmetric with the client's registered keys. none is never accepted.",
+		"request_object_encryption_alg_values_supported": "JWE key management algorithms for request objects encrypted to an enc key in the provider's JWKS, which keeps the parameters confidential from the browser.",
+		"request_object_encryption_enc_values_supported": "JWE content encryption algorithms accepted for encrypted request objects.",
+		"authorization_signing_alg_values_supported":     "JWS algorithms used to sign authorization responses in the jwt, query.jwt, fragment.jwt and form_post.jwt response modes (JARM).",
+		"acr_values_supported":                           "Authentication context classes a client may request in acr_values: a password login, or a password confirmed with a one-time code. The ID token reports the one performed in acr.",
+		"claims_parameter_supported":                     "Whether the claims request parameter may name individual claims for the ID token and UserInfo response, with essential, value and values (OIDC Core Section 5.5).",
+		"prompt_values_supported":                        "prompt values accepted at the authorization endpoint. none answers silently from the browser's SSO session or returns an error, login forces a new login, consent asks again for approval and select_account shows the account chooser.",
+		"end_session_endpoint":                       "URL where a client sends the user to log out, with id_token_hint and a registered post_logout_redirect_uri (OIDC RP-Initiated Logout 1.0).",
+		"frontchannel_logout_supported":              "Whether the logout page loads each client's frontchannel_logout_uri in an iframe so it can clear its session (OIDC Front-Channel Logout 1.0).",
+		"frontchannel_logout_session_supported":      "Whether front-channel logout URLs carry iss and sid, identifying the session that ended.",
+		"backchannel_logout_supported":               "Whether the provider POSTs a signed logout token to each client's backchannel_logout_uri when the user logs out (OIDC Back-Channel Logout 1.0).",
+		"backchannel_logout_session_supported":       "Whether logout tokens carry the sid of the session that ended, matching the sid claim of the client's ID token.",
+		"id_token_encryption_alg_values_supported":   "JWE key management algorithms for ID tokens encrypted to a key in the client's JWKS when it registers id_token_encrypted_response_alg. The signed ID token is nested inside the JWE.",
+		"id_token_encryption_enc_values_supported":   "JWE content encryption algorithms for encrypted ID tokens. A128CBC-HS256 is used when the client registers only the alg.",
+		"userinfo_signing_alg_values_supported":      "JWS algorithms for UserInfo responses returned as a signed JWT with iss and aud when the client registers userinfo_signed_response_alg.",
+		"userinfo_encryption_alg_values_supported":   "JWE key management algorithms for UserInfo responses encrypted to the client's key, signed first if the client also registered a signing algorithm.",
+		"userinfo_encryption_enc_values_supported":   "JWE content encryption algorithms for encrypted UserInfo responses.",
+		"signed_metadata":                            "JWT signed with the provider's key whose claims repeat this document. Clients that verify it detect metadata tampered with in transit or by a mix-up attacker (RFC 8414 Section 2.1).",
 	}
 }
 
@@ -116,6 +209,27 @@ func (p *Plugin) GetEndpointInfo() []DiscoveryEndpointInfo {
 			Description: "Returns OpenID Provider metadata. Starting point for OIDC client configuration.",
 			RFCSection:  "OpenID Connect Discovery 1.0",
 		},
+		{
+			Name:        "Pushed Authorization Request Endpoint",
+			URL:         issuer + "/oidc/par",
+			Method:      "POST",
+			Description: "Accepts authorization parameters directly from an authenticated client and returns a single-use request_uri.",
+			RFCSection:  "RFC 9126",
+		},
+		{
+			Name:        "Backchannel Authentication Endpoint",
+			URL:         issuer + "/oidc/bc-authorize",
+			Method:      "POST",
+			Description: "Starts a CIBA authentication for a user identified by login_hint or id_token_hint and returns an auth_req_id.",
+			RFCSection:  "OpenID CIBA Core 1.0 Section 7",
+		},
+		{
+			Name:        "End Session Endpoint",
+			URL:         issuer + "/oidc/logout",
+			Method:      "GET",
+			Description: "Logs the user out of the provider and notifies every client signed in to their sessions over the front and back channels.",
+			RFCSection:  "OIDC RP-Initiated Logout 1.0 Section 2",
+		},
 		{
 			Name:        "Revocation Endpoint",
 			URL:         issuer + "/oauth2/revoke",
@@ -130,6 +244,13 @@ func (p *Plugin) GetEndpointInfo() []DiscoveryEndpointInfo {
 			Description: "Returns metadata about a token (active status, claims, etc.).",
 			RFCSection:  "RFC 7662",
 		},
+		{
+			Name:        "Registration Endpoint",
+			URL:         issuer + "/oauth2/register",
+			Method:      "POST",
+			Description: "Registers a new client from JSON metadata and returns its credentials and a registration access token.",
+			RFCSection:  "RFC 7591",
+		},
 	}
 }
 
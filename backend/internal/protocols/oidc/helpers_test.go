@@ -0,0 +1,49 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/plugin"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/oauth2"
+)
+
+const testBaseURL = "http://localhost:8080"
+
+// newTestPlugin returns an initialized OIDC plugin and the OAuth 2.0 plugin it builds on, backed
+// by a provider with the demo users and clients in a memory store
+func newTestPlugin(t *testing.T) *Plugin {
+	t.Helper()
+	keySet, err := crypto.NewKeySet()
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	idp, err := mockidp.NewMockIdP(keySet, mockidp.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewMockIdP: %v", err)
+	}
+	config := plugin.PluginConfig{BaseURL: testBaseURL, KeySet: keySet, MockIdP: idp}
+	oauth2Plugin := oauth2.NewPlugin()
+	if err := oauth2Plugin.Initialize(context.Background(), config); err != nil {
+		t.Fatalf("oauth2 Initialize: %v", err)
+	}
+	p := NewPlugin(oauth2Plugin)
+	if err := p.Initialize(context.Background(), config); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return p
+}
+
+// decodeJSON decodes a JSON response body
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, w.Body.String())
+	}
+	return body
+}
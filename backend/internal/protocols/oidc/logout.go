@@ -0,0 +1,580 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/oauth2"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// maxLogoutNotifications is how many logouts the demo relying party keeps
+const maxLogoutNotifications = 50
+
+// demoLogoutClients are the demo clients whose logouts are received by the demo relying party
+var demoLogoutClients = []string{"demo-app", "public-app", "news-app", "shop-app"}
+
+// logoutNotification is a logout received by the demo relying party
+type logoutNotification struct {
+	ReceivedAt time.Time `json:"received_at"`
+	Channel    string    `json:"channel"`
+	ClientID   string    `json:"client_id,omitempty"`
+	Issuer     string    `json:"iss,omitempty"`
+	Subject    string    `json:"sub,omitempty"`
+	SessionID  string    `json:"sid,omitempty"`
+	Verified   bool      `json:"verified"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// logoutCSRFCookieName is the cookie holding the token the logout confirmation form must echo
+const logoutCSRFCookieName = "oidc_logout_csrf"
+
+// logoutConfirmationLifetime is how long the user has to confirm a logout
+const logoutConfirmationLifetime = 10 * time.Minute
+
+// handleEndSession handles the end session endpoint (OIDC RP-Initiated Logout 1.0 Section 2). The
+// browser's session of the user ends, every client signed in to it is notified over the front and
+// back channels, and the user is returned to the client's registered post_logout_redirect_uri.
+// Sessions the user has in other browsers are left alone.
+func (p *Plugin) handleEndSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := p.getSessionFromRequest(r)
+
+	if err := r.ParseForm(); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
+		return
+	}
+	idTokenHint := r.FormValue("id_token_hint")
+	logoutHint := r.FormValue("logout_hint")
+	clientID := r.FormValue("client_id")
+	postLogoutRedirectURI := r.FormValue("post_logout_redirect_uri")
+	state := r.FormValue("state")
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "RP-Initiated Logout Request", map[string]interface{}{
+		"step":                     1,
+		"from":                     "Client",
+		"to":                       "OpenID Provider",
+		"has_id_token_hint":        idTokenHint != "",
+		"logout_hint":              logoutHint,
+		"client_id":                clientID,
+		"post_logout_redirect_uri": postLogoutRedirectURI,
+	})
+
+	var user *models.User
+	hintSID := ""
+	if idTokenHint != "" {
+		hint, err := p.mockIdP.ParseIDTokenHint(idTokenHint)
+		if err != nil {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid id_token_hint", map[string]interface{}{
+				"error": err.Error(),
+			})
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if clientID != "" && clientID != hint.ClientID {
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request", "client_id does not match the audience of id_token_hint")
+			return
+		}
+		clientID = hint.ClientID
+		user = hint.User
+		hintSID = hint.SessionID
+	} else if logoutHint != "" {
+		// An unknown logout_hint is ignored rather than revealing which users exist
+		user, _ = p.mockIdP.ResolveLoginHint(logoutHint)
+	}
+
+	// Only a session this browser is signed in with can end here, so a hint alone cannot sign a
+	// user out of their other browsers. Without a hint the most recent account signs out.
+	var session *models.Session
+	for _, candidate := range p.browserSessions(r) {
+		if user == nil || candidate.UserID == user.ID {
+			session = candidate
+			break
+		}
+	}
+	if session != nil && user == nil {
+		if user, _ = p.mockIdP.GetUser(session.UserID); user == nil {
+			session = nil
+		}
+	}
+	if user != nil && session == nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "No Browser Session", map[string]interface{}{
+			"user_id": user.ID,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeSecurityHint,
+			Title:       "Hint Does Not Match the Browser",
+			Description: "The browser is not signed in as the hinted user, so no session ends. A logout request can only end the session of the browser that sends it.",
+			Reference:   "OIDC RP-Initiated Logout 1.0 Section 2",
+		})
+	}
+
+	if postLogoutRedirectURI != "" {
+		if clientID == "" {
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request", "post_logout_redirect_uri requires id_token_hint or client_id")
+			return
+		}
+		client, exists := p.mockIdP.GetClient(clientID)
+		if !exists {
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Unknown client")
+			return
+		}
+		if err := mockidp.ValidatePostLogoutRedirectURI(client, postLogoutRedirectURI); err != nil {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Unregistered Post-Logout Redirect", map[string]interface{}{
+				"client_id":                clientID,
+				"post_logout_redirect_uri": postLogoutRedirectURI,
+			}, lookingglass.Annotation{
+				Type:        lookingglass.AnnotationTypeSecurityHint,
+				Title:       "Open Redirect Prevention",
+				Description: "The user is only sent back to a post_logout_redirect_uri the client registered, compared exactly, so the logout endpoint cannot be used to redirect to an attacker's site",
+				Severity:    "warning",
+				Reference:   "OIDC RP-Initiated Logout 1.0 Section 3",
+			})
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+	}
+
+	// Without an id_token_hint for this very session the request may not come from a client the
+	// user signed in to, so the user confirms in a form only this provider's pages can submit
+	if session != nil && (idTokenHint == "" || (hintSID != "" && hintSID != session.ID)) && !logoutConfirmed(r) {
+		token := p.setLogoutCSRFCookie(w, r)
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(p.generateLogoutConfirmationPage(user, r.Form, token, sessionID)))
+		return
+	}
+
+	var frontchannelURLs []string
+	if session != nil {
+		if ended, ok := p.mockIdP.EndSession(session.ID); ok {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Session Ended", map[string]interface{}{
+				"step":    2,
+				"user_id": user.ID,
+				"sid":     ended.ID,
+			}, lookingglass.Annotation{
+				Type:        lookingglass.AnnotationTypeExplanation,
+				Title:       "Provider Logout",
+				Description: "The OpenID Provider ends the browser's session and revokes the refresh tokens granted in it. Clients keep their own sessions until they are told about the logout over the front or back channel.",
+				Reference:   "OIDC RP-Initiated Logout 1.0 Section 2",
+			})
+			frontchannelURLs = p.propagateLogout(sessionID, []*models.Session{ended})
+		}
+		p.forgetBrowserSessions(w, r, user.ID)
+	}
+
+	redirectURL := ""
+	if u, err := url.Parse(postLogoutRedirectURI); err == nil && postLogoutRedirectURI != "" {
+		if state != "" {
+			q := u.Query()
+			q.Set("state", state)
+			u.RawQuery = q.Encode()
+		}
+		redirectURL = u.String()
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "Logout Complete", map[string]interface{}{
+		"step":                 4,
+		"from":                 "OpenID Provider",
+		"to":                   "Client",
+		"frontchannel_iframes": len(frontchannelURLs),
+		"post_logout_redirect": redirectURL,
+	})
+
+	if len(frontchannelURLs) == 0 && redirectURL != "" {
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(generateLogoutPage(frontchannelURLs, redirectURL)))
+}
+
+// propagateLogout tells the clients signed in to the ended sessions about the logout. Logout
+// tokens are POSTed to back-channel logout URIs in parallel before the user is redirected; the
+// front-channel logout URLs are returned for the logout page to load in iframes.
+func (p *Plugin) propagateLogout(lgSession string, sessions []*models.Session) []string {
+	var wg sync.WaitGroup
+	frontchannelURLs := make([]string, 0)
+	for _, session := range sessions {
+		for _, clientID := range mockidp.SessionClients(session) {
+			client, exists := p.mockIdP.GetClient(clientID)
+			if !exists {
+				continue
+			}
+			if client.FrontchannelLogoutURI != "" {
+				if logoutURL := p.mockIdP.FrontchannelLogoutURL(client, session); !slices.Contains(frontchannelURLs, logoutURL) {
+					frontchannelURLs = append(frontchannelURLs, logoutURL)
+				}
+			}
+			if client.BackchannelLogoutURI != "" {
+				wg.Add(1)
+				go func(client *models.Client, session *models.Session) {
+					defer wg.Done()
+					p.sendLogoutToken(lgSession, client, session)
+				}(client, session)
+			}
+		}
+	}
+	wg.Wait()
+
+	if len(frontchannelURLs) > 0 {
+		p.emitEvent(lgSession, lookingglass.EventTypeFlowStep, "Front-Channel Logout", map[string]interface{}{
+			"step":    3,
+			"from":    "OpenID Provider",
+			"to":      "Client",
+			"iframes": frontchannelURLs,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Logout Through the Browser",
+			Description: "The logout page loads each client's frontchannel_logout_uri in a hidden iframe, with iss and sid when the client asked for them, so the client can clear its cookies. It depends on third-party cookies, which browsers increasingly block.",
+			Reference:   "OIDC Front-Channel Logout 1.0 Section 3",
+		})
+	}
+	return frontchannelURLs
+}
+
+// sendLogoutToken POSTs a logout token to a client's back-channel logout URI (OIDC Back-Channel Logout 1.0 Section 2.5)
+func (p *Plugin) sendLogoutToken(lgSession string, client *models.Client, session *models.Session) {
+	logoutToken, err := p.mockIdP.CreateLogoutToken(client, session)
+	if err != nil {
+		p.emitEvent(lgSession, lookingglass.EventTypeSecurityWarning, "Logout Token Failed", map[string]interface{}{
+			"client_id": client.ID,
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	status, err := p.deliverLogoutToken(client.BackchannelLogoutURI, logoutToken)
+	data := map[string]interface{}{
+		"step":         3,
+		"from":         "OpenID Provider",
+		"to":           "Client",
+		"client_id":    client.ID,
+		"endpoint":     client.BackchannelLogoutURI,
+		"sid":          session.ID,
+		"logout_token": logoutToken,
+		"status":       status,
+	}
+	if err != nil {
+		data["error"] = err.Error()
+		p.emitEvent(lgSession, lookingglass.EventTypeSecurityWarning, "Back-Channel Logout Failed", data)
+		return
+	}
+	p.emitEvent(lgSession, lookingglass.EventTypeFlowStep, "Back-Channel Logout Delivered", data, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Logout Token",
+		Description: "The provider POSTs a signed logout+jwt to the client directly, without the browser. It names the user and session in sub and sid, carries the back-channel logout event, and never contains a nonce so it cannot be mistaken for an ID token.",
+		Reference:   "OIDC Back-Channel Logout 1.0 Section 2.4",
+	})
+}
+
+// deliverLogoutToken POSTs a logout token as a form parameter and reports the response status
+func (p *Plugin) deliverLogoutToken(endpoint, logoutToken string) (int, error) {
+	form := url.Values{"logout_token": {logoutToken}}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Logout URIs are client metadata, so they are reached through the guarded outbound client
+	resp, err := p.mockIdP.OutboundClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("back-channel logout endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// ============================================================================
+// Demo relying party
+// ============================================================================
+
+// handleDemoFrontchannelLogout is the demo clients' front-channel logout URI, loaded by the
+// provider's logout page in an iframe (OIDC Front-Channel Logout 1.0 Section 2)
+func (p *Plugin) handleDemoFrontchannelLogout(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	notification := logoutNotification{
+		ReceivedAt: time.Now(),
+		Channel:    "front-channel",
+		Issuer:     query.Get("iss"),
+		SessionID:  query.Get("sid"),
+	}
+	// The client only acts on a logout for its own issuer and a session it knows
+	notification.Verified = notification.Issuer == p.mockIdP.GetIssuer() && notification.SessionID != ""
+	if !notification.Verified {
+		notification.Error = "iss and sid do not identify a session issued by this provider"
+	}
+	p.recordLogoutNotification(notification)
+
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(oauth2.GenerateDeviceResultPage("Signed Out", "The demo application cleared its session.")))
+}
+
+// handleDemoBackchannelLogout is the demo clients' back-channel logout URI, which validates the
+// logout token before ending the session it names (OIDC Back-Channel Logout 1.0 Section 2.8)
+func (p *Plugin) handleDemoBackchannelLogout(w http.ResponseWriter, r *http.Request) {
+	notification := logoutNotification{
+		ReceivedAt: time.Now(),
+		Channel:    "back-channel",
+	}
+
+	claims, err := p.verifyLogoutToken(r.FormValue("logout_token"))
+	if claims != nil {
+		notification.Issuer, _ = claims.GetIssuer()
+		notification.Subject, _ = claims.GetSubject()
+		notification.SessionID, _ = claims["sid"].(string)
+		if aud, _ := claims.GetAudience(); len(aud) > 0 {
+			notification.ClientID = aud[0]
+		}
+	}
+	if err != nil {
+		notification.Error = err.Error()
+		p.recordLogoutNotification(notification)
+		w.Header().Set("Cache-Control", "no-store")
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	notification.Verified = true
+	p.recordLogoutNotification(notification)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// verifyLogoutToken validates a logout token as a relying party must (OIDC Back-Channel Logout 1.0 Section 2.6).
+// The claims are returned whenever the token is well formed, even if it is rejected.
+func (p *Plugin) verifyLogoutToken(logoutToken string) (jwt.MapClaims, error) {
+	if logoutToken == "" {
+		return nil, errors.New("missing logout_token")
+	}
+	token, err := jwt.Parse(logoutToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA:
+			return p.keySet.RSAPublicKey(), nil
+		case *jwt.SigningMethodECDSA:
+			return p.keySet.ECPublicKey(), nil
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+	}, jwt.WithIssuer(p.mockIdP.GetIssuer()), jwt.WithIssuedAt(), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("invalid logout token: %w", err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if typ, _ := token.Header["typ"].(string); typ != crypto.LogoutTokenType {
+		return claims, fmt.Errorf("logout token typ must be %s", crypto.LogoutTokenType)
+	}
+	aud, _ := claims.GetAudience()
+	if !slices.ContainsFunc(aud, func(clientID string) bool { return slices.Contains(demoLogoutClients, clientID) }) {
+		return claims, errors.New("logout token is not addressed to a demo client")
+	}
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[crypto.BackchannelLogoutEvent].(map[string]interface{}); !ok {
+		return claims, errors.New("logout token is missing the back-channel logout event")
+	}
+	if _, hasNonce := claims["nonce"]; hasNonce {
+		return claims, errors.New("logout token must not contain a nonce")
+	}
+	sub, _ := claims.GetSubject()
+	sid, _ := claims["sid"].(string)
+	if sub == "" && sid == "" {
+		return claims, errors.New("logout token must contain sub or sid")
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return claims, errors.New("logout token must contain jti")
+	}
+	if !p.acceptLogoutTokenJTI(jti, claims) {
+		return claims, errors.New("logout token was already used")
+	}
+	return claims, nil
+}
+
+// acceptLogoutTokenJTI records a logout token's jti, reporting false if it was seen before
+func (p *Plugin) acceptLogoutTokenJTI(jti string, claims jwt.MapClaims) bool {
+	p.logoutsMu.Lock()
+	defer p.logoutsMu.Unlock()
+
+	now := time.Now()
+	for seen, expiry := range p.logoutTokenJTIs {
+		if expiry.Before(now) {
+			delete(p.logoutTokenJTIs, seen)
+		}
+	}
+	if _, seen := p.logoutTokenJTIs[jti]; seen {
+		return false
+	}
+	expiry, _ := claims.GetExpirationTime()
+	p.logoutTokenJTIs[jti] = expiry.Time
+	return true
+}
+
+// handleDemoLoggedOut is the demo clients' post_logout_redirect_uri
+func (p *Plugin) handleDemoLoggedOut(w http.ResponseWriter, r *http.Request) {
+	message := "You have been signed out of the demo application."
+	if state := r.URL.Query().Get("state"); state != "" {
+		message += " State: " + state
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(oauth2.GenerateDeviceResultPage("Signed Out", message)))
+}
+
+// handleListLogoutNotifications returns the logouts received by the demo relying party
+func (p *Plugin) handleListLogoutNotifications(w http.ResponseWriter, r *http.Request) {
+	sid := r.URL.Query().Get("sid")
+
+	p.logoutsMu.Lock()
+	notifications := make([]logoutNotification, 0, len(p.logoutNotifications))
+	for _, n := range p.logoutNotifications {
+		if sid == "" || n.SessionID == sid {
+			notifications = append(notifications, n)
+		}
+	}
+	p.logoutsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"logouts": notifications,
+	})
+}
+
+// recordLogoutNotification keeps a received logout, dropping the oldest beyond maxLogoutNotifications
+func (p *Plugin) recordLogoutNotification(n logoutNotification) {
+	p.logoutsMu.Lock()
+	defer p.logoutsMu.Unlock()
+
+	p.logoutNotifications = append(p.logoutNotifications, n)
+	if len(p.logoutNotifications) > maxLogoutNotifications {
+		p.logoutNotifications = p.logoutNotifications[len(p.logoutNotifications)-maxLogoutNotifications:]
+	}
+}
+
+// ============================================================================
+// Pages
+// ============================================================================
+
+// setLogoutCSRFCookie sets a new random token the logout confirmation form must echo and returns
+// it. The cookie is SameSite=Strict, so a form posted from another site never carries it.
+func (p *Plugin) setLogoutCSRFCookie(w http.ResponseWriter, r *http.Request) string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     logoutCSRFCookieName,
+		Value:    token,
+		Path:     "/oidc/logout",
+		MaxAge:   int(logoutConfirmationLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   p.secureCookies(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// logoutConfirmed reports whether the request is the POSTed logout confirmation form, carrying
+// the token of the browser's CSRF cookie
+func logoutConfirmed(r *http.Request) bool {
+	if r.Method != http.MethodPost || r.PostFormValue("confirm") != "yes" {
+		return false
+	}
+	cookie, err := r.Cookie(logoutCSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostFormValue("csrf_token"))) == 1
+}
+
+// generateLogoutConfirmationPage asks the user to confirm a logout that was requested without an
+// id_token_hint for the browser's session
+func (p *Plugin) generateLogoutConfirmationPage(user *models.User, form url.Values, csrfToken, lgSession string) string {
+	action := "/oidc/logout"
+	if lgSession != "" {
+		action += "?lg_session=" + url.QueryEscape(lgSession)
+	}
+	fields := ""
+	for _, name := range []string{"id_token_hint", "logout_hint", "client_id", "post_logout_redirect_uri", "state"} {
+		if value := form.Get(name); value != "" {
+			fields += `
+            <input type="hidden" name="` + name + `" value="` + htmlEscape(value) + `">`
+		}
+	}
+
+	return `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Sign Out - Protocol Showcase</title>
+    <style>` + oauth2.DevicePageStyles + `</style>
+</head>
+<body>
+    <div class="container">
+        <div class="logo">
+            <h1>Sign Out</h1>
+            <p>Sign ` + htmlEscape(user.Email) + ` out of this browser and the applications signed in with it?</p>
+        </div>
+        <form method="POST" action="` + htmlEscape(action) + `">` + fields + `
+            <input type="hidden" name="csrf_token" value="` + htmlEscape(csrfToken) + `">
+            <input type="hidden" name="confirm" value="yes">
+            <button type="submit">Sign Out</button>
+        </form>
+    </div>
+</body>
+</html>`
+}
+
+// generateLogoutPage loads the front-channel logout URLs in hidden iframes, then continues to the
+// post-logout redirect once every iframe has loaded
+func generateLogoutPage(frontchannelURLs []string, redirectURL string) string {
+	iframes := ""
+	for _, logoutURL := range frontchannelURLs {
+		iframes += `
+        <iframe src="` + htmlEscape(logoutURL) + `" style="display:none"></iframe>`
+	}
+	message := "You have been signed out."
+	if len(frontchannelURLs) > 0 {
+		message += fmt.Sprintf(" Signing you out of %d application(s) too.", len(frontchannelURLs))
+	}
+	next := ""
+	if redirectURL != "" {
+		next = `
+            <p><a href="` + htmlEscape(redirectURL) + `" style="color:#a5b4fc">Continue</a></p>`
+	}
+
+	return `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Signed Out - Protocol Showcase</title>
+    <style>` + oauth2.DevicePageStyles + `</style>
+</head>
+<body data-next="` + htmlEscape(redirectURL) + `" onload="if (this.dataset.next) window.location.replace(this.dataset.next)">
+    <div class="container">
+        <div class="logo">
+            <h1>Signed Out</h1>
+            <p>` + message + `</p>` + next + `
+        </div>` + iframes + `
+    </div>
+</body>
+</html>`
+}
@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+)
+
+var csrfTokenField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// endSession calls the end session endpoint from a browser whose SSO cookie names sid
+func endSession(p *Plugin, method, sid string, params url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var r *http.Request
+	if method == http.MethodPost {
+		r = httptest.NewRequest(method, "/oidc/logout", strings.NewReader(params.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, "/oidc/logout?"+params.Encode(), nil)
+	}
+	if sid != "" {
+		r.AddCookie(&http.Cookie{Name: ssoCookieName, Value: sid})
+	}
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	p.handleEndSession(w, r)
+	return w
+}
+
+func sessionExists(p *Plugin, sid string) bool {
+	_, exists := p.mockIdP.GetSession(sid)
+	return exists
+}
+
+func TestLogoutHintRequiresConfirmedPost(t *testing.T) {
+	p := newTestPlugin(t)
+	here := p.mockIdP.CreateSession("alice", "jar-app", mockidp.ACRPassword)
+	elsewhere := p.mockIdP.CreateSession("alice", "jar-app", mockidp.ACRPassword)
+	hint := url.Values{"logout_hint": {"alice@example.com"}, "confirm": {"yes"}}
+
+	// A link with confirm=yes only shows the confirmation page
+	w := endSession(p, http.MethodGet, here.ID, hint)
+	if !sessionExists(p, here.ID) {
+		t.Fatal("GET with confirm=yes ended the session")
+	}
+	match := csrfTokenField.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("no confirmation form: %s", w.Body.String())
+	}
+	var csrfCookie *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == logoutCSRFCookieName {
+			csrfCookie = cookie
+		}
+	}
+	if csrfCookie == nil || csrfCookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("CSRF cookie = %+v", csrfCookie)
+	}
+
+	// A cross-site POST carries neither the cookie nor the token
+	endSession(p, http.MethodPost, here.ID, hint)
+	if !sessionExists(p, here.ID) {
+		t.Fatal("POST without the CSRF token ended the session")
+	}
+	forged := url.Values{"logout_hint": {"alice@example.com"}, "confirm": {"yes"}, "csrf_token": {"guess"}}
+	endSession(p, http.MethodPost, here.ID, forged, csrfCookie)
+	if !sessionExists(p, here.ID) {
+		t.Fatal("POST with a wrong CSRF token ended the session")
+	}
+
+	confirmed := url.Values{"logout_hint": {"alice@example.com"}, "confirm": {"yes"}, "csrf_token": {match[1]}}
+	if w := endSession(p, http.MethodPost, here.ID, confirmed, csrfCookie); w.Code != http.StatusOK {
+		t.Fatalf("confirmed logout: status = %d: %s", w.Code, w.Body.String())
+	}
+	if sessionExists(p, here.ID) {
+		t.Error("confirmed logout kept the browser's session")
+	}
+	if !sessionExists(p, elsewhere.ID) {
+		t.Error("logout ended the user's session in another browser")
+	}
+}
+
+func TestLogoutHintForAnotherUserEndsNothing(t *testing.T) {
+	p := newTestPlugin(t)
+	alice := p.mockIdP.CreateSession("alice", "jar-app", mockidp.ACRPassword)
+	bob := p.mockIdP.CreateSession("bob", "jar-app", mockidp.ACRPassword)
+
+	w := endSession(p, http.MethodGet, alice.ID, url.Values{"logout_hint": {"bob"}})
+	if csrfTokenField.MatchString(w.Body.String()) {
+		t.Error("confirmation offered for a user the browser is not signed in as")
+	}
+	if !sessionExists(p, alice.ID) || !sessionExists(p, bob.ID) {
+		t.Error("a session ended")
+	}
+}
+
+func TestIDTokenHintEndsOnlyItsBrowserSession(t *testing.T) {
+	p := newTestPlugin(t)
+	here := p.mockIdP.CreateSession("alice", "jar-app", mockidp.ACRPassword)
+	elsewhere := p.mockIdP.CreateSession("alice", "jar-app", mockidp.ACRPassword)
+	idToken, err := p.mockIdP.JWTService().CreateIDToken("alice", "jar-app", "", time.Now(), time.Hour, map[string]interface{}{"sid": here.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hint := url.Values{"id_token_hint": {idToken}}
+
+	// From a browser that is not signed in with the hinted session, nothing ends
+	endSession(p, http.MethodGet, "", hint)
+	if !sessionExists(p, here.ID) {
+		t.Fatal("id_token_hint ended a session without the browser's cookie")
+	}
+
+	if w := endSession(p, http.MethodGet, here.ID, hint); w.Code != http.StatusOK || csrfTokenField.MatchString(w.Body.String()) {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if sessionExists(p, here.ID) {
+		t.Error("hinted browser session kept")
+	}
+	if !sessionExists(p, elsewhere.ID) {
+		t.Error("logout ended the user's session in another browser")
+	}
+}
+
+func TestLogoutTokenDeliveryRefusesPrivateAddresses(t *testing.T) {
+	p := newTestPlugin(t)
+	delivered := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered++
+	}))
+	defer server.Close()
+
+	if _, err := p.deliverLogoutToken(server.URL, "token"); err == nil || delivered != 0 {
+		t.Fatalf("delivered to a loopback address: err = %v", err)
+	}
+	p.mockIdP.SetPrivateNetworkFetches(true)
+	if status, err := p.deliverLogoutToken(server.URL, "token"); err != nil || status != http.StatusOK || delivered != 1 {
+		t.Errorf("delivery with private addresses allowed: status = %d, err = %v", status, err)
+	}
+}
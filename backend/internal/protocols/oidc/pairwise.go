@@ -0,0 +1,42 @@
+package oidc
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+)
+
+// emitPairwiseSubject reports the subject identifier a pairwise client is given for a user
+func (p *Plugin) emitPairwiseSubject(sessionID, clientID, userID string) {
+	client, exists := p.mockIdP.GetClient(clientID)
+	if !exists || client.SubjectType != mockidp.SubjectTypePairwise {
+		return
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Pairwise Subject Identifier", map[string]interface{}{
+		"client_id":             clientID,
+		"sector_identifier":     mockidp.SectorIdentifier(client),
+		"sector_identifier_uri": client.SectorIdentifierURI,
+		"sub":                   p.mockIdP.SubjectIdentifier(clientID, userID),
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Correlation Resistance",
+		Description: "The client is registered with subject_type pairwise, so its ID tokens, UserInfo responses, refresh tokens, introspection responses and logout tokens name the user by a salted hash of the user ID and the client's sector. Relying parties in other sectors receive unrelated values and cannot link their accounts by comparing sub.",
+		Reference:   "OpenID Connect Core 1.0 Section 8.1",
+	})
+}
+
+// handleDemoSectorIdentifier serves a sector identifier document listing the demo redirect URIs,
+// so dynamically registered pairwise clients can join the demo relying party's sector
+// (OIDC Dynamic Client Registration Section 5)
+func (p *Plugin) handleDemoSectorIdentifier(w http.ResponseWriter, r *http.Request) {
+	redirectURIs := []string{}
+	if client, exists := p.mockIdP.GetClient("demo-app"); exists {
+		redirectURIs = client.RedirectURIs
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(redirectURIs)
+}
@@ -0,0 +1,42 @@
+package oidc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+func TestUserInfoGivesPairwiseClientsTheirSectorSubject(t *testing.T) {
+	p := newTestPlugin(t)
+	userinfo := http.HandlerFunc(p.handleUserInfo)
+
+	subs := map[string]interface{}{}
+	for _, clientID := range []string{"news-app", "shop-app"} {
+		token, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+			Subject:  "alice",
+			ClientID: clientID,
+			Scope:    "openid profile",
+			AuthTime: time.Now(),
+		}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := callWithToken(userinfo, "/oidc/userinfo", token)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", clientID, w.Code, w.Body.String())
+		}
+		claims := decodeJSON(t, w)
+		if claims["sub"] != p.mockIdP.SubjectIdentifier(clientID, "alice") {
+			t.Errorf("%s: sub = %v, want the pairwise sub", clientID, claims["sub"])
+		}
+		if claims["preferred_username"] != nil {
+			t.Errorf("%s: given preferred_username %v", clientID, claims["preferred_username"])
+		}
+		subs[clientID] = claims["sub"]
+	}
+	if subs["news-app"] == subs["shop-app"] {
+		t.Errorf("clients of different sectors share sub %v", subs["news-app"])
+	}
+}
@@ -0,0 +1,35 @@
+package oidc
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// validOIDCResponseTypes are the response types accepted by the OIDC authorization endpoint
+var validOIDCResponseTypes = map[string]bool{
+	"code":           true,
+	"token":          true,
+	"id_token":       true,
+	"id_token token": true,
+	"token id_token": true,
+}
+
+// handlePushedAuthorizationRequest handles the OIDC PAR endpoint (RFC 9126) using the
+// OAuth 2.0 implementation with OpenID Connect parameter rules
+func (p *Plugin) handlePushedAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
+	p.oauth2Plugin.HandlePushedAuthorizationRequest(w, r, func(client *models.Client, params map[string]string) (string, string) {
+		if !strings.Contains(params["scope"], "openid") {
+			return "invalid_scope", "openid scope is required for OIDC"
+		}
+		if !validOIDCResponseTypes[params["response_type"]] {
+			return "unsupported_response_type", "Supported: code, token, id_token, id_token token"
+		}
+		if _, err := mockidp.ParseClaimsRequest(params["claims"]); err != nil {
+			return "invalid_request", err.Error()
+		}
+		return "", ""
+	})
+}
@@ -0,0 +1,127 @@
+package oidc
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/oauth2"
+)
+
+// authorizeResourceRequest validates the access token of a request to one of the provider's
+// protected resources, such as UserInfo or the step-up demo API. The token must be an active
+// at+jwt or reference token, be presented as its binding demands (the DPoP scheme and a proof
+// of its cnf.jkt key, or mutual TLS with its x5t#S256 certificate), and be issued for resource.
+// On failure the error response has been written and ok is false.
+func (p *Plugin) authorizeResourceRequest(w http.ResponseWriter, r *http.Request, sessionID, resource string) (map[string]interface{}, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Missing Authorization", map[string]interface{}{
+			"error": "invalid_token",
+		})
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", "Missing Authorization header")
+		return nil, false
+	}
+
+	parts := strings.SplitN(authHeader, " ", 2)
+	scheme := ""
+	if len(parts) == 2 {
+		scheme = strings.ToLower(parts[0])
+	}
+	if scheme != "bearer" && scheme != "dpop" {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid Authorization Format", map[string]interface{}{
+			"error": "expected_bearer_or_dpop",
+		})
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", "Invalid Authorization header format")
+		return nil, false
+	}
+
+	accessToken := parts[1]
+
+	// DPoP scheme: the request must carry a proof of possession for this token (RFC 9449 Section 7)
+	proofJKT := ""
+	if scheme == "dpop" {
+		proof, err := p.oauth2Plugin.ValidateDPoPProof(r, sessionID, accessToken)
+		if err != nil {
+			oauth2.WriteDPoPResourceError(w, err)
+			return nil, false
+		}
+		proofJKT = proof.Thumbprint
+	}
+
+	// Validate the access token
+	claims, err := p.mockIdP.ResolveToken(accessToken)
+	if err == nil {
+		err = p.oauth2Plugin.CheckAccessTokenActive(claims)
+	}
+	if err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Validation Failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", "Token validation failed")
+		return nil, false
+	}
+
+	// Sender-constrained tokens must be presented with the DPoP scheme and the bound key
+	tokenJKT := oauth2.TokenThumbprint(claims)
+	if tokenJKT != proofJKT {
+		reason := "DPoP proof key does not match the token's cnf.jkt"
+		if proofJKT == "" {
+			reason = "DPoP-bound token presented as a bearer token"
+		} else if tokenJKT == "" {
+			reason = "Bearer token presented with the DPoP scheme"
+		}
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Binding Check Failed", map[string]interface{}{
+			"scheme":    scheme,
+			"token_jkt": tokenJKT,
+			"proof_jkt": proofJKT,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeVulnerability,
+			Title:       "Sender Constraint Enforced",
+			Description: reason + ". Without this check a stolen DPoP token could be replayed as a plain bearer token.",
+			Severity:    "warning",
+			Reference:   "RFC 9449 Section 7.1",
+		})
+		if tokenJKT != "" {
+			oauth2.WriteDPoPResourceError(w, &oauth2.DPoPError{Code: "invalid_token", Description: reason})
+			return nil, false
+		}
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", reason)
+		return nil, false
+	}
+	if tokenJKT != "" {
+		p.emitEvent(sessionID, lookingglass.EventTypeTokenValidated, "DPoP Token Binding Verified", map[string]interface{}{
+			"jkt": tokenJKT,
+		})
+	}
+
+	// Certificate-bound tokens must arrive over mutual TLS with the bound certificate (RFC 8705 Section 3)
+	if err := p.oauth2Plugin.VerifyCertificateBinding(r, sessionID, claims); err != nil {
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return nil, false
+	}
+
+	// A token restricted to other APIs must not be replayed here
+	if !mockidp.AudienceAccepts(claims, resource) {
+		p.emitAudienceRejected(sessionID, claims["aud"], resource)
+		writeOIDCError(w, http.StatusUnauthorized, "invalid_token", "Access token audience does not include this resource")
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// emitAudienceRejected reports an access token presented to a resource it was not issued for
+func (p *Plugin) emitAudienceRejected(sessionID string, aud interface{}, resource string) {
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Token Audience Rejected", map[string]interface{}{
+		"aud":      aud,
+		"resource": resource,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeVulnerability,
+		Title:       "Cross-API Replay Blocked",
+		Description: "The access token is audience-restricted to other resources, so this resource server rejects it",
+		Severity:    "warning",
+		Reference:   "RFC 8707 Section 2",
+	})
+}
@@ -0,0 +1,111 @@
+package oidc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+)
+
+const ordersResource = "https://api.protocolsoup.com/orders"
+
+func issueUserToken(t *testing.T, p *Plugin, audience ...string) string {
+	t.Helper()
+	token, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+		Subject:  "alice",
+		ClientID: "demo-app",
+		Audience: audience,
+		Scope:    "openid profile",
+		AuthTime: time.Now(),
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func callWithToken(handler http.Handler, path, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestUserInfoEnforcesAudience(t *testing.T) {
+	p := newTestPlugin(t)
+	userinfo := http.HandlerFunc(p.handleUserInfo)
+
+	for name, token := range map[string]string{
+		"unrestricted":     issueUserToken(t, p),
+		"profile resource": issueUserToken(t, p, mockidp.ProfileResource),
+	} {
+		if w := callWithToken(userinfo, "/oidc/userinfo", token); w.Code != http.StatusOK {
+			t.Errorf("%s token: status = %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	w := callWithToken(userinfo, "/oidc/userinfo", issueUserToken(t, p, ordersResource))
+	if w.Code != http.StatusUnauthorized || decodeJSON(t, w)["error"] != "invalid_token" {
+		t.Errorf("orders token at UserInfo: status = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStepUpResourceEnforcesAudience(t *testing.T) {
+	p := newTestPlugin(t)
+	resource := p.RequireAuthentication(accountResourcePolicy)(http.HandlerFunc(p.handleProtectedResource))
+
+	if w := callWithToken(resource, "/oidc/demo/resource/account", issueUserToken(t, p, mockidp.AccountResource)); w.Code != http.StatusOK {
+		t.Errorf("account token: status = %d: %s", w.Code, w.Body.String())
+	}
+	if w := callWithToken(resource, "/oidc/demo/resource/account", issueUserToken(t, p, mockidp.ProfileResource)); w.Code != http.StatusUnauthorized {
+		t.Errorf("profile token at the account resource: status = %d", w.Code)
+	}
+}
+
+func TestProfileResourceKeepsOpenIDScope(t *testing.T) {
+	p := newTestPlugin(t)
+	if got := p.mockIdP.ResourceScope([]string{mockidp.ProfileResource}, "openid profile api:read"); got != "openid profile" {
+		t.Errorf("scope = %q, want openid profile", got)
+	}
+}
+
+func TestStepUpResourceEnforcesTokenBinding(t *testing.T) {
+	p := newTestPlugin(t)
+	resource := p.RequireAuthentication(accountResourcePolicy)(http.HandlerFunc(p.handleProtectedResource))
+	bound := func(cnf map[string]interface{}) string {
+		token, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+			Subject:  "alice",
+			ClientID: "demo-app",
+			Audience: []string{mockidp.AccountResource},
+			Scope:    "openid",
+			AuthTime: time.Now(),
+			Custom:   map[string]interface{}{"cnf": cnf},
+		}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for name, token := range map[string]string{
+		"DPoP-bound":        bound(map[string]interface{}{"jkt": "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"}),
+		"certificate-bound": bound(map[string]interface{}{"x5t#S256": "bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2"}),
+	} {
+		w := callWithToken(resource, "/oidc/demo/resource/account", token)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s token as a bearer token: status = %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/oidc/demo/resource/account", nil)
+	r.Header.Set("Authorization", "DPoP "+issueUserToken(t, p, mockidp.AccountResource))
+	w := httptest.NewRecorder()
+	resource.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("DPoP scheme without a proof: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package oidc
+
+import (
+	"net/http"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// emitIDTokenEncrypted reports an ID token that was encrypted to the client's public key
+func (p *Plugin) emitIDTokenEncrypted(sessionID, clientID, idToken string) {
+	if !crypto.IsJWE(idToken) {
+		return
+	}
+	header, _ := crypto.DecodeJWEHeader(idToken)
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "ID Token Encrypted", map[string]interface{}{
+		"client_id": clientID,
+		"alg":       header["alg"],
+		"enc":       header["enc"],
+		"kid":       header["kid"],
+		"cty":       header["cty"],
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Nested JWT",
+		Description: "The client registered id_token_encrypted_response_alg, so the signed ID token was encrypted to its public key. Only the client can read the claims; it decrypts the JWE first and then validates the signature of the JWT inside, which still proves the token came from this provider.",
+		Reference:   "OpenID Connect Core 1.0 Section 10.2",
+	})
+}
+
+// writeUserInfoJWT returns UserInfo claims as the signed and/or encrypted JWT the client registered
+// for (OIDC Core Section 5.3.2)
+func (p *Plugin) writeUserInfoJWT(w http.ResponseWriter, sessionID string, client *models.Client, userClaims map[string]interface{}) {
+	response, err := p.mockIdP.CreateUserInfoJWT(client, userClaims)
+	if err != nil {
+		writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to create UserInfo response")
+		return
+	}
+
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "UserInfo Response as JWT", map[string]interface{}{
+		"client_id":                       client.ID,
+		"userinfo_signed_response_alg":    client.UserInfoSignedResponseAlg,
+		"userinfo_encrypted_response_alg": client.UserInfoEncryptedResponseAlg,
+		"userinfo_encrypted_response_enc": client.UserInfoEncryptedResponseEnc,
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Signed and Encrypted UserInfo",
+		Description: "A signed UserInfo response carries iss and aud, so the client can verify where the claims came from and that they were meant for it. An encrypted response can only be read by the client, even where TLS is terminated by an intermediary.",
+		Reference:   "OpenID Connect Core 1.0 Section 5.3.2",
+	})
+
+	w.Header().Set("Content-Type", "application/jwt")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(response))
+}
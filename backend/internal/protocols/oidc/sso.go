@@ -0,0 +1,465 @@
+package oidc
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// ssoCookieName is the browser cookie listing the provider sessions the browser is signed in with
+const ssoCookieName = "oidc_sso"
+
+// maxSSOAccounts is how many accounts a browser can stay signed in with at once
+const maxSSOAccounts = 5
+
+// ssoCookieLifetime matches the lifetime of the sessions the cookie refers to
+const ssoCookieLifetime = 24 * time.Hour
+
+// authorizationRequest holds the validated parameters of an authentication request
+type authorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ResponseType        string
+	ResponseMode        string
+	RequestURI          string
+	// RequestObject is the request object the parameters came from, consumed on completion
+	RequestObject string
+	// Claims is the claims request parameter (OIDC Core Section 5.5)
+	Claims    string
+	Details   []map[string]interface{}
+	Resources []string
+}
+
+// ssoOutcome is whether an authentication request can be answered from the browser's sessions
+type ssoOutcome struct {
+	// Session is the session the request can be answered from when Error is empty
+	Session *models.Session
+	// Error is the error returned to a prompt=none request: login_required,
+	// account_selection_required, consent_required or interaction_required
+	Error       string
+	Description string
+	// Accounts are the sessions meeting the request's authentication requirements, which the
+	// user may continue with on the login page without a password
+	Accounts []*models.Session
+}
+
+// browserSessions returns the live sessions named by the browser's SSO cookie, most recent first
+func (p *Plugin) browserSessions(r *http.Request) []*models.Session {
+	cookie, err := r.Cookie(ssoCookieName)
+	if err != nil {
+		return nil
+	}
+	sessions := make([]*models.Session, 0)
+	for _, id := range strings.Split(cookie.Value, ".") {
+		if session, exists := p.mockIdP.GetSession(id); exists {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// browserSession returns a session only if the browser's SSO cookie names it, so a sid learned
+// from an ID token cannot be used to continue as its user from another browser
+func (p *Plugin) browserSession(r *http.Request, id string) (*models.Session, bool) {
+	for _, session := range p.browserSessions(r) {
+		if session.ID == id {
+			return session, true
+		}
+	}
+	return nil, false
+}
+
+// rememberBrowserSession adds a session to the browser's SSO cookie, replacing any earlier
+// session of the same user
+func (p *Plugin) rememberBrowserSession(w http.ResponseWriter, r *http.Request, session *models.Session) {
+	sessions := []*models.Session{session}
+	for _, existing := range p.browserSessions(r) {
+		if existing.UserID != session.UserID && len(sessions) < maxSSOAccounts {
+			sessions = append(sessions, existing)
+		}
+	}
+	p.writeSSOCookie(w, r, sessions)
+}
+
+// forgetBrowserSessions removes a user's sessions from the browser's SSO cookie
+func (p *Plugin) forgetBrowserSessions(w http.ResponseWriter, r *http.Request, userID string) {
+	if _, err := r.Cookie(ssoCookieName); err != nil {
+		return
+	}
+	sessions := make([]*models.Session, 0)
+	for _, session := range p.browserSessions(r) {
+		if session.UserID != userID {
+			sessions = append(sessions, session)
+		}
+	}
+	p.writeSSOCookie(w, r, sessions)
+}
+
+// writeSSOCookie sets the SSO cookie to a list of sessions, deleting it when the list is empty.
+// The cookie is sent only to the provider's OIDC endpoints and is unreadable from scripts.
+func (p *Plugin) writeSSOCookie(w http.ResponseWriter, r *http.Request, sessions []*models.Session) {
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	cookie := &http.Cookie{
+		Name:     ssoCookieName,
+		Value:    strings.Join(ids, "."),
+		Path:     "/oidc",
+		MaxAge:   int(ssoCookieLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   p.secureCookies(r),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if len(ids) == 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// secureCookies reports whether cookies must be marked Secure. Behind a TLS-terminating proxy the
+// request itself arrives over plain HTTP, so the scheme of the public base URL decides.
+func (p *Plugin) secureCookies(r *http.Request) bool {
+	return r.TLS != nil || strings.HasPrefix(strings.ToLower(p.baseURL), "https://")
+}
+
+// checkBrowserSessions decides whether an authentication request can be answered from the
+// browser's sessions without showing the login page (OIDC Core Section 3.1.2.3). A hinted user
+// narrows the sessions to theirs; the request's authentication requirements and the consent the
+// user gave during the session are then checked.
+func (p *Plugin) checkBrowserSessions(sessions []*models.Session, hintUser *models.User, req authorizationRequest, acrValues, maxAge string, prompts map[string]bool) ssoOutcome {
+	if hintUser != nil {
+		hinted := make([]*models.Session, 0, 1)
+		for _, session := range sessions {
+			if session.UserID == hintUser.ID {
+				hinted = append(hinted, session)
+			}
+		}
+		sessions = hinted
+	}
+	if len(sessions) == 0 {
+		return ssoOutcome{Error: "login_required", Description: "The user is not signed in"}
+	}
+	accounts := make([]*models.Session, 0, len(sessions))
+	reason := ""
+	for _, session := range sessions {
+		if reason = authenticationReason(session, acrValues, maxAge, prompts); reason == "" {
+			accounts = append(accounts, session)
+		}
+	}
+	if len(accounts) == 0 {
+		return ssoOutcome{Error: "login_required", Description: reason}
+	}
+	if len(accounts) > 1 {
+		return ssoOutcome{
+			Error:       "account_selection_required",
+			Description: "The browser is signed in with several accounts and the user must choose one",
+			Accounts:    accounts,
+		}
+	}
+
+	session := accounts[0]
+	if prompts["consent"] || !mockidp.SessionHasConsent(session, req.ClientID, req.Scope) {
+		return ssoOutcome{
+			Error:       "consent_required",
+			Description: "The user has not approved the requested scopes for this client",
+			Accounts:    accounts,
+		}
+	}
+	if len(req.Details) > 0 {
+		return ssoOutcome{
+			Error:       "interaction_required",
+			Description: "The user must approve the authorization details",
+			Accounts:    accounts,
+		}
+	}
+	return ssoOutcome{Session: session, Accounts: accounts}
+}
+
+// authenticationReason reports why a session does not satisfy the request's authentication
+// requirements, or "" when it does: prompt=login and max_age=0 always require a new login,
+// max_age limits the age of the session's authentication and acr_values its level
+func authenticationReason(session *models.Session, acrValues, maxAge string, prompts map[string]bool) string {
+	if prompts["login"] {
+		return "prompt=login requires the user to authenticate again"
+	}
+	policy := StepUpPolicy{}
+	if acrValues != "" {
+		policy.ACR = mockidp.SelectACR(strings.Fields(acrValues))
+	}
+	if maxAge != "" {
+		seconds, _ := strconv.Atoi(maxAge)
+		if seconds == 0 {
+			return "max_age=0 requires the user to authenticate again"
+		}
+		policy.MaxAge = time.Duration(seconds) * time.Second
+	}
+	if err := policy.check(session.ACR, session.AuthTime); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// parseAuthenticationHint resolves the user an id_token_hint or login_hint names. An unknown
+// login_hint is ignored; an id_token_hint this provider did not issue is an error.
+func (p *Plugin) parseAuthenticationHint(idTokenHint, loginHint string) (*models.User, error) {
+	if idTokenHint != "" {
+		hint, err := p.mockIdP.ParseIDTokenHint(idTokenHint)
+		if err != nil {
+			return nil, err
+		}
+		return hint.User, nil
+	}
+	if loginHint != "" {
+		user, _ := p.mockIdP.ResolveLoginHint(loginHint)
+		return user, nil
+	}
+	return nil, nil
+}
+
+// completeAuthorization answers an authentication request for a user signed in with session.
+// The grant is recorded in the session, then the code or tokens are returned to the client.
+func (p *Plugin) completeAuthorization(w http.ResponseWriter, r *http.Request, sessionID string, req authorizationRequest, user *models.User, session *models.Session) {
+	// A pushed request is single use
+	if req.RequestURI != "" {
+		if _, err := p.mockIdP.ConsumePushedAuthorizationRequest(req.RequestURI, req.ClientID); err != nil {
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request_uri", err.Error())
+			return
+		}
+	}
+	// So is a request object
+	if req.RequestObject != "" {
+		if err := p.mockIdP.ConsumeRequestObject(req.ClientID, req.RequestObject); err != nil {
+			writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidRequestObject, err.Error())
+			return
+		}
+	}
+
+	// An ID token may only be issued for the sub the claims request asks for (OIDC Core Section 5.5.1)
+	claimsRequest, _ := mockidp.ParseClaimsRequest(req.Claims)
+	if sub := claimsRequest.RequestedSubject(); sub != "" && sub != p.mockIdP.SubjectIdentifier(req.ClientID, user.ID) {
+		p.writeAuthorizationError(w, r, sessionID, req, "login_required", "The requested sub is not the signed-in user")
+		return
+	}
+	auth := mockidp.Authentication{Time: session.AuthTime, ACR: session.ACR, AMR: session.AMR, SessionID: session.ID}
+	p.emitIDTokenClaims(sessionID, claimsRequest, user, req.Scope, auth)
+	p.emitPairwiseSubject(sessionID, req.ClientID, user.ID)
+
+	p.mockIdP.RecordSessionGrant(session.ID, req.ClientID, req.Scope)
+	p.oauth2Plugin.EmitAuthorizationDetailsGranted(sessionID, user.ID, req.Details)
+
+	// Build redirect URL - redirect URI was already validated by the caller
+	redirectURL, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Malformed redirect_uri")
+		return
+	}
+
+	// Handle based on response_type
+	if req.ResponseType == "code" {
+		// Authorization Code Flow
+		authCode, err := p.mockIdP.CreateAuthorizationCode(
+			req.ClientID, user.ID, req.RedirectURI, req.Scope, req.State, req.Nonce,
+			req.CodeChallenge, req.CodeChallengeMethod,
+		)
+		if err != nil {
+			writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to create authorization code")
+			return
+		}
+		if len(req.Details) > 0 {
+			p.mockIdP.GrantAuthorizationDetails(authCode.Code, req.Details)
+		}
+		if len(req.Resources) > 0 {
+			p.mockIdP.GrantResources(authCode.Code, req.Resources)
+		}
+		p.mockIdP.SetAuthorizationCodeSession(authCode.Code, session.ID)
+		if req.Claims != "" {
+			p.mockIdP.SetAuthorizationCodeClaimsRequest(authCode.Code, req.Claims)
+		}
+		if mockidp.IsJWTResponseMode(req.ResponseMode) {
+			params := map[string]string{"code": authCode.Code}
+			if req.State != "" {
+				params["state"] = req.State
+			}
+			p.writeJWTAuthorizationResponse(w, r, sessionID, req.ClientID, req.RedirectURI, req.ResponseMode, req.ResponseType, params)
+			return
+		}
+		q := redirectURL.Query()
+		q.Set("code", authCode.Code)
+		if req.State != "" {
+			q.Set("state", req.State)
+		}
+		redirectURL.RawQuery = q.Encode()
+	} else {
+		// Implicit Flow - return tokens in fragment
+		fragment := url.Values{}
+		jwtService := p.mockIdP.JWTService()
+
+		// Generate access token if requested
+		if strings.Contains(req.ResponseType, "token") {
+			tokenScope, err := p.oauth2Plugin.ResourceScope(sessionID, req.Resources, req.Scope)
+			if err != nil {
+				writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidTarget, err.Error())
+				return
+			}
+			accessToken, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+				Subject:              user.ID,
+				ClientID:             req.ClientID,
+				Audience:             req.Resources,
+				Scope:                tokenScope,
+				AuthTime:             session.AuthTime,
+				ACR:                  session.ACR,
+				AMR:                  session.AMR,
+				AuthorizationDetails: req.Details,
+				UserInfoClaims:       mockidp.EncodeClaimsRequestMember(claimsRequest.UserInfo),
+			}, time.Hour)
+			if err != nil {
+				writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to create access token")
+				return
+			}
+			fragment.Set("access_token", accessToken)
+			fragment.Set("token_type", "Bearer")
+			fragment.Set("expires_in", "3600")
+		}
+
+		// Generate ID token if requested
+		if strings.Contains(req.ResponseType, "id_token") {
+			scopes := strings.Split(req.Scope, " ")
+			userClaims := p.mockIdP.IDTokenClaims(req.ClientID, user.ID, scopes, claimsRequest.IDToken)
+			idToken, err := jwtService.CreateIDToken(
+				p.mockIdP.SubjectIdentifier(req.ClientID, user.ID),
+				req.ClientID,
+				req.Nonce,
+				session.AuthTime,
+				time.Hour,
+				authenticationClaims(userClaims, auth),
+			)
+			if err == nil {
+				idToken, err = p.mockIdP.EncryptIDToken(req.ClientID, idToken)
+			}
+			if err != nil {
+				writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to create ID token")
+				return
+			}
+			p.emitIDTokenEncrypted(sessionID, req.ClientID, idToken)
+			fragment.Set("id_token", idToken)
+		}
+
+		if req.State != "" {
+			fragment.Set("state", req.State)
+		}
+
+		if mockidp.IsJWTResponseMode(req.ResponseMode) {
+			params := make(map[string]string, len(fragment))
+			for name := range fragment {
+				params[name] = fragment.Get(name)
+			}
+			p.writeJWTAuthorizationResponse(w, r, sessionID, req.ClientID, req.RedirectURI, req.ResponseMode, req.ResponseType, params)
+			return
+		}
+
+		redirectURL.Fragment = fragment.Encode()
+	}
+
+	// Redirect to client (safe - redirect URI validated against registered URIs)
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+// writeAuthorizationError returns an error to the client's redirect_uri with the state: in the
+// query for the code flow, in the fragment for flows returning tokens, or as a JARM response
+// (OIDC Core Section 3.1.2.6)
+func (p *Plugin) writeAuthorizationError(w http.ResponseWriter, r *http.Request, sessionID string, req authorizationRequest, code, description string) {
+	params := map[string]string{"error": code, "error_description": description}
+	if req.State != "" {
+		params["state"] = req.State
+	}
+	if mockidp.IsJWTResponseMode(req.ResponseMode) {
+		p.writeJWTAuthorizationResponse(w, r, sessionID, req.ClientID, req.RedirectURI, req.ResponseMode, req.ResponseType, params)
+		return
+	}
+
+	redirectURL, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Malformed redirect_uri")
+		return
+	}
+	if req.ResponseType == "code" {
+		q := redirectURL.Query()
+		for name, value := range params {
+			q.Set(name, value)
+		}
+		redirectURL.RawQuery = q.Encode()
+	} else {
+		fragment := url.Values{}
+		for name, value := range params {
+			fragment.Set(name, value)
+		}
+		redirectURL.Fragment = fragment.Encode()
+	}
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+// emitSessionReused reports an authentication request answered from an existing session
+func (p *Plugin) emitSessionReused(sessionID string, session *models.Session, silent bool) {
+	title := "Session Reused"
+	if silent {
+		title = "Silent Authentication"
+	}
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, title, map[string]interface{}{
+		"step":      2,
+		"user_id":   session.UserID,
+		"sid":       session.ID,
+		"acr":       session.ACR,
+		"auth_time": session.AuthTime.Unix(),
+		"age":       time.Since(session.AuthTime).Round(time.Second).String(),
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Single Sign-On",
+		Description: "The browser's SSO cookie names a provider session that meets the request's prompt, max_age and acr_values, so the user is not asked for a password. auth_time in the ID token still reports when they last authenticated, which the client compares with max_age.",
+		Reference:   "OpenID Connect Core 1.0 Section 3.1.2.3",
+	})
+}
+
+// withLoginHint pre-fills the email field of the login page with the user a hint names
+func withLoginHint(page, email string) string {
+	if email == "" {
+		return page
+	}
+	return strings.Replace(page, `name="email" placeholder`, `name="email" value="`+htmlEscape(email)+`" placeholder`, 1)
+}
+
+// withSignedInAccounts lets the user continue on the login page as one of the accounts the
+// browser is signed in with. Choosing an account submits its session ID instead of a password.
+func (p *Plugin) withSignedInAccounts(page string, accounts []*models.Session) string {
+	buttons := ""
+	for _, session := range accounts {
+		user, exists := p.mockIdP.GetUser(session.UserID)
+		if !exists {
+			continue
+		}
+		buttons += `<button type="submit" name="sso_session" value="` + htmlEscape(session.ID) + `" formnovalidate style="margin-bottom: 8px">Continue as ` + htmlEscape(user.Name) + ` (` + htmlEscape(user.Email) + `)</button>
+            `
+	}
+	if buttons == "" {
+		return page
+	}
+	section := `<div class="form-group">
+                <label>Signed in on this browser</label>
+                ` + buttons + `</div>
+            <div class="form-group"><label>Or sign in with another account</label></div>
+
+            `
+	return strings.Replace(page, `<div class="form-group">`, section+`<div class="form-group">`, 1)
+}
@@ -0,0 +1,33 @@
+package oidc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+func TestSSOCookieSecureFollowsBaseURL(t *testing.T) {
+	p := newTestPlugin(t)
+	session := p.mockIdP.CreateSession("alice", "demo-app", mockidp.ACRPassword)
+
+	cases := []struct {
+		baseURL string
+		want    bool
+	}{
+		{"http://localhost:8080", false},
+		// TLS ends at a proxy, which forwards plain HTTP
+		{"https://protocolsoup.example", true},
+	}
+	for _, c := range cases {
+		p.baseURL = c.baseURL
+		w := httptest.NewRecorder()
+		p.writeSSOCookie(w, httptest.NewRequest(http.MethodGet, "/oidc/authorize", nil), []*models.Session{session})
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Secure != c.want {
+			t.Errorf("%s: cookies = %+v, want Secure %t", c.baseURL, cookies, c.want)
+		}
+	}
+}
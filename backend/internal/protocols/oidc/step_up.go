@@ -0,0 +1,188 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/oauth2"
+)
+
+// StepUpPolicy is the user authentication a protected resource requires (RFC 9470 Section 3)
+type StepUpPolicy struct {
+	// ACR is the minimum authentication context class
+	ACR string
+	// MaxAge is how long ago the user may have authenticated; zero accepts any age
+	MaxAge time.Duration
+}
+
+// Demo resources protected by the step-up middleware
+var (
+	// accountResourcePolicy accepts any user authentication
+	accountResourcePolicy = StepUpPolicy{ACR: mockidp.ACRPassword}
+	// transferResourcePolicy requires a second factor within the last five minutes
+	transferResourcePolicy = StepUpPolicy{ACR: mockidp.ACRMultiFactor, MaxAge: 5 * time.Minute}
+)
+
+// stepUpClaimsKey is the request context key of the access token claims accepted by RequireAuthentication
+type stepUpClaimsKey struct{}
+
+// validPromptValues are the prompt values defined by OIDC Core Section 3.1.2.1
+var validPromptValues = map[string]bool{"none": true, "login": true, "consent": true, "select_account": true}
+
+// RequireAuthentication is resource server middleware that accepts an access token only if it
+// is valid for the account resource, as at UserInfo, and the user authentication it records
+// meets policy. Otherwise it answers with the RFC 9470
+// insufficient_user_authentication challenge, naming the acr_values and max_age the client
+// must request from the authorization server to obtain a suitable token.
+func (p *Plugin) RequireAuthentication(policy StepUpPolicy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sessionID := p.getSessionFromRequest(r)
+
+			claims, ok := p.authorizeResourceRequest(w, r, sessionID, mockidp.AccountResource)
+			if !ok {
+				return
+			}
+
+			acr, _ := claims["acr"].(string)
+			var authTime time.Time
+			if at, ok := claims["auth_time"].(float64); ok {
+				authTime = time.Unix(int64(at), 0)
+			}
+
+			if err := policy.check(acr, authTime); err != nil {
+				p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Step-Up Authentication Required", map[string]interface{}{
+					"resource":     r.URL.Path,
+					"token_acr":    acr,
+					"auth_time":    authTime.Unix(),
+					"required_acr": policy.ACR,
+					"max_age":      int(policy.MaxAge.Seconds()),
+					"reason":       err.Error(),
+				}, lookingglass.Annotation{
+					Type:        lookingglass.AnnotationTypeSecurityHint,
+					Title:       "Insufficient User Authentication",
+					Description: "The token is valid, but the user authenticated too weakly or too long ago for this resource. The challenge tells the client which acr_values and max_age to send in a new authorization request.",
+					Severity:    "info",
+					Reference:   "RFC 9470 Section 3",
+				})
+				writeStepUpChallenge(w, policy, err.Error())
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), stepUpClaimsKey{}, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// check reports why an authentication at acr and authTime does not satisfy the policy
+func (policy StepUpPolicy) check(acr string, authTime time.Time) error {
+	if policy.ACR != "" && mockidp.ACRLevel(acr) < mockidp.ACRLevel(policy.ACR) {
+		return errors.New("a higher authentication level is required")
+	}
+	if policy.MaxAge > 0 && (authTime.IsZero() || time.Since(authTime) > policy.MaxAge) {
+		return errors.New("a more recent authentication is required")
+	}
+	return nil
+}
+
+// writeStepUpChallenge writes the insufficient_user_authentication error (RFC 9470 Section 3)
+func writeStepUpChallenge(w http.ResponseWriter, policy StepUpPolicy, description string) {
+	challenge := `Bearer error="` + mockidp.ErrorInsufficientUserAuthentication + `", error_description="` + description + `"`
+	if policy.ACR != "" {
+		challenge += `, acr_values="` + policy.ACR + `"`
+	}
+	if policy.MaxAge > 0 {
+		challenge += `, max_age="` + strconv.Itoa(int(policy.MaxAge.Seconds())) + `"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             mockidp.ErrorInsufficientUserAuthentication,
+		"error_description": description,
+	})
+}
+
+// handleProtectedResource is a demo API behind RequireAuthentication that echoes the accepted authentication
+func (p *Plugin) handleProtectedResource(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(stepUpClaimsKey{}).(map[string]interface{})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"resource":  r.URL.Path,
+		"sub":       claims["sub"],
+		"acr":       claims["acr"],
+		"amr":       claims["amr"],
+		"auth_time": claims["auth_time"],
+	})
+}
+
+// parsePrompt validates the space-separated prompt parameter; none may not be combined with other values
+func parsePrompt(prompt string) (map[string]bool, error) {
+	values := make(map[string]bool)
+	for _, value := range strings.Fields(prompt) {
+		if !validPromptValues[value] {
+			return nil, errors.New("unsupported prompt value " + value)
+		}
+		values[value] = true
+	}
+	if values["none"] && len(values) > 1 {
+		return nil, errors.New("prompt=none must not be combined with other values")
+	}
+	return values, nil
+}
+
+// parseMaxAge validates the max_age parameter, the allowable seconds since the last authentication
+func parseMaxAge(maxAge string) error {
+	if maxAge == "" {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(maxAge); err != nil || seconds < 0 {
+		return errors.New("max_age must be a non-negative number of seconds")
+	}
+	return nil
+}
+
+// withAuthenticationFields carries acr_values, max_age and prompt through the login form and
+// adds the inputs of the factors the selected authentication context requires
+func (p *Plugin) withAuthenticationFields(page, acrValues, maxAge, prompt string) string {
+	fields := ""
+	for _, field := range [][2]string{{"acr_values", acrValues}, {"max_age", maxAge}, {"prompt", prompt}} {
+		if field[1] != "" {
+			fields += `<input type="hidden" name="` + field[0] + `" value="` + html.EscapeString(field[1]) + `">
+            `
+		}
+	}
+	page = strings.Replace(page, `<input type="hidden" name="client_id"`, fields+`<input type="hidden" name="client_id"`, 1)
+
+	acr := mockidp.SelectACR(strings.Fields(acrValues))
+	return oauth2.WithCredentialFields(page, p.mockIdP.CredentialVerifiers(acr))
+}
+
+// authenticationClaims adds the acr, amr and sid of an authentication to ID token claims
+func authenticationClaims(userClaims map[string]interface{}, auth mockidp.Authentication) map[string]interface{} {
+	claims := make(map[string]interface{}, len(userClaims)+3)
+	for k, v := range userClaims {
+		claims[k] = v
+	}
+	if auth.ACR != "" {
+		claims["acr"] = auth.ACR
+	}
+	if len(auth.AMR) > 0 {
+		claims["amr"] = auth.AMR
+	}
+	if auth.SessionID != "" {
+		// Front-channel and back-channel logout identify the session by sid
+		claims["sid"] = auth.SessionID
+	}
+	return claims
+}
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"html"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
 	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/internal/protocols/oauth2"
 	"github.com/ParleSec/ProtocolSoup/pkg/models"
 )
 
@@ -39,6 +41,13 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	sessionID := p.getSessionFromRequest(r)
 
+	// Request object (RFC 9101, OIDC Core Section 6): signed parameters replace those in the query
+	requestObject, roErr := p.oauth2Plugin.ApplyRequestObject(sessionID, query.Get("client_id"), query)
+	if roErr != nil {
+		writeOIDCError(w, http.StatusBadRequest, roErr.Code, roErr.Description)
+		return
+	}
+
 	responseType := query.Get("response_type")
 	clientID := query.Get("client_id")
 	redirectURI := query.Get("redirect_uri")
@@ -47,6 +56,55 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 	nonce := query.Get("nonce")
 	codeChallenge := query.Get("code_challenge")
 	codeChallengeMethod := query.Get("code_challenge_method")
+	requestURI := query.Get("request_uri")
+	authorizationDetails := query.Get("authorization_details")
+	resources := query["resource"]
+	responseMode := query.Get("response_mode")
+	acrValues := query.Get("acr_values")
+	maxAge := query.Get("max_age")
+	prompt := query.Get("prompt")
+	loginHint := query.Get("login_hint")
+	idTokenHint := query.Get("id_token_hint")
+	claims := query.Get("claims")
+
+	// Pushed authorization request (RFC 9126): parameters come from the back channel
+	if requestURI != "" {
+		par, err := p.mockIdP.GetPushedAuthorizationRequest(requestURI, clientID)
+		if err != nil {
+			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Invalid Request URI", map[string]interface{}{
+				"request_uri": requestURI,
+				"reason":      err.Error(),
+			})
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request_uri", err.Error())
+			return
+		}
+		responseType = par.Parameters["response_type"]
+		redirectURI = par.Parameters["redirect_uri"]
+		scope = par.Parameters["scope"]
+		state = par.Parameters["state"]
+		nonce = par.Parameters["nonce"]
+		codeChallenge = par.Parameters["code_challenge"]
+		codeChallengeMethod = par.Parameters["code_challenge_method"]
+		authorizationDetails = par.Parameters["authorization_details"]
+		resources = strings.Fields(par.Parameters["resource"])
+		responseMode = par.Parameters["response_mode"]
+		acrValues = par.Parameters["acr_values"]
+		maxAge = par.Parameters["max_age"]
+		prompt = par.Parameters["prompt"]
+		loginHint = par.Parameters["login_hint"]
+		idTokenHint = par.Parameters["id_token_hint"]
+		claims = par.Parameters["claims"]
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Pushed Authorization Request Resolved", map[string]interface{}{
+			"request_uri": requestURI,
+			"client_id":   clientID,
+			"scope":       scope,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Parameters Loaded from request_uri",
+			Description: "Only the parameters pushed over the back channel are used; any other query parameters in the browser request are ignored",
+			Reference:   "RFC 9126 Section 4",
+		})
+	}
 
 	// Emit OIDC authorization request
 	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "OIDC Authentication Request", map[string]interface{}{
@@ -92,18 +150,16 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate response type
-	validResponseTypes := map[string]bool{
-		"code":           true,
-		"token":          true,
-		"id_token":       true,
-		"id_token token": true,
-		"token id_token": true,
-	}
-	if !validResponseTypes[responseType] {
+	if !validOIDCResponseTypes[responseType] {
 		writeOIDCError(w, http.StatusBadRequest, "unsupported_response_type", "Supported: code, token, id_token, id_token token")
 		return
 	}
 
+	if err := oauth2.ValidateResponseMode(responseMode, responseType, []string{"query", "fragment"}); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
 	// Nonce is required for implicit flows that return id_token
 	if strings.Contains(responseType, "id_token") && nonce == "" {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Missing Nonce for Implicit Flow", map[string]interface{}{
@@ -129,12 +185,120 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if client.RequirePushedAuthorizationRequests && requestURI == "" {
+		p.oauth2Plugin.EmitPARRequired(sessionID, clientID)
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "This client must use pushed authorization requests")
+		return
+	}
+
 	// Validate redirect URI
 	if !p.mockIdP.ValidateRedirectURI(clientID, redirectURI) {
 		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Invalid redirect_uri")
 		return
 	}
 
+	// Native apps must use the code flow with PKCE (RFC 8252 Section 8.1)
+	if err := p.oauth2Plugin.CheckNativeAppRequest(sessionID, client, redirectURI, responseType, codeChallenge, codeChallengeMethod); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	// Authentication requirements (OIDC Core Section 3.1.2.1)
+	prompts, err := parsePrompt(prompt)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if err := parseMaxAge(maxAge); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	claimsRequest, acrValues, err := parseClaimsParameter(claims, acrValues)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	p.emitClaimsRequested(sessionID, claimsRequest)
+	hintUser, err := p.parseAuthenticationHint(idTokenHint, loginHint)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if sub := claimsRequest.RequestedSubject(); hintUser == nil && sub != "" {
+		// A sub requested with a value names the user like a hint does
+		hintUser, _ = p.mockIdP.GetUser(p.mockIdP.ResolveSubject(clientID, sub))
+	}
+	if acrValues != "" || maxAge != "" || prompts["login"] {
+		acr := mockidp.SelectACR(strings.Fields(acrValues))
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "Authentication Requirements", map[string]interface{}{
+			"acr_values":   acrValues,
+			"selected_acr": acr,
+			"amr":          p.mockIdP.AMRForACR(acr),
+			"max_age":      maxAge,
+			"prompt":       prompt,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "Requested Authentication Level",
+			Description: "acr_values asks for an authentication context class, max_age for a recent authentication and prompt=login for a fresh one. The ID token reports what was performed in acr, amr and auth_time, which the client must check.",
+			Reference:   "OpenID Connect Core 1.0 Section 3.1.2.1",
+		})
+	}
+
+	// Resource indicators (RFC 8707)
+	if err := p.oauth2Plugin.ValidateResources(sessionID, resources); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidTarget, err.Error())
+		return
+	}
+
+	// Rich authorization request (RFC 9396)
+	details, err := p.oauth2Plugin.ParseAuthorizationDetails(sessionID, clientID, authorizationDetails)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidAuthorizationDetails, err.Error())
+		return
+	}
+	p.oauth2Plugin.EmitAuthorizationDetailsRequested(sessionID, details)
+
+	req := authorizationRequest{
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		State:               state,
+		Nonce:               nonce,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		ResponseType:        responseType,
+		ResponseMode:        responseMode,
+		RequestURI:          requestURI,
+		RequestObject:       requestObject,
+		Claims:              claims,
+		Details:             details,
+		Resources:           resources,
+	}
+
+	// Single sign-on: a session named by the browser's SSO cookie may answer the request without a login page
+	sso := p.checkBrowserSessions(p.browserSessions(r), hintUser, req, acrValues, maxAge, prompts)
+	if sso.Session != nil && !prompts["select_account"] {
+		if user, exists := p.mockIdP.GetUser(sso.Session.UserID); exists {
+			p.emitSessionReused(sessionID, sso.Session, prompts["none"])
+			p.completeAuthorization(w, r, sessionID, req, user, sso.Session)
+			return
+		}
+		sso = ssoOutcome{Error: "login_required", Description: "The signed-in user no longer exists"}
+	}
+	if prompts["none"] {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Silent Authentication Failed", map[string]interface{}{
+			"error":             sso.Error,
+			"error_description": sso.Description,
+		}, lookingglass.Annotation{
+			Type:        lookingglass.AnnotationTypeExplanation,
+			Title:       "prompt=none",
+			Description: "With prompt=none the provider must not show any page. When the user is not signed in, must re-authenticate, choose an account or consent, the error is returned to the client, which can then send an interactive request.",
+			Reference:   "OpenID Connect Core 1.0 Section 3.1.2.6",
+		})
+		p.writeAuthorizationError(w, r, sessionID, req, sso.Error, sso.Description)
+		return
+	}
+
 	// Generate login page with HTML-escaped values to prevent XSS
 	loginPage := p.generateOIDCLoginPage(
 		htmlEscape(clientID),
@@ -147,7 +311,21 @@ func (p *Plugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		htmlEscape(client.Name),
 		htmlEscape(responseType),
 	)
+	loginPage = oauth2.WithRequestURIField(loginPage, requestURI)
+	loginPage = oauth2.WithRequestObjectField(loginPage, requestObject)
+	loginPage = oauth2.WithResponseModeField(loginPage, responseMode)
+	loginPage = p.withAuthenticationFields(loginPage, acrValues, maxAge, prompt)
+	loginPage = withClaimsField(loginPage, claims)
+	loginPage = oauth2.WithAuthorizationDetails(loginPage, authorizationDetails, details)
+	loginPage = oauth2.WithResourceFields(loginPage, resources)
+	loginPage = p.withSignedInAccounts(loginPage, sso.Accounts)
+	if hintUser != nil {
+		loginPage = withLoginHint(loginPage, hintUser.Email)
+	} else {
+		loginPage = withLoginHint(loginPage, loginHint)
+	}
 	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
 	w.Write([]byte(loginPage))
 }
 
@@ -157,6 +335,14 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
 		return
 	}
+	sessionID := p.getSessionFromRequest(r)
+
+	// A request object carried by the form is verified again and takes precedence over the other fields
+	requestObject, roErr := p.oauth2Plugin.ApplyRequestObject(sessionID, r.FormValue("client_id"), r.Form)
+	if roErr != nil {
+		writeOIDCError(w, http.StatusBadRequest, roErr.Code, roErr.Description)
+		return
+	}
 
 	// Get form values
 	email := r.FormValue("email")
@@ -169,6 +355,41 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 	codeChallenge := r.FormValue("code_challenge")
 	codeChallengeMethod := r.FormValue("code_challenge_method")
 	responseType := r.FormValue("response_type")
+	requestURI := r.FormValue("request_uri")
+	authorizationDetails := r.FormValue("authorization_details")
+	resources := r.Form["resource"]
+	responseMode := r.FormValue("response_mode")
+	acrValues := r.FormValue("acr_values")
+	maxAge := r.FormValue("max_age")
+	prompt := r.FormValue("prompt")
+	claims := r.FormValue("claims")
+
+	// Pushed parameters take precedence over anything in the submitted form
+	if requestURI != "" {
+		par, err := p.mockIdP.GetPushedAuthorizationRequest(requestURI, clientID)
+		if err != nil {
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request_uri", err.Error())
+			return
+		}
+		redirectURI = par.Parameters["redirect_uri"]
+		scope = par.Parameters["scope"]
+		state = par.Parameters["state"]
+		nonce = par.Parameters["nonce"]
+		codeChallenge = par.Parameters["code_challenge"]
+		codeChallengeMethod = par.Parameters["code_challenge_method"]
+		responseType = par.Parameters["response_type"]
+		authorizationDetails = par.Parameters["authorization_details"]
+		resources = strings.Fields(par.Parameters["resource"])
+		responseMode = par.Parameters["response_mode"]
+		acrValues = par.Parameters["acr_values"]
+		maxAge = par.Parameters["max_age"]
+		prompt = par.Parameters["prompt"]
+		claims = par.Parameters["claims"]
+	} else if client, exists := p.mockIdP.GetClient(clientID); exists && client.RequirePushedAuthorizationRequests {
+		p.oauth2Plugin.EmitPARRequired(sessionID, clientID)
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "This client must use pushed authorization requests")
+		return
+	}
 	if responseType == "" {
 		responseType = "code"
 	}
@@ -178,11 +399,31 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Invalid redirect_uri")
 		return
 	}
+	if client, exists := p.mockIdP.GetClient(clientID); exists {
+		if err := p.oauth2Plugin.CheckNativeAppRequest(sessionID, client, redirectURI, responseType, codeChallenge, codeChallengeMethod); err != nil {
+			writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+	}
 
-	// Validate user credentials
-	user, err := p.mockIdP.ValidateCredentials(email, password)
+	// Re-validate resource indicators and authorization details, which travel through the form unless pushed
+	if err := p.oauth2Plugin.ValidateResources(sessionID, resources); err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidTarget, err.Error())
+		return
+	}
+	details, err := p.oauth2Plugin.ParseAuthorizationDetails(sessionID, clientID, authorizationDetails)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidAuthorizationDetails, err.Error())
+		return
+	}
+	_, acrValues, err = parseClaimsParameter(claims, acrValues)
 	if err != nil {
-		// Return to login page with error - HTML escape all values to prevent XSS
+		writeOIDCError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	// Return to the login page with an error - HTML escape all values to prevent XSS
+	renderLoginError := func(message string) {
 		client, _ := p.mockIdP.GetClient(clientID)
 		clientName := ""
 		if client != nil {
@@ -199,87 +440,97 @@ func (p *Plugin) handleAuthorizeSubmit(w http.ResponseWriter, r *http.Request) {
 			htmlEscape(clientName),
 			htmlEscape(responseType),
 		)
-		loginPage = strings.Replace(loginPage, "<!-- ERROR -->", `<div class="error">Invalid email or password</div>`, 1)
+		loginPage = oauth2.WithRequestURIField(loginPage, requestURI)
+		loginPage = oauth2.WithRequestObjectField(loginPage, requestObject)
+		loginPage = oauth2.WithResponseModeField(loginPage, responseMode)
+		loginPage = p.withAuthenticationFields(loginPage, acrValues, maxAge, prompt)
+		loginPage = withClaimsField(loginPage, claims)
+		loginPage = oauth2.WithAuthorizationDetails(loginPage, authorizationDetails, details)
+		loginPage = oauth2.WithResourceFields(loginPage, resources)
+		loginPage = strings.Replace(loginPage, "<!-- ERROR -->", `<div class="error">`+message+`</div>`, 1)
 		w.Header().Set("Content-Type", "text/html")
 		w.Write([]byte(loginPage))
-		return
 	}
 
-	// Build redirect URL - redirect URI was already validated above
-	redirectURL, err := url.Parse(redirectURI)
-	if err != nil {
-		writeOIDCError(w, http.StatusBadRequest, "invalid_request", "Malformed redirect_uri")
-		return
+	req := authorizationRequest{
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		State:               state,
+		Nonce:               nonce,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		ResponseType:        responseType,
+		ResponseMode:        responseMode,
+		RequestURI:          requestURI,
+		RequestObject:       requestObject,
+		Claims:              claims,
+		Details:             details,
+		Resources:           resources,
 	}
 
-	// Handle based on response_type
-	if responseType == "code" {
-		// Authorization Code Flow
-		authCode, err := p.mockIdP.CreateAuthorizationCode(
-			clientID, user.ID, redirectURI, scope, state, nonce,
-			codeChallenge, codeChallengeMethod,
-		)
-		if err != nil {
-			writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to create authorization code")
-			return
-		}
-		q := redirectURL.Query()
-		q.Set("code", authCode.Code)
-		if state != "" {
-			q.Set("state", state)
-		}
-		redirectURL.RawQuery = q.Encode()
-	} else {
-		// Implicit Flow - return tokens in fragment
-		fragment := url.Values{}
-		jwtService := p.mockIdP.JWTService()
-		
-		// Generate access token if requested
-		if strings.Contains(responseType, "token") {
-			accessToken, err := jwtService.CreateAccessToken(
-				user.ID,
-				clientID,
-				scope,
-				time.Hour,
-				nil,
-			)
-			if err != nil {
-				writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to create access token")
+	// Continuing as an account the browser is signed in with needs no password, as long as its
+	// session still meets the request's authentication requirements
+	if ssoSessionID := r.FormValue("sso_session"); ssoSessionID != "" {
+		prompts, _ := parsePrompt(prompt)
+		session, exists := p.browserSession(r, ssoSessionID)
+		if exists && authenticationReason(session, acrValues, maxAge, prompts) == "" {
+			if user, exists := p.mockIdP.GetUser(session.UserID); exists {
+				p.emitSessionReused(sessionID, session, false)
+				p.completeAuthorization(w, r, sessionID, req, user, session)
 				return
 			}
-			fragment.Set("access_token", accessToken)
-			fragment.Set("token_type", "Bearer")
-			fragment.Set("expires_in", "3600")
-		}
-		
-		// Generate ID token if requested
-		if strings.Contains(responseType, "id_token") {
-			scopes := strings.Split(scope, " ")
-			userClaims := p.mockIdP.UserClaims(user.ID, scopes)
-			idToken, err := jwtService.CreateIDToken(
-				user.ID,
-				clientID,
-				nonce,
-				time.Now(),
-				time.Hour,
-				userClaims,
-			)
-			if err != nil {
-				writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to create ID token")
-				return
-			}
-			fragment.Set("id_token", idToken)
-		}
-		
-		if state != "" {
-			fragment.Set("state", state)
 		}
-		
-		redirectURL.Fragment = fragment.Encode()
+		renderLoginError("Your session has ended. Please sign in again.")
+		return
+	}
+
+	// Validate user credentials
+	user, err := p.mockIdP.ValidateCredentials(email, password)
+	if err != nil {
+		p.oauth2Plugin.EmitLoginFailure(sessionID, email, err)
+		renderLoginError(oauth2.LoginErrorMessage(err))
+		return
 	}
 
-	// Redirect to client (safe - redirect URI validated against registered URIs)
-	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+	// Further factors are required when the requested authentication context calls for them
+	acr := mockidp.SelectACR(strings.Fields(acrValues))
+	if err := p.mockIdP.VerifyCredentials(user, acr, r.Form); err != nil {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Second Factor Failed", map[string]interface{}{
+			"user_id": user.ID,
+			"acr":     acr,
+			"error":   err.Error(),
+		})
+		renderLoginError(htmlEscape(oauth2.CredentialErrorMessage(err)))
+		return
+	}
+	session := p.mockIdP.CreateSession(user.ID, clientID, acr)
+	p.rememberBrowserSession(w, r, session)
+	p.emitEvent(sessionID, lookingglass.EventTypeSecurityInfo, "User Authenticated", map[string]interface{}{
+		"user_id":   user.ID,
+		"acr":       session.ACR,
+		"amr":       session.AMR,
+		"auth_time": session.AuthTime.Unix(),
+	}, lookingglass.Annotation{
+		Type:        lookingglass.AnnotationTypeExplanation,
+		Title:       "Authentication Context Recorded",
+		Description: "The session records when and how the user authenticated. Tokens issued from it carry auth_time, acr and amr so clients and resource servers can tell how strong and how recent the login was.",
+		Reference:   "OpenID Connect Core 1.0 Section 2",
+	})
+
+	p.completeAuthorization(w, r, sessionID, req, user, session)
+}
+
+// writeJWTAuthorizationResponse returns the authorization response as a JARM JWT
+func (p *Plugin) writeJWTAuthorizationResponse(w http.ResponseWriter, r *http.Request, sessionID, clientID, redirectURI, responseMode, responseType string, params map[string]string) {
+	client, exists := p.mockIdP.GetClient(clientID)
+	if !exists {
+		writeOIDCError(w, http.StatusBadRequest, "invalid_client", "Unknown client")
+		return
+	}
+	if err := p.oauth2Plugin.WriteJWTAuthorizationResponse(w, r, sessionID, client, redirectURI, responseMode, responseType, params); err != nil {
+		writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to sign authorization response")
+	}
 }
 
 // handleToken handles OIDC token requests
@@ -299,31 +550,52 @@ func (p *Plugin) handleToken(w http.ResponseWriter, r *http.Request) {
 		"endpoint":   "/oidc/token",
 	})
 
-	switch grantType {
-	case "authorization_code":
-		p.handleAuthorizationCodeGrant(w, r, sessionID)
-	case "refresh_token":
-		p.handleRefreshTokenGrant(w, r, sessionID)
-	default:
+	// A DPoP proof binds the issued tokens to the client's key (RFC 9449 Section 5)
+	if r.Header.Get("DPoP") != "" {
+		proof, err := p.oauth2Plugin.ValidateDPoPProof(r, sessionID, "")
+		if err != nil {
+			code, description := oauth2.ErrorInvalidDPoPProof, err.Error()
+			if dpopErr, ok := err.(*oauth2.DPoPError); ok {
+				code, description = dpopErr.Code, dpopErr.Description
+				if dpopErr.Nonce != "" {
+					w.Header().Set("DPoP-Nonce", dpopErr.Nonce)
+				}
+			}
+			writeOIDCError(w, http.StatusBadRequest, code, description)
+			return
+		}
+		r = oauth2.WithDPoPBinding(r, proof.Thumbprint)
+	}
+	// A client certificate binds them to the certificate instead (RFC 8705 Section 3)
+	r = p.oauth2Plugin.BindClientCertificate(r)
+
+	handleGrant, supported := p.grantHandlers()[grantType]
+	if !supported {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Unsupported Grant Type", map[string]interface{}{
 			"grant_type": grantType,
 		})
 		writeOIDCError(w, http.StatusBadRequest, "unsupported_grant_type", "Grant type not supported")
+		return
+	}
+	handleGrant(w, r, sessionID)
+}
+
+// grantHandlers maps each grant_type the OIDC token endpoint accepts to its handler.
+// The discovery document advertises exactly these grant types.
+func (p *Plugin) grantHandlers() map[string]func(http.ResponseWriter, *http.Request, string) {
+	return map[string]func(http.ResponseWriter, *http.Request, string){
+		"authorization_code":  p.handleAuthorizationCodeGrant,
+		"refresh_token":       p.handleRefreshTokenGrant,
+		mockidp.GrantTypeCIBA: p.handleCIBAGrant,
 	}
 }
 
 func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request, sessionID string) {
 	code := r.FormValue("code")
 	redirectURI := r.FormValue("redirect_uri")
-	clientID := r.FormValue("client_id")
-	clientSecret := r.FormValue("client_secret")
+	clientID := oauth2.RequestClientID(r)
 	codeVerifier := r.FormValue("code_verifier")
 
-	// Try to get client credentials from Authorization header
-	if clientID == "" {
-		clientID, clientSecret, _ = r.BasicAuth()
-	}
-
 	// Emit token exchange request
 	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "OIDC Token Exchange", map[string]interface{}{
 		"step":         6,
@@ -349,7 +621,7 @@ func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Req
 	}
 
 	if !client.Public {
-		if _, err := p.mockIdP.ValidateClient(clientID, clientSecret); err != nil {
+		if _, err := p.oauth2Plugin.AuthenticateClient(r, sessionID); err != nil {
 			p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Client Auth Failed", map[string]interface{}{
 				"client_id": clientID,
 			})
@@ -368,19 +640,36 @@ func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// The access token may carry a subset of the granted authorization details and resources
+	details, err := p.oauth2Plugin.TokenAuthorizationDetails(r, sessionID, clientID, authCode.AuthorizationDetails)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidAuthorizationDetails, err.Error())
+		return
+	}
+	resources, err := p.oauth2Plugin.TokenResources(r, sessionID, authCode.Resources)
+	if err == nil {
+		_, err = p.oauth2Plugin.ResourceScope(sessionID, resources, authCode.Scope)
+	}
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidTarget, err.Error())
+		return
+	}
+
 	// Generate tokens including ID token
-	tokenResponse, err := p.issueOIDCTokens(authCode)
+	tokenResponse, err := p.issueOIDCTokens(authCode, oauth2.RequestTokenBinding(r), details, resources)
 	if err != nil {
 		writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to issue tokens")
 		return
 	}
+	p.oauth2Plugin.EmitAudienceRestricted(sessionID, clientID, resources)
+	p.emitIDTokenEncrypted(sessionID, clientID, tokenResponse.IDToken)
 
 	// Emit ID token issued event
 	p.emitEvent(sessionID, lookingglass.EventTypeTokenIssued, "OIDC Tokens Issued", map[string]interface{}{
 		"step":         7,
 		"from":         "OpenID Provider",
 		"to":           "Client",
-		"token_type":   "Bearer",
+		"token_type":   tokenResponse.TokenType,
 		"has_id_token": tokenResponse.IDToken != "",
 		"scope":        tokenResponse.Scope,
 		"expires_in":   tokenResponse.ExpiresIn,
@@ -414,15 +703,9 @@ func (p *Plugin) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Req
 
 func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request, sessionID string) {
 	refreshToken := r.FormValue("refresh_token")
-	clientID := r.FormValue("client_id")
-	clientSecret := r.FormValue("client_secret")
+	clientID := oauth2.RequestClientID(r)
 	scope := r.FormValue("scope")
 
-	// Try to get client credentials from Authorization header
-	if clientID == "" {
-		clientID, clientSecret, _ = r.BasicAuth()
-	}
-
 	// Emit refresh request
 	p.emitEvent(sessionID, lookingglass.EventTypeFlowStep, "OIDC Token Refresh", map[string]interface{}{
 		"grant_type": "refresh_token",
@@ -442,7 +725,7 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 	}
 
 	if !client.Public {
-		if _, err := p.mockIdP.ValidateClient(clientID, clientSecret); err != nil {
+		if _, err := p.oauth2Plugin.AuthenticateClient(r, sessionID); err != nil {
 			writeOIDCError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
 			return
 		}
@@ -450,6 +733,11 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 
 	// Validate refresh token
 	rt, err := p.mockIdP.ValidateRefreshToken(refreshToken, clientID)
+	if reuse, ok := err.(*mockidp.RefreshTokenReuseError); ok {
+		p.oauth2Plugin.EmitRefreshTokenReuse(sessionID, reuse)
+		writeOIDCError(w, http.StatusBadRequest, "invalid_grant", "Refresh token has already been used; the token family has been revoked")
+		return
+	}
 	if err != nil {
 		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Refresh Token Invalid", map[string]interface{}{
 			"error": err.Error(),
@@ -458,32 +746,83 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// Use original scope if not specified
+	// A DPoP-bound refresh token can only be used with proof of the same key
+	jkt := oauth2.DPoPBinding(r)
+	if rt.JKT != "" && rt.JKT != jkt {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Refresh Token Key Mismatch", map[string]interface{}{
+			"bound_jkt": rt.JKT,
+			"proof_jkt": jkt,
+		})
+		writeOIDCError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is bound to a different DPoP key")
+		return
+	}
+
+	// Use original scope if not specified; a refresh may downscope but never widen the grant
 	if scope == "" {
 		scope = rt.Scope
+	} else if !oauth2.ScopeSubset(scope, rt.Scope) {
+		p.emitEvent(sessionID, lookingglass.EventTypeSecurityWarning, "Scope Escalation Rejected", map[string]interface{}{
+			"requested_scope": scope,
+			"granted_scope":   rt.Scope,
+		})
+		writeOIDCError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the scope originally granted")
+		return
+	}
+
+	details, err := p.oauth2Plugin.TokenAuthorizationDetails(r, sessionID, clientID, rt.AuthorizationDetails)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidAuthorizationDetails, err.Error())
+		return
+	}
+	resources, err := p.oauth2Plugin.TokenResources(r, sessionID, rt.Resources)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidTarget, err.Error())
+		return
+	}
+	tokenScope, err := p.oauth2Plugin.ResourceScope(sessionID, resources, scope)
+	if err != nil {
+		writeOIDCError(w, http.StatusBadRequest, mockidp.ErrorInvalidTarget, err.Error())
+		return
+	}
+
+	// Rotate only now that every check has passed, so a rejected request leaves the token usable
+	if err := p.mockIdP.RotateRefreshToken(rt); err != nil {
+		if reuse, ok := err.(*mockidp.RefreshTokenReuseError); ok {
+			p.oauth2Plugin.EmitRefreshTokenReuse(sessionID, reuse)
+			writeOIDCError(w, http.StatusBadRequest, "invalid_grant", "Refresh token has already been used; the token family has been revoked")
+			return
+		}
+		writeOIDCError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
 	}
 
 	// Generate new tokens (including new ID token if openid scope)
 	jwtService := p.mockIdP.JWTService()
 	scopes := strings.Split(scope, " ")
-	userClaims := p.mockIdP.UserClaims(rt.UserID, scopes)
+	userClaims := p.mockIdP.UserClaims(rt.UserID, scopes, nil)
+	claimsRequest, _ := mockidp.ParseClaimsRequest(rt.ClaimsRequest)
 
 	// Create access token
-	accessToken, err := jwtService.CreateAccessToken(
-		rt.UserID,
-		clientID,
-		scope,
-		time.Hour,
-		userClaims,
-	)
+	accessToken, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+		Subject:              rt.UserID,
+		ClientID:             clientID,
+		Audience:             resources,
+		Scope:                tokenScope,
+		AuthTime:             rt.AuthTime,
+		ACR:                  rt.ACR,
+		AMR:                  rt.AMR,
+		AuthorizationDetails: details,
+		UserInfoClaims:       mockidp.EncodeClaimsRequestMember(claimsRequest.UserInfo),
+		Custom:               oauth2.RequestTokenBinding(r).BoundClaims(userClaims),
+	}, time.Hour)
 	if err != nil {
 		writeOIDCError(w, http.StatusInternalServerError, "server_error", "Failed to create access token")
 		return
 	}
 
-	// Create new refresh token (rotation)
+	// Create new refresh token (rotation), naming the user as the client knows them
 	newRefreshToken, err := jwtService.CreateRefreshToken(
-		rt.UserID,
+		p.mockIdP.SubjectIdentifier(clientID, rt.UserID),
 		clientID,
 		scope,
 		7*24*time.Hour,
@@ -494,14 +833,21 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Store new refresh token
-	p.mockIdP.StoreRefreshToken(newRefreshToken, clientID, rt.UserID, scope, time.Now().Add(7*24*time.Hour))
+	p.mockIdP.StoreRefreshToken(newRefreshToken, clientID, rt.UserID, scope, p.mockIdP.AccessTokenJTI(accessToken), rt.AuthTime, time.Now().Add(7*24*time.Hour))
+	p.mockIdP.ContinueRefreshTokenFamily(newRefreshToken, rt)
+	p.oauth2Plugin.EmitRefreshTokenRotated(sessionID, rt)
+	p.oauth2Plugin.EmitAudienceRestricted(sessionID, clientID, resources)
+	if client.Public && jkt != "" {
+		p.mockIdP.BindRefreshToken(newRefreshToken, jkt)
+	}
 
 	response := models.TokenResponse{
-		AccessToken:  accessToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    3600,
-		RefreshToken: newRefreshToken,
-		Scope:        scope,
+		AccessToken:          accessToken,
+		TokenType:            oauth2.AccessTokenType(jkt),
+		ExpiresIn:            3600,
+		RefreshToken:         newRefreshToken,
+		Scope:                tokenScope,
+		AuthorizationDetails: details,
 	}
 
 	// Include new ID token if openid scope is present
@@ -515,15 +861,19 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 
 	if hasOpenID {
 		idToken, err := jwtService.CreateIDToken(
-			rt.UserID,
+			p.mockIdP.SubjectIdentifier(clientID, rt.UserID),
 			clientID,
 			"", // No nonce for refresh
-			time.Now(),
+			rt.AuthTime, // The original authentication (OIDC Core Section 12.2)
 			time.Hour,
-			userClaims,
+			authenticationClaims(p.mockIdP.IDTokenClaims(clientID, rt.UserID, scopes, claimsRequest.IDToken), mockidp.Authentication{Time: rt.AuthTime, ACR: rt.ACR, AMR: rt.AMR, SessionID: rt.SessionID}),
 		)
+		if err == nil {
+			idToken, err = p.mockIdP.EncryptIDToken(clientID, idToken)
+		}
 		if err == nil {
 			response.IDToken = idToken
+			p.emitIDTokenEncrypted(sessionID, clientID, idToken)
 		}
 	}
 
@@ -540,28 +890,38 @@ func (p *Plugin) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request,
 }
 
 // issueOIDCTokens creates access token, refresh token, and ID token
-func (p *Plugin) issueOIDCTokens(authCode *models.AuthorizationCode) (*models.TokenResponse, error) {
+func (p *Plugin) issueOIDCTokens(authCode *models.AuthorizationCode, binding oauth2.TokenBinding, details []map[string]interface{}, resources []string) (*models.TokenResponse, error) {
 	jwtService := p.mockIdP.JWTService()
 
 	// Parse scopes
 	scopes := strings.Split(authCode.Scope, " ")
-	userClaims := p.mockIdP.UserClaims(authCode.UserID, scopes)
-
-	// Create access token
-	accessToken, err := jwtService.CreateAccessToken(
-		authCode.UserID,
-		authCode.ClientID,
-		authCode.Scope,
-		time.Hour,
-		userClaims,
-	)
+	userClaims := p.mockIdP.UserClaims(authCode.UserID, scopes, nil)
+	claimsRequest, _ := mockidp.ParseClaimsRequest(authCode.ClaimsRequest)
+
+	// The access token only carries the scopes its audience accepts; the refresh token keeps the full grant
+	tokenScope := p.mockIdP.ResourceScope(resources, authCode.Scope)
+	auth := p.mockIdP.SessionAuthentication(authCode.SessionID, authCode.CreatedAt)
+
+	// Create access token, sender-constrained when a DPoP key or client certificate is presented
+	accessToken, err := p.mockIdP.IssueAccessToken(crypto.AccessTokenClaims{
+		Subject:              authCode.UserID,
+		ClientID:             authCode.ClientID,
+		Audience:             resources,
+		Scope:                tokenScope,
+		AuthTime:             auth.Time,
+		ACR:                  auth.ACR,
+		AMR:                  auth.AMR,
+		AuthorizationDetails: details,
+		UserInfoClaims:       mockidp.EncodeClaimsRequestMember(claimsRequest.UserInfo),
+		Custom:               binding.BoundClaims(userClaims),
+	}, time.Hour)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create refresh token
+	// Create refresh token, naming the user as the client knows them
 	refreshToken, err := jwtService.CreateRefreshToken(
-		authCode.UserID,
+		p.mockIdP.SubjectIdentifier(authCode.ClientID, authCode.UserID),
 		authCode.ClientID,
 		authCode.Scope,
 		7*24*time.Hour,
@@ -571,14 +931,28 @@ func (p *Plugin) issueOIDCTokens(authCode *models.AuthorizationCode) (*models.To
 	}
 
 	// Store refresh token
-	p.mockIdP.StoreRefreshToken(refreshToken, authCode.ClientID, authCode.UserID, authCode.Scope, time.Now().Add(7*24*time.Hour))
+	p.mockIdP.StoreRefreshToken(refreshToken, authCode.ClientID, authCode.UserID, authCode.Scope, p.mockIdP.AccessTokenJTI(accessToken), auth.Time, time.Now().Add(7*24*time.Hour))
+	p.mockIdP.SetRefreshTokenAuthentication(refreshToken, auth)
+	if client, exists := p.mockIdP.GetClient(authCode.ClientID); exists && client.Public && binding.JKT != "" {
+		p.mockIdP.BindRefreshToken(refreshToken, binding.JKT)
+	}
+	if len(authCode.AuthorizationDetails) > 0 {
+		p.mockIdP.SetRefreshTokenAuthorizationDetails(refreshToken, authCode.AuthorizationDetails)
+	}
+	if len(authCode.Resources) > 0 {
+		p.mockIdP.SetRefreshTokenResources(refreshToken, authCode.Resources)
+	}
+	if authCode.ClaimsRequest != "" {
+		p.mockIdP.SetRefreshTokenClaimsRequest(refreshToken, authCode.ClaimsRequest)
+	}
 
 	response := &models.TokenResponse{
-		AccessToken:  accessToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    3600,
-		RefreshToken: refreshToken,
-		Scope:        authCode.Scope,
+		AccessToken:          accessToken,
+		TokenType:            oauth2.AccessTokenType(binding.JKT),
+		ExpiresIn:            3600,
+		RefreshToken:         refreshToken,
+		Scope:                tokenScope,
+		AuthorizationDetails: details,
 	}
 
 	// Create ID token if openid scope is present
@@ -592,16 +966,20 @@ func (p *Plugin) issueOIDCTokens(authCode *models.AuthorizationCode) (*models.To
 
 	if hasOpenID {
 		idToken, err := jwtService.CreateIDToken(
-			authCode.UserID,
+			p.mockIdP.SubjectIdentifier(authCode.ClientID, authCode.UserID),
 			authCode.ClientID,
 			authCode.Nonce,
-			time.Now(),
+			auth.Time,
 			time.Hour,
-			userClaims,
+			authenticationClaims(p.mockIdP.IDTokenClaims(authCode.ClientID, authCode.UserID, scopes, claimsRequest.IDToken), auth),
 		)
 		if err != nil {
 			return nil, err
 		}
+		// Clients that registered id_token_encrypted_response_alg receive a nested JWT (OIDC Core Section 10.2)
+		if idToken, err = p.mockIdP.EncryptIDToken(authCode.ClientID, idToken); err != nil {
+			return nil, err
+		}
 		response.IDToken = idToken
 	}
 
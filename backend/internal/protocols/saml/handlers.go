@@ -24,7 +24,7 @@ func (p *Plugin) handleMetadata(w http.ResponseWriter, r *http.Request) {
 	config := &MetadataConfig{
 		EntityID:             p.entityID,
 		BaseURL:              p.baseURL,
-		Certificate:          nil, // In production, this would be a real X.509 certificate
+		Certificate:          p.certificate,
 		WantAssertionsSigned: true,
 		AuthnRequestsSigned:  false,
 		ACSURL:               p.acsURL,
@@ -432,7 +432,10 @@ func (p *Plugin) handleSPInitiatedLoginSubmit(w http.ResponseWriter, r *http.Req
 	bindingType := r.FormValue("binding_type")
 	
 	// Validate ACS URL to prevent open redirect and XSS
-	validatedACSURL, err := p.validateRedirectURL(acsURL)
+	validatedACSURL, err := p.validateRegisteredACSURL(issuer, acsURL)
+	if err != nil {
+		validatedACSURL, err = p.validateRedirectURL(acsURL)
+	}
 	if err != nil {
 		http.Error(w, "Invalid ACS URL: "+err.Error(), http.StatusBadRequest)
 		return
@@ -472,6 +475,10 @@ func (p *Plugin) handleSPInitiatedLoginSubmit(w http.ResponseWriter, r *http.Req
 		"name":                              {user.Name},
 		"uid":                               {user.ID},
 	}
+	if len(user.Groups) > 0 {
+		attributes["urn:oid:1.3.6.1.4.1.5923.1.5.1.1"] = user.Groups // isMemberOf
+		attributes["groups"] = user.Groups
+	}
 	
 	sessionIndex := GenerateID()
 	assertion := NewAssertion(
@@ -489,7 +496,18 @@ func (p *Plugin) handleSPInitiatedLoginSubmit(w http.ResponseWriter, r *http.Req
 		assertion.Subject.SubjectConfirmation.SubjectConfirmationData.Recipient = acsURL
 	}
 	
-	response.Assertions = []*Assertion{assertion}
+	// Sign the assertion (SAML 2.0 Profiles Section 4.1.3.5); the response carries the
+	// signed bytes verbatim so the signature survives serialization
+	if p.keySet == nil || p.certificate == nil {
+		http.Error(w, "SAML signing key not configured", http.StatusInternalServerError)
+		return
+	}
+	signedAssertion, err := SignAssertion(assertion, p.keySet.RSAPrivateKey(), p.certificate)
+	if err != nil {
+		http.Error(w, "Failed to sign assertion: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	message := &SignedResponse{Response: response, Assertion: string(signedAssertion)}
 	
 	// Create session
 	session := &SAMLSession{
@@ -514,8 +532,7 @@ func (p *Plugin) handleSPInitiatedLoginSubmit(w http.ResponseWriter, r *http.Req
 			broadcaster := p.lookingGlass.NewEventBroadcaster(sessionID)
 			
 			// Serialize the response for inspection
-			responseXML, _ := Marshal(response)
-			assertionXML, _ := Marshal(assertion)
+			responseXML, _ := Marshal(message)
 			
 			// Emit the full SAML Response for Looking Glass inspection
 			broadcaster.Emit(
@@ -558,7 +575,7 @@ func (p *Plugin) handleSPInitiatedLoginSubmit(w http.ResponseWriter, r *http.Req
 						"authnContextClass":   AuthnContextPasswordProtectedTransport,
 					},
 					"attributes":    attributes,
-					"assertionXML":  string(assertionXML), // Full Assertion XML
+					"assertionXML":  string(signedAssertion), // Full signed Assertion XML
 				},
 			)
 		}
@@ -573,7 +590,7 @@ func (p *Plugin) handleSPInitiatedLoginSubmit(w http.ResponseWriter, r *http.Req
 	// Send response based on binding type
 	if bindingType == "post" || bindingType == "" {
 		postBinding := NewPostBinding(privateKey)
-		html, err := postBinding.GeneratePostForm(acsURL, response, relayState, false)
+		html, err := postBinding.GeneratePostForm(acsURL, message, relayState, false)
 		if err != nil {
 			http.Error(w, "Failed to generate response: "+err.Error(), http.StatusInternalServerError)
 			return
@@ -582,7 +599,7 @@ func (p *Plugin) handleSPInitiatedLoginSubmit(w http.ResponseWriter, r *http.Req
 		w.Write([]byte(html))
 	} else {
 		redirectBinding := NewRedirectBinding(privateKey)
-		redirectURL, err := redirectBinding.BuildRedirectURL(acsURL, response, relayState, false)
+		redirectURL, err := redirectBinding.BuildRedirectURL(acsURL, message, relayState, false)
 		if err != nil {
 			http.Error(w, "Failed to build redirect: "+err.Error(), http.StatusInternalServerError)
 			return
@@ -1249,6 +1266,20 @@ func (p *Plugin) validateRedirectURL(rawURL string) (string, error) {
 	return rawURL, nil
 }
 
+// validateRegisteredACSURL accepts an ACS URL registered for a service provider whose entity ID
+// is a client_id at the Mock IdP, so dynamically registered clients can use SAML SSO with
+// their redirect_uris as Assertion Consumer Service URLs
+func (p *Plugin) validateRegisteredACSURL(entityID, acsURL string) (string, error) {
+	if !p.mockIdP.ValidateRedirectURI(entityID, acsURL) {
+		return "", fmt.Errorf("ACS URL not registered for %s", entityID)
+	}
+	parsedURL, err := url.Parse(acsURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return "", fmt.Errorf("invalid ACS URL scheme")
+	}
+	return acsURL, nil
+}
+
 // sanitizeRelayState sanitizes the RelayState value for safe use
 func sanitizeRelayState(relayState string) string {
 	// Limit length to prevent DoS
@@ -2,6 +2,8 @@ package saml
 
 import (
 	"context"
+	"crypto/x509"
+	"fmt"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/ParleSec/ProtocolSoup/internal/crypto"
@@ -15,6 +17,7 @@ type Plugin struct {
 	*plugin.BasePlugin
 	mockIdP      *mockidp.MockIdP
 	keySet       *crypto.KeySet
+	certificate  *x509.Certificate // self-signed certificate of the key that signs assertions
 	lookingGlass *lookingglass.Engine
 	baseURL      string
 	// SAML-specific configuration
@@ -80,6 +83,14 @@ func (p *Plugin) Initialize(ctx context.Context, config plugin.PluginConfig) err
 	p.metadataURL = p.baseURL + "/saml/metadata"
 	p.ssoServiceURL = p.baseURL + "/saml/sso"
 
+	if p.keySet != nil {
+		cert, err := NewSigningCertificate(p.keySet.RSAPrivateKey(), p.entityID)
+		if err != nil {
+			return fmt.Errorf("failed to create SAML signing certificate: %w", err)
+		}
+		p.certificate = cert
+	}
+
 	return nil
 }
 
@@ -527,6 +538,16 @@ func (p *Plugin) KeySet() *crypto.KeySet {
 	return p.keySet
 }
 
+// SigningCertificate returns the certificate of the key that signs assertions
+func (p *Plugin) SigningCertificate() *x509.Certificate {
+	return p.certificate
+}
+
+// VerifyAssertion verifies a serialized assertion signed by this identity provider
+func (p *Plugin) VerifyAssertion(data []byte) (*Assertion, error) {
+	return VerifyAssertion(data, p.certificate)
+}
+
 // LookingGlass returns the looking glass engine
 func (p *Plugin) LookingGlass() *lookingglass.Engine {
 	return p.lookingGlass
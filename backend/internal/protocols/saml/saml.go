@@ -318,6 +318,8 @@ type StatusDetail struct {
 type Assertion struct {
 	XMLName            xml.Name            `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
 	SAML               string              `xml:"xmlns:saml,attr,omitempty"`
+	XSI                string              `xml:"xmlns:xsi,attr,omitempty"` // declares the prefix of xsi:type attribute values
+	XS                 string              `xml:"xmlns:xs,attr,omitempty"`
 	ID                 string              `xml:"ID,attr"`
 	Version            string              `xml:"Version,attr"`
 	IssueInstant       string              `xml:"IssueInstant,attr"`
@@ -447,6 +449,8 @@ func NewAssertion(issuer, audience, nameID, nameIDFormat, sessionIndex string, a
 	
 	assertion := &Assertion{
 		SAML:         NamespaceSAML,
+		XSI:          NamespaceXSI,
+		XS:           NamespaceXS,
 		ID:           GenerateID(),
 		Version:      "2.0",
 		IssueInstant: now,
@@ -0,0 +1,121 @@
+package saml
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// NewSigningCertificate returns a self-signed certificate for the identity provider's RSA key.
+// It is published in the IdP metadata and names the key that signs assertions.
+func NewSigningCertificate(key *rsa.PrivateKey, entityID string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: entityID, Organization: []string{"ProtocolSoup"}},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing certificate: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// SignAssertion serializes an assertion with an enveloped XML signature (RSA-SHA256, exclusive
+// canonicalization). The returned bytes must be sent unchanged: re-encoding them breaks the
+// signature. Per SAML 2.0 Core Section 5.4.1 the Signature follows the Issuer element.
+func SignAssertion(assertion *Assertion, key *rsa.PrivateKey, cert *x509.Certificate) ([]byte, error) {
+	data, err := xml.Marshal(assertion)
+	if err != nil {
+		return nil, err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+
+	ctx, err := dsig.NewSigningContext(key, [][]byte{cert.Raw})
+	if err != nil {
+		return nil, err
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	signed, err := ctx.SignEnveloped(doc.Root())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign assertion: %w", err)
+	}
+
+	// SignEnveloped appends the signature; move it behind the Issuer
+	sig := signed.RemoveChildAt(len(signed.Child) - 1)
+	position := 0
+	for i, child := range signed.Child {
+		if el, ok := child.(*etree.Element); ok && el.Tag == "Issuer" {
+			position = i + 1
+			break
+		}
+	}
+	signed.InsertChildAt(position, sig)
+
+	out := etree.NewDocument()
+	out.SetRoot(signed)
+	return out.WriteToBytes()
+}
+
+// VerifyAssertion checks the enveloped signature of a serialized assertion against the trusted
+// certificate. Only the signed element is decoded, so content outside the signature's reference
+// (XML signature wrapping) never reaches the caller.
+func VerifyAssertion(data []byte, cert *x509.Certificate) (*Assertion, error) {
+	if cert == nil {
+		return nil, errors.New("no trusted signing certificate")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Assertion" || root.NamespaceURI() != NamespaceSAML {
+		return nil, errors.New("document is not a SAML assertion")
+	}
+
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+		Roots: []*x509.Certificate{cert},
+	})
+	validated, err := ctx.Validate(root)
+	if err != nil {
+		return nil, fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	out := etree.NewDocument()
+	out.SetRoot(validated)
+	signedXML, err := out.WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+	var assertion Assertion
+	if err := xml.Unmarshal(signedXML, &assertion); err != nil {
+		return nil, err
+	}
+	return &assertion, nil
+}
+
+// SignedResponse is a Response whose assertion was signed with SignAssertion. The assertion
+// is written verbatim after the status so its signature survives serialization.
+type SignedResponse struct {
+	*Response
+	Assertion string `xml:",innerxml"`
+}
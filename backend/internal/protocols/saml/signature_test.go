@@ -0,0 +1,108 @@
+package saml
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func newTestSigner(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := NewSigningCertificate(key, "https://idp.example/saml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func newTestAssertion() *Assertion {
+	return NewAssertion("https://idp.example/saml", "https://sp.example", "alice@example.com", NameIDFormatEmail, GenerateID(), map[string][]string{"uid": {"alice"}})
+}
+
+func TestSignedAssertionVerifies(t *testing.T) {
+	key, cert := newTestSigner(t)
+	signed, err := SignAssertion(newTestAssertion(), key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertion, err := VerifyAssertion(signed, cert)
+	if err != nil {
+		t.Fatalf("VerifyAssertion: %v", err)
+	}
+	if assertion.Subject.NameID.Value != "alice@example.com" {
+		t.Errorf("NameID = %q", assertion.Subject.NameID.Value)
+	}
+}
+
+func TestVerifyAssertionRejectsTampering(t *testing.T) {
+	key, cert := newTestSigner(t)
+	signed, err := SignAssertion(newTestAssertion(), key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := bytes.Replace(signed, []byte("alice@example.com"), []byte("admin@example.com"), 1)
+	if _, err := VerifyAssertion(tampered, cert); err == nil {
+		t.Error("tampered assertion verified")
+	}
+}
+
+func TestVerifyAssertionRejectsUntrustedSigner(t *testing.T) {
+	key, cert := newTestSigner(t)
+	_, trusted := newTestSigner(t)
+	signed, err := SignAssertion(newTestAssertion(), key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAssertion(signed, trusted); err == nil {
+		t.Error("assertion signed by an untrusted key verified")
+	}
+}
+
+func TestVerifyAssertionRejectsUnsigned(t *testing.T) {
+	_, cert := newTestSigner(t)
+	unsigned, err := xml.Marshal(newTestAssertion())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAssertion(unsigned, cert); err == nil {
+		t.Error("unsigned assertion verified")
+	}
+}
+
+func TestSignedResponseKeepsAssertionVerbatim(t *testing.T) {
+	key, cert := newTestSigner(t)
+	signed, err := SignAssertion(newTestAssertion(), key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := NewResponse("https://idp.example/saml", "https://sp.example/acs", "", true)
+	data, err := Marshal(&SignedResponse{Response: response, Assertion: string(signed)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "<Response") || !bytes.Contains(data, signed) {
+		t.Fatalf("signed assertion not embedded verbatim:\n%s", data)
+	}
+
+	var parsed Response
+	if err := Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Assertions) != 1 || parsed.Assertions[0].Signature == nil {
+		t.Fatal("response assertion or its signature did not parse")
+	}
+	if parsed.Status == nil || parsed.Status.StatusCode.Value != StatusSuccess {
+		t.Error("response status did not parse")
+	}
+}
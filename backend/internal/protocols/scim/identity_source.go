@@ -0,0 +1,156 @@
+package scim
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
+	"github.com/ParleSec/ProtocolSoup/pkg/models"
+)
+
+// IdentitySourceName is the Source recorded on mock IdP users provisioned over SCIM
+const IdentitySourceName = "scim"
+
+// IdentitySource lets users provisioned over SCIM sign in through the mock IdP with the
+// password set at provisioning. Their group memberships become the groups claim of ID tokens
+// and the groups attribute of SAML assertions; their SCIM roles are not released. Deactivated
+// users cannot sign in.
+type IdentitySource struct {
+	storage *Storage
+}
+
+// NewIdentitySource creates an identity source over the SCIM users in storage
+func NewIdentitySource(storage *Storage) *IdentitySource {
+	return &IdentitySource{storage: storage}
+}
+
+// Name identifies SCIM as the source of its users
+func (s *IdentitySource) Name() string {
+	return IdentitySourceName
+}
+
+// LookupUser returns the active SCIM user with the given resource ID
+func (s *IdentitySource) LookupUser(id string) (*models.User, error) {
+	ctx := context.Background()
+	user, err := s.storage.GetUser(ctx, id)
+	if err != nil {
+		return nil, sourceError(err)
+	}
+	return s.toIdPUser(ctx, user)
+}
+
+// LookupUserByLogin returns the active SCIM user whose userName or an email address is login
+func (s *IdentitySource) LookupUserByLogin(login string) (*models.User, error) {
+	ctx := context.Background()
+	user, err := s.findUser(ctx, login)
+	if err != nil {
+		return nil, sourceError(err)
+	}
+	return s.toIdPUser(ctx, user)
+}
+
+// Authenticate verifies the password provisioned for the SCIM user with the given login
+func (s *IdentitySource) Authenticate(login, password string) (*models.User, error) {
+	ctx := context.Background()
+	user, err := s.findUser(ctx, login)
+	if err != nil {
+		return nil, sourceError(err)
+	}
+	if user.Active != nil && !*user.Active {
+		return nil, errors.New("user is deactivated")
+	}
+	if err := s.storage.VerifyPassword(ctx, user.ID, password); err != nil {
+		return nil, err
+	}
+	return s.toIdPUser(ctx, user)
+}
+
+// findUser looks a user up by userName, then by email address
+func (s *IdentitySource) findUser(ctx context.Context, login string) (*User, error) {
+	user, err := s.storage.GetUserByUserName(ctx, login)
+	if errors.Is(err, ErrNotFound) && strings.Contains(login, "@") {
+		user, err = s.storage.GetUserByEmail(ctx, login)
+	}
+	return user, err
+}
+
+// toIdPUser maps a SCIM user (RFC 7643 Section 4.1) to a mock IdP user. Every provisioned user
+// gets only the user role: SCIM roles are set by whoever can provision, so they must not grant
+// roles such as admin that the mock IdP releases in tokens.
+func (s *IdentitySource) toIdPUser(ctx context.Context, user *User) (*models.User, error) {
+	if user.Active != nil && !*user.Active {
+		return nil, mockidp.ErrNotFound
+	}
+
+	idpUser := &models.User{
+		ID:     user.ID,
+		Email:  primaryEmail(user),
+		Name:   displayName(user),
+		Roles:  []string{"user"},
+		Claims: make(map[string]string),
+	}
+	if user.Meta != nil && user.Meta.Created != nil {
+		idpUser.CreatedAt = *user.Meta.Created
+	}
+
+	groups, err := s.storage.GetUserGroups(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		idpUser.Groups = append(idpUser.Groups, group.Display)
+	}
+
+	if user.Name != nil {
+		if user.Name.GivenName != "" {
+			idpUser.Claims["given_name"] = user.Name.GivenName
+		}
+		if user.Name.FamilyName != "" {
+			idpUser.Claims["family_name"] = user.Name.FamilyName
+		}
+	}
+	idpUser.Claims["preferred_username"] = user.UserName
+	if user.EnterpriseUser != nil && user.EnterpriseUser.Department != "" {
+		idpUser.Claims["department"] = user.EnterpriseUser.Department
+	}
+	return idpUser, nil
+}
+
+// primaryEmail returns the primary email address of a user, the first one if none is primary,
+// or the userName if the user has no email addresses
+func primaryEmail(user *User) string {
+	for _, email := range user.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(user.Emails) > 0 {
+		return user.Emails[0].Value
+	}
+	return user.UserName
+}
+
+// displayName returns the most specific name a user has
+func displayName(user *User) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	if user.Name != nil {
+		if user.Name.Formatted != "" {
+			return user.Name.Formatted
+		}
+		if full := strings.TrimSpace(user.Name.GivenName + " " + user.Name.FamilyName); full != "" {
+			return full
+		}
+	}
+	return user.UserName
+}
+
+// sourceError reports a missing SCIM user as the mock IdP's ErrNotFound
+func sourceError(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return mockidp.ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package scim
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestIdentitySourceIgnoresSCIMRoles(t *testing.T) {
+	storage, err := NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	_, err = storage.CreateUser(context.Background(), &User{
+		BaseResource: BaseResource{Schemas: []string{SchemaURNUser}},
+		UserName:     "mallory@example.com",
+		Password:     "Provisioned-1",
+		Roles:        []MultiValue{{Value: "admin"}, {Value: "user"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := NewIdentitySource(storage).Authenticate("mallory@example.com", "Provisioned-1")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !slices.Equal(user.Roles, []string{"user"}) {
+		t.Errorf("roles = %v, want only user", user.Roles)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/ParleSec/ProtocolSoup/internal/lookingglass"
+	"github.com/ParleSec/ProtocolSoup/internal/mockidp"
 	"github.com/ParleSec/ProtocolSoup/internal/plugin"
 	"github.com/go-chi/chi/v5"
 )
@@ -52,6 +53,16 @@ func (p *Plugin) Initialize(ctx context.Context, config plugin.PluginConfig) err
 	}
 	p.storage = storage
 
+	// Provisioned users sign in through the mock IdP, but only while provisioning requires the
+	// API token; otherwise anyone could create an account and sign in with it
+	if idp, ok := config.MockIdP.(*mockidp.MockIdP); ok {
+		if GetAuthConfig().RequireAuth {
+			idp.AddIdentitySource(NewIdentitySource(p.storage))
+		} else {
+			log.Printf("SCIM users cannot sign in: set SCIM_API_TOKEN to enable sign-in for provisioned users")
+		}
+	}
+
 	// Seed demo data
 	if err := p.storage.SeedDemoData(ctx, p.baseURL); err != nil {
 		log.Printf("Warning: failed to seed SCIM demo data: %v", err)
@@ -189,6 +200,20 @@ func (p *Plugin) GetFlowDefinitions() []plugin.FlowDefinition {
 				{Order: 6, Name: "Member Removed", Description: "200 OK with updated group", From: "SCIM Server", To: "IdP", Type: "response"},
 			},
 		},
+		{
+			ID:          "provision-then-sso",
+			Name:        "Provision then SSO",
+			Description: "Provision a user and group over SCIM, then sign in as that user through OIDC or SAML",
+			Executable:  false, // Reference only: sign-in happens at the OIDC or SAML login page
+			Category:    "provisioning",
+			Steps: []plugin.FlowStep{
+				{Order: 1, Name: "Create User", Description: "POST /Users with a password - The user becomes a principal of the mock IdP", From: "IdP", To: "SCIM Server", Type: "request", Parameters: map[string]string{"method": "POST", "endpoint": "/Users"}},
+				{Order: 2, Name: "Create Group", Description: "POST /Groups with the user as a member", From: "IdP", To: "SCIM Server", Type: "request", Parameters: map[string]string{"method": "POST", "endpoint": "/Groups"}},
+				{Order: 3, Name: "Sign In", Description: "Log in with the provisioned userName or email and password", From: "User", To: "Mock IdP", Type: "request", Parameters: map[string]string{"scope": "openid profile email groups"}},
+				{Order: 4, Name: "Groups Released", Description: "ID token groups claim and SAML groups attribute list the SCIM group", From: "Mock IdP", To: "Relying Party", Type: "response"},
+				{Order: 5, Name: "Deactivate User", Description: "PATCH /Users/{id} active=false - Further sign-ins are refused", From: "IdP", To: "SCIM Server", Type: "request", Parameters: map[string]string{"method": "PATCH", "path": "active", "value": "false"}},
+			},
+		},
 		{
 			ID:          "user-discovery",
 			Name:        "User Discovery with Filters",
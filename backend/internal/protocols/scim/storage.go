@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 	_ "modernc.org/sqlite" // Pure Go SQLite driver
 )
 
@@ -19,6 +20,8 @@ var (
 	ErrNotFound      = errors.New("resource not found")
 	ErrConflict      = errors.New("resource already exists")
 	ErrVersionConflict = errors.New("version conflict")
+	ErrNoPassword    = errors.New("no password provisioned")
+	ErrInvalidPassword = errors.New("invalid password")
 )
 
 // Storage handles SQLite persistence for SCIM resources
@@ -102,6 +105,14 @@ func (s *Storage) migrate() error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_members_user_id ON scim_group_members(user_id)`,
 
+		// Password hashes of provisioned users, who sign in through the mock IdP
+		`CREATE TABLE IF NOT EXISTS scim_user_credentials (
+			user_id TEXT PRIMARY KEY,
+			password_hash TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES scim_users(id) ON DELETE CASCADE
+		)`,
+
 		// Sync state for SCIM client
 		`CREATE TABLE IF NOT EXISTS scim_sync_state (
 			target_url TEXT PRIMARY KEY,
@@ -171,6 +182,10 @@ func (s *Storage) CreateUser(ctx context.Context, user *User) (*User, error) {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	if err := s.storePassword(ctx, user.ID, user.Password); err != nil {
+		return nil, err
+	}
+
 	return &userCopy, nil
 }
 
@@ -290,6 +305,10 @@ func (s *Storage) UpdateUser(ctx context.Context, id string, user *User, expecte
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
 
+	if err := s.storePassword(ctx, id, user.Password); err != nil {
+		return nil, err
+	}
+
 	return &userCopy, nil
 }
 
@@ -379,6 +398,84 @@ func (s *Storage) ListUsers(ctx context.Context, filter string, startIndex, coun
 	return users, totalCount, nil
 }
 
+// GetUserByEmail retrieves a user by one of their email addresses
+func (s *Storage) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data string
+	var version int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT u.data, u.version FROM scim_users u, json_each(u.data, '$.emails') e
+		 WHERE json_extract(e.value, '$.value') = ? COLLATE NOCASE
+		 ORDER BY json_extract(e.value, '$.primary') DESC LIMIT 1`, email).Scan(&data, &version)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var user User
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+
+	if user.Meta != nil {
+		user.Meta.Version = GenerateETag(version)
+	}
+
+	return &user, nil
+}
+
+// ================== Credential Operations ==================
+
+// storePassword hashes and saves a user's password; an empty password leaves the current one.
+// The caller must hold the write lock.
+func (s *Storage) storePassword(ctx context.Context, userID, password string) error {
+	if password == "" {
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO scim_user_credentials (user_id, password_hash, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(user_id) DO UPDATE SET password_hash = excluded.password_hash, updated_at = excluded.updated_at`,
+		userID, string(hash), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to store password: %w", err)
+	}
+	return nil
+}
+
+// VerifyPassword checks a password against the hash stored for a user. Users provisioned
+// without a password cannot sign in.
+func (s *Storage) VerifyPassword(ctx context.Context, userID, password string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hash string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT password_hash FROM scim_user_credentials WHERE user_id = ?`, userID).Scan(&hash)
+
+	if err == sql.ErrNoRows {
+		return ErrNoPassword
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get password: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
 // ================== Group Operations ==================
 
 // CreateGroup creates a new group
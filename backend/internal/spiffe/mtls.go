@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 )
@@ -25,6 +26,10 @@ type MTLSConfig struct {
 
 	// TrustDomain for authorization
 	TrustDomain spiffeid.TrustDomain
+
+	// ClientCAs are trusted for client certificates in addition to the trust domain's bundle
+	// when RequireClientCert is false, e.g. the CA of OAuth mutual TLS clients
+	ClientCAs []*x509.Certificate
 }
 
 // MTLSServer wraps an HTTP server with SPIFFE mTLS
@@ -80,6 +85,20 @@ func (s *MTLSServer) ListenAndServeTLS(ctx context.Context) error {
 
 	// Create TLS config using SPIFFE
 	tlsConfig := tlsconfig.MTLSServerConfig(x509Source, x509Source, authorizer)
+	if !s.config.RequireClientCert {
+		// Client certificates are optional, but one that is presented must chain to the trust
+		// bundle or a configured client CA; the handler then decides which client it identifies.
+		// The pool is rebuilt for every handshake so a rotated bundle takes effect.
+		base := tlsconfig.TLSServerConfig(x509Source)
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+		base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := base.Clone()
+			config.GetConfigForClient = nil
+			config.ClientCAs = s.clientCAs(x509Source)
+			return config, nil
+		}
+		tlsConfig = base
+	}
 
 	// Create listener
 	listener, err := tls.Listen("tcp", s.httpServer.Addr, tlsConfig)
@@ -97,6 +116,20 @@ func (s *MTLSServer) ListenAndServeTLS(ctx context.Context) error {
 	return s.httpServer.Serve(listener)
 }
 
+// clientCAs returns the trust domain's current X.509 authorities and the configured client CAs
+func (s *MTLSServer) clientCAs(source x509bundle.Source) *x509.CertPool {
+	pool := x509.NewCertPool()
+	if bundle, err := source.GetX509BundleForTrustDomain(s.config.TrustDomain); err == nil {
+		for _, authority := range bundle.X509Authorities() {
+			pool.AddCert(authority)
+		}
+	}
+	for _, ca := range s.config.ClientCAs {
+		pool.AddCert(ca)
+	}
+	return pool
+}
+
 // Shutdown gracefully shuts down the server
 func (s *MTLSServer) Shutdown(ctx context.Context) error {
 	return s.httpServer.Shutdown(ctx)
@@ -0,0 +1,63 @@
+package spiffe
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+
+	"github.com/ParleSec/ProtocolSoup/internal/crypto"
+)
+
+func issueTestClientCertificate(t *testing.T, ca *crypto.TestCA) *x509.Certificate {
+	t.Helper()
+	certPEM, _, err := ca.IssueClientCertificate(pkix.Name{CommonName: "client"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestClientCAsTrustBundleAndConfiguredCAs(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	bundleCA, err := crypto.NewTestCA("Bundle CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCA, err := crypto.NewTestCA("Client CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrustedCA, err := crypto.NewTestCA("Untrusted CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &MTLSServer{config: &MTLSConfig{TrustDomain: td, ClientCAs: []*x509.Certificate{clientCA.Certificate()}}}
+	pool := server.clientCAs(x509bundle.FromX509Authorities(td, []*x509.Certificate{bundleCA.Certificate()}))
+
+	verify := func(ca *crypto.TestCA) error {
+		_, err := issueTestClientCertificate(t, ca).Verify(x509.VerifyOptions{
+			Roots:     pool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		return err
+	}
+	if err := verify(bundleCA); err != nil {
+		t.Errorf("trust bundle certificate rejected: %v", err)
+	}
+	if err := verify(clientCA); err != nil {
+		t.Errorf("client CA certificate rejected: %v", err)
+	}
+	if err := verify(untrustedCA); err == nil {
+		t.Error("certificate from an untrusted CA accepted")
+	}
+}
@@ -337,6 +337,22 @@ func (c *WorkloadClient) ValidateJWTSVID(ctx context.Context, token string, expe
 	return svid, nil
 }
 
+// VerifyClientCertificate verifies that a certificate chain presented over mutual TLS is an
+// X509-SVID issued by the trust bundle, so a workload can use its SVID as an OAuth client certificate
+func (c *WorkloadClient) VerifyClientCertificate(chain []*x509.Certificate) error {
+	c.mu.RLock()
+	bundleSource := c.bundleSet
+	c.mu.RUnlock()
+
+	if bundleSource == nil {
+		return errors.New("BundleSource not initialized")
+	}
+	if _, _, err := x509svid.Verify(chain, bundleSource); err != nil {
+		return fmt.Errorf("X509-SVID verification failed: %w", err)
+	}
+	return nil
+}
+
 // GetTrustBundle returns the X.509 trust bundle for the trust domain
 func (c *WorkloadClient) GetTrustBundle() ([]*x509.Certificate, error) {
 	c.mu.RLock()
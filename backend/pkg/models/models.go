@@ -9,8 +9,11 @@ type User struct {
 	Name      string            `json:"name"`
 	Password  string            `json:"-"` // Never serialized
 	Roles     []string          `json:"roles"`
+	Groups    []string          `json:"groups,omitempty"`
 	Claims    map[string]string `json:"claims,omitempty"`
 	CreatedAt time.Time         `json:"created_at"`
+	// Source names the identity source of a user managed outside the IdP, such as "scim"
+	Source string `json:"source,omitempty"`
 }
 
 // Client represents an OAuth client application
@@ -22,7 +25,130 @@ type Client struct {
 	GrantTypes   []string `json:"grant_types"`
 	Scopes       []string `json:"scopes"`
 	Public       bool     `json:"public"` // Public clients (no secret)
-	CreatedAt    time.Time `json:"created_at"`
+	// ApplicationType is web or native; native apps get loopback redirect port matching and mandatory PKCE (RFC 8252)
+	ApplicationType string `json:"application_type,omitempty"`
+	// RequirePushedAuthorizationRequests rejects authorization requests not made via PAR (RFC 9126)
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+	// TokenEndpointAuthMethod is the registered client authentication method; empty accepts any secret-based method
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty"`
+	// JWKS or JWKSURI hold the public keys used to verify private_key_jwt assertions (RFC 7523)
+	JWKS          map[string]interface{} `json:"jwks,omitempty"`
+	JWKSURI       string                 `json:"jwks_uri,omitempty"`
+	ResponseTypes []string               `json:"response_types,omitempty"`
+	// AccessTokenFormat selects JWT (RFC 9068) or opaque reference access tokens; empty means JWT.
+	// Pairwise clients always get opaque tokens.
+	AccessTokenFormat string `json:"access_token_format,omitempty"`
+	// AuthorizationDetailsTypes lists the authorization_details types the client may request (RFC 9396 Section 10)
+	AuthorizationDetailsTypes []string `json:"authorization_details_types,omitempty"`
+	// BackchannelTokenDeliveryMode is poll, ping or push for clients using CIBA (OpenID CIBA Core 1.0 Section 4)
+	BackchannelTokenDeliveryMode          string `json:"backchannel_token_delivery_mode,omitempty"`
+	BackchannelClientNotificationEndpoint string `json:"backchannel_client_notification_endpoint,omitempty"`
+	// TLSClientAuth* identify the certificate of a tls_client_auth client; exactly one is set (RFC 8705 Section 2.1.2)
+	TLSClientAuthSubjectDN string `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientAuthSANDNS    string `json:"tls_client_auth_san_dns,omitempty"`
+	TLSClientAuthSANURI    string `json:"tls_client_auth_san_uri,omitempty"`
+	// TLSClientCertificateBoundAccessTokens binds the client's access tokens to its mTLS certificate (RFC 8705 Section 3.4)
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	// RequestURIs are the URLs the client may pass by reference as a request object's request_uri (OIDC Dynamic Client Registration Section 2)
+	RequestURIs []string `json:"request_uris,omitempty"`
+	// RequestObjectSigningAlg pins the request object signing algorithm; RequireSignedRequestObject rejects plain requests (RFC 9101 Section 10.5)
+	RequestObjectSigningAlg    string `json:"request_object_signing_alg,omitempty"`
+	RequireSignedRequestObject bool   `json:"require_signed_request_object,omitempty"`
+	// AuthorizationSignedResponseAlg signs JWT authorization responses (JARM Section 3); empty means RS256
+	AuthorizationSignedResponseAlg string `json:"authorization_signed_response_alg,omitempty"`
+	// PostLogoutRedirectURIs are where the client may send the user after RP-Initiated Logout
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+	// FrontchannelLogoutURI is loaded in an iframe and BackchannelLogoutURI receives a logout token when
+	// the user's session ends; *SessionRequired asks for the iss and sid of the session (OIDC Front-Channel
+	// and Back-Channel Logout 1.0)
+	FrontchannelLogoutURI             string `json:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool   `json:"frontchannel_logout_session_required,omitempty"`
+	BackchannelLogoutURI              string `json:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired  bool   `json:"backchannel_logout_session_required,omitempty"`
+	// SubjectType is public or pairwise; pairwise clients see a sub calculated for their sector, the host
+	// of SectorIdentifierURI or of their redirect URIs (OIDC Core Section 8)
+	SubjectType         string `json:"subject_type,omitempty"`
+	SectorIdentifierURI string `json:"sector_identifier_uri,omitempty"`
+	// IDTokenEncrypted* encrypt ID tokens to the client's JWKS; UserInfoSignedResponseAlg and
+	// UserInfoEncrypted* return UserInfo as a signed and/or encrypted JWT (OIDC Core Section 10)
+	IDTokenEncryptedResponseAlg  string `json:"id_token_encrypted_response_alg,omitempty"`
+	IDTokenEncryptedResponseEnc  string `json:"id_token_encrypted_response_enc,omitempty"`
+	UserInfoSignedResponseAlg    string `json:"userinfo_signed_response_alg,omitempty"`
+	UserInfoEncryptedResponseAlg string `json:"userinfo_encrypted_response_alg,omitempty"`
+	UserInfoEncryptedResponseEnc string `json:"userinfo_encrypted_response_enc,omitempty"`
+	// Disabled clients are rejected at every endpoint until re-enabled through the admin API
+	Disabled bool `json:"disabled,omitempty"`
+	// Registration holds the metadata of a dynamically registered client (RFC 7591); nil for built-in clients
+	Registration            *ClientMetadata `json:"-"`
+	RegistrationAccessToken string          `json:"-"`
+	CreatedAt               time.Time       `json:"created_at"`
+}
+
+// ClientMetadata is the client metadata accepted by the registration endpoint (RFC 7591 Section 2)
+type ClientMetadata struct {
+	RedirectURIs            []string               `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string                 `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string               `json:"grant_types,omitempty"`
+	ResponseTypes           []string               `json:"response_types,omitempty"`
+	ClientName              string                 `json:"client_name,omitempty"`
+	ClientURI               string                 `json:"client_uri,omitempty"`
+	LogoURI                 string                 `json:"logo_uri,omitempty"`
+	Scope                   string                 `json:"scope,omitempty"`
+	Contacts                []string               `json:"contacts,omitempty"`
+	TosURI                  string                 `json:"tos_uri,omitempty"`
+	PolicyURI               string                 `json:"policy_uri,omitempty"`
+	JWKSURI                 string                 `json:"jwks_uri,omitempty"`
+	JWKS                    map[string]interface{} `json:"jwks,omitempty"`
+	SoftwareID              string                 `json:"software_id,omitempty"`
+	SoftwareVersion         string                 `json:"software_version,omitempty"`
+	SoftwareStatement       string                 `json:"software_statement,omitempty"`
+	// ApplicationType is web or native (OIDC Dynamic Client Registration Section 2)
+	ApplicationType                    string `json:"application_type,omitempty"`
+	RequirePushedAuthorizationRequests bool   `json:"require_pushed_authorization_requests,omitempty"`
+	// AccessTokenFormat is a non-standard extension selecting jwt or opaque access tokens
+	AccessTokenFormat         string   `json:"access_token_format,omitempty"`
+	AuthorizationDetailsTypes []string `json:"authorization_details_types,omitempty"`
+	// BackchannelTokenDeliveryMode and BackchannelClientNotificationEndpoint register a CIBA client (OpenID CIBA Core 1.0 Section 4)
+	BackchannelTokenDeliveryMode          string `json:"backchannel_token_delivery_mode,omitempty"`
+	BackchannelClientNotificationEndpoint string `json:"backchannel_client_notification_endpoint,omitempty"`
+	// TLSClientAuth* and TLSClientCertificateBoundAccessTokens register a mutual TLS client (RFC 8705 Section 2.1.2, 3.4)
+	TLSClientAuthSubjectDN                string `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientAuthSANDNS                   string `json:"tls_client_auth_san_dns,omitempty"`
+	TLSClientAuthSANURI                   string `json:"tls_client_auth_san_uri,omitempty"`
+	TLSClientCertificateBoundAccessTokens bool   `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	// RequestURIs, RequestObjectSigningAlg and RequireSignedRequestObject register a JAR client (RFC 9101 Section 10.5)
+	RequestURIs                []string `json:"request_uris,omitempty"`
+	RequestObjectSigningAlg    string   `json:"request_object_signing_alg,omitempty"`
+	RequireSignedRequestObject bool     `json:"require_signed_request_object,omitempty"`
+	// AuthorizationSignedResponseAlg is the JWS algorithm of JWT authorization responses (JARM Section 3)
+	AuthorizationSignedResponseAlg string `json:"authorization_signed_response_alg,omitempty"`
+	// PostLogoutRedirectURIs and the *Logout* parameters register a client for logout
+	// (OIDC RP-Initiated Logout 1.0 Section 3.1, Front-Channel Logout 1.0 Section 2.2, Back-Channel Logout 1.0 Section 2.2)
+	PostLogoutRedirectURIs            []string `json:"post_logout_redirect_uris,omitempty"`
+	FrontchannelLogoutURI             string   `json:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool     `json:"frontchannel_logout_session_required,omitempty"`
+	BackchannelLogoutURI              string   `json:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired  bool     `json:"backchannel_logout_session_required,omitempty"`
+	// SubjectType and SectorIdentifierURI select pairwise subject identifiers (OIDC Dynamic Client Registration Section 2)
+	SubjectType         string `json:"subject_type,omitempty"`
+	SectorIdentifierURI string `json:"sector_identifier_uri,omitempty"`
+	// The ID token and UserInfo response algorithms (OIDC Dynamic Client Registration Section 2)
+	IDTokenEncryptedResponseAlg  string `json:"id_token_encrypted_response_alg,omitempty"`
+	IDTokenEncryptedResponseEnc  string `json:"id_token_encrypted_response_enc,omitempty"`
+	UserInfoSignedResponseAlg    string `json:"userinfo_signed_response_alg,omitempty"`
+	UserInfoEncryptedResponseAlg string `json:"userinfo_encrypted_response_alg,omitempty"`
+	UserInfoEncryptedResponseEnc string `json:"userinfo_encrypted_response_enc,omitempty"`
+}
+
+// ClientInformationResponse is returned by the registration and management endpoints (RFC 7591 Section 3.2.1, RFC 7592 Section 3)
+type ClientInformationResponse struct {
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+	ClientMetadata
 }
 
 // AuthorizationCode represents an OAuth authorization code
@@ -38,16 +164,28 @@ type AuthorizationCode struct {
 	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
 	ExpiresAt           time.Time `json:"expires_at"`
 	CreatedAt           time.Time `json:"created_at"`
+
+	// AuthorizationDetails holds the fine-grained permissions the user consented to (RFC 9396)
+	AuthorizationDetails []map[string]interface{} `json:"authorization_details,omitempty"`
+	// Resources are the resource indicators the grant is restricted to (RFC 8707)
+	Resources []string `json:"resources,omitempty"`
+	// SessionID is the session in which the user authenticated, which supplies auth_time, acr and amr
+	SessionID string `json:"session_id,omitempty"`
+	// ClaimsRequest is the claims request parameter of the authorization request (OIDC Core Section 5.5)
+	ClaimsRequest string `json:"claims_request,omitempty"`
 }
 
 // TokenResponse represents an OAuth token response
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int    `json:"expires_in"`
-	RefreshToken string `json:"refresh_token,omitempty"`
-	IDToken      string `json:"id_token,omitempty"` // For OIDC
-	Scope        string `json:"scope,omitempty"`
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"` // For token exchange (RFC 8693)
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	IDToken         string `json:"id_token,omitempty"` // For OIDC
+	Scope           string `json:"scope,omitempty"`
+	// AuthorizationDetails echoes the granted authorization details (RFC 9396 Section 7)
+	AuthorizationDetails []map[string]interface{} `json:"authorization_details,omitempty"`
 }
 
 // Session represents an authentication session
@@ -57,32 +195,160 @@ type Session struct {
 	ClientID  string    `json:"client_id"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// AuthTime is when the user last authenticated in this session
+	AuthTime time.Time `json:"auth_time"`
+	// ACR and AMR record the assurance level and methods of that authentication (OIDC Core Section 2, RFC 8176)
+	ACR string   `json:"acr"`
+	AMR []string `json:"amr"`
+
+	// Clients lists the clients the user signed in to with this session, in order
+	Clients []string `json:"clients,omitempty"`
+	// Consents maps each client to the scopes the user approved for it during this session
+	Consents map[string][]string `json:"consents,omitempty"`
 }
 
 // RefreshToken represents a refresh token
 type RefreshToken struct {
-	Token     string    `json:"token"`
-	ClientID  string    `json:"client_id"`
-	UserID    string    `json:"user_id"`
-	Scope     string    `json:"scope"`
+	Token    string `json:"token"`
+	ClientID string `json:"client_id"`
+	UserID   string `json:"user_id"`
+	Scope    string `json:"scope"`
+	JKT      string `json:"jkt,omitempty"` // DPoP key thumbprint the token is bound to
+	// FamilyID is shared by every token rotated from the same original grant
+	FamilyID   string `json:"family_id"`
+	Generation int    `json:"generation"`
+	// AccessTokenJTI identifies the access token issued alongside this refresh token
+	AccessTokenJTI string `json:"access_token_jti,omitempty"`
+	// AuthTime is when the user authenticated for the original grant
+	AuthTime time.Time `json:"auth_time,omitempty"`
+	// ACR and AMR describe that authentication, so refreshed tokens keep the original assurance level
+	ACR string   `json:"acr,omitempty"`
+	AMR []string `json:"amr,omitempty"`
+	// SessionID is the session the grant was made in; the token is revoked when that session is logged out
+	SessionID string `json:"session_id,omitempty"`
+	// ClaimsRequest is the claims request parameter of the grant, applied to refreshed tokens
+	ClaimsRequest string `json:"claims_request,omitempty"`
+	// AuthorizationDetails is the RAR grant that refreshed access tokens may draw on
+	AuthorizationDetails []map[string]interface{} `json:"authorization_details,omitempty"`
+	// Resources are the resource indicators refreshed access tokens may be issued for (RFC 8707)
+	Resources []string  `json:"resources,omitempty"`
+	RotatedAt time.Time `json:"rotated_at,omitempty"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// ProtectedResource is an API that access tokens can be audience-restricted to (RFC 8707)
+type ProtectedResource struct {
+	URI         string   `json:"uri"` // resource indicator, used as the token audience
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Scopes      []string `json:"scopes"` // scopes the resource accepts
+}
+
+// ReferenceToken is an opaque access token whose claims are held by the authorization server
+// and disclosed only through introspection (RFC 7662)
+type ReferenceToken struct {
+	Token     string                 `json:"token"`
+	ClientID  string                 `json:"client_id"`
+	Claims    map[string]interface{} `json:"claims"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// Device authorization status values (RFC 8628)
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+// DeviceAuthorization represents a pending device authorization grant (RFC 8628)
+type DeviceAuthorization struct {
+	DeviceCode   string    `json:"device_code"`
+	UserCode     string    `json:"user_code"`
+	ClientID     string    `json:"client_id"`
+	Scope        string    `json:"scope"`
+	UserID       string    `json:"user_id,omitempty"`
+	Status       string    `json:"status"`
+	Interval     int       `json:"interval"` // Minimum polling interval in seconds
+	LastPolledAt time.Time `json:"last_polled_at,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// DeviceAuthorizationResponse represents the device authorization endpoint response
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// BackchannelAuthentication represents a CIBA authentication request (OpenID CIBA Core 1.0 Section 7)
+type BackchannelAuthentication struct {
+	AuthReqID      string `json:"auth_req_id"`
+	ClientID       string `json:"client_id"`
+	UserID         string `json:"user_id"`
+	Scope          string `json:"scope"`
+	BindingMessage string `json:"binding_message,omitempty"`
+	DeliveryMode   string `json:"delivery_mode"`
+	// ClientNotificationToken authenticates ping and push callbacks to the client
+	ClientNotificationToken string    `json:"-"`
+	Status                  string    `json:"status"`   // DeviceStatusPending, DeviceStatusApproved or DeviceStatusDenied
+	Interval                int       `json:"interval"` // Minimum polling interval in seconds; zero outside poll mode
+	LastPolledAt            time.Time `json:"last_polled_at,omitempty"`
+	AuthTime                time.Time `json:"auth_time,omitempty"`
+	ExpiresAt               time.Time `json:"expires_at"`
+	CreatedAt               time.Time `json:"created_at"`
+	// LookingGlassSession is the session of the originating request, so transitions driven by the
+	// authentication device are reported to the flow that started them
+	LookingGlassSession string `json:"-"`
+}
+
+// BackchannelAuthenticationResponse represents the backchannel authentication endpoint response (OpenID CIBA Core 1.0 Section 7.3)
+type BackchannelAuthenticationResponse struct {
+	AuthReqID string `json:"auth_req_id"`
+	ExpiresIn int    `json:"expires_in"`
+	Interval  int    `json:"interval,omitempty"`
+}
+
+// PushedAuthorizationRequest represents an authorization request pushed to the PAR endpoint
+type PushedAuthorizationRequest struct {
+	RequestURI string            `json:"request_uri"`
+	ClientID   string            `json:"client_id"`
+	Parameters map[string]string `json:"parameters"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// PushedAuthorizationResponse represents the PAR endpoint response (RFC 9126 Section 2.2)
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
 // IntrospectionResponse represents token introspection response
 type IntrospectionResponse struct {
-	Active    bool   `json:"active"`
-	Scope     string `json:"scope,omitempty"`
-	ClientID  string `json:"client_id,omitempty"`
-	Username  string `json:"username,omitempty"`
-	TokenType string `json:"token_type,omitempty"`
-	Exp       int64  `json:"exp,omitempty"`
-	Iat       int64  `json:"iat,omitempty"`
-	Nbf       int64  `json:"nbf,omitempty"`
-	Sub       string `json:"sub,omitempty"`
-	Aud       string `json:"aud,omitempty"`
-	Iss       string `json:"iss,omitempty"`
-	Jti       string `json:"jti,omitempty"`
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	Exp       int64       `json:"exp,omitempty"`
+	Iat       int64       `json:"iat,omitempty"`
+	Nbf       int64       `json:"nbf,omitempty"`
+	Sub       string      `json:"sub,omitempty"`
+	Aud       interface{} `json:"aud,omitempty"` // string or array of strings
+	Iss       string      `json:"iss,omitempty"`
+	Jti       string      `json:"jti,omitempty"`
+	// Cnf carries the confirmation method for sender-constrained tokens (RFC 9449 Section 6.2, RFC 8705 Section 3.2)
+	Cnf map[string]interface{} `json:"cnf,omitempty"`
+	// AuthorizationDetails carries the token's fine-grained permissions (RFC 9396 Section 9.2)
+	AuthorizationDetails []map[string]interface{} `json:"authorization_details,omitempty"`
 }
 
 // OIDCClaims represents standard OIDC claims
@@ -109,24 +375,68 @@ type OIDCClaims struct {
 	Roles []string `json:"roles,omitempty"`
 }
 
-// DiscoveryDocument represents OIDC discovery document
-type DiscoveryDocument struct {
-	Issuer                           string   `json:"issuer"`
-	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
-	TokenEndpoint                    string   `json:"token_endpoint"`
-	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
-	JwksURI                          string   `json:"jwks_uri"`
-	RegistrationEndpoint             string   `json:"registration_endpoint,omitempty"`
-	RevocationEndpoint               string   `json:"revocation_endpoint,omitempty"`
-	IntrospectionEndpoint            string   `json:"introspection_endpoint,omitempty"`
-	ScopesSupported                  []string `json:"scopes_supported"`
-	ResponseTypesSupported           []string `json:"response_types_supported"`
-	ResponseModesSupported           []string `json:"response_modes_supported,omitempty"`
-	GrantTypesSupported              []string `json:"grant_types_supported"`
-	SubjectTypesSupported            []string `json:"subject_types_supported"`
-	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
-	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
-	ClaimsSupported                  []string `json:"claims_supported,omitempty"`
-	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported,omitempty"`
+// AuthorizationServerMetadata represents OAuth 2.0 authorization server metadata (RFC 8414 Section 2)
+type AuthorizationServerMetadata struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                              string   `json:"token_endpoint,omitempty"`
+	JwksURI                                    string   `json:"jwks_uri,omitempty"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint,omitempty"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint,omitempty"`
+	PushedAuthorizationRequestEndpoint         string   `json:"pushed_authorization_request_endpoint,omitempty"`
+	ScopesSupported                            []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	ResponseModesSupported                     []string `json:"response_modes_supported,omitempty"`
+	GrantTypesSupported                        []string `json:"grant_types_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpointAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported,omitempty"`
+	RequirePushedAuthorizationRequests         bool     `json:"require_pushed_authorization_requests,omitempty"`
+	DPoPSigningAlgValuesSupported              []string `json:"dpop_signing_alg_values_supported,omitempty"`
+	AuthorizationDetailsTypesSupported         []string `json:"authorization_details_types_supported,omitempty"`
+	TLSClientCertificateBoundAccessTokens      bool     `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	// MTLSEndpointAliases lists the endpoints that accept mutual TLS, which are served on a separate listener (RFC 8705 Section 5)
+	MTLSEndpointAliases map[string]string `json:"mtls_endpoint_aliases,omitempty"`
+	// Request objects (RFC 9101 Section 10.1, OpenID Connect Discovery 1.0 Section 3)
+	RequestParameterSupported                 bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported              bool     `json:"request_uri_parameter_supported"`
+	RequireRequestURIRegistration             bool     `json:"require_request_uri_registration,omitempty"`
+	RequestObjectSigningAlgValuesSupported    []string `json:"request_object_signing_alg_values_supported,omitempty"`
+	RequestObjectEncryptionAlgValuesSupported []string `json:"request_object_encryption_alg_values_supported,omitempty"`
+	RequestObjectEncryptionEncValuesSupported []string `json:"request_object_encryption_enc_values_supported,omitempty"`
+	// AuthorizationSigningAlgValuesSupported lists the algorithms of JWT authorization responses (JARM Section 4)
+	AuthorizationSigningAlgValuesSupported []string `json:"authorization_signing_alg_values_supported,omitempty"`
+	// SignedMetadata is a JWT asserting the other metadata values, signed by the issuer (RFC 8414 Section 2.1)
+	SignedMetadata string `json:"signed_metadata,omitempty"`
 }
 
+// DiscoveryDocument represents OIDC discovery document. It extends the OAuth 2.0
+// authorization server metadata with OpenID Provider values (OpenID Connect Discovery 1.0 Section 3).
+type DiscoveryDocument struct {
+	AuthorizationServerMetadata
+	UserinfoEndpoint                       string   `json:"userinfo_endpoint"`
+	SubjectTypesSupported                  []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported       []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                        []string `json:"claims_supported,omitempty"`
+	BackchannelAuthenticationEndpoint      string   `json:"backchannel_authentication_endpoint,omitempty"`
+	BackchannelTokenDeliveryModesSupported []string `json:"backchannel_token_delivery_modes_supported,omitempty"`
+	BackchannelUserCodeParameterSupported  bool     `json:"backchannel_user_code_parameter_supported,omitempty"`
+	ACRValuesSupported                     []string `json:"acr_values_supported,omitempty"`
+	ClaimsParameterSupported               bool     `json:"claims_parameter_supported"`
+	PromptValuesSupported                  []string `json:"prompt_values_supported,omitempty"`
+	EndSessionEndpoint                     string   `json:"end_session_endpoint,omitempty"`
+	FrontchannelLogoutSupported            bool     `json:"frontchannel_logout_supported,omitempty"`
+	FrontchannelLogoutSessionSupported     bool     `json:"frontchannel_logout_session_supported,omitempty"`
+	BackchannelLogoutSupported             bool     `json:"backchannel_logout_supported,omitempty"`
+	BackchannelLogoutSessionSupported      bool     `json:"backchannel_logout_session_supported,omitempty"`
+	// ID token and UserInfo response signing and encryption (OpenID Connect Discovery 1.0 Section 3)
+	IDTokenEncryptionAlgValuesSupported  []string `json:"id_token_encryption_alg_values_supported,omitempty"`
+	IDTokenEncryptionEncValuesSupported  []string `json:"id_token_encryption_enc_values_supported,omitempty"`
+	UserInfoSigningAlgValuesSupported    []string `json:"userinfo_signing_alg_values_supported,omitempty"`
+	UserInfoEncryptionAlgValuesSupported []string `json:"userinfo_encryption_alg_values_supported,omitempty"`
+	UserInfoEncryptionEncValuesSupported []string `json:"userinfo_encryption_enc_values_supported,omitempty"`
+}